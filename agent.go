@@ -7,10 +7,16 @@
 package gossh
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
+	"encoding/pem"
 	"fmt"
+	"math"
+	"strings"
 	"syscall/js"
 
 	"golang.org/x/crypto/ssh"
@@ -38,17 +44,32 @@ func keyBits(pubKey ssh.PublicKey) int {
 
 // globalAgent is the in-memory SSH agent shared across all sessions.
 // It implements the agent.Agent interface from golang.org/x/crypto/ssh/agent.
-var globalAgent agent.Agent
+var globalAgent *confirmAgent
 
 func init() {
-	globalAgent = agent.NewKeyring()
+	globalAgent = newConfirmAgent()
 }
 
 // agentAddKey parses a PEM private key and adds it to the in-memory agent.
+// opts.lifetimeSecs expires the key after that many seconds;
+// opts.confirmBeforeUse makes every signature wait for
+// opts.onAgentSignConfirm(fingerprint) to resolve true.
 // Returns the key's SHA256 fingerprint.
-// Called from JS as: GoSSH.agentAddKey(keyPEM, passphrase?) → Promise<fingerprint>
-func agentAddKey(keyPEM string, passphrase string) js.Value {
+// Called from JS as:
+//
+//	GoSSH.agentAddKey(keyPEM, passphrase?, {lifetimeSecs?, confirmBeforeUse?, onAgentSignConfirm?}?) → Promise<fingerprint>
+func agentAddKey(keyPEM string, passphrase string, opts js.Value) js.Value {
 	return newPromise(func() (any, error) {
+		lifetime := jsInt(jsGet(opts, "lifetimeSecs"), 0)
+		if lifetime < 0 || lifetime > math.MaxUint32 {
+			return nil, fmt.Errorf("agentAddKey: lifetimeSecs must be between 0 and %d", uint32(math.MaxUint32))
+		}
+		confirm := jsBool(jsGet(opts, "confirmBeforeUse"))
+		onConfirm, hasConfirm := getCallback(opts, "onAgentSignConfirm")
+		if confirm && !hasConfirm {
+			return nil, fmt.Errorf("agentAddKey: confirmBeforeUse requires onAgentSignConfirm")
+		}
+
 		// Parse raw private key (rsa, ed25519, ecdsa, etc.)
 		var rawKey any
 		var err error
@@ -65,24 +86,110 @@ func agentAddKey(keyPEM string, passphrase string) js.Value {
 			return nil, fmt.Errorf("agentAddKey: %w", err)
 		}
 
+		// Get fingerprint by creating a signer from the raw key.
+		signer, err := ssh.NewSignerFromKey(rawKey)
+		if err != nil {
+			return nil, fmt.Errorf("agentAddKey: fingerprint: %w", err)
+		}
+		fingerprint := ssh.FingerprintSHA256(signer.PublicKey())
+
 		addedKey := agent.AddedKey{
-			PrivateKey: rawKey,
+			PrivateKey:       rawKey,
+			LifetimeSecs:     uint32(lifetime),
+			ConfirmBeforeUse: confirm,
 		}
-		if err := globalAgent.Add(addedKey); err != nil {
+		if err := globalAgent.addConfirmed(addedKey, fingerprint, onConfirm); err != nil {
 			return nil, fmt.Errorf("agentAddKey: add to keyring: %w", err)
 		}
+		return fingerprint, nil
+	})
+}
 
-		// Get fingerprint by creating a signer from the raw key.
-		signer, err := ssh.NewSignerFromKey(rawKey)
+// agentGenerateKey creates a new keypair, adds it to the agent, and returns
+// it so the app can store the private key if it wants to keep it.
+// Called from JS as:
+//
+//	GoSSH.agentGenerateKey({type?, bits?, comment?}) → Promise<{fingerprint, publicKeyOpenSSH, privateKeyPEM}>
+func agentGenerateKey(opts js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		keyType := jsString(jsGet(opts, "type"))
+		if keyType == "" {
+			keyType = "ed25519"
+		}
+		comment := jsString(jsGet(opts, "comment"))
+		if containsCTL(comment) {
+			return nil, fmt.Errorf("agentGenerateKey: comment must not contain control characters")
+		}
+
+		priv, err := generateKey(keyType, jsInt(jsGet(opts, "bits"), 0))
 		if err != nil {
-			return nil, fmt.Errorf("agentAddKey: fingerprint: %w", err)
+			return nil, fmt.Errorf("agentGenerateKey: %w", err)
+		}
+		signer, err := ssh.NewSignerFromKey(priv)
+		if err != nil {
+			return nil, fmt.Errorf("agentGenerateKey: %w", err)
+		}
+		block, err := ssh.MarshalPrivateKey(priv, comment)
+		if err != nil {
+			return nil, fmt.Errorf("agentGenerateKey: encode: %w", err)
 		}
+		privPEM := pem.EncodeToMemory(block)
+		defer scrubBytes(privPEM)
 
-		fingerprint := ssh.FingerprintSHA256(signer.PublicKey())
-		return fingerprint, nil
+		if err := globalAgent.Add(agent.AddedKey{PrivateKey: priv, Comment: comment}); err != nil {
+			return nil, fmt.Errorf("agentGenerateKey: add to keyring: %w", err)
+		}
+
+		pubLine := strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(signer.PublicKey())), "\n")
+		if comment != "" {
+			pubLine += " " + comment
+		}
+		return map[string]any{
+			"fingerprint":      ssh.FingerprintSHA256(signer.PublicKey()),
+			"publicKeyOpenSSH": pubLine,
+			"privateKeyPEM":    string(privPEM),
+		}, nil
 	})
 }
 
+// generateKey creates a private key of the given type. bits selects the
+// ECDSA curve (256, 384, 521; default 256) or RSA modulus (2048, 3072,
+// 4096; default 3072); it must be 0 or 256 for ed25519.
+func generateKey(keyType string, bits int) (crypto.Signer, error) {
+	switch keyType {
+	case "ed25519":
+		if bits != 0 && bits != 256 {
+			return nil, fmt.Errorf("ed25519 keys are always 256 bits")
+		}
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	case "ecdsa":
+		var curve elliptic.Curve
+		switch bits {
+		case 0, 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("ecdsa bits must be 256, 384, or 521")
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	case "rsa":
+		switch bits {
+		case 0:
+			bits = 3072
+		case 2048, 3072, 4096:
+		default:
+			return nil, fmt.Errorf("rsa bits must be 2048, 3072, or 4096")
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q (use ed25519, ecdsa, or rsa)", keyType)
+	}
+}
+
 // agentRemoveKey removes a single key from the agent by its SHA256 fingerprint.
 // Called from JS as: GoSSH.agentRemoveKey(fingerprint) → Promise<void>
 func agentRemoveKey(fingerprint string) js.Value {
@@ -103,6 +210,58 @@ func agentRemoveKey(fingerprint string) js.Value {
 	})
 }
 
+// agentGetPublicKey returns the authorized_keys line for a key in the
+// agent, with its comment appended when it has one.
+// Called from JS as: GoSSH.agentGetPublicKey(fingerprint) → Promise<string>
+func agentGetPublicKey(fingerprint string) js.Value {
+	return newPromise(func() (any, error) {
+		keys, err := globalAgent.List()
+		if err != nil {
+			return nil, fmt.Errorf("agentGetPublicKey: list: %w", err)
+		}
+		for _, k := range keys {
+			if ssh.FingerprintSHA256(k) == fingerprint {
+				line := strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(k)), "\n")
+				if k.Comment != "" {
+					line += " " + k.Comment
+				}
+				return line, nil
+			}
+		}
+		return nil, fmt.Errorf("agentGetPublicKey: key with fingerprint %q not found", fingerprint)
+	})
+}
+
+// agentLock locks the agent with a passphrase. While locked, keys stay
+// loaded but nothing can sign with them, and agent auth fails.
+// Called from JS as: GoSSH.agentLock(passphrase) → Promise<void>
+func agentLock(passphrase string) js.Value {
+	return newPromise(func() (any, error) {
+		passBytes := []byte(passphrase)
+		defer scrubBytes(passBytes)
+		if len(passBytes) == 0 {
+			return nil, fmt.Errorf("agentLock: passphrase required")
+		}
+		if err := globalAgent.Lock(passBytes); err != nil {
+			return nil, fmt.Errorf("agentLock: %w", err)
+		}
+		return nil, nil
+	})
+}
+
+// agentUnlock unlocks the agent; it rejects on a wrong passphrase.
+// Called from JS as: GoSSH.agentUnlock(passphrase) → Promise<void>
+func agentUnlock(passphrase string) js.Value {
+	return newPromise(func() (any, error) {
+		passBytes := []byte(passphrase)
+		defer scrubBytes(passBytes)
+		if err := globalAgent.Unlock(passBytes); err != nil {
+			return nil, fmt.Errorf("agentUnlock: %w", err)
+		}
+		return nil, nil
+	})
+}
+
 // agentRemoveAll removes all keys from the in-memory agent.
 // Called from JS as: GoSSH.agentRemoveAll()
 func agentRemoveAll() {
@@ -111,22 +270,32 @@ func agentRemoveAll() {
 	}
 }
 
-// agentListKeys returns information about all keys in the agent.
-// Called from JS as: GoSSH.agentListKeys() → [{fingerprint, type, comment}]
+// agentListKeys returns information about all keys in the agent. While
+// the agent is locked it lists the keys held when it was locked, each with
+// locked set.
+// Called from JS as: GoSSH.agentListKeys() → [{fingerprint, type, comment, bits, randomArt, confirmBeforeUse, locked}]
 func agentListKeys() js.Value {
-	keys, err := globalAgent.List()
-	if err != nil {
-		return js.Global().Get("Array").New()
+	locked, keys := globalAgent.lockState()
+	if !locked {
+		var err error
+		keys, err = globalAgent.List()
+		if err != nil {
+			return js.Global().Get("Array").New()
+		}
 	}
 
 	result := js.Global().Get("Array").New(len(keys))
 	for i, k := range keys {
+		fingerprint := ssh.FingerprintSHA256(k)
+		_, confirm := globalAgent.needsConfirm(fingerprint)
 		info := map[string]any{
-			"fingerprint": ssh.FingerprintSHA256(k),
-			"type":        k.Type(),
-			"comment":     k.Comment,
-			"bits":        keyBits(k),
-			"randomArt":   RandomArt(k),
+			"fingerprint":      fingerprint,
+			"type":             k.Type(),
+			"comment":          k.Comment,
+			"bits":             keyBits(k),
+			"randomArt":        RandomArt(k),
+			"confirmBeforeUse": confirm,
+			"locked":           locked,
 		}
 		result.SetIndex(i, js.ValueOf(info))
 	}
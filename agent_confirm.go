@@ -0,0 +1,240 @@
+// agent_confirm.go wraps the keyring to enforce confirm-before-use keys
+// (ssh-add -c). agent.NewKeyring accepts but ignores the ConfirmBeforeUse
+// constraint, so signing with such a key is intercepted here and held
+// until the key's onAgentSignConfirm callback resolves true. This covers
+// both local authentication (Signers) and forwarded agent requests (Sign).
+//
+// The wrapper also tracks whether the keyring is locked, which the keyring
+// doesn't expose, and keeps the lock passphrase out of it: the keyring
+// holds on to the slice it is given until unlocked, so it gets a salted
+// digest instead and the caller can scrub the passphrase.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"sync"
+	"syscall/js"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+var errAgentSignDenied = errors.New("agent: signature not confirmed")
+
+// confirmAgent is the keyring plus the confirmation callbacks of its
+// confirm-before-use keys and its lock state.
+type confirmAgent struct {
+	agent.ExtendedAgent
+
+	mu      sync.Mutex
+	confirm map[string]js.Value // key fingerprint → onAgentSignConfirm(fingerprint)
+	// lockSalt is set while the keyring is locked.
+	lockSalt []byte
+	// lockedKeys are the keys listed when the keyring was locked; the
+	// keyring itself lists none while locked.
+	lockedKeys []*agent.Key
+}
+
+func newConfirmAgent() *confirmAgent {
+	return &confirmAgent{
+		ExtendedAgent: agent.NewKeyring().(agent.ExtendedAgent),
+		confirm:       make(map[string]js.Value),
+	}
+}
+
+// addConfirmed adds key, recording onConfirm when the key requires
+// confirmation. Re-adding a key replaces its constraints.
+func (a *confirmAgent) addConfirmed(key agent.AddedKey, fingerprint string, onConfirm js.Value) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.ExtendedAgent.Add(key); err != nil {
+		return err
+	}
+	if key.ConfirmBeforeUse {
+		a.confirm[fingerprint] = onConfirm
+	} else {
+		delete(a.confirm, fingerprint)
+	}
+	return nil
+}
+
+// Add adds key without a confirmation callback; a confirm-before-use key
+// added this way can never be used.
+func (a *confirmAgent) Add(key agent.AddedKey) error {
+	signer, err := ssh.NewSignerFromKey(key.PrivateKey)
+	if err != nil {
+		return err
+	}
+	return a.addConfirmed(key, ssh.FingerprintSHA256(signer.PublicKey()), js.Undefined())
+}
+
+func (a *confirmAgent) Remove(key ssh.PublicKey) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.ExtendedAgent.Remove(key); err != nil {
+		return err
+	}
+	delete(a.confirm, ssh.FingerprintSHA256(key))
+	return nil
+}
+
+func (a *confirmAgent) RemoveAll() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.ExtendedAgent.RemoveAll(); err != nil {
+		return err
+	}
+	clear(a.confirm)
+	return nil
+}
+
+// Lock locks the keyring: signing fails and List is empty until Unlock
+// with the same passphrase.
+func (a *confirmAgent) Lock(passphrase []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.lockSalt != nil {
+		return errors.New("agent: already locked")
+	}
+	keys, err := a.ExtendedAgent.List()
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	if err := a.ExtendedAgent.Lock(lockDigest(salt, passphrase)); err != nil {
+		return err
+	}
+	a.lockSalt, a.lockedKeys = salt, keys
+	return nil
+}
+
+// Unlock unlocks the keyring; it fails on a wrong passphrase.
+func (a *confirmAgent) Unlock(passphrase []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.lockSalt == nil {
+		return errors.New("agent: not locked")
+	}
+	if err := a.ExtendedAgent.Unlock(lockDigest(a.lockSalt, passphrase)); err != nil {
+		return err
+	}
+	a.lockSalt, a.lockedKeys = nil, nil
+	return nil
+}
+
+// lockDigest is what the keyring stores and compares in place of the
+// lock passphrase.
+func lockDigest(salt, passphrase []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(passphrase)
+	return mac.Sum(nil)
+}
+
+// lockState reports whether the keyring is locked, and if so the keys it
+// held when locked.
+func (a *confirmAgent) lockState() (bool, []*agent.Key) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.lockSalt != nil, a.lockedKeys
+}
+
+// needsConfirm reports whether the key with fingerprint requires
+// confirmation, and returns its callback.
+func (a *confirmAgent) needsConfirm(fingerprint string) (js.Value, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cb, ok := a.confirm[fingerprint]
+	return cb, ok
+}
+
+// authorize asks JS to approve a signature with key, if it requires it.
+func (a *confirmAgent) authorize(key ssh.PublicKey) error {
+	fingerprint := ssh.FingerprintSHA256(key)
+	cb, ok := a.needsConfirm(fingerprint)
+	if !ok {
+		return nil
+	}
+	if cb.Type() != js.TypeFunction {
+		return errAgentSignDenied
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), agentConfirmTimeout)
+	defer cancel()
+	promise := js.Global().Get("Promise").Call("resolve", cb.Invoke(fingerprint))
+	result, err := awaitPromise(ctx, promise)
+	if err != nil || result.Type() != js.TypeBoolean || !result.Bool() {
+		return errAgentSignDenied
+	}
+	return nil
+}
+
+func (a *confirmAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return a.SignWithFlags(key, data, 0)
+}
+
+func (a *confirmAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	if err := a.authorize(key); err != nil {
+		return nil, err
+	}
+	return a.ExtendedAgent.SignWithFlags(key, data, flags)
+}
+
+// Signers returns the keyring's signers, with confirm-before-use keys
+// wrapped so each signature is authorized first.
+func (a *confirmAgent) Signers() ([]ssh.Signer, error) {
+	signers, err := a.ExtendedAgent.Signers()
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range signers {
+		if _, ok := a.needsConfirm(ssh.FingerprintSHA256(s.PublicKey())); !ok {
+			continue
+		}
+		// Keyring signers come from ssh.NewSignerFromKey and support
+		// algorithm selection (rsa-sha2-*); keep that.
+		if ms, ok := s.(ssh.MultiAlgorithmSigner); ok {
+			signers[i] = &confirmSigner{MultiAlgorithmSigner: ms, agent: a}
+		} else {
+			signers[i] = deniedSigner{s}
+		}
+	}
+	return signers, nil
+}
+
+// confirmSigner authorizes each signature before delegating.
+type confirmSigner struct {
+	ssh.MultiAlgorithmSigner
+	agent *confirmAgent
+}
+
+func (s *confirmSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	if err := s.agent.authorize(s.PublicKey()); err != nil {
+		return nil, err
+	}
+	return s.MultiAlgorithmSigner.Sign(rand, data)
+}
+
+func (s *confirmSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	if err := s.agent.authorize(s.PublicKey()); err != nil {
+		return nil, err
+	}
+	return s.MultiAlgorithmSigner.SignWithAlgorithm(rand, data, algorithm)
+}
+
+// deniedSigner stands in for a confirm-before-use key whose signer can't
+// be wrapped; it refuses to sign rather than sign unconfirmed.
+type deniedSigner struct{ ssh.Signer }
+
+func (deniedSigner) Sign(io.Reader, []byte) (*ssh.Signature, error) {
+	return nil, errAgentSignDenied
+}
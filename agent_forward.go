@@ -0,0 +1,284 @@
+// agent_forward.go implements scoped agent forwarding: the remote host may
+// use the forwarded agent only to authenticate to an allowlisted set of
+// downstream hosts.
+//
+// The destination is learned from the session-bind@openssh.com extension
+// (OpenSSH 8.9+): before authenticating, the remote ssh client sends the
+// downstream host key, the SSH session identifier, and the host's signature
+// over that identifier. A userauth signature request starts with the same
+// session identifier, so a sign request can be tied to a verified host key.
+// When no binding matches (older clients, or non-userauth signing), the
+// onAgentForwardConfirm callback decides; without one the request is denied.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"syscall/js"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	// agentChannelType is the channel type the server opens for forwarded
+	// agent connections.
+	agentChannelType = "auth-agent@openssh.com"
+	// sessionBindExtension binds an agent connection to a host key.
+	sessionBindExtension = "session-bind@openssh.com"
+	// maxAgentBindings bounds the session bindings kept per agent channel.
+	maxAgentBindings = 16
+	// agentConfirmTimeout bounds how long a sign request waits for JS.
+	agentConfirmTimeout = 2 * time.Minute
+	// agentSuccess is SSH_AGENT_SUCCESS, the reply to a handled extension.
+	agentSuccess = 6
+	// msgUserAuthRequest is SSH_MSG_USERAUTH_REQUEST.
+	msgUserAuthRequest = 50
+)
+
+var errAgentForwardDenied = errors.New("agent: signature request denied by forwarding scope")
+
+// agentForwardScope is the forwarding policy from the connect config.
+type agentForwardScope struct {
+	allowed map[string]bool // downstream host key SHA256 fingerprints
+	confirm js.Value        // optional onAgentForwardConfirm(info) → boolean | Promise<boolean>
+}
+
+// parseAgentForwardScope reads agentForwardHosts and onAgentForwardConfirm.
+// It returns nil when neither is set (unrestricted forwarding).
+func parseAgentForwardScope(config js.Value) (*agentForwardScope, error) {
+	hosts := config.Get("agentForwardHosts")
+	confirm, hasConfirm := getCallback(config, "onAgentForwardConfirm")
+	hasHosts := hosts.Type() == js.TypeObject && !hosts.Get("length").IsUndefined()
+	if !hasHosts && !hasConfirm {
+		return nil, nil
+	}
+
+	scope := &agentForwardScope{allowed: make(map[string]bool), confirm: confirm}
+	if hasHosts {
+		for i := 0; i < hosts.Length(); i++ {
+			fp := jsString(hosts.Index(i))
+			if !strings.HasPrefix(fp, "SHA256:") {
+				return nil, fmt.Errorf("agentForwardHosts[%d]: expected a SHA256 fingerprint", i)
+			}
+			scope.allowed[fp] = true
+		}
+	}
+	return scope, nil
+}
+
+// forwardScopedAgent serves forwarded agent channels on client, each with
+// its own scopedAgent so session bindings don't leak between connections.
+func forwardScopedAgent(client *ssh.Client, keyring agent.Agent, scope *agentForwardScope) error {
+	ext, ok := keyring.(agent.ExtendedAgent)
+	if !ok {
+		return errors.New("agent: keyring does not support extended operations")
+	}
+	channels := client.HandleChannelOpen(agentChannelType)
+	if channels == nil {
+		return errors.New("agent: already have handler for " + agentChannelType)
+	}
+	spawn("agentForward.accept", func() {
+		for ch := range channels {
+			channel, reqs, err := ch.Accept()
+			if err != nil {
+				continue
+			}
+			spawn("agentForward.requests", func() { ssh.DiscardRequests(reqs) })
+			spawn("agentForward.serve", func() {
+				_ = agent.ServeAgent(&scopedAgent{keyring: ext, scope: scope}, channel)
+				closeQuietly(channel)
+			})
+		}
+	})
+	return nil
+}
+
+// scopedAgent wraps the keyring for one forwarded agent connection. Keys
+// can be listed and used for signing within the scope; the remote cannot
+// modify or lock the keyring.
+type scopedAgent struct {
+	keyring agent.ExtendedAgent
+	scope   *agentForwardScope
+
+	mu       sync.Mutex
+	bindings []agentBinding
+}
+
+// agentBinding is a verified session-bind: session ID → host key.
+type agentBinding struct {
+	sessionID   []byte
+	fingerprint string
+}
+
+func (a *scopedAgent) List() ([]*agent.Key, error) { return a.keyring.List() }
+
+func (a *scopedAgent) Signers() ([]ssh.Signer, error) {
+	return nil, errors.New("agent: signers not available over forwarding")
+}
+
+func (a *scopedAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return a.SignWithFlags(key, data, 0)
+}
+
+func (a *scopedAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	if err := a.authorize(key, data); err != nil {
+		return nil, err
+	}
+	return a.keyring.SignWithFlags(key, data, flags)
+}
+
+func (a *scopedAgent) Add(agent.AddedKey) error       { return errAgentForwardDenied }
+func (a *scopedAgent) Remove(ssh.PublicKey) error     { return errAgentForwardDenied }
+func (a *scopedAgent) RemoveAll() error               { return errAgentForwardDenied }
+func (a *scopedAgent) Lock(passphrase []byte) error   { return errAgentForwardDenied }
+func (a *scopedAgent) Unlock(passphrase []byte) error { return errAgentForwardDenied }
+
+// authorize decides whether a signature over data may be produced.
+func (a *scopedAgent) authorize(key ssh.PublicKey, data []byte) error {
+	info := map[string]any{
+		"keyFingerprint": ssh.FingerprintSHA256(key),
+		"keyType":        key.Type(),
+	}
+
+	if sessionID, hostKey, ok := parseUserAuthSignData(data); ok {
+		if fp, bound := a.lookupBinding(sessionID); bound {
+			// A hostbound request names the host key itself; it must be
+			// the key the session was bound to.
+			if hostKey != nil && ssh.FingerprintSHA256(hostKey) != fp {
+				return errAgentForwardDenied
+			}
+			if a.scope.allowed[fp] {
+				return nil
+			}
+			return errAgentForwardDenied
+		}
+	}
+
+	// The destination is unknown: ask the user, if a callback is set.
+	if a.scope.confirm.Type() != js.TypeFunction {
+		return errAgentForwardDenied
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), agentConfirmTimeout)
+	defer cancel()
+	promise := js.Global().Get("Promise").Call("resolve", a.scope.confirm.Invoke(info))
+	result, err := awaitPromise(ctx, promise)
+	if err != nil || result.Type() != js.TypeBoolean || !result.Bool() {
+		return errAgentForwardDenied
+	}
+	return nil
+}
+
+// Extension handles session-bind@openssh.com; other extensions are not
+// supported over a scoped forward.
+func (a *scopedAgent) Extension(extensionType string, contents []byte) ([]byte, error) {
+	if extensionType != sessionBindExtension {
+		return nil, agent.ErrExtensionUnsupported
+	}
+	hostKey, sessionID, _, err := parseSessionBind(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.bindings) >= maxAgentBindings {
+		return nil, errors.New("agent: too many session bindings")
+	}
+	a.bindings = append(a.bindings, agentBinding{
+		sessionID:   sessionID,
+		fingerprint: ssh.FingerprintSHA256(hostKey),
+	})
+	return []byte{agentSuccess}, nil
+}
+
+// lookupBinding returns the host key fingerprint bound to sessionID.
+func (a *scopedAgent) lookupBinding(sessionID []byte) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, b := range a.bindings {
+		if bytes.Equal(b.sessionID, sessionID) {
+			return b.fingerprint, true
+		}
+	}
+	return "", false
+}
+
+// parseSessionBind decodes and verifies a session-bind@openssh.com request:
+// the host key's signature over the session identifier must be valid.
+func parseSessionBind(contents []byte) (hostKey ssh.PublicKey, sessionID []byte, forwarding bool, err error) {
+	var msg struct {
+		HostKey    []byte
+		SessionID  []byte
+		Signature  []byte
+		Forwarding bool
+	}
+	if err := ssh.Unmarshal(contents, &msg); err != nil {
+		return nil, nil, false, fmt.Errorf("session-bind: %w", err)
+	}
+	hostKey, err = ssh.ParsePublicKey(msg.HostKey)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("session-bind: host key: %w", err)
+	}
+	var sig ssh.Signature
+	if err := ssh.Unmarshal(msg.Signature, &sig); err != nil {
+		return nil, nil, false, fmt.Errorf("session-bind: signature: %w", err)
+	}
+	if err := hostKey.Verify(msg.SessionID, &sig); err != nil {
+		return nil, nil, false, fmt.Errorf("session-bind: %w", err)
+	}
+	return hostKey, msg.SessionID, msg.Forwarding, nil
+}
+
+// parseUserAuthSignData recognizes the data signed for publickey userauth
+// (RFC 4252 §7) and returns its session identifier. For the
+// publickey-hostbound-v00@openssh.com method the embedded host key is
+// returned too. ok is false for anything that isn't a userauth request.
+func parseUserAuthSignData(data []byte) (sessionID []byte, hostKey ssh.PublicKey, ok bool) {
+	var msg struct {
+		SessionID []byte
+		Type      byte
+		User      string
+		Service   string
+		Method    string
+		HasSig    bool
+		Algo      string
+		PubKey    []byte
+		Rest      []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(data, &msg); err != nil {
+		return nil, nil, false
+	}
+	if msg.Type != msgUserAuthRequest || !msg.HasSig {
+		return nil, nil, false
+	}
+	switch msg.Method {
+	case "publickey":
+		if len(msg.Rest) != 0 {
+			return nil, nil, false
+		}
+		return msg.SessionID, nil, true
+	case "publickey-hostbound-v00@openssh.com":
+		var hb struct {
+			HostKey []byte
+		}
+		if err := ssh.Unmarshal(msg.Rest, &hb); err != nil {
+			return nil, nil, false
+		}
+		k, err := ssh.ParsePublicKey(hb.HostKey)
+		if err != nil {
+			return nil, nil, false
+		}
+		return msg.SessionID, k, true
+	default:
+		return nil, nil, false
+	}
+}
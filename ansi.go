@@ -0,0 +1,121 @@
+// ansi.go removes terminal escape sequences from captured output so it can
+// be parsed programmatically.
+//
+// A regex such as /\x1b\[[0-9;]*m/ only handles SGR colors; real output also
+// contains private-mode CSI (ESC[?25l), OSC titles and hyperlinks terminated
+// by BEL or ST, DCS strings, and charset designations (ESC(B). This is a
+// small state machine following the ECMA-48 / VT500 parser states. Only
+// 7-bit sequences are recognized: 8-bit C1 bytes would collide with UTF-8
+// continuation bytes.
+
+//go:build js && wasm
+
+package gossh
+
+import "syscall/js"
+
+type ansiState int
+
+const (
+	ansiGround    ansiState = iota
+	ansiEscape              // after ESC
+	ansiEscInter            // ESC followed by intermediate bytes (e.g. ESC ( B)
+	ansiCSI                 // ESC [ params/intermediates until a final byte
+	ansiString              // OSC/DCS/SOS/PM/APC body until BEL or ST
+	ansiStringEsc           // ESC seen inside a string; '\' completes ST
+)
+
+// stripANSI returns data with escape sequences removed. Printable text,
+// tabs, and line endings are preserved; other C0 controls except BS are
+// dropped along with the sequences.
+func stripANSI(data []byte) []byte {
+	var s ansiStripper
+	return s.strip(data)
+}
+
+// ansiStripper strips escape sequences from a stream delivered in chunks,
+// keeping the parser state between them so a sequence split across two
+// reads is still removed whole.
+type ansiStripper struct {
+	state ansiState
+}
+
+// strip returns the text in the next chunk of the stream.
+func (s *ansiStripper) strip(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	state := s.state
+	defer func() { s.state = state }()
+	for _, b := range data {
+		switch state {
+		case ansiGround:
+			switch {
+			case b == 0x1b:
+				state = ansiEscape
+			case b == '\n', b == '\r', b == '\t', b == '\b':
+				out = append(out, b)
+			case b < 0x20 || b == 0x7f:
+				// Other C0 controls (BEL, SO/SI, ...) carry no text.
+			default:
+				out = append(out, b)
+			}
+
+		case ansiEscape:
+			switch {
+			case b == '[':
+				state = ansiCSI
+			case b == ']', b == 'P', b == 'X', b == '^', b == '_':
+				state = ansiString
+			case b >= 0x20 && b <= 0x2f:
+				state = ansiEscInter
+			case b == 0x1b:
+				// ESC ESC: restart the sequence.
+			default:
+				// Two-byte sequence (ESC 7, ESC =, ESC M, ...) or a stray ESC.
+				state = ansiGround
+			}
+
+		case ansiEscInter:
+			if b < 0x20 || b > 0x2f {
+				state = ansiGround
+			}
+
+		case ansiCSI:
+			switch {
+			case b >= 0x40 && b <= 0x7e:
+				state = ansiGround
+			case b == 0x1b:
+				state = ansiEscape
+			case b == 0x18 || b == 0x1a: // CAN/SUB abort the sequence
+				state = ansiGround
+			}
+
+		case ansiString:
+			switch b {
+			case 0x07:
+				state = ansiGround
+			case 0x1b:
+				state = ansiStringEsc
+			case 0x18, 0x1a:
+				state = ansiGround
+			}
+
+		case ansiStringEsc:
+			if b == '\\' {
+				state = ansiGround
+			} else {
+				state = ansiString
+			}
+		}
+	}
+	return out
+}
+
+// jsStripANSI strips escape sequences from a string or Uint8Array,
+// returning the same type it was given.
+// Called from JS as: GoSSH.stripAnsi(input: string | Uint8Array) → string | Uint8Array
+func jsStripANSI(input js.Value) js.Value {
+	if input.Type() == js.TypeString {
+		return js.ValueOf(string(stripANSI([]byte(input.String()))))
+	}
+	return bytesToUint8Array(stripANSI(uint8ArrayToBytes(input)))
+}
@@ -0,0 +1,84 @@
+// chunking.go sizes transfer chunks. By default every chunk is
+// transferChunkSize; with adaptiveChunks the size follows the link, much
+// like TCP slow start. pkg/sftp splits a chunk into pipelined packets, so a
+// bigger chunk keeps more requests in flight: that is what fills a fast or
+// high-latency link, while a slow link is better served by small chunks
+// that keep progress and cancellation responsive.
+
+//go:build js && wasm
+
+package gossh
+
+import "time"
+
+const (
+	minAdaptiveChunk = 16 * 1024
+	maxAdaptiveChunk = 4 * 1024 * 1024
+	// adaptiveFastChunk is the time under which a full chunk counts as
+	// keeping up with the link, so the next one grows.
+	adaptiveFastChunk = 200 * time.Millisecond
+	// adaptiveGain is the throughput improvement over the previous size
+	// that makes a slower chunk grow anyway: on a high-latency link every
+	// chunk is slow, but bigger ones still pay off until the link is full.
+	adaptiveGain = 1.1
+	// adaptiveStallChunk is the time over which a chunk counts as a stall,
+	// and the size backs off.
+	adaptiveStallChunk = 2 * time.Second
+)
+
+// chunkSizer picks the size of each transfer chunk.
+type chunkSizer struct {
+	adaptive bool
+	size     int
+	// threshold ends the doubling phase; past it, growth is linear.
+	threshold int
+	// rate is the throughput (bytes/s) when the size last grew.
+	rate float64
+}
+
+func newChunkSizer(adaptive bool) *chunkSizer {
+	if !adaptive {
+		return &chunkSizer{size: transferChunkSize}
+	}
+	return &chunkSizer{adaptive: true, size: minAdaptiveChunk, threshold: maxAdaptiveChunk}
+}
+
+// next returns the size of the next chunk.
+func (c *chunkSizer) next() int { return c.size }
+
+// max returns the largest size next can return, for sizing buffers.
+func (c *chunkSizer) max() int {
+	if c.adaptive {
+		return maxAdaptiveChunk
+	}
+	return transferChunkSize
+}
+
+// observe records that n bytes of a chunk took elapsed. A full chunk grows
+// the size when it was fast or when growing last time raised throughput; a
+// short read at end of file says nothing about the link.
+func (c *chunkSizer) observe(n int, elapsed time.Duration) {
+	if !c.adaptive {
+		return
+	}
+	if elapsed >= adaptiveStallChunk {
+		c.size = max(c.size/2, minAdaptiveChunk)
+		c.threshold = c.size
+		c.rate = 0
+		return
+	}
+	if n < c.size || elapsed <= 0 {
+		return
+	}
+	rate := float64(n) / elapsed.Seconds()
+	if elapsed >= adaptiveFastChunk && rate < c.rate*adaptiveGain {
+		return
+	}
+	c.rate = rate
+	if c.size < c.threshold {
+		c.size *= 2
+	} else {
+		c.size += minAdaptiveChunk
+	}
+	c.size = min(c.size, maxAdaptiveChunk)
+}
@@ -0,0 +1,78 @@
+// conninfo.go reports what a connection's handshake negotiated: the
+// version strings, the algorithms, and the server's host key, for a
+// "connection security" panel or to debug compatibility with old servers.
+// The algorithms are those of the initial key exchange; a later rekey
+// negotiates from the same preferences, so they don't change in practice.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"fmt"
+	"syscall/js"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// connInfo is captured once the handshake completes.
+type connInfo struct {
+	serverVersion, clientVersion string
+	algorithms                   ssh.NegotiatedAlgorithms
+	hostKey                      ssh.PublicKey
+	// wsProtocol is the WebSocket subprotocol the proxy selected.
+	wsProtocol string
+}
+
+func newConnInfo(conn ssh.Conn, hostKey ssh.PublicKey) connInfo {
+	info := connInfo{
+		serverVersion: string(conn.ServerVersion()),
+		clientVersion: string(conn.ClientVersion()),
+		hostKey:       hostKey,
+	}
+	if m, ok := conn.(ssh.AlgorithmsConnMetadata); ok {
+		info.algorithms = m.Algorithms()
+	}
+	return info
+}
+
+// toJS describes the connection. cipher and mac are for data sent to the
+// server; the server usually picks the same ones for its direction, and
+// readCipher/readMac say when it didn't. mac is empty for AEAD ciphers
+// (GCM, ChaCha20-Poly1305), which authenticate on their own.
+func (c connInfo) toJS() js.Value {
+	result := map[string]any{
+		"serverVersion": maskControl(c.serverVersion),
+		"clientVersion": c.clientVersion,
+		"cipher":        c.algorithms.Write.Cipher,
+		"mac":           c.algorithms.Write.MAC,
+		"readCipher":    c.algorithms.Read.Cipher,
+		"readMac":       c.algorithms.Read.MAC,
+		"kex":           c.algorithms.KeyExchange,
+		// The signature algorithm: rsa-sha2-512 for an ssh-rsa key.
+		"hostKeyAlgorithm": c.algorithms.HostKey,
+		"wsProtocol":       c.wsProtocol,
+	}
+	if c.hostKey != nil {
+		result["hostKeyType"] = c.hostKey.Type()
+		result["hostKeyFingerprint"] = ssh.FingerprintSHA256(c.hostKey)
+	}
+	return js.ValueOf(result)
+}
+
+// sshSessionInfo describes the session's current connection; after a
+// reconnect, that's the new one.
+// Called from JS as: GoSSH.sshSessionInfo(sessionId) → {serverVersion, clientVersion, cipher, mac, readCipher, readMac, kex, hostKeyType, hostKeyAlgorithm, hostKeyFingerprint, wsProtocol}
+func sshSessionInfo(sessionID string) (js.Value, error) {
+	sess, err := getSession(sessionID)
+	if err != nil {
+		return js.Undefined(), fmt.Errorf("sshSessionInfo: %w", err)
+	}
+	sess.connMu.Lock()
+	cc := sess.cc
+	sess.connMu.Unlock()
+	if cc == nil {
+		return js.Undefined(), fmt.Errorf("sshSessionInfo: session %q is not connected", sessionID)
+	}
+	return cc.info.toJS(), nil
+}
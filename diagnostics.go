@@ -0,0 +1,140 @@
+// diagnostics.go counts the package's goroutines by what started them, so
+// leaks show up during development and in bug reports. Every long-lived
+// goroutine is started with spawn under a label; counting is off until
+// enableDiagnostics is called, since it costs a lock per goroutine.
+//
+// It also reports memory use. WASM linear memory only grows — the browser
+// can't reclaim it — so memStats pairs the Go heap figures with the bytes
+// the package itself holds for transfers in progress, and collectGarbage
+// forces a collection. The GC doesn't shrink the instance either; what it
+// buys is reuse of the freed heap by the next transfer instead of growing
+// memory again. That makes it a stopgap for back-to-back large in-memory
+// transfers, not a fix for WASM's memory model.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"syscall/js"
+)
+
+// heldBytes counts data buffered in Go for operations in progress: the
+// in-memory sftpDownload buffer, queued sftpUploadStreamWrite chunks, and
+// aggregated exec output.
+var heldBytes struct {
+	downloads atomic.Int64
+	uploads   atomic.Int64
+	exec      atomic.Int64
+}
+
+// memStats reports Go heap statistics and the package's held buffers.
+// Called from JS as: GoSSH.memStats() → {heapAlloc, heapSys, heapInuse, sys, numGC, held: {downloads, uploads, exec, total}}
+func memStats() js.Value {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	downloads, uploads, exec := heldBytes.downloads.Load(), heldBytes.uploads.Load(), heldBytes.exec.Load()
+	return js.ValueOf(map[string]any{
+		"heapAlloc": float64(m.HeapAlloc),
+		"heapSys":   float64(m.HeapSys),
+		"heapInuse": float64(m.HeapInuse),
+		"sys":       float64(m.Sys),
+		"numGC":     int(m.NumGC),
+		"held": map[string]any{
+			"downloads": float64(downloads),
+			"uploads":   float64(uploads),
+			"exec":      float64(exec),
+			"total":     float64(downloads + uploads + exec),
+		},
+	})
+}
+
+// autoGCThreshold is the transfer size (bytes) at or above which a
+// collection runs once the transfer finishes; 0 disables it.
+var autoGCThreshold atomic.Int64
+
+// collectGarbage runs a full collection and returns freed spans to the
+// runtime. debug.FreeOSMemory includes the runtime.GC.
+// Called from JS as: GoSSH.collectGarbage()
+func collectGarbage() {
+	debug.FreeOSMemory()
+}
+
+// setAutoCollectGarbage sets autoGCThreshold.
+// Called from JS as: GoSSH.setAutoCollectGarbage(thresholdBytes)
+func setAutoCollectGarbage(threshold int64) {
+	if threshold < 0 {
+		threshold = 0
+	}
+	autoGCThreshold.Store(threshold)
+}
+
+// afterTransfer schedules a collection after an in-memory transfer of n
+// bytes when it reaches autoGCThreshold. It runs in its own goroutine so
+// the transfer's buffers are out of scope by then.
+func afterTransfer(n int64) {
+	if t := autoGCThreshold.Load(); t > 0 && n >= t {
+		spawn("gc", collectGarbage)
+	}
+}
+
+// goroutineCounts holds the number of live goroutines per spawn label.
+var goroutineCounts struct {
+	enabled atomic.Bool
+	mu      sync.Mutex
+	byLabel map[string]int
+}
+
+// spawn runs fn in a new goroutine, counted under label while diagnostics
+// are enabled. A goroutine started before they were enabled is never
+// counted, so counts don't go negative.
+func spawn(label string, fn func()) {
+	if !goroutineCounts.enabled.Load() {
+		go fn()
+		return
+	}
+	countGoroutine(label, 1)
+	go func() {
+		defer countGoroutine(label, -1)
+		fn()
+	}()
+}
+
+func countGoroutine(label string, delta int) {
+	goroutineCounts.mu.Lock()
+	defer goroutineCounts.mu.Unlock()
+	if goroutineCounts.byLabel == nil {
+		goroutineCounts.byLabel = make(map[string]int)
+	}
+	goroutineCounts.byLabel[label] += delta
+	if goroutineCounts.byLabel[label] == 0 {
+		delete(goroutineCounts.byLabel, label)
+	}
+}
+
+// enableDiagnostics turns goroutine counting on or off. Goroutines already
+// counted are still uncounted when they exit.
+// Called from JS as: GoSSH.enableDiagnostics(enabled: boolean)
+func enableDiagnostics(enabled bool) {
+	goroutineCounts.enabled.Store(enabled)
+}
+
+// diagnostics reports live goroutines by label, counting those started
+// since diagnostics were enabled.
+// Called from JS as: GoSSH.diagnostics() → {enabled, goroutines: {label: count}}
+func diagnostics() js.Value {
+	goroutineCounts.mu.Lock()
+	counts := make(map[string]any, len(goroutineCounts.byLabel))
+	for label, n := range goroutineCounts.byLabel {
+		counts[label] = n
+	}
+	goroutineCounts.mu.Unlock()
+	return js.ValueOf(map[string]any{
+		"enabled":    goroutineCounts.enabled.Load(),
+		"goroutines": counts,
+	})
+}
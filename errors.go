@@ -8,3 +8,52 @@ var (
 	errMissingConfig = errors.New("connect: config object required")
 	errMissingKey    = errors.New("agentAddKey: keyPEM string required")
 )
+
+// Error codes exposed to JS as err.code for failures callers need to
+// tell apart programmatically.
+const (
+	errCodeSFTPUnavailable      = "SFTP_SUBSYSTEM_UNAVAILABLE"
+	errCodeUploadOverlap        = "UPLOAD_WRITE_OVERLAP"
+	errCodeUploadResumeMismatch = "UPLOAD_RESUME_MISMATCH"
+	errCodeSymlinkLoop          = "SYMLINK_LOOP"
+	errCodeSFTPExtension        = "SFTP_EXTENSION_UNSUPPORTED"
+	errCodeHostKeyChanged       = "HOST_KEY_CHANGED"
+	errCodeTooManyAuthFailures  = "TOO_MANY_AUTH_FAILURES"
+	errCodePasswordChange       = "PASSWORD_CHANGE_REQUIRED"
+	errCodeInputRateLimited     = "INPUT_RATE_LIMITED"
+	errCodeConnectAborted       = "CONNECT_ABORTED"
+	errCodeSFTPReadOnly         = "SFTP_READ_ONLY"
+	errCodeSFTPOutsideRoot      = "SFTP_OUTSIDE_ROOT"
+	errCodeWSDialFailed         = "WS_DIAL_FAILED"
+	errCodeWSDialTimeout        = "WS_DIAL_TIMEOUT"
+	errCodeWSProxyRejected      = "WS_PROXY_REJECTED"
+)
+
+// codedError is an error with a stable, machine-readable code.
+// jsError copies the code onto the JS Error object as err.code.
+type codedError struct {
+	code string
+	msg  string
+}
+
+func (e *codedError) Error() string { return e.msg }
+
+var errSFTPUnavailable = &codedError{
+	code: errCodeSFTPUnavailable,
+	msg:  "sftpOpen: the server does not have the SFTP subsystem enabled",
+}
+
+var errUploadOverlap = &codedError{
+	code: errCodeUploadOverlap,
+	msg:  "sftpUploadStreamWrite: write issued before the previous one resolved (serialWrites is enabled; await each write)",
+}
+
+var errInputRateLimited = &codedError{
+	code: errCodeInputRateLimited,
+	msg:  "write: input rate limit exceeded, data dropped (use sendText for large input)",
+}
+
+var errConnectAborted = &codedError{
+	code: errCodeConnectAborted,
+	msg:  "connect: aborted",
+}
@@ -0,0 +1,41 @@
+// events.go delivers structured connection lifecycle events to the connect
+// config's onEvent callback, alongside the older free-text onClose. Each
+// event is an object with a type and fields for that type:
+//
+//	{type: 'banner', banner}                    server identification, at connect
+//	{type: 'keepalive_failed', attempt, error}  a keepalive got no reply
+//	{type: 'keepalive_recovered', attempts}     one did after failures
+//	{type: 'pty_resized', channelId, cols, rows}
+//	{type: 'connection_lost', reason}           autoReconnect is taking over
+//	{type: 'reconnecting', attempt?}            attempt is set for autoReconnect
+//	{type: 'reconnected', attempt?}
+//	{type: 'reconnect_failed', attempt?, error}
+//	{type: 'host_key_changed', previousKeyType, previousFingerprint, keyType, fingerprint}
+//	                                            reconnectHostKeyPolicy 'warn'
+//	{type: 'closed', reason, exitCode?, exitSignal?}  just before onClose
+//
+// Events are delivered from the goroutine that observed them, so a slow
+// onEvent delays that goroutine; it should hand work off rather than block.
+
+//go:build js && wasm
+
+package gossh
+
+import "syscall/js"
+
+// emitEvent calls onEvent, when it's a function, with {type, ...fields}.
+func emitEvent(onEvent js.Value, eventType string, fields map[string]any) {
+	if onEvent.Type() != js.TypeFunction {
+		return
+	}
+	event := map[string]any{"type": eventType}
+	for k, v := range fields {
+		event[k] = v
+	}
+	onEvent.Invoke(js.ValueOf(event))
+}
+
+// emit sends an event to the session's onEvent.
+func (s *session) emit(eventType string, fields map[string]any) {
+	emitEvent(s.onEvent, eventType, fields)
+}
@@ -0,0 +1,149 @@
+// exec_time.go measures the remote time of an exec'd command
+// (measureRemote). The command runs under `sh -c` — whatever the user's
+// login shell — between two `date` calls and followed by the POSIX `times`
+// builtin, and both reports are written to stderr after a per-call marker
+// line. `times` is used rather than a `time` wrapper because `time` is a
+// shell keyword whose options and output vary (zsh has no -p, dash has none
+// at all and relies on an often-missing /usr/bin/time). `times` reports CPU
+// time only, so real time comes from the `date` pair: nanoseconds where
+// date supports %N, whole seconds where it doesn't.
+//
+// The marker and report are cut out of stderr before it reaches onStderr
+// or the aggregated result.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxTimesTrailer bounds the bytes kept after the marker.
+const maxTimesTrailer = 4096
+
+// wrapTimed returns command wrapped to report its start and end time and
+// its CPU time after marker, preserving its exit status.
+func wrapTimed(command, marker string) string {
+	script := `t0=$(date +%s.%N 2>/dev/null); sh -c "$1"; s=$?; t1=$(date +%s.%N 2>/dev/null); ` +
+		`printf '\n%s\n%s %s\n' "$2" "$t0" "$t1" >&2; times >&2; exit $s`
+	return "sh -c " + shellQuote(script) + " sh " + shellQuote(command) + " " + shellQuote(marker)
+}
+
+// trailerSplitter passes writes through to w until marker appears, then
+// diverts everything after it into trailer. Bytes that might begin the
+// marker are held back until the next write (or flush) decides.
+type trailerSplitter struct {
+	w       io.Writer
+	marker  []byte
+	pending []byte
+	found   bool
+	trailer bytes.Buffer
+}
+
+func (t *trailerSplitter) Write(p []byte) (int, error) {
+	n := len(p)
+	if t.found {
+		t.keepTrailer(p)
+		return n, nil
+	}
+	data := append(t.pending, p...)
+	t.pending = nil
+	if i := bytes.Index(data, t.marker); i >= 0 {
+		t.found = true
+		if _, err := t.w.Write(data[:i]); err != nil {
+			return n, err
+		}
+		t.keepTrailer(data[i+len(t.marker):])
+		return n, nil
+	}
+	k := markerOverlap(data, t.marker)
+	t.pending = append([]byte(nil), data[len(data)-k:]...)
+	if _, err := t.w.Write(data[:len(data)-k]); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// flush releases held-back bytes once the stream has ended.
+func (t *trailerSplitter) flush() error {
+	if len(t.pending) == 0 {
+		return nil
+	}
+	_, err := t.w.Write(t.pending)
+	t.pending = nil
+	return err
+}
+
+func (t *trailerSplitter) keepTrailer(p []byte) {
+	if room := maxTimesTrailer - t.trailer.Len(); len(p) > room {
+		p = p[:room]
+	}
+	t.trailer.Write(p)
+}
+
+// markerOverlap returns the length of the longest suffix of data that is a
+// proper prefix of marker.
+func markerOverlap(data, marker []byte) int {
+	k := len(marker) - 1
+	if k > len(data) {
+		k = len(data)
+	}
+	for ; k > 0; k-- {
+		if bytes.HasPrefix(marker, data[len(data)-k:]) {
+			return k
+		}
+	}
+	return 0
+}
+
+// timesField matches one duration in `times` output: "0m1.250s" (bash,
+// dash) or "0m 1.25s" (busybox).
+var timesField = regexp.MustCompile(`(\d+)m\s*(\d+(?:\.\d+)?)s`)
+
+// parseRealTime reads the command's real time from the trailer's first
+// line, "start end" as printed by `date +%s.%N`. A date without %N prints
+// it literally (or as "N"); only whole seconds are used then.
+func parseRealTime(out string) (realMs int64, ok bool) {
+	line, _, _ := strings.Cut(out, "\n")
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		return 0, false
+	}
+	var ts [2]float64
+	for i, f := range fields {
+		sec, frac, _ := strings.Cut(f, ".")
+		if _, err := strconv.ParseUint(frac, 10, 64); err != nil {
+			frac = ""
+		}
+		v, err := strconv.ParseFloat(sec+"."+frac+"0", 64)
+		if err != nil {
+			return 0, false
+		}
+		ts[i] = v
+	}
+	if ts[1] < ts[0] {
+		return 0, false
+	}
+	return int64((ts[1]-ts[0])*1000 + 0.5), true
+}
+
+// parseTimes reads the children's user and system CPU time from `times`
+// output: its last line.
+func parseTimes(out string) (userMs, sysMs int64, ok bool) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	fields := timesField.FindAllStringSubmatch(lines[len(lines)-1], -1)
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	ms := func(f []string) int64 {
+		min, _ := strconv.ParseInt(f[1], 10, 64)
+		sec, _ := strconv.ParseFloat(f[2], 64)
+		return min*60_000 + int64(sec*1000+0.5)
+	}
+	return ms(fields[0]), ms(fields[1]), true
+}
@@ -12,58 +12,422 @@
 interface GoSSHAPI {
   // ──── SSH Session ────
 
-  /** Establish an SSH connection through a WebSocket proxy. */
+  /**
+   * Establish an SSH connection through a WebSocket proxy. When the
+   * WebSocket can't be opened, the error has code 'WS_DIAL_FAILED',
+   * 'WS_DIAL_TIMEOUT', or 'WS_PROXY_REJECTED' (the proxy closed with 1008
+   * or a 4000-4999 code), and the message includes the close code and
+   * reason, e.g. "proxy rejected: 4401 unauthorized". Browsers report
+   * every failure before the upgrade (DNS, refused, TLS, HTTP 401) as
+   * code 1006 without detail; the browser console says which.
+   */
   connect(config: SSHConnectConfig): Promise<string>;
 
-  /** Send data to the SSH session's stdin. */
-  write(sessionId: string, data: Uint8Array): void;
+  /**
+   * Connect and, when `config.sftp` is set, open SFTP in the same call.
+   * If SFTP can't be opened the session is closed and the promise rejects
+   * with the sftpOpen error. sftpId is null when `sftp` is not requested.
+   */
+  connectFull(config: SSHConnectFullConfig): Promise<{ sessionId: string; sftpId: string | null }>;
 
-  /** Change the PTY window size. */
-  resize(sessionId: string, cols: number, rows: number): void;
+  /**
+   * Send data to the SSH session's stdin. Returns an error with code
+   * 'INPUT_RATE_LIMITED' (and drops the data) when it would exceed the
+   * session's inputRateLimit.
+   */
+  write(sessionId: string, data: Uint8Array): GoSSHError | undefined;
+
+  /**
+   * Write text to the shell in paced chunks, so a large paste isn't
+   * mangled by a line-editing shell. Resolves once everything is sent.
+   * Concurrent calls run one after another, and input sent with write
+   * meanwhile is held until the paste is done (up to 64KB).
+   */
+  sendText(sessionId: string, text: string, opts?: SendTextOptions): Promise<void>;
+
+  /**
+   * Change the PTY window size.
+   * @param channelId - PTY channel to resize: an exec PTY ID from
+   *   `onPtyOpen`, or omit for the interactive shell
+   */
+  resize(sessionId: string, cols: number, rows: number, channelId?: string): void;
+
+  /**
+   * Last PTY size sent for a channel (default: the shell), or null if
+   * unknown. The shell's size carries over reconnect, which re-sends it.
+   */
+  getPtySize(sessionId: string, channelId?: string): { cols: number; rows: number } | null;
+
+  /**
+   * Dial the session's host again with its connect config and swap the new
+   * connection in under the same session ID. The shell is requested again
+   * with the same term, modes, and env at the last size sent by resize.
+   * SFTP sessions, forwards, and channels on the old connection are closed.
+   */
+  reconnect(sessionId: string): Promise<void>;
+
+  /**
+   * What the session's current connection negotiated. Returns a GoSSHError
+   * for an unknown session.
+   */
+  sshSessionInfo(sessionId: string): SSHSessionInfo | GoSSHError;
 
   /** Gracefully close an SSH session. */
   disconnect(sessionId: string): void;
 
+  /**
+   * Empty the connection pool. Unused pooled connections close now; ones
+   * in use close with their last session instead of being kept.
+   */
+  poolFlush(): void;
+
+  /**
+   * Run a command on its own channel (with a PTY only if `pty` is set)
+   * and collect its output.
+   * A non-zero exit status resolves with that exitCode; it does not reject.
+   * Output can be streamed via onData/onStderr as it arrives; the
+   * aggregated stdout/stderr in the result are each capped at 16 MiB.
+   */
+  exec(sessionId: string, command: string, opts?: ExecOptions): Promise<ExecResult>;
+
+  /**
+   * Search file contents under `path` (default: the login directory) with
+   * `rg` on the server, or `grep -r` where rg isn't installed. The pattern
+   * is a regex in that tool's syntax (extended for grep), or a literal
+   * string with `flags.fixed`. Each match also goes to onMatch as it
+   * arrives. The search stops at maxResults (default 1000, max 10000), with
+   * `truncated` set. Binary and unreadable files are skipped; rejects only
+   * if the tool fails having found nothing (e.g. a missing path).
+   */
+  grepRemote(sessionId: string, opts: GrepOptions): Promise<{ matches: GrepMatch[]; truncated: boolean; tool: 'rg' | 'grep' }>;
+
+  /**
+   * Remove ANSI/VT escape sequences (CSI, OSC, DCS, charset designations)
+   * from captured output. Returns the same type it was given.
+   */
+  stripAnsi<T extends string | Uint8Array>(input: T): T;
+
+  // ──── Raw protocol passthrough ────
+
+  /**
+   * Send a raw SSH global request (e.g. vendor extensions) on the session's
+   * connection. The payload is the request-specific data, base64-encoded
+   * (max 32 KB decoded). `ok` is false if the server refused the request.
+   */
+  sendGlobalRequest(
+    sessionId: string,
+    name: string,
+    wantReply: boolean,
+    payloadBase64?: string
+  ): Promise<{ ok: boolean; responseBase64: string }>;
+
+  /**
+   * Open an SSH channel of any type (vendor extensions, custom subsystems).
+   * payloadBase64 is the type-specific open data. Rejects if the server
+   * refuses the channel. The channel is closed with the session.
+   */
+  openChannel(
+    sessionId: string,
+    channelType: string,
+    payloadBase64?: string,
+    opts?: ChannelOptions
+  ): Promise<string>;
+
+  /**
+   * Start a subsystem other than SFTP (e.g. 'netconf') on a new session
+   * channel, used like an openChannel channel. Rejects if the server
+   * refuses the subsystem.
+   */
+  openSubsystem(sessionId: string, name: string, opts?: ChannelOptions): Promise<string>;
+
+  /** Write data to a channel opened with openChannel or openSubsystem. */
+  channelWrite(channelId: string, data: Uint8Array): Promise<void>;
+
+  /** Close a channel opened with openChannel or openSubsystem. */
+  channelClose(channelId: string): void;
+
   // ──── SSH Agent ────
 
   /** Add a PEM-encoded private key to the in-memory agent. Returns fingerprint. */
-  agentAddKey(keyPEM: string, passphrase?: string): Promise<string>;
+  agentAddKey(keyPEM: string, passphrase?: string, opts?: AddKeyOptions): Promise<string>;
+
+  /**
+   * Generate a keypair (default ed25519) and add it to the agent. The
+   * private key is returned unencrypted in OpenSSH PEM format for the app to
+   * store; it is not kept anywhere else.
+   */
+  agentGenerateKey(opts?: GenerateKeyOptions): Promise<GeneratedKey>;
+
+  /**
+   * The authorized_keys line ("ssh-ed25519 AAAA... comment") for a key in
+   * the agent, by SHA256 fingerprint.
+   */
+  agentGetPublicKey(fingerprint: string): Promise<string>;
 
   /** Remove a single key from the agent by fingerprint. */
   agentRemoveKey(fingerprint: string): Promise<void>;
 
+  /**
+   * Lock the agent with a passphrase. Keys stay loaded but can't sign, and
+   * authMethod 'agent' fails, until agentUnlock.
+   */
+  agentLock(passphrase: string): Promise<void>;
+
+  /** Unlock the agent. Rejects on a wrong passphrase. */
+  agentUnlock(passphrase: string): Promise<void>;
+
   /** Remove all keys from the agent. */
   agentRemoveAll(): void;
 
   /** List all keys in the agent. */
   agentListKeys(): KeyInfo[];
 
+  /**
+   * OpenSSH visual host key for a public key (authorized_keys format), at
+   * the standard 17×9 unless `width`/`height` are given: odd, 9–65 wide
+   * and 5–33 high. Larger grids make similar keys easier to tell apart.
+   * The walk follows the SHA256 fingerprint, as ssh shows it; `hash: 'md5'`
+   * draws the legacy MD5 art. `color: true` colors the text with ANSI
+   * escapes by visit count, for a terminal. With `format: 'grid'`, the
+   * cells come back as data for drawing in color instead of as text.
+   */
+  randomArt(
+    publicKey: string,
+    opts?: { width?: number; height?: number; format?: 'text'; hash?: 'sha256' | 'md5'; color?: boolean }
+  ): string | GoSSHError;
+  randomArt(
+    publicKey: string,
+    opts: { width?: number; height?: number; format: 'grid'; hash?: 'sha256' | 'md5' }
+  ): RandomArtGrid | GoSSHError;
+
+  /**
+   * Drop cached randomart. Randomart is cached per key (up to 128 keys),
+   * so listing keys and host key prompts don't redraw it each time.
+   */
+  clearRandomArtCache(): void;
+
   // ──── SFTP ────
 
-  /** Open an SFTP subsystem on an existing SSH session. */
-  sftpOpen(sessionId: string): Promise<string>;
+  /**
+   * Open an SFTP subsystem on an existing SSH session.
+   * With `reuse: true`, returns the ID of an SFTP session already open on
+   * the same SSH session instead of starting another subsystem. A reused ID
+   * stays open until each sftpOpen that returned it is matched by sftpClose.
+   * Rejects with `code: 'SFTP_SUBSYSTEM_UNAVAILABLE'` when the server does
+   * not have the SFTP subsystem enabled.
+   */
+  sftpOpen(sessionId: string, options?: SFTPOpenOptions): Promise<string>;
 
-  /** Close an SFTP session. */
+  /**
+   * Close an SFTP session. A reused ID closes once all its holders have
+   * called sftpClose; closing the SSH session closes it regardless.
+   */
   sftpClose(sftpId: string): void;
 
-  /** List directory contents. */
-  sftpListDir(sftpId: string, path: string): Promise<FileInfo[]>;
+  /**
+   * List directory contents. With `realPath: true`, each entry includes its
+   * canonical path; this costs one extra round-trip per symlink entry.
+   */
+  sftpListDir(sftpId: string, path: string, opts?: { realPath?: boolean }): Promise<FileInfo[]>;
 
-  /** Get file info for a single path. */
-  sftpStat(sftpId: string, path: string): Promise<FileInfo>;
+  /**
+   * Entries matching a glob pattern (`*`, `?`, `[...]`, matched within one
+   * path component; no `**`), in name order. At most 10000 are returned;
+   * `truncated` is set if there were more.
+   */
+  sftpGlob(sftpId: string, pattern: string): Promise<{ matches: FileInfo[]; truncated: boolean }>;
 
-  /** Create a remote directory (recursive). */
-  sftpMkdir(sftpId: string, path: string): Promise<void>;
+  /**
+   * Walk a tree for entries whose name (not path) matches `namePattern`, a
+   * glob, or `nameRegex`, an RE2 regular expression. Stops at maxResults
+   * (default 1000, max 10000) with `truncated` set. Directories that can't
+   * be listed are skipped. A directory comes after its contents.
+   */
+  sftpFind(
+    sftpId: string,
+    root: string,
+    opts: {
+      namePattern?: string;
+      nameRegex?: string;
+      maxResults?: number;
+      followSymlinks?: boolean;
+      signal?: AbortSignal;
+    }
+  ): Promise<{ matches: FileInfo[]; truncated: boolean }>;
 
-  /** Remove a file or directory. */
-  sftpRemove(sftpId: string, path: string, recursive?: boolean): Promise<void>;
+  /** Get file info for a single path (not following a final symlink). */
+  sftpStat(sftpId: string, path: string, opts?: { realPath?: boolean }): Promise<FileInfo>;
 
-  /** Rename/move a file or directory. */
-  sftpRename(sftpId: string, oldPath: string, newPath: string): Promise<void>;
+  /**
+   * Whether a path exists, following symlinks. Not-found resolves
+   * {exists: false}; permission and connection errors reject.
+   */
+  sftpExists(sftpId: string, path: string): Promise<{ exists: boolean; isDir?: boolean }>;
+
+  /**
+   * Create a remote directory (recursive). With `mode` (e.g. 0o700), each
+   * directory this call creates is chmodded to it, regardless of the
+   * server's umask; existing directories are not changed.
+   */
+  sftpMkdir(sftpId: string, path: string, mode?: number): Promise<void>;
+
+  /**
+   * Make sure `path` is a directory, creating it and missing parents.
+   * Rejects naming the component that exists but isn't a directory. With
+   * `mode`, the directory is chmodded to it even if it already existed.
+   */
+  sftpEnsureDir(sftpId: string, path: string, opts?: { mode?: number }): Promise<void>;
+
+  /**
+   * Remove a file or directory. Recursive removal never follows symlinks
+   * unless `followSymlinks` is set; a followed link's target contents are
+   * removed, then the link itself.
+   */
+  sftpRemove(
+    sftpId: string,
+    path: string,
+    recursive?: boolean,
+    opts?: TreeWalkOptions
+  ): Promise<void>;
+
+  /**
+   * Rename/move a file or directory. With `overwrite: true`, an existing
+   * newPath is replaced atomically via posix-rename@openssh.com; rejects
+   * with code 'SFTP_EXTENSION_UNSUPPORTED' if the server lacks it.
+   */
+  sftpRename(
+    sftpId: string,
+    oldPath: string,
+    newPath: string,
+    opts?: { overwrite?: boolean }
+  ): Promise<void>;
+
+  /**
+   * Create newPath as a hard link to oldPath (hardlink@openssh.com).
+   * Rejects with code 'SFTP_EXTENSION_UNSUPPORTED' if the server lacks it.
+   */
+  sftpHardlink(sftpId: string, oldPath: string, newPath: string): Promise<void>;
+
+  /**
+   * Capacity of the filesystem holding path, in bytes (availBytes is what
+   * an unprivileged user can still write), plus total and free inodes.
+   * Rejects with 'SFTP_EXTENSION_UNSUPPORTED' if the server lacks
+   * statvfs@openssh.com.
+   */
+  sftpStatVFS(
+    sftpId: string,
+    path: string
+  ): Promise<{ totalBytes: number; freeBytes: number; availBytes: number; files: number; ffree: number }>;
+
+  /** Target of a symbolic link, as stored (may be relative). */
+  sftpReadlink(sftpId: string, path: string): Promise<string>;
+
+  /**
+   * Create newPath as a symbolic link to target. With strictSFTPPaths the
+   * target must be absolute and free of "..", like any other path.
+   */
+  sftpSymlink(sftpId: string, target: string, newPath: string): Promise<void>;
+
+  /** Set a file's size, shrinking it or extending it with zeros. */
+  sftpTruncate(sftpId: string, path: string, size: number): Promise<void>;
 
   /** Change file permissions. */
   sftpChmod(sftpId: string, path: string, mode: number): Promise<void>;
 
+  /** Change a file's owner and group by numeric ID. */
+  sftpChown(sftpId: string, path: string, uid: number, gid: number): Promise<void>;
+
+  /**
+   * Set access and modification times (Unix milliseconds, truncated to
+   * seconds). Pass null for atime to keep the current access time.
+   */
+  sftpChtimes(sftpId: string, path: string, atimeMs: number | null, mtimeMs: number): Promise<void>;
+
+  /**
+   * Chmod a whole tree: fileMode for regular files, dirMode for directories
+   * (at least one required). Symlinks are skipped unless `followSymlinks`
+   * is set. Directories are changed after their contents. onProgress
+   * receives the running count and path.
+   */
+  sftpChmodRecursive(
+    sftpId: string,
+    path: string,
+    opts: TreeWalkOptions & {
+      fileMode?: number;
+      dirMode?: number;
+      onProgress?: (changed: number, path: string) => void;
+    }
+  ): Promise<{ files: number; dirs: number }>;
+
+  /**
+   * Run removes, chmods, and renames in order in one call. Each op gets a
+   * result at its index; a failure doesn't stop the rest unless
+   * `abortOnError` is set. Ops not run are `{ok: false, skipped: true}`.
+   */
+  sftpBatch(
+    sftpId: string,
+    ops: SFTPBatchOp[],
+    opts?: { abortOnError?: boolean; signal?: AbortSignal }
+  ): Promise<SFTPBatchResult[]>;
+
+  /**
+   * Total size of the regular files in a tree, like du. Symlinks count
+   * only with `followSymlinks`, as their targets.
+   */
+  sftpDirSize(
+    sftpId: string,
+    path: string,
+    opts?: TreeWalkOptions
+  ): Promise<{ bytes: number; files: number; dirs: number }>;
+
+  /**
+   * Download a tree one file at a time: onFile receives each regular file
+   * (max 512MB each) with its path relative to `path`, and onDir each
+   * directory after its contents. Symlinks are skipped unless
+   * `followSymlinks` is set, in which case targets arrive under the link's
+   * path.
+   */
+  sftpDownloadDir(
+    sftpId: string,
+    path: string,
+    opts: TreeWalkOptions & {
+      onFile: (path: string, data: Uint8Array) => void;
+      onDir?: (path: string) => void;
+    }
+  ): Promise<{ files: number; bytes: number }>;
+
+  /**
+   * Hex digest of a remote file, streamed through the hash without loading
+   * it into memory. crc32 is the IEEE polynomial (zip, gzip).
+   */
+  sftpChecksum(
+    sftpId: string,
+    path: string,
+    algorithm: 'sha256' | 'sha512' | 'md5' | 'crc32',
+    onProgress?: (read: number, total: number) => void,
+    signal?: AbortSignal
+  ): Promise<string>;
+
+  /**
+   * Open a remote file for random access. Returns a handle ID. Handles are
+   * closed with sftpClose and when the session closes.
+   * @param flags - fopen-style: 'r' (default), 'r+', 'w', 'w+', 'a', 'a+';
+   *   'wx'/'ax' (and '+' forms) fail if the file exists
+   */
+  sftpFileOpen(sftpId: string, path: string, flags?: string): Promise<string>;
+
+  /**
+   * Read up to length bytes (max 16MB) at offset. Shorter only at end of
+   * file; empty past it.
+   */
+  sftpFileReadAt(handleId: string, offset: number, length: number): Promise<Uint8Array>;
+
+  /** Write data (max 16MB) at offset. */
+  sftpFileWriteAt(handleId: string, offset: number, data: Uint8Array): Promise<void>;
+
+  /** Close a file handle. */
+  sftpFileClose(handleId: string): Promise<void>;
+
   /**
    * Upload data to a remote file.
    * For files > 512MB, use streaming upload APIs.
@@ -75,9 +439,25 @@ interface GoSSHAPI {
     remotePath: string,
     data: Uint8Array,
     onProgress?: (bytes: number, total: number) => void,
-    signal?: AbortSignal
+    signal?: AbortSignal,
+    opts?: TransferOptions
   ): Promise<void>;
 
+  /**
+   * Upload files below remoteBasePath, creating parent directories as
+   * needed. Entries (max 10000, each up to 512MB) are validated before
+   * anything is written; relativePath may not leave the base. On abort or
+   * error the file in progress is removed; finished files are kept.
+   * @param onProgress - Called with (bytesWritten, totalBytes) across all files
+   */
+  sftpUploadTree(
+    sftpId: string,
+    remoteBasePath: string,
+    entries: { relativePath: string; data: Uint8Array; mode?: number }[],
+    onProgress?: (bytes: number, total: number) => void,
+    signal?: AbortSignal
+  ): Promise<{ files: number; bytes: number }>;
+
   /**
    * Download a remote file into memory.
    * For files > 100MB, use sftpDownloadStream instead.
@@ -88,21 +468,92 @@ interface GoSSHAPI {
     sftpId: string,
     remotePath: string,
     onProgress?: (bytes: number, total: number) => void,
-    signal?: AbortSignal
+    signal?: AbortSignal,
+    opts?: TransferOptions
   ): Promise<Uint8Array>;
 
+  /**
+   * Download many files at once, `concurrency` (default 8, max 64) in
+   * flight over the one SFTP connection. A file that fails lands in
+   * `errors` and the rest continue, unless `abortOnError` is set, which
+   * rejects on the first failure. Files are held in memory and may total
+   * at most 512MB.
+   * @param onProgress - Called as each file completes with (filesDone,
+   *   filesTotal, bytes downloaded so far)
+   */
+  sftpDownloadBatch(
+    sftpId: string,
+    paths: string[],
+    opts?: { concurrency?: number; abortOnError?: boolean; signal?: AbortSignal },
+    onProgress?: (filesDone: number, filesTotal: number, bytes: number) => void
+  ): Promise<{ files: Record<string, Uint8Array>; errors: Record<string, string> }>;
+
   /**
    * Download a remote file via Service Worker streaming.
    * Triggers a browser download without buffering the entire file in WASM memory.
    * Requires stream_worker.js and stream_helper.js to be loaded.
-   * @param onProgress - Called with (bytesRead, totalBytes)
+   * @param onProgress - Called with (bytesRead, totalBytes) every 250ms while
+   *   the download progresses, and once more when it completes
+   * @param opts.idleTimeoutMs - Fail if the Service Worker stops pulling for
+   *   this long (default: 300000). Reset on every chunk, so large downloads
+   *   that keep progressing never time out.
    */
   sftpDownloadStream(
     sftpId: string,
     remotePath: string,
-    onProgress?: (bytes: number, total: number) => void
+    onProgress?: (bytes: number, total: number) => void,
+    opts?: TransferOptions & { idleTimeoutMs?: number }
+  ): Promise<void>;
+
+  /**
+   * Cancel a streaming download directly from the app, independent of the
+   * Service Worker. Closes the remote file and rejects the pending
+   * sftpDownloadStream promise. streamId and streamToken come from the
+   * `gossh-stream-download` event detail.
+   */
+  sftpDownloadStreamCancel(streamId: string, streamToken: string): void;
+
+  /**
+   * Follow several remote files (like `tail -f`), polling over SFTP.
+   * Starts at each file's current end. A file that shrinks, or whose last
+   * read bytes change (rotated by copytruncate or rename-and-recreate), is
+   * re-read from the start. Returns a tail ID.
+   */
+  sftpTailMany(sftpId: string, paths: string[], options: TailOptions): Promise<string>;
+
+  /** Stop a tail started by sftpTailMany. */
+  sftpTailStop(tailId: string): void;
+
+  // ──── SCP (fallback when SFTP is unavailable) ────
+
+  /**
+   * Upload data to a remote file using the SCP protocol over an exec channel.
+   * Use when sftpOpen rejects with code 'SFTP_SUBSYSTEM_UNAVAILABLE'.
+   * @param onProgress - Called with (bytesWritten, totalBytes)
+   * @param signal - AbortSignal to cancel the transfer
+   * @param options.mode - Permission bits for the created file (default 0o644)
+   */
+  scpUpload(
+    sessionId: string,
+    remotePath: string,
+    data: Uint8Array,
+    onProgress?: (bytes: number, total: number) => void,
+    signal?: AbortSignal,
+    options?: { mode?: number }
   ): Promise<void>;
 
+  /**
+   * Download a remote file into memory using the SCP protocol.
+   * @param onProgress - Called with (bytesRead, totalBytes)
+   * @param signal - AbortSignal to cancel the transfer
+   */
+  scpDownload(
+    sessionId: string,
+    remotePath: string,
+    onProgress?: (bytes: number, total: number) => void,
+    signal?: AbortSignal
+  ): Promise<Uint8Array>;
+
   // ──── Streaming Upload ────
 
   /**
@@ -116,12 +567,34 @@ interface GoSSHAPI {
    *     await GoSSH.sftpUploadStreamWrite(uploadId, chunk);
    *   }
    *   await GoSSH.sftpUploadStreamEnd(uploadId);
+   *
+   * Await each write: that is what applies backpressure. With
+   * `serialWrites: true`, a write issued before the previous one resolved
+   * fails the upload with code 'UPLOAD_WRITE_OVERLAP'.
+   *
+   * With `resume: true`, an existing remote file is kept and the upload
+   * continues after its last byte; skip the first `offset` bytes of the data.
+   * A remote file larger than `size` rejects with 'UPLOAD_RESUME_MISMATCH'.
    */
-  sftpUploadStreamStart(sftpId: string, remotePath: string, size: number): Promise<string>;
+  sftpUploadStreamStart(
+    sftpId: string,
+    remotePath: string,
+    size: number,
+    opts: { serialWrites?: boolean; resume: true }
+  ): Promise<{ uploadId: string; offset: number }>;
+  sftpUploadStreamStart(
+    sftpId: string,
+    remotePath: string,
+    size: number,
+    opts?: { serialWrites?: boolean; resume?: false }
+  ): Promise<string>;
 
-  /** Push a chunk to an active streaming upload. */
+  /** Push a chunk to an active streaming upload. Resolves once buffered. */
   sftpUploadStreamWrite(uploadId: string, chunk: Uint8Array): Promise<void>;
 
+  /** Buffer fill level of an active streaming upload, or null if unknown. */
+  sftpUploadStreamStatus(uploadId: string): UploadStreamStatus | null;
+
   /** Finalize a streaming upload (waits for all writes to complete). */
   sftpUploadStreamEnd(uploadId: string): Promise<void>;
 
@@ -145,6 +618,56 @@ interface GoSSHAPI {
   /** List all active port forwards for a session. */
   portForwardList(sessionId: string): TunnelInfo[];
 
+  /**
+   * Remote port forwarding (-R): the SSH server listens on
+   * remoteBindAddr:remotePort and each connection is handed to
+   * onConnection. Write and close accepted connections with channelWrite /
+   * channelClose. Stopped automatically when the session closes.
+   */
+  portForwardRemoteStart(
+    sessionId: string,
+    config: RemoteForwardConfig
+  ): Promise<{ id: string; bindAddr: string; port: number }>;
+
+  /** Stop a remote forward and close its connections. */
+  portForwardRemoteStop(forwardId: string): void;
+
+  // ──── Diagnostics ────
+
+  /**
+   * Turn goroutine accounting on (default) or off. Off until called; only
+   * goroutines started while it is on are counted.
+   */
+  enableDiagnostics(enabled?: boolean): void;
+
+  /**
+   * Live goroutines by what started them (e.g. "session.stdout",
+   * "sftp.tail"). A count that keeps growing points at a leak.
+   */
+  diagnostics(): { enabled: boolean; goroutines: Record<string, number> };
+
+  /**
+   * Go heap statistics (bytes) and the bytes the package holds for
+   * in-progress work: in-memory downloads, queued streaming-upload chunks,
+   * and aggregated exec output. WASM memory never shrinks, so heapSys is
+   * the high-water mark the tab keeps.
+   */
+  memStats(): MemStats;
+
+  /**
+   * Force a garbage collection. A stopgap for WASM's memory model: memory
+   * never shrinks, but freed heap is reused by the next transfer instead of
+   * growing the instance again. Useful between large in-memory transfers.
+   */
+  collectGarbage(): void;
+
+  /**
+   * Collect garbage automatically after each in-memory transfer (upload,
+   * download, scp, tree operations) of at least thresholdBytes. 0 (the
+   * default) turns it off.
+   */
+  setAutoCollectGarbage(thresholdBytes: number): void;
+
   // ──── Internal (used by Service Worker) ────
 
   /** @internal Pull next chunk for streaming download. */
@@ -154,6 +677,150 @@ interface GoSSHAPI {
   _streamCancel(streamId: string, streamToken: string): void;
 }
 
+interface MemStats {
+  /** Bytes of live heap objects */
+  heapAlloc: number;
+  /** Heap memory obtained from the WASM instance */
+  heapSys: number;
+  /** Bytes in in-use heap spans */
+  heapInuse: number;
+  /** Total memory obtained by the Go runtime */
+  sys: number;
+  /** Completed GC cycles */
+  numGC: number;
+  held: { downloads: number; uploads: number; exec: number; total: number };
+}
+
+type AuthMethodName = 'password' | 'key' | 'agent' | 'keyboard-interactive';
+
+interface AuthProgress {
+  /** SSH auth method being tried ('key' and 'agent' are both 'publickey') */
+  method: 'publickey' | 'password' | 'keyboard-interactive';
+  /** 1 for the first method tried, counting up; keyboard-interactive counts each round */
+  attempt: number;
+}
+
+type HostKeyFingerprintFormat = 'sha256' | 'md5' | 'sha1' | 'sha512' | 'sha256-hex' | 'blake2b-256';
+
+interface RandomArtGrid {
+  width: number;
+  height: number;
+  /** Top border title, e.g. 'SSH-ED25519 256' */
+  title: string;
+  /** Hash the walk used: 'SHA256' or 'MD5' */
+  hash: string;
+  /** height rows of width cells */
+  rows: RandomArtCell[][];
+}
+
+interface RandomArtCell {
+  /** The character the text form uses here */
+  char: string;
+  /** Times the walk crossed the cell, and that scaled to 0–1; absent on markers */
+  visits?: number;
+  intensity?: number;
+  /** Where the walk started and ended */
+  marker?: 'start' | 'end';
+}
+
+type SFTPBatchOp =
+  | { op: 'remove'; path: string; recursive?: boolean }
+  | { op: 'chmod'; path: string; mode: number }
+  | { op: 'rename'; oldPath: string; newPath: string; overwrite?: boolean };
+
+interface SFTPBatchResult {
+  ok: boolean;
+  /** Why the op failed */
+  error?: string;
+  code?: string;
+  /** Not run: an earlier op failed with abortOnError, or the signal aborted */
+  skipped?: boolean;
+}
+
+type SSHEvent =
+  | { type: 'banner'; banner: string }
+  | { type: 'keepalive_failed'; attempt: number; error: string }
+  | { type: 'keepalive_recovered'; attempts: number }
+  | { type: 'pty_resized'; channelId: string; cols: number; rows: number }
+  | { type: 'connection_lost'; reason: string }
+  | { type: 'reconnecting'; attempt?: number }
+  | { type: 'reconnected'; attempt?: number }
+  | { type: 'reconnect_failed'; attempt?: number; error: string }
+  | {
+      type: 'host_key_changed';
+      previousKeyType: string;
+      previousFingerprint: string;
+      keyType: string;
+      fingerprint: string;
+    }
+  | ({ type: 'closed' } & SSHCloseDetails);
+
+/**
+ * Why a session closed. When the shell ended with an exit status (e.g. a
+ * single command run as the shell), exitCode is set, and exitSignal when
+ * a signal killed it; both are absent if the server sent no status.
+ */
+interface GrepOptions {
+  pattern: string;
+  path?: string;
+  flags?: {
+    fixed?: boolean;
+    ignoreCase?: boolean;
+    /** Match whole words only */
+    word?: boolean;
+    /** One match per file, without line and text */
+    filesOnly?: boolean;
+  };
+  maxResults?: number;
+  onMatch?: (match: GrepMatch) => void;
+  signal?: AbortSignal;
+}
+
+/** A matching line; `text` is capped at 4096 bytes. Only `file` is set with filesOnly. */
+interface GrepMatch {
+  file: string;
+  line?: number;
+  text?: string;
+}
+
+interface SSHCloseDetails {
+  reason: string;
+  exitCode?: number;
+  exitSignal?: string;
+}
+
+interface SSHSessionInfo {
+  /** Server identification string, e.g. 'SSH-2.0-OpenSSH_9.6' */
+  serverVersion: string;
+  clientVersion: string;
+  /** Cipher and MAC for data sent to the server; mac is '' for AEAD ciphers */
+  cipher: string;
+  mac: string;
+  /** Cipher and MAC for data from the server, usually the same */
+  readCipher: string;
+  readMac: string;
+  kex: string;
+  /** Host key type, e.g. 'ssh-rsa' */
+  hostKeyType: string;
+  /** Host key signature algorithm, e.g. 'rsa-sha2-512' */
+  hostKeyAlgorithm: string;
+  /** SHA256:... */
+  hostKeyFingerprint: string;
+  /** WebSocket subprotocol the proxy selected ('' if none) */
+  wsProtocol: string;
+}
+
+interface SSHAlgorithms {
+  /** e.g. ['chacha20-poly1305@openssh.com', 'aes256-gcm@openssh.com'] */
+  ciphers?: string[];
+  /** e.g. ['hmac-sha2-256-etm@openssh.com'] */
+  macs?: string[];
+  /** e.g. ['curve25519-sha256'] */
+  keyExchanges?: string[];
+  /** Host key signature algorithms, e.g. ['ssh-ed25519'] */
+  hostKeyAlgorithms?: string[];
+}
+
 interface SSHConnectConfig {
   /** WebSocket proxy URL (e.g., wss://proxy.example.com/relay) */
   proxyUrl: string;
@@ -163,16 +830,93 @@ interface SSHConnectConfig {
   port?: number;
   /** SSH username */
   username: string;
-  /** Authentication method */
-  authMethod: 'password' | 'key' | 'agent';
+  /**
+   * Authentication method, or several tried in order as the server allows
+   * (e.g. ['agent', 'password']). In a list, a method that can't be used
+   * (no agent keys, agent locked, no password) is skipped with a warning.
+   * 'key' and 'agent' both use publickey and are offered together.
+   */
+  authMethod: AuthMethodName | AuthMethodName[];
+  /** Called as each auth method starts; a later attempt means the earlier one didn't succeed */
+  onAuthProgress?: (info: AuthProgress) => void;
   /** Password for password auth */
   password?: string;
+  /**
+   * Supplies a new password when the server says `password` has expired
+   * and asks for a change over keyboard-interactive (as PAM does): prompts
+   * for the current password are answered with `password`, those for the
+   * new one with what this resolves to. Called at most once per connect;
+   * tried after the other methods unless keyboard-interactive is
+   * configured, when onKeyboardInteractive sees the prompts instead.
+   * Servers that send the SSH password change request itself fail with
+   * code 'PASSWORD_CHANGE_REQUIRED'.
+   */
+  onPasswordChange?: (info: { prompt: string; instruction: string }) => string | Promise<string>;
   /** PEM-encoded private key for key auth */
   keyPEM?: string;
   /** Passphrase for encrypted private key */
   keyPassphrase?: string;
-  /** Enable SSH agent forwarding */
+  /**
+   * Offer at most this many agent keys, in the order they were added
+   * (default: all). Servers count each rejected key as a failed attempt and
+   * disconnect past MaxAuthTries (OpenSSH default 6), which rejects with
+   * code 'TOO_MANY_AUTH_FAILURES'.
+   */
+  agentMaxKeys?: number;
+  /**
+   * Offer only the agent key with this SHA256 fingerprint: one attempt
+   * instead of one per key. Connect rejects if the key isn't loaded.
+   */
+  agentKeyFingerprint?: string;
+  /**
+   * Answer a keyboard-interactive challenge round with one answer per
+   * question. Required for keyboard-interactive auth; called once per round
+   * (e.g. password, then OTP). Each round times out after 5 minutes.
+   */
+  onKeyboardInteractive?: KeyboardInteractiveCallback;
+  /**
+   * Enable SSH agent forwarding on the shell and, by default, on exec
+   * channels opened later. SFTP channels never request forwarding.
+   */
   agentForward?: boolean;
+  /**
+   * Scope agent forwarding to these downstream host key fingerprints
+   * (SHA256:...). A signature is allowed only when the remote ssh client
+   * bound the request to one of these hosts (session-bind@openssh.com,
+   * OpenSSH 8.9+). Other requests go to onAgentForwardConfirm, or are denied.
+   * The remote can never add, remove, or lock keys in a scoped forward.
+   */
+  agentForwardHosts?: string[];
+  /**
+   * Confirm a forwarded signature whose destination is unknown. Setting
+   * this without agentForwardHosts confirms every forwarded signature.
+   */
+  onAgentForwardConfirm?: (info: AgentForwardConfirmInfo) => boolean | Promise<boolean>;
+  /**
+   * Coalesce queued WebSocket messages into one read (default true). Set
+   * false to hand each message to SSH as soon as it arrives, trading bulk
+   * throughput for slightly lower keystroke latency.
+   */
+  coalesceReads?: boolean;
+  /**
+   * WebSocket buffer sizes. readBufferFrames (64–65536, default 4096) is
+   * how many received messages may queue for SSH; a burst beyond that is
+   * held in an overflow queue of up to overflowBytes (64 KiB–256 MiB,
+   * default 16 MiB), and only when that is full is the connection closed
+   * as overrun. writeChunkBytes (1 KiB–256 KiB, default 4 KiB) is the most
+   * sent per message; maxMessageBytes (64 KiB–64 MiB, default 8 MiB) is
+   * the largest message accepted. Connect rejects values out of range.
+   */
+  transport?: {readBufferFrames?: number; overflowBytes?: number; writeChunkBytes?: number; maxMessageBytes?: number};
+  /**
+   * Reuse a live connection to the same host, user, and credentials (and
+   * jump host) instead of dialing, opening only a new channel on it. The
+   * connection stays open for ttlMs (default 60000, max 3600000) after its
+   * last session closes. Host key checks, onBanner, onStall, and transport
+   * options apply only when a connection is dialed. Ignored for
+   * keyboard-interactive auth and scoped agent forwarding.
+   */
+  pool?: boolean | { ttlMs?: number };
   /**
    * Allow ws:// proxy URLs for development only.
    * Production should always use wss://.
@@ -188,42 +932,436 @@ interface SSHConnectConfig {
    * When true, paths must be absolute and cannot contain '..' segments.
    */
   strictSFTPPaths?: boolean;
+  /**
+   * Cap on shell input in bytes per second, with bursts of up to one
+   * second's worth. write drops input over the cap and returns an
+   * 'INPUT_RATE_LIMITED' error; sendText slows down instead. Default:
+   * unlimited.
+   */
+  inputRateLimit?: number;
   /**
    * Jump host (ProxyJump) configuration.
    * If provided, connects through the bastion host first.
    */
   jumpHost?: JumpHostConfig;
+  /**
+   * Open an interactive shell with a PTY (default: true). With false the
+   * session is for sftpOpen/exec only: no PTY or shell channel is opened,
+   * and write/resize are no-ops.
+   */
+  shell?: boolean;
+  /** TERM requested for the PTY (default: xterm-256color) */
+  term?: string;
+  /**
+   * Environment variables set on the shell (max 64). Servers only accept
+   * names listed in their AcceptEnv; refused ones are logged and skipped.
+   */
+  env?: Record<string, string>;
+  /**
+   * Called once the shell's env has been sent (and again after reconnect)
+   * with the names the server accepted and refused, each sorted.
+   */
+  onEnv?: (result: { accepted: string[]; rejected: string[] }) => void;
   /** Terminal columns (default: 80) */
   cols?: number;
   /** Terminal rows (default: 24) */
   rows?: number;
   /** JWT token for proxy authentication */
   token?: string;
+  /**
+   * WebSocket subprotocols to offer (Sec-WebSocket-Protocol). Each must be
+   * an HTTP token. The proxy must select one, or the browser fails the
+   * connection; sshSessionInfo reports which as wsProtocol.
+   */
+  wsSubprotocols?: string[];
+  /**
+   * Token offered as one more subprotocol, 'base64url.bearer.' followed by
+   * the token base64url-encoded without padding, for proxies that read
+   * auth from Sec-WebSocket-Protocol since browsers can't set headers.
+   * The proxy should select a protocol from wsSubprotocols, not this one.
+   */
+  wsProtocolAuth?: string;
 
-  /** Called with terminal output data */
-  onData: (data: Uint8Array) => void;
-  /** Called when the connection closes */
-  onClose: (reason: string) => void;
+  /** Called with terminal output data (optional when lineMode is set) */
+  onData?: (data: Uint8Array) => void;
+  /**
+   * Give the shell's stderr its own stream, delivered to onStderr, instead
+   * of dropping it. With a PTY most servers merge stderr into stdout;
+   * this catches what they keep apart. onClose comes after both streams
+   * have ended.
+   */
+  separateStderr?: boolean;
+  /** Called with shell stderr data when separateStderr is set */
+  onStderr?: (data: Uint8Array) => void;
+  /**
+   * Deliver output as complete lines via onLine. Handles both "\r\n" and
+   * "\n"; a partial line is flushed when the session closes.
+   */
+  lineMode?: boolean;
+  /** Called once per output line (without terminator) when lineMode is set */
+  onLine?: (line: string) => void;
+  /** Force-emit a line after this many bytes without a newline (default 65536) */
+  maxLineLength?: number;
+  /** Called when the connection closes, with the shell's exit status if it ended */
+  onClose: (reason: string, details: SSHCloseDetails) => void;
+  /**
+   * Structured lifecycle events: keepalive failures, reconnects, PTY
+   * resizes, the banner, and close (just before onClose). Called from the
+   * goroutine that saw the event; don't block in it.
+   */
+  onEvent?: (event: SSHEvent) => void;
+  /**
+   * Reconnect on its own when the connection is lost (keepalive failure,
+   * dropped WebSocket), as reconnect() does: same config and auth, a new
+   * shell at the last size. `true` means {maxRetries: 5, backoffMs: 1000};
+   * the delay doubles after each attempt, up to 30 s. onClose fires only
+   * once every attempt has failed. The new shell is a fresh login: remote
+   * scrollback and running programs are gone, and SFTP sessions and
+   * forwards must be opened again.
+   */
+  autoReconnect?: boolean | { maxRetries?: number; backoffMs?: number };
+  /** Called as each autoReconnect attempt starts (1-based) */
+  onReconnect?: (attempt: number) => void;
+  /**
+   * What a reconnect does when the server presents a different host key
+   * (or key type, e.g. ed25519 → ssh-rsa) than the session was opened
+   * with. 'reject' (default) fails the attempt with HOST_KEY_CHANGED
+   * before authenticating; 'warn' emits a host_key_changed event and
+   * verifies the new key as a first connect would. The original key is
+   * accepted without calling onHostKey again.
+   */
+  reconnectHostKeyPolicy?: 'reject' | 'warn';
+  /**
+   * Keepalive pings: every intervalMs (default 30000, min 1000; 0 turns
+   * them off), each failing after timeoutMs without a reply (default
+   * 15000). maxFailures in a row (default 3) close the session, or start
+   * autoReconnect.
+   */
+  keepalive?: { intervalMs?: number; timeoutMs?: number; maxFailures?: number };
+  /**
+   * Cancels the connect: a pending onHostKey prompt is rejected, the
+   * transport closed, and connect rejects with code CONNECT_ABORTED.
+   * Has no effect once connect has resolved.
+   */
+  signal?: AbortSignal;
   /**
    * Called for host key verification.
    * Return true to accept the key, false to reject.
-   * Required unless allowInsecureHostKey is set.
+   * Required unless allowInsecureHostKey is set. With knownHosts, only
+   * called for hosts that aren't listed.
    */
   onHostKey?: (info: HostKeyInfo) => Promise<boolean>;
+  /**
+   * Extra formats for HostKeyInfo.fingerprints, beyond sha256 and md5:
+   * e.g. ['sha1', 'sha256-hex'] to match an external inventory.
+   */
+  hostKeyFingerprints?: HostKeyFingerprintFormat[];
+  /**
+   * OpenSSH known_hosts content to verify host keys against. A listed key
+   * connects without onHostKey; a different key of the same type fails
+   * with code 'HOST_KEY_CHANGED'; @revoked keys fail. Hashed entries and
+   * wildcard/negated patterns are supported.
+   */
+  knownHosts?: string;
+  /**
+   * Called with a known_hosts line for a key accepted through onHostKey,
+   * for the app to persist and pass back as knownHosts next time.
+   */
+  onHostKeyAdd?: (line: string) => void;
+  /**
+   * Trust on first use with per-host storage: asked for the host's
+   * known_hosts lines ('host' or '[host]:port', as in known_hosts) when
+   * its key is checked, alongside knownHosts. Return null for a host never
+   * seen: onHostKey is then asked, and an accepted key goes to
+   * onHostKeyLearn. A listed key connects silently and a different one
+   * fails with code 'HOST_KEY_CHANGED'. Rejecting, or returning anything
+   * but a string or null, fails the connection. Waited on for 30 s.
+   */
+  onHostKeyLookup?: (host: string) => string | null | Promise<string | null>;
+  /** Called with the host and known_hosts line of a key accepted through onHostKey, to persist for onHostKeyLookup */
+  onHostKeyLearn?: (host: string, line: string) => void;
   /** Called with the SSH server banner */
   onBanner?: (banner: string) => void;
+  /**
+   * Called when data was sent but nothing has been received for
+   * stallTimeoutMs (e.g. a hung rekey or a dead network path), and again
+   * with recovered: true once traffic resumes. Outstanding data is probed
+   * with a keepalive first, so input that gets no reply (e.g. a password
+   * typed with echo off) doesn't count. Idle sessions don't stall.
+   */
+  onStall?: (info: StallInfo) => void;
+  /** Stall window in milliseconds (default: 15000, minimum: 1000) */
+  stallTimeoutMs?: number;
+  /**
+   * X11 forwarding (ssh -X): the shell requests it, and each X11
+   * connection from the remote is bridged to `endpoint`, a WebSocket that
+   * speaks the X protocol (e.g. websockify in front of an X server). The
+   * server only sees a random cookie; `cookie` (32 hex digits) is the
+   * display's real MIT-MAGIC-COOKIE-1, substituted into each connection.
+   * Without it, connections reach the X server with no authorization.
+   */
+  x11Forward?: { endpoint: string; cookie?: string; screen?: number };
+  /**
+   * Called when the server opens an X11 channel (a remote GUI program
+   * connecting to the display). Without x11Forward the channel is then
+   * rejected, so this reports attempts that would otherwise fail silently.
+   */
+  onX11Request?: (info: X11RequestInfo) => void;
+  /**
+   * Rekey after this many bytes (default: 1 GB). Larger values avoid
+   * periodic rekey pauses on big transfers; smaller ones rekey more often.
+   * Must be an integer from 256 to 2^53-1.
+   */
+  rekeyThreshold?: number;
+  /**
+   * Restrict or reorder negotiated algorithms (default: the library's).
+   * Lists are in preference order; unknown names reject with the list of
+   * supported ones. Legacy names such as 'aes128-cbc' or
+   * 'diffie-hellman-group14-sha1' are accepted for old servers.
+   */
+  algorithms?: SSHAlgorithms;
+  /** WebSocket dial timeout in milliseconds, per hop (default: 30000) */
+  dialTimeoutMs?: number;
+  /**
+   * SSH handshake timeout in milliseconds, per hop (default: 30000). It
+   * covers the exchange up to host key verification; time spent in
+   * onHostKey and authentication prompts isn't counted.
+   */
+  handshakeTimeoutMs?: number;
+}
+
+interface X11RequestInfo {
+  /** Address of the X client on the remote side, as reported by the server */
+  originatorAddress: string;
+  originatorPort: number;
+}
+
+interface StallInfo {
+  /** How long sent data has gone unanswered */
+  stalledMs: number;
+  /** true when traffic resumed after a reported stall */
+  recovered: boolean;
 }
 
+interface SSHConnectFullConfig extends SSHConnectConfig {
+  /** Also open SFTP: true, or options as for sftpOpen */
+  sftp?: boolean | SFTPOpenOptions;
+}
+
+interface KeyboardInteractiveChallenge {
+  name: string;
+  instruction: string;
+  /** Empty for informational rounds, whose result is ignored */
+  questions: { prompt: string; echo: boolean }[];
+}
+
+type KeyboardInteractiveCallback = (
+  challenge: KeyboardInteractiveChallenge
+) => string[] | Promise<string[]>;
+
 interface HostKeyInfo {
   hostname: string;
   /** SHA256 fingerprint (e.g., SHA256:xxx...) */
   fingerprint: string;
   /** MD5 fingerprint (e.g., MD5:xx:xx:...) */
   fingerprintMD5: string;
+  /**
+   * The fingerprint by format: sha256 and md5 always, plus those asked for
+   * in hostKeyFingerprints. sha1, sha512, and blake2b-256 are NAME:base64
+   * like sha256; sha256-hex is colon-separated hex.
+   */
+  fingerprints: Partial<Record<HostKeyFingerprintFormat, string>>;
   /** Key type (e.g., ssh-ed25519, ssh-rsa) */
   keyType: string;
-  /** ASCII art visualization of the key (OpenSSH Bishop algorithm) */
+  /** ASCII art of the MD5 fingerprint (OpenSSH Bishop algorithm), kept for compatibility */
   randomArt: string;
+  /** ASCII art of the SHA256 fingerprint, as ssh shows it */
+  randomArtSHA256: string;
+  /**
+   * Server identification banner (e.g. "SSH-2.0-OpenSSH_9.6"), the same
+   * string later passed to onBanner. The pre-auth message (Banner in
+   * sshd_config) is sent only after the host key is accepted.
+   */
+  banner?: string;
+}
+
+interface AgentForwardConfirmInfo {
+  /** SHA256 fingerprint of the agent key the remote wants to use */
+  keyFingerprint: string;
+  /** Key type (e.g., ssh-ed25519) */
+  keyType: string;
+}
+
+interface UploadStreamStatus {
+  /** Chunks queued for the remote writer */
+  buffered: number;
+  /** Queue capacity; writes block once it is full */
+  capacity: number;
+  /** sftpUploadStreamWrite calls not yet resolved */
+  pendingWrites: number;
+  /** Bytes written to the remote file so far */
+  written: number;
+  /** Declared upload size */
+  size: number;
+}
+
+interface ChannelOptions {
+  /** Channel data */
+  onData?: (data: Uint8Array) => void;
+  /** Extended data (e.g. stderr); discarded if unset */
+  onExtendedData?: (data: Uint8Array) => void;
+  /**
+   * Channel requests from the server. Return true to accept; unset or
+   * non-boolean results refuse the request.
+   */
+  onRequest?: (req: { type: string; wantReply: boolean; payloadBase64: string }) => boolean;
+  /** Called once when the channel closes */
+  onClose?: () => void;
+}
+
+interface SendTextOptions {
+  /** Bytes per chunk, split on character boundaries (default 256) */
+  chunkSize?: number;
+  /** Pause between chunks in milliseconds (default 10) */
+  interChunkDelayMs?: number;
+  /** Wait for shell output (the echo) after each chunk before continuing */
+  waitForEcho?: boolean;
+  /** Longest wait for echo in milliseconds (default 1000) */
+  echoTimeoutMs?: number;
+  /** Stop sending; the call rejects */
+  signal?: AbortSignal;
+}
+
+interface ExecOptions {
+  /**
+   * Environment variables (max 64); the server must accept them
+   * (AcceptEnv). Values with CR, LF, or NUL are rejected, as for the shell.
+   */
+  env?: Record<string, string>;
+  /**
+   * Called once env has been sent with the names the server accepted and
+   * refused, each sorted. With it, a refused name no longer fails the call.
+   */
+  onEnv?: (result: { accepted: string[]; rejected: string[] }) => void;
+  /** Close the channel; the call rejects with "exec: aborted" */
+  signal?: AbortSignal;
+  /**
+   * Remove terminal escape sequences from the output, including the live
+   * onData/onStderr chunks; a sequence split across chunks is still removed
+   */
+  stripAnsi?: boolean;
+  /** Set false to skip agent forwarding for this command (default: the connection's agentForward) */
+  agentForward?: boolean;
+  /**
+   * Run the command with a PTY (default 80x24, xterm-256color). Its output
+   * then all arrives on stdout. Resize it with `resize(sessionId, cols,
+   * rows, channelId)` using the ID from onPtyOpen.
+   */
+  pty?: { cols?: number; rows?: number; term?: string };
+  /** Called with the PTY's channel ID once it is allocated, before the command starts */
+  onPtyOpen?: (channelId: string) => void;
+  /** Live stdout chunks */
+  onData?: (data: Uint8Array) => void;
+  /** Live stderr chunks */
+  onStderr?: (data: Uint8Array) => void;
+  /** Collect output for the result (default true); false leaves stdout/stderr empty */
+  aggregate?: boolean;
+  /**
+   * Report the command's time on the server in `remote`. The command then
+   * runs under `sh -c` instead of the login shell, so it must be POSIX sh
+   * syntax, between two `date` calls and followed by the `times` builtin.
+   */
+  measureRemote?: boolean;
+}
+
+interface ExecResult {
+  stdout: string;
+  stderr: string;
+  exitCode: number;
+  /** Signal name (e.g. "TERM") when the command was killed by a signal */
+  exitSignal?: string;
+  /** True if stdout or stderr exceeded the aggregation cap and was cut short */
+  truncated: boolean;
+  /** Client clock when the command was started, in Unix milliseconds */
+  startedAt: number;
+  /** Client-side wall time, including network round-trips */
+  durationMs: number;
+  /**
+   * Remote CPU and real time with measureRemote; null if it couldn't be
+   * measured. realMs is whole seconds where the server's date lacks %N,
+   * and absent without date.
+   */
+  remote?: { userMs: number; sysMs: number; realMs?: number } | null;
+}
+
+/** Error rejected by GoSSH APIs. `code` is set for distinguishable failures. */
+interface GoSSHError extends Error {
+  code?:
+    | 'SFTP_SUBSYSTEM_UNAVAILABLE'
+    | 'UPLOAD_WRITE_OVERLAP'
+    | 'UPLOAD_RESUME_MISMATCH'
+    | 'SYMLINK_LOOP'
+    | 'SFTP_EXTENSION_UNSUPPORTED'
+    | 'HOST_KEY_CHANGED'
+    | 'TOO_MANY_AUTH_FAILURES'
+    | 'PASSWORD_CHANGE_REQUIRED'
+    | 'INPUT_RATE_LIMITED'
+    | 'CONNECT_ABORTED'
+    | 'SFTP_READ_ONLY'
+    | 'SFTP_OUTSIDE_ROOT'
+    | 'WS_DIAL_FAILED'
+    | 'WS_DIAL_TIMEOUT'
+    | 'WS_PROXY_REJECTED';
+}
+
+interface SFTPOpenOptions {
+  /**
+   * Reuse an existing SFTP session on this SSH session if one is open. The
+   * shared ID is reference counted: call sftpClose once per sftpOpen.
+   * Only a session with the same readOnly setting is reused.
+   */
+  reuse?: boolean;
+  /**
+   * Reject everything that would change the remote (mkdir, remove,
+   * rename, chmod/chown/chtimes, symlinks, truncate, uploads, batches, and
+   * file handles opened for writing) with code 'SFTP_READ_ONLY'. Listing,
+   * stat, reads, and downloads work as usual.
+   */
+  readOnly?: boolean;
+  /**
+   * Confine the session to this directory, which must exist. Every path
+   * must then be absolute and under it, both as given and once the
+   * server resolves symlinks (including rename's two paths and symlink
+   * targets); anything else rejects with code 'SFTP_OUTSIDE_ROOT'. Tree
+   * walks with followSymlinks reject on a link that leads out (sftpFind
+   * lists it as a link instead), and sftpRealPath rejects on one. Checks
+   * run before each request, so they cost a realpath round trip and
+   * can't stop another process swapping a symlink in between; for a hard
+   * boundary, chroot the server. Only a session with the same rootPrefix
+   * is reused.
+   */
+  rootPrefix?: string;
+}
+
+interface TailOptions {
+  /** Poll interval in milliseconds (default 1000, minimum 100) */
+  pollMs?: number;
+  /** Called with newly appended bytes, tagged with the source path */
+  onData: (chunk: { path: string; bytes: Uint8Array }) => void;
+  /** Called once when a file starts failing (e.g. missing, permission denied) */
+  onError?: (error: { path: string; message: string }) => void;
+}
+
+interface TreeWalkOptions {
+  /**
+   * Descend into symlinked directories (default false). Directories are
+   * tracked by resolved path, so one reached twice is walked once, and a
+   * link back into a directory being walked rejects with code
+   * 'SYMLINK_LOOP'. Walks are limited to 256 levels.
+   */
+  followSymlinks?: boolean;
+  /** Abort the walk between entries */
+  signal?: AbortSignal;
 }
 
 interface FileInfo {
@@ -237,6 +1375,52 @@ interface FileInfo {
   permissions: string;
   /** Last modification time in Unix milliseconds */
   modTime: number;
+  /**
+   * Canonical path with symlinks and `..` resolved; only present when
+   * requested with `realPath: true`, and null for an unresolvable link
+   * or, under a rootPrefix, one that leads outside it.
+   */
+  realPath?: string | null;
+}
+
+interface TransferOptions {
+  /**
+   * Size chunks from measured throughput instead of a fixed 64KB: start at
+   * 16KB, double while chunks complete quickly (up to 4MB), and halve on
+   * stalls. Helps both fast, high-latency links and slow mobile ones.
+   */
+  adaptiveChunks?: boolean;
+}
+
+interface AddKeyOptions {
+  /** Remove the key from the agent after this many seconds (default: never) */
+  lifetimeSecs?: number;
+  /**
+   * Require onAgentSignConfirm to approve every signature with this key,
+   * for authentication and forwarded agent requests alike (ssh-add -c).
+   */
+  confirmBeforeUse?: boolean;
+  /**
+   * Approve a signature with the key. Resolve true to sign; anything else,
+   * or no answer within 2 minutes, refuses. Required with confirmBeforeUse.
+   */
+  onAgentSignConfirm?: (fingerprint: string) => boolean | Promise<boolean>;
+}
+
+interface GenerateKeyOptions {
+  type?: 'ed25519' | 'ecdsa' | 'rsa';
+  /** ecdsa: 256 (default), 384, 521. rsa: 2048, 3072 (default), 4096 */
+  bits?: number;
+  comment?: string;
+}
+
+interface GeneratedKey {
+  /** SHA256 fingerprint */
+  fingerprint: string;
+  /** authorized_keys line, e.g. "ssh-ed25519 AAAA... comment" */
+  publicKeyOpenSSH: string;
+  /** Unencrypted OpenSSH private key */
+  privateKeyPEM: string;
 }
 
 interface KeyInfo {
@@ -250,6 +1434,10 @@ interface KeyInfo {
   bits: number;
   /** ASCII art visualization of the key (OpenSSH Bishop algorithm) */
   randomArt: string;
+  /** Signatures with this key need onAgentSignConfirm approval */
+  confirmBeforeUse: boolean;
+  /** The agent is locked: the key can't sign until agentUnlock */
+  locked: boolean;
 }
 
 interface JumpHostConfig {
@@ -259,20 +1447,34 @@ interface JumpHostConfig {
   port?: number;
   /** Jump host SSH username */
   username: string;
-  /** Authentication method for jump host */
-  authMethod: 'password' | 'key' | 'agent';
+  /** Authentication method(s) for jump host, tried in order */
+  authMethod: AuthMethodName | AuthMethodName[];
+  /** Called as each jump host auth method starts */
+  onAuthProgress?: (info: AuthProgress) => void;
   /** Password for jump host password auth */
   password?: string;
+  /** New password when the jump host's has expired; see SSHConnectConfig.onPasswordChange */
+  onPasswordChange?: (info: { prompt: string; instruction: string }) => string | Promise<string>;
+  /** Challenge callback for jump host keyboard-interactive auth */
+  onKeyboardInteractive?: KeyboardInteractiveCallback;
   /** PEM-encoded private key for jump host key auth */
   keyPEM?: string;
   /** Passphrase for jump host encrypted key */
   keyPassphrase?: string;
+  /** Offer at most this many agent keys to the jump host (default: all) */
+  agentMaxKeys?: number;
+  /** Offer only this agent key (SHA256 fingerprint) to the jump host */
+  agentKeyFingerprint?: string;
   /** WebSocket proxy URL for jump host connection */
   proxyUrl: string;
   /** JWT token for proxy auth */
   token?: string;
   /** Allow ws:// jump proxy URL for development only */
   allowInsecureWS?: boolean;
+  /** Rekey threshold in bytes for the jump host connection */
+  rekeyThreshold?: number;
+  /** Algorithm preferences for the jump host connection */
+  algorithms?: SSHAlgorithms;
 }
 
 interface PortForwardConfig {
@@ -286,6 +1488,35 @@ interface PortForwardConfig {
   token?: string;
   /** Allow ws:// tunnel proxy URL for development only */
   allowInsecureWS?: boolean;
+  /**
+   * Largest forwarded HTTP response, headers included, in bytes (default
+   * 10 MiB, 64 KiB to 256 MiB). A larger one is answered with 502 and an
+   * `X-GoSSH-Error: response-too-large` header rather than truncated.
+   */
+  maxResponseBytes?: number;
+}
+
+interface RemoteForwardConfig {
+  /** Address to listen on at the server (default: localhost) */
+  remoteBindAddr?: string;
+  /** Port to listen on; 0 lets the server choose (see the resolved port) */
+  remotePort: number;
+  /**
+   * Called for each accepted connection. Return handlers to accept it, or
+   * a falsy value to refuse. Must settle within 30 seconds.
+   */
+  onConnection: (conn: {
+    channelId: string;
+    originAddr: string;
+    originPort: number;
+  }) => RemoteConnectionHandlers | null | undefined | Promise<RemoteConnectionHandlers | null | undefined>;
+}
+
+interface RemoteConnectionHandlers {
+  /** Data from the remote peer */
+  onData?: (data: Uint8Array) => void;
+  /** Called once when the connection closes */
+  onClose?: () => void;
 }
 
 interface TunnelInfo {
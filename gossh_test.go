@@ -8,10 +8,45 @@
 package gossh
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	pathpkg "path"
+	"reflect"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"syscall/js"
 	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 // ────────────────────────────────────────────────────────────────────
@@ -138,29 +173,6 @@ func TestContainsCRLF(t *testing.T) {
 	}
 }
 
-func TestIsTextContentType(t *testing.T) {
-	tests := []struct {
-		ct   string
-		want bool
-	}{
-		{"text/html", true},
-		{"text/plain", true},
-		{"application/json", true},
-		{"application/xml", true},
-		{"text/javascript", true},
-		{"application/octet-stream", false},
-		{"image/png", false},
-		{"", false},
-	}
-
-	for _, tt := range tests {
-		got := isTextContentType(tt.ct)
-		if got != tt.want {
-			t.Errorf("isTextContentType(%q) = %v, want %v", tt.ct, got, tt.want)
-		}
-	}
-}
-
 func TestFindHeaderEnd(t *testing.T) {
 	tests := []struct {
 		s    string
@@ -193,6 +205,36 @@ func TestSplitLines(t *testing.T) {
 	}
 }
 
+func TestParseResponseHeaders(t *testing.T) {
+	got := parseResponseHeaders([]string{
+		"Set-Cookie: session=abc; Path=/; HttpOnly",
+		"Content-Type:text/html",
+		"set-cookie: theme=dark, light; Path=/",
+		"X-Folded: first",
+		" \tsecond",
+		"Vary: Accept",
+		"Vary:  Origin\t",
+		"no colon here",
+		"Bad Name: x",
+	})
+	want := []httpHeader{
+		{"Set-Cookie", "session=abc; Path=/; HttpOnly"},
+		{"Content-Type", "text/html"},
+		{"set-cookie", "theme=dark, light; Path=/"},
+		{"X-Folded", "first second"},
+		{"Vary", "Accept"},
+		{"Vary", "Origin"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseResponseHeaders = %q, want %q", got, want)
+	}
+
+	m := headerMap(got)
+	if m["Vary"] != "Accept, Origin" || m["Set-Cookie"] != "theme=dark, light; Path=/" || len(m) != 4 {
+		t.Errorf("headerMap = %q", m)
+	}
+}
+
 // ────────────────────────────────────────────────────────────────────
 // randomart.go — Bishop algorithm
 // ────────────────────────────────────────────────────────────────────
@@ -268,6 +310,196 @@ func TestRandomArtFromFingerprint(t *testing.T) {
 	}
 }
 
+func TestRandomArtSized(t *testing.T) {
+	hash := []byte{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0xba, 0xbe, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+	for _, size := range [][2]int{{17, 9}, {9, 5}, {33, 17}, {65, 33}} {
+		w, h := size[0], size[1]
+		lines := strings.Split(randomArtSized(hash, "ssh-rsa", 4096, "MD5", w, h, false), "\n")
+		if len(lines) != h+2 {
+			t.Fatalf("%dx%d: %d lines, want %d", w, h, len(lines), h+2)
+		}
+		for i, line := range lines {
+			if len(line) != w+2 {
+				t.Errorf("%dx%d: line %d is %d wide, want %d: %q", w, h, i, len(line), w+2, line)
+			}
+		}
+		if lines[h/2+1][w/2+1] != 'S' {
+			t.Errorf("%dx%d: start isn't at the center", w, h)
+		}
+	}
+	// OpenSSH's layout: the title centered, rounding left.
+	if top := strings.Split(randomArtFromHash(hash, "rsa", 2048, "SHA256"), "\n")[0]; top != "+---[RSA 2048]----+" {
+		t.Errorf("top border = %q", top)
+	}
+	// Too narrow for the bits: the type alone.
+	if top := strings.Split(randomArtSized(hash, "ssh-rsa", 4096, "MD5", 9, 5, false), "\n")[0]; top != "+[SSH-RSA]+" {
+		t.Errorf("narrow top border = %q", top)
+	}
+
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	k, _ := ssh.NewPublicKey(pub)
+	if art, err := RandomArtSized(k, artWidth, artHeight); err != nil || art != RandomArtSHA256FromKey(k) {
+		t.Errorf("RandomArtSized at 17x9 = %q, %v; want RandomArtSHA256FromKey", art, err)
+	}
+	if art, err := RandomArtSized(k, 65, 33); err != nil || strings.Count(art, "\n") != 34 || !strings.HasSuffix(art, "[SHA256]"+strings.Repeat("-", 29)+"+") {
+		t.Errorf("RandomArtSized at 65x33 = %q, %v", art, err)
+	}
+	for _, size := range [][2]int{{16, 9}, {17, 8}, {7, 5}, {67, 9}, {17, 35}} {
+		if _, err := RandomArtSized(k, size[0], size[1]); err == nil {
+			t.Errorf("RandomArtSized accepted %dx%d", size[0], size[1])
+		}
+	}
+	line := string(ssh.MarshalAuthorizedKey(k))
+	if art, err := randomArtForKey(line, js.Undefined()); err != nil || art != RandomArtSHA256FromKey(k) {
+		t.Errorf("default size = %q, %v; want RandomArtSHA256FromKey", art, err)
+	}
+	if art, err := randomArtForKey(line, js.ValueOf(map[string]any{"hash": "md5"})); err != nil || art != RandomArt(k) {
+		t.Errorf("hash md5 = %q, %v; want RandomArt", art, err)
+	}
+	for _, bad := range []map[string]any{{"width": 18}, {"height": 3}, {"width": 67}, {"hash": "sha1"}} {
+		if _, err := randomArtForKey(line, js.ValueOf(bad)); err == nil {
+			t.Errorf("size %v accepted", bad)
+		}
+	}
+}
+
+func TestRandomArtSHA256FromKey(t *testing.T) {
+	// ssh-keygen -lv of this key, without the border titles: this package
+	// titles with the key's full type.
+	k, _, _, _, err := ssh.ParseAuthorizedKey([]byte("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIFZhVnuDirANHkOfP21/YXWBHgmOs9NQzpIfPM29d4Ey"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		art  string
+		want []string
+	}{
+		{RandomArtSHA256FromKey(k), []string{
+			"|          o      |",
+			"|           +    .|",
+			"|          o .  +.|",
+			"|         . . .=+@|",
+			"|        S   oo+/O|",
+			"|           . B=*X|",
+			"|            + O+E|",
+			"|           o =.=o|",
+			"|            + +**|",
+			"+----[SHA256]-----+",
+		}},
+		{RandomArt(k), []string{
+			"|  +o.            |",
+			"|  .=.    .       |",
+			"| ..  .  o        |",
+			"|E   .. o         |",
+			"| . .  o S        |",
+			"|. oo .           |",
+			"| =  = .          |",
+			"|o+.. o..         |",
+			"|= . .oo.         |",
+			"+------[MD5]------+",
+		}},
+	} {
+		if got := strings.Split(tt.art, "\n")[1:]; !slices.Equal(got, tt.want) {
+			t.Errorf("art =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+
+	line := string(ssh.MarshalAuthorizedKey(k))
+	colored, err := randomArtForKey(line, js.ValueOf(map[string]any{"color": true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := colored.(string)
+	if !strings.Contains(text, "\x1b[1;35mS\x1b[0m") || !strings.Contains(text, "\x1b[31m/\x1b[0m") {
+		t.Errorf("colored art lacks the expected escapes:\n%q", text)
+	}
+	if got := string(stripANSI([]byte(text))); got != RandomArtSHA256FromKey(k) {
+		t.Errorf("colored art without escapes =\n%s\nwant the plain art", got)
+	}
+}
+
+func TestRandomArtGrid(t *testing.T) {
+	hash := []byte{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0xba, 0xbe, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+	text := strings.Split(randomArtFromHash(hash, "ssh-rsa", 4096, "MD5"), "\n")
+	grid := js.ValueOf(randomArtGrid(hash, "ssh-rsa", 4096, "MD5", artWidth, artHeight))
+	if grid.Get("title").String() != "SSH-RSA 4096" || grid.Get("hash").String() != "MD5" {
+		t.Errorf("title %v, hash %v", grid.Get("title"), grid.Get("hash"))
+	}
+	rows := grid.Get("rows")
+	if rows.Length() != artHeight {
+		t.Fatalf("%d rows, want %d", rows.Length(), artHeight)
+	}
+	markers := 0
+	for y := 0; y < artHeight; y++ {
+		for x := 0; x < artWidth; x++ {
+			cell := rows.Index(y).Index(x)
+			// The grid matches the text form cell for cell.
+			if got, want := cell.Get("char").String(), string(text[y+1][x+1]); got != want {
+				t.Errorf("cell %d,%d char %q, text has %q", x, y, got, want)
+			}
+			if !cell.Get("marker").IsUndefined() {
+				markers++
+				continue
+			}
+			if in := cell.Get("intensity").Float(); in < 0 || in > 1 {
+				t.Errorf("cell %d,%d intensity %v", x, y, in)
+			}
+		}
+	}
+	// The walk can end where it started, leaving only the end marker.
+	if markers < 1 || markers > 2 {
+		t.Errorf("%d marker cells", markers)
+	}
+
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	k, _ := ssh.NewPublicKey(pub)
+	line := string(ssh.MarshalAuthorizedKey(k))
+	if _, err := randomArtForKey(line, js.ValueOf(map[string]any{"format": "html"})); err == nil {
+		t.Error("unknown format accepted")
+	}
+	if got, err := randomArtForKey(line, js.ValueOf(map[string]any{"format": "grid", "width": 9, "height": 5})); err != nil {
+		t.Error(err)
+	} else if js.ValueOf(got).Get("rows").Length() != 5 {
+		t.Error("grid format ignored the size")
+	}
+}
+
+func TestRandomArtCache(t *testing.T) {
+	clearRandomArtCache()
+	defer clearRandomArtCache()
+	var keys []ssh.PublicKey
+	for i := 0; i <= artCacheSize; i++ {
+		pub, _, _ := ed25519.GenerateKey(rand.Reader)
+		k, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, k)
+	}
+
+	art := RandomArt(keys[0])
+	if cached, ok := artCache.get("MD5\x00" + string(keys[0].Marshal())); !ok || cached != art {
+		t.Fatal("randomart not cached")
+	}
+	if RandomArt(keys[0]) != art {
+		t.Error("cached randomart differs")
+	}
+	// One more than fits evicts the least recently used, keys[0].
+	for _, k := range keys[1:] {
+		RandomArt(k)
+	}
+	if _, ok := artCache.get("MD5\x00" + string(keys[0].Marshal())); ok {
+		t.Error("least recently used entry not evicted")
+	}
+	if n := artCache.order.Len(); n != artCacheSize {
+		t.Errorf("cache holds %d entries, want %d", n, artCacheSize)
+	}
+	clearRandomArtCache()
+	if _, ok := artCache.get("MD5\x00" + string(keys[1].Marshal())); ok {
+		t.Error("entry survived clear")
+	}
+}
+
 // ────────────────────────────────────────────────────────────────────
 // sftp_transfer.go — helper functions
 // ────────────────────────────────────────────────────────────────────
@@ -281,3 +513,4495 @@ func TestIsAbortedUndefined(t *testing.T) {
 		t.Error("isAborted(js.Null()) should be false")
 	}
 }
+
+// ────────────────────────────────────────────────────────────────────
+// sftp.go — shared SFTP sessions
+// ────────────────────────────────────────────────────────────────────
+
+// newTestSSHClient connects to an in-process SSH server over a pipe. The
+// server accepts session channels, serves the sftp subsystem from memory,
+// and grants tcpip-forward requests.
+func newTestSSHClient(t *testing.T) *ssh.Client {
+	t.Helper()
+	return newTestSSHClientWith(t, testServer{})
+}
+
+// testServer customizes the in-process server.
+type testServer struct {
+	// subsystem handles subsystem requests, including the reply; by
+	// default they get an in-memory SFTP server.
+	subsystem func(conn ssh.Conn, req *ssh.Request, ch ssh.Channel)
+	// request sees every other channel request after it is accepted.
+	request func(req *ssh.Request, ch ssh.Channel)
+	// refuse picks channel requests to fail instead of accepting.
+	refuse func(req *ssh.Request) bool
+	// direct serves direct-tcpip channels, which are refused without it.
+	direct func(ch ssh.Channel)
+}
+
+func serveTestSFTP(_ ssh.Conn, req *ssh.Request, ch ssh.Channel) {
+	_ = req.Reply(true, nil)
+	go func() {
+		_ = sftp.NewRequestServer(ch, sftp.InMemHandler()).Serve()
+		ch.Close()
+	}()
+}
+
+// newTestSSHClientWith is newTestSSHClient with the server customized by
+// srv.
+func newTestSSHClientWith(t *testing.T, srv testServer) *ssh.Client {
+	t.Helper()
+	_, hostKey, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subsystem := srv.subsystem
+	if subsystem == nil {
+		subsystem = serveTestSFTP
+	}
+	serverCfg := &ssh.ServerConfig{NoClientAuth: true}
+	serverCfg.AddHostKey(hostSigner)
+
+	clientSide, serverSide := net.Pipe()
+	go func() {
+		sconn, chans, reqs, err := ssh.NewServerConn(serverSide, serverCfg)
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range reqs {
+				if req.Type == "tcpip-forward" {
+					_ = req.Reply(true, ssh.Marshal(struct{ Port uint32 }{2222}))
+				} else if req.WantReply {
+					_ = req.Reply(false, nil)
+				}
+			}
+		}()
+		for nc := range chans {
+			if nc.ChannelType() == "direct-tcpip" && srv.direct != nil {
+				ch, chReqs, err := nc.Accept()
+				if err != nil {
+					continue
+				}
+				go ssh.DiscardRequests(chReqs)
+				go srv.direct(ch)
+				continue
+			}
+			if nc.ChannelType() != "session" {
+				_ = nc.Reject(ssh.UnknownChannelType, "unsupported")
+				continue
+			}
+			ch, chReqs, err := nc.Accept()
+			if err != nil {
+				continue
+			}
+			go func() {
+				defer ch.Close()
+				for req := range chReqs {
+					if req.Type == "subsystem" {
+						subsystem(sconn, req, ch)
+						continue
+					}
+					if srv.refuse != nil && srv.refuse(req) {
+						_ = req.Reply(false, nil)
+						continue
+					}
+					_ = req.Reply(true, nil)
+					if srv.request != nil {
+						srv.request(req, ch)
+					}
+				}
+			}()
+		}
+	}()
+
+	conn, chans, reqs, err := ssh.NewClientConn(newAsyncConn(clientSide), "test", &ssh.ClientConfig{
+		User:            "test",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ssh.NewClient(conn, chans, reqs)
+}
+
+// newTestSession registers a session, without a shell, connected to the
+// in-process server.
+func newTestSession(t *testing.T, id string) *session {
+	t.Helper()
+	client := newTestSSHClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &session{
+		id:        id,
+		ctx:       ctx,
+		cancel:    cancel,
+		cc:        &clientConn{sshClient: client},
+		sshClient: client,
+		onData:    js.Undefined(),
+		onClose:   js.Undefined(),
+	}
+	sessionStore.Store(s.id, s)
+	return s
+}
+
+// asyncConn queues writes so both ends of a net.Pipe can write at once, as
+// they do in the SSH version exchange; a bare net.Pipe deadlocks there.
+type asyncConn struct {
+	net.Conn
+	mu     sync.Mutex
+	queue  chan []byte
+	closed bool
+}
+
+func newAsyncConn(c net.Conn) *asyncConn {
+	a := &asyncConn{Conn: c, queue: make(chan []byte, 64)}
+	go func() {
+		for b := range a.queue {
+			if _, err := c.Write(b); err != nil {
+				c.Close()
+			}
+		}
+	}()
+	return a
+}
+
+func (a *asyncConn) Write(b []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return 0, net.ErrClosed
+	}
+	a.queue <- append([]byte(nil), b...)
+	return len(b), nil
+}
+
+func (a *asyncConn) Close() error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+	return a.Conn.Close()
+}
+
+func awaitTestPromise(t *testing.T, promise js.Value) js.Value {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	v, err := awaitPromise(ctx, promise)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestNewSFTPClientErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		subsystem   func(conn ssh.Conn, req *ssh.Request, ch ssh.Channel)
+		unavailable bool
+	}{
+		{"refused", func(_ ssh.Conn, req *ssh.Request, _ ssh.Channel) {
+			_ = req.Reply(false, nil)
+		}, true},
+		{"no sftp-server", func(_ ssh.Conn, req *ssh.Request, ch ssh.Channel) {
+			_ = req.Reply(true, nil)
+			ch.Close()
+		}, true},
+		{"connection dropped", func(conn ssh.Conn, _ *ssh.Request, _ ssh.Channel) {
+			conn.Close()
+		}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newTestSSHClientWith(t, testServer{subsystem: tc.subsystem})
+			defer client.Close()
+			_, err := newSFTPClient(client)
+			if err == nil {
+				t.Fatal("newSFTPClient succeeded")
+			}
+			var coded *codedError
+			if got := errors.As(err, &coded) && coded.code == errCodeSFTPUnavailable; got != tc.unavailable {
+				t.Errorf("err = %v, reported as SFTP_SUBSYSTEM_UNAVAILABLE: %v", err, got)
+			}
+		})
+	}
+}
+
+func TestSFTPReuseRefcount(t *testing.T) {
+	s := newTestSession(t, "sess-sftp-reuse")
+	defer s.close("test done")
+
+	reuse := js.ValueOf(map[string]any{"reuse": true})
+	first := awaitTestPromise(t, sftpOpen(s.id, reuse)).String()
+	if second := awaitTestPromise(t, sftpOpen(s.id, reuse)).String(); second != first {
+		t.Fatalf("reuse returned %q, want %q", second, first)
+	}
+
+	sftpClose(first)
+	ss, err := getSFTPSession(first)
+	if err != nil {
+		t.Fatal("shared session closed while still held")
+	}
+	if _, err := ss.client.Getwd(); err != nil {
+		t.Fatalf("shared client unusable after one release: %v", err)
+	}
+
+	sftpClose(first)
+	if _, err := getSFTPSession(first); err == nil {
+		t.Error("session still open after its last release")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// jsutil.go — error conversion
+// ────────────────────────────────────────────────────────────────────
+
+func TestJSErrorCarriesCode(t *testing.T) {
+	v := jsError(fmt.Errorf("wrapped: %w", errSFTPUnavailable))
+	if got := v.Get("code").String(); got != errCodeSFTPUnavailable {
+		t.Errorf("code = %q, want %q", got, errCodeSFTPUnavailable)
+	}
+	if !strings.Contains(v.Get("message").String(), "SFTP subsystem") {
+		t.Errorf("message = %q", v.Get("message").String())
+	}
+
+	plain := jsError(fmt.Errorf("plain"))
+	if !plain.Get("code").IsUndefined() {
+		t.Errorf("plain error should have no code, got %v", plain.Get("code"))
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// ssh.go — host key fingerprint formats
+// ────────────────────────────────────────────────────────────────────
+
+func TestHostKeyFingerprints(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	key, _ := ssh.NewPublicKey(pub)
+
+	formats, err := fingerprintFormats(js.ValueOf(map[string]any{}))
+	if err != nil || !slices.Equal(formats, []string{"sha256", "md5"}) {
+		t.Fatalf("default formats = %v, %v", formats, err)
+	}
+	formats, err = fingerprintFormats(js.ValueOf(map[string]any{"hostKeyFingerprints": []any{"sha256-hex", "sha1", "md5"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fps := hostKeyFingerprints(key, formats)
+	if len(fps) != 4 {
+		t.Errorf("got %d fingerprints, want 4: %v", len(fps), fps)
+	}
+	if fps["sha256"] != ssh.FingerprintSHA256(key) || fps["md5"] != ssh.FingerprintLegacyMD5(key) {
+		t.Errorf("default fingerprints = %v", fps)
+	}
+	sum := sha256.Sum256(key.Marshal())
+	if want := strings.ReplaceAll(fmt.Sprintf("% x", sum), " ", ":"); fps["sha256-hex"] != want {
+		t.Errorf("sha256-hex = %v, want %s", fps["sha256-hex"], want)
+	}
+	if fp, _ := fps["sha1"].(string); !strings.HasPrefix(fp, "SHA1:") || len(fp) != len("SHA1:")+27 {
+		t.Errorf("sha1 = %q", fp)
+	}
+
+	if _, err := fingerprintFormats(js.ValueOf(map[string]any{"hostKeyFingerprints": []any{"crc32"}})); err == nil || !strings.Contains(err.Error(), "blake2b-256") {
+		t.Errorf("unknown format: err = %v, want one listing the formats", err)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// ssh.go — authentication failures
+// ────────────────────────────────────────────────────────────────────
+
+func TestHandshakeErrorTooManyAuthFailures(t *testing.T) {
+	err := handshakeError("connect: SSH handshake failed",
+		errors.New("ssh: disconnect, reason 2: Too many authentication failures"))
+	var ce *codedError
+	if !errors.As(err, &ce) || ce.code != errCodeTooManyAuthFailures {
+		t.Fatalf("err = %v, want code %s", err, errCodeTooManyAuthFailures)
+	}
+	if !strings.Contains(ce.msg, "agentMaxKeys") {
+		t.Errorf("message doesn't suggest agentMaxKeys: %q", ce.msg)
+	}
+
+	if errors.As(handshakeError("connect: SSH handshake failed", io.EOF), &ce) {
+		t.Error("plain handshake failure got a code")
+	}
+}
+
+func TestPasswordChange(t *testing.T) {
+	var prompts []string
+	onChange := js.FuncOf(func(_ js.Value, args []js.Value) any {
+		prompts = append(prompts, args[0].Get("prompt").String())
+		return js.Global().Get("Promise").Call("resolve", "n3w-secret")
+	})
+	defer onChange.Release()
+	methods, err := buildAuthMethods(js.ValueOf(map[string]any{
+		"authMethod":       "password",
+		"password":         "old-secret",
+		"onPasswordChange": onChange,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(methods) != 2 {
+		t.Fatalf("got %d methods, want password and the password change", len(methods))
+	}
+
+	// A PAM-style server: password is refused as expired, and the
+	// keyboard-interactive conversation changes it.
+	var changedTo string
+	_, hostKey, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, _ := ssh.NewSignerFromKey(hostKey)
+	serverCfg := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, errors.New("expired")
+		},
+		KeyboardInteractiveCallback: func(_ ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client("", "You are required to change your password immediately", []string{"Current password: ", "New password: ", "Retype new password: "}, []bool{false, false, false})
+			if err != nil {
+				return nil, err
+			}
+			if answers[0] != "old-secret" || answers[1] != answers[2] {
+				return nil, errors.New("no")
+			}
+			changedTo = answers[1]
+			return nil, nil
+		},
+	}
+	serverCfg.AddHostKey(hostSigner)
+	clientSide, serverSide := net.Pipe()
+	go func() {
+		if sconn, _, _, err := ssh.NewServerConn(serverSide, serverCfg); err == nil {
+			sconn.Close()
+		}
+	}()
+	conn, _, _, err := ssh.NewClientConn(newAsyncConn(clientSide), "test", &ssh.ClientConfig{
+		User: "u", Auth: methods, HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	conn.Close()
+	if changedTo != "n3w-secret" || !slices.Equal(prompts, []string{"New password: "}) {
+		t.Errorf("changed to %q, onPasswordChange prompts %q", changedTo, prompts)
+	}
+
+	// An OTP prompt is beyond it.
+	challenge := passwordChangeChallenge("old-secret", onChange.Value)
+	if _, err := challenge("", "", []string{"Verification code: "}, []bool{true}); err == nil {
+		t.Error("answered an OTP prompt")
+	}
+	// With keyboard-interactive configured, that handles the conversation.
+	methods, _ = buildAuthMethods(js.ValueOf(map[string]any{
+		"authMethod":            []any{"password", "keyboard-interactive"},
+		"password":              "old-secret",
+		"onPasswordChange":      onChange,
+		"onKeyboardInteractive": onChange,
+	}))
+	if len(methods) != 2 {
+		t.Errorf("got %d methods alongside keyboard-interactive, want 2", len(methods))
+	}
+}
+
+// TestPasswordChangeRequest logs in with a password against a server that
+// answers SSH_MSG_USERAUTH_PASSWD_CHANGEREQ, checking that the error
+// x/crypto/ssh fails with is still the one isPasswordChangeRequest matches.
+func TestPasswordChangeRequest(t *testing.T) {
+	_, hostKey, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientSide, serverSide := net.Pipe()
+	go servePasswordChangeRequest(serverSide, hostSigner)
+
+	_, _, _, err = ssh.NewClientConn(newAsyncConn(clientSide), "test", &ssh.ClientConfig{
+		Config: ssh.Config{
+			KeyExchanges: []string{"curve25519-sha256"},
+			Ciphers:      []string{"aes128-ctr"},
+			MACs:         []string{"hmac-sha2-256"},
+		},
+		User:              "u",
+		Auth:              []ssh.AuthMethod{ssh.Password("expired")},
+		HostKeyCallback:   ssh.InsecureIgnoreHostKey(),
+		HostKeyAlgorithms: []string{ssh.KeyAlgoED25519},
+	})
+	if err == nil || !isPasswordChangeRequest(err) {
+		t.Fatalf("err = %v, want the password change request", err)
+	}
+	var ce *codedError
+	if !errors.As(handshakeError("connect: SSH handshake failed", err), &ce) || ce.code != errCodePasswordChange {
+		t.Errorf("handshakeError(%v) = %v, want code %s", err, ce, errCodePasswordChange)
+	}
+}
+
+// servePasswordChangeRequest is a bare SSH server that answers password
+// auth with SSH_MSG_USERAUTH_PASSWD_CHANGEREQ, which x/crypto/ssh servers
+// never send. It speaks just enough of the protocol for that: one key
+// exchange with curve25519-sha256, ssh-ed25519, aes128-ctr, and
+// hmac-sha2-256.
+func servePasswordChangeRequest(conn net.Conn, hostSigner ssh.Signer) {
+	defer conn.Close()
+	const serverVersion = "SSH-2.0-passwd-changereq"
+	if _, err := fmt.Fprintf(conn, "%s\r\n", serverVersion); err != nil {
+		return
+	}
+	r := bufio.NewReader(conn)
+	clientVersion, err := r.ReadString('\n')
+	if err != nil {
+		return
+	}
+	clientVersion = strings.TrimRight(clientVersion, "\r\n")
+
+	var (
+		seq      uint32 // of the next packet sent
+		enc, dec cipher.Stream
+		macKey   []byte
+	)
+	write := func(payload []byte) error {
+		padLen := aes.BlockSize - (5+len(payload))%aes.BlockSize
+		if padLen < 4 {
+			padLen += aes.BlockSize
+		}
+		packet := binary.BigEndian.AppendUint32(nil, uint32(1+len(payload)+padLen))
+		packet = append(packet, byte(padLen))
+		packet = append(packet, payload...)
+		packet = append(packet, make([]byte, padLen)...)
+		var mac []byte
+		if enc != nil {
+			h := hmac.New(sha256.New, macKey)
+			h.Write(binary.BigEndian.AppendUint32(nil, seq))
+			h.Write(packet)
+			mac = h.Sum(nil)
+			enc.XORKeyStream(packet, packet)
+		}
+		seq++
+		_, err := conn.Write(append(packet, mac...))
+		return err
+	}
+	read := func() ([]byte, error) {
+		head := make([]byte, 4)
+		if _, err := io.ReadFull(r, head); err != nil {
+			return nil, err
+		}
+		if dec != nil {
+			dec.XORKeyStream(head, head)
+		}
+		body := make([]byte, binary.BigEndian.Uint32(head))
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, err
+		}
+		if dec != nil {
+			dec.XORKeyStream(body, body)
+			if _, err := io.ReadFull(r, make([]byte, sha256.Size)); err != nil { // MAC, unchecked
+				return nil, err
+			}
+		}
+		return body[1 : len(body)-int(body[0])], nil
+	}
+	readType := func(msgType byte) ([]byte, error) {
+		for {
+			p, err := read()
+			if err != nil || (len(p) > 0 && p[0] == msgType) {
+				return p, err
+			}
+		}
+	}
+
+	serverKexInit := ssh.Marshal(struct {
+		Cookie                  [16]byte `sshtype:"20"`
+		KexAlgos                []string
+		HostKeyAlgos            []string
+		CiphersClientServer     []string
+		CiphersServerClient     []string
+		MACsClientServer        []string
+		MACsServerClient        []string
+		CompressionClientServer []string
+		CompressionServerClient []string
+		LanguagesClientServer   []string
+		LanguagesServerClient   []string
+		FirstKexFollows         bool
+		Reserved                uint32
+	}{
+		KexAlgos:                []string{"curve25519-sha256"},
+		HostKeyAlgos:            []string{ssh.KeyAlgoED25519},
+		CiphersClientServer:     []string{"aes128-ctr"},
+		CiphersServerClient:     []string{"aes128-ctr"},
+		MACsClientServer:        []string{"hmac-sha2-256"},
+		MACsServerClient:        []string{"hmac-sha2-256"},
+		CompressionClientServer: []string{"none"},
+		CompressionServerClient: []string{"none"},
+	})
+	if write(serverKexInit) != nil {
+		return
+	}
+	clientKexInit, err := readType(20)
+	if err != nil {
+		return
+	}
+	p, err := readType(30) // SSH_MSG_KEX_ECDH_INIT
+	if err != nil {
+		return
+	}
+	var kexInit struct {
+		ClientPub []byte `sshtype:"30"`
+	}
+	if ssh.Unmarshal(p, &kexInit) != nil {
+		return
+	}
+	priv, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	clientPub, err := ecdh.X25519().NewPublicKey(kexInit.ClientPub)
+	if err != nil {
+		return
+	}
+	secret, _ := priv.ECDH(clientPub)
+	k := ssh.Marshal(struct{ K *big.Int }{new(big.Int).SetBytes(secret)})
+	hostKeyBlob := hostSigner.PublicKey().Marshal()
+	digest := sha256.Sum256(append(ssh.Marshal(struct {
+		ClientVersion, ServerVersion                                string
+		ClientKexInit, ServerKexInit, HostKey, ClientPub, ServerPub []byte
+	}{clientVersion, serverVersion, clientKexInit, serverKexInit, hostKeyBlob, kexInit.ClientPub, priv.PublicKey().Bytes()}), k...))
+	h := digest[:]
+	sig, err := hostSigner.Sign(rand.Reader, h)
+	if err != nil {
+		return
+	}
+	reply := ssh.Marshal(struct {
+		HostKey   []byte `sshtype:"31"`
+		ServerPub []byte
+		Signature []byte
+	}{hostKeyBlob, priv.PublicKey().Bytes(), ssh.Marshal(sig)})
+	if write(reply) != nil || write([]byte{21}) != nil { // SSH_MSG_NEWKEYS
+		return
+	}
+
+	// Keys per RFC 4253 section 7.2; the session ID is the first
+	// exchange hash.
+	derive := func(letter byte, n int) []byte {
+		d := sha256.New()
+		d.Write(k)
+		d.Write(h)
+		d.Write([]byte{letter})
+		d.Write(h)
+		return d.Sum(nil)[:n]
+	}
+	newCTR := func(key, iv []byte) cipher.Stream {
+		block, _ := aes.NewCipher(key)
+		return cipher.NewCTR(block, iv)
+	}
+	enc, macKey = newCTR(derive('D', 16), derive('B', aes.BlockSize)), derive('F', sha256.Size)
+	if _, err := readType(21); err != nil {
+		return
+	}
+	dec = newCTR(derive('C', 16), derive('A', aes.BlockSize))
+
+	if _, err := readType(5); err != nil { // SSH_MSG_SERVICE_REQUEST
+		return
+	}
+	if write(ssh.Marshal(struct {
+		Service string `sshtype:"6"`
+	}{"ssh-userauth"})) != nil {
+		return
+	}
+	for {
+		p, err := readType(50) // SSH_MSG_USERAUTH_REQUEST
+		if err != nil {
+			return
+		}
+		var req struct {
+			User, Service, Method string `sshtype:"50"`
+			Rest                  []byte `ssh:"rest"`
+		}
+		if ssh.Unmarshal(p, &req) != nil {
+			return
+		}
+		if req.Method == "password" {
+			_ = write(ssh.Marshal(struct {
+				Prompt   string `sshtype:"60"`
+				Language string
+			}{"Password expired", ""}))
+			return
+		}
+		if write(ssh.Marshal(struct {
+			Methods        []string `sshtype:"51"`
+			PartialSuccess bool
+		}{[]string{"password"}, false})) != nil {
+			return
+		}
+	}
+}
+
+func TestLimitSigners(t *testing.T) {
+	signers := make([]ssh.Signer, 5)
+	all := func() ([]ssh.Signer, error) { return signers, nil }
+	for _, tt := range []struct{ max, want int }{{0, 5}, {2, 2}, {9, 5}} {
+		got, _ := limitSigners(all, tt.max)()
+		if len(got) != tt.want {
+			t.Errorf("limitSigners(max %d) offered %d, want %d", tt.max, len(got), tt.want)
+		}
+	}
+}
+
+func TestFindSigner(t *testing.T) {
+	var signers []ssh.Signer
+	for i := 0; i < 3; i++ {
+		priv, _ := generateKey("ed25519", 0)
+		s, err := ssh.NewSignerFromKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, s)
+	}
+	all := func() ([]ssh.Signer, error) { return signers, nil }
+
+	want := ssh.FingerprintSHA256(signers[1].PublicKey())
+	got, err := findSigner(all, want)
+	if err != nil || ssh.FingerprintSHA256(got.PublicKey()) != want {
+		t.Errorf("findSigner = %v, %v", got, err)
+	}
+	if _, err := findSigner(all, "SHA256:missing"); err == nil || !strings.Contains(err.Error(), "not loaded") {
+		t.Errorf("missing key: err = %v", err)
+	}
+}
+
+func TestBuildAuthMethodsFallback(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tried []string
+	onProgress := js.FuncOf(func(_ js.Value, args []js.Value) any {
+		tried = append(tried, fmt.Sprintf("%s#%d", args[0].Get("method").String(), args[0].Get("attempt").Int()))
+		return nil
+	})
+	defer onProgress.Release()
+	config := js.ValueOf(map[string]any{
+		// No agent keys are loaded, so agent is skipped.
+		"authMethod":     []any{"agent", "key", "password"},
+		"keyPEM":         string(pem.EncodeToMemory(block)),
+		"password":       "hunter2",
+		"onAuthProgress": onProgress,
+	})
+	methods, err := buildAuthMethods(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(methods) != 2 {
+		t.Fatalf("got %d methods, want publickey and password", len(methods))
+	}
+
+	// The server rejects the key and accepts the password.
+	_, hostKey, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, _ := ssh.NewSignerFromKey(hostKey)
+	serverCfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, errors.New("no")
+		},
+		PasswordCallback: func(_ ssh.ConnMetadata, pw []byte) (*ssh.Permissions, error) {
+			if string(pw) != "hunter2" {
+				return nil, errors.New("no")
+			}
+			return nil, nil
+		},
+	}
+	serverCfg.AddHostKey(hostSigner)
+	clientSide, serverSide := net.Pipe()
+	go func() {
+		if sconn, _, _, err := ssh.NewServerConn(serverSide, serverCfg); err == nil {
+			sconn.Close()
+		}
+	}()
+	conn, _, _, err := ssh.NewClientConn(newAsyncConn(clientSide), "test", &ssh.ClientConfig{
+		User: "u", Auth: methods, HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	conn.Close()
+	if want := []string{"publickey#1", "password#2"}; !slices.Equal(tried, want) {
+		t.Errorf("onAuthProgress saw %v, want %v", tried, want)
+	}
+
+	// Skipping is for lists; nothing usable is still an error.
+	if _, err := buildAuthMethods(js.ValueOf(map[string]any{"authMethod": []any{"agent", "password"}})); err == nil {
+		t.Error("list with no usable method succeeded")
+	}
+	if _, err := buildAuthMethods(js.ValueOf(map[string]any{"authMethod": []any{"password", "sso"}, "password": "x"})); err == nil {
+		t.Error("unknown method in list accepted")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp_file.go — handle validation
+// ────────────────────────────────────────────────────────────────────
+
+func TestOpenFlags(t *testing.T) {
+	for mode, want := range map[string]int{
+		"r":   os.O_RDONLY,
+		"r+":  os.O_RDWR,
+		"w":   os.O_WRONLY | os.O_CREATE | os.O_TRUNC,
+		"wx+": os.O_RDWR | os.O_CREATE | os.O_EXCL,
+		"a":   os.O_WRONLY | os.O_CREATE | os.O_APPEND,
+	} {
+		if got, err := openFlags(mode); err != nil || got != want {
+			t.Errorf("openFlags(%q) = %#x, %v; want %#x", mode, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "rw", "x", "rb"} {
+		if _, err := openFlags(bad); err == nil {
+			t.Errorf("openFlags(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestValidateOffset(t *testing.T) {
+	for _, ok := range []float64{0, 1, maxSafeOffset} {
+		if got, err := validateOffset(ok); err != nil || got != int64(ok) {
+			t.Errorf("validateOffset(%v) = %d, %v", ok, got, err)
+		}
+	}
+	for _, bad := range []float64{-1, 1.5, maxSafeOffset + 2, math.Inf(1), math.NaN()} {
+		if _, err := validateOffset(bad); err == nil {
+			t.Errorf("validateOffset(%v) succeeded", bad)
+		}
+	}
+}
+
+func TestFileReadAtEOF(t *testing.T) {
+	s := newTestSession(t, "sess-file-eof")
+	defer s.close("test done")
+	sftpID, err := openSFTPSession(s.id, js.Undefined())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _ := getSFTPSession(sftpID)
+	f, err := ss.client.Create("/ten")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("0123456789"))
+	f.Close()
+
+	handleID := awaitTestPromise(t, sftpFileOpen(sftpID, "/ten", "r")).String()
+	for _, tt := range []struct {
+		offset float64
+		want   string
+	}{
+		{0, "01234"},
+		{8, "89"}, // short read at end of file
+		{10, ""},  // at end of file
+		{20, ""},  // past it
+	} {
+		got := awaitTestPromise(t, sftpFileReadAt(handleID, tt.offset, 5))
+		if s := string(uint8ArrayToBytes(got)); s != tt.want {
+			t.Errorf("ReadAt(%v, 5) = %q, want %q", tt.offset, s, tt.want)
+		}
+	}
+}
+
+func TestFileHandleLimit(t *testing.T) {
+	s := newTestSession(t, "sess-file-limit")
+	defer s.close("test done")
+	sftpID, err := openSFTPSession(s.id, js.Undefined())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _ := getSFTPSession(sftpID)
+	f, err := ss.client.Create("/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// Open more than the limit at once: exactly maxFileHandles succeed.
+	results := make([]js.Value, maxFileHandles+8)
+	for i := range results {
+		results[i] = sftpFileOpen(sftpID, "/f", "r")
+	}
+	var opened []string
+	failed := 0
+	for _, promise := range results {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		v, err := awaitPromise(ctx, promise)
+		cancel()
+		if err != nil {
+			failed++
+			continue
+		}
+		opened = append(opened, v.String())
+	}
+	if len(opened) != maxFileHandles || failed != 8 {
+		t.Fatalf("opened %d, failed %d; want %d, 8", len(opened), failed, maxFileHandles)
+	}
+
+	// Closing one frees its slot.
+	awaitTestPromise(t, sftpFileClose(opened[0]))
+	awaitTestPromise(t, sftpFileOpen(sftpID, "/f", "r"))
+	if n := ss.handles.Load(); n != maxFileHandles {
+		t.Errorf("handles = %d, want %d", n, maxFileHandles)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// pool.go — connection reuse
+// ────────────────────────────────────────────────────────────────────
+
+func TestPoolOptions(t *testing.T) {
+	config := func(extra map[string]any) js.Value {
+		m := map[string]any{
+			"proxyUrl": "wss://proxy", "host": "h", "username": "u",
+			"authMethod": "password", "password": "p", "pool": true,
+		}
+		for k, v := range extra {
+			m[k] = v
+		}
+		return js.ValueOf(m)
+	}
+	key, ttl, err := poolOptions(config(nil))
+	if err != nil || key == "" || ttl != defaultPoolTTL {
+		t.Fatalf("poolOptions = %q, %v, %v", key, ttl, err)
+	}
+	if again, _, _ := poolOptions(config(nil)); again != key {
+		t.Error("same config gave a different key")
+	}
+	if other, _, _ := poolOptions(config(map[string]any{"password": "q"})); other == key {
+		t.Error("different password gave the same key")
+	}
+	if other, _, _ := poolOptions(config(map[string]any{"port": 2222})); other == key {
+		t.Error("different port gave the same key")
+	}
+	for name, extra := range map[string]map[string]any{
+		"off":                  {"pool": false},
+		"keyboard-interactive": {"authMethod": "keyboard-interactive"},
+	} {
+		if k, _, _ := poolOptions(config(extra)); k != "" {
+			t.Errorf("%s: pooled", name)
+		}
+	}
+	if _, ttl, _ := poolOptions(config(map[string]any{"pool": map[string]any{"ttlMs": 500}})); ttl != 500*time.Millisecond {
+		t.Errorf("ttl = %v", ttl)
+	}
+	if _, _, err := poolOptions(config(map[string]any{"pool": map[string]any{"ttlMs": -1}})); err == nil {
+		t.Error("negative ttlMs accepted")
+	}
+}
+
+func TestPooledConnRefs(t *testing.T) {
+	pc := &pooledConn{key: "test", cc: &clientConn{}, ttl: time.Hour, refs: 1, pooled: true}
+	poolMu.Lock()
+	connPool[pc.key] = pc
+	poolMu.Unlock()
+
+	if got := acquirePooled(pc.key); got != pc || pc.refs != 2 {
+		t.Fatalf("acquire = %p refs %d", got, pc.refs)
+	}
+	pc.release()
+	pc.release()
+	if pc.idle == nil || !pc.pooled {
+		t.Fatal("unused connection not kept for the TTL")
+	}
+	if acquirePooled(pc.key) != pc || pc.idle != nil {
+		t.Fatal("reuse didn't cancel the idle close")
+	}
+	pc.release()
+
+	poolFlush()
+	if pc.pooled || pc.idle != nil || acquirePooled(pc.key) != nil {
+		t.Error("flush left the connection pooled")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// scp.go — protocol helpers
+// ────────────────────────────────────────────────────────────────────
+
+func TestParseSCPHeader(t *testing.T) {
+	mode, size, name, err := parseSCPHeader("C0644 1234 report.txt")
+	if err != nil {
+		t.Fatalf("parseSCPHeader: %v", err)
+	}
+	if mode != 0o644 || size != 1234 || name != "report.txt" {
+		t.Errorf("got mode=%o size=%d name=%q", mode, size, name)
+	}
+
+	_, _, name, err = parseSCPHeader("C0600 0 name with spaces")
+	if err != nil || name != "name with spaces" {
+		t.Errorf("spaces in name: name=%q err=%v", name, err)
+	}
+
+	for _, bad := range []string{"", "D0755 0 dir", "C0644 12", "Cxyz 1 a", "C0644 -1 a", "C0644 1 ../x", "E"} {
+		if _, _, _, err := parseSCPHeader(bad); err == nil {
+			t.Errorf("parseSCPHeader(%q) should fail", bad)
+		}
+	}
+}
+
+func TestSCPReadAck(t *testing.T) {
+	if err := scpReadAck(bufio.NewReader(bytes.NewReader([]byte{0}))); err != nil {
+		t.Errorf("ack 0: %v", err)
+	}
+	err := scpReadAck(bufio.NewReader(bytes.NewReader(append([]byte{1}, "scp: /x: Permission denied\n"...))))
+	if err == nil || !strings.Contains(err.Error(), "Permission denied") {
+		t.Errorf("ack 1: got %v", err)
+	}
+	if err := scpReadAck(bufio.NewReader(bytes.NewReader(nil))); err == nil {
+		t.Error("ack on EOF should fail")
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"/tmp/file":   "'/tmp/file'",
+		"it's":        `'it'\''s'`,
+		"$(rm -rf /)": "'$(rm -rf /)'",
+		"a b\tc":      "'a b\tc'",
+	}
+	for in, want := range tests {
+		if got := shellQuote(in); got != want {
+			t.Errorf("shellQuote(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp_tail.go — truncation and rotation
+// ────────────────────────────────────────────────────────────────────
+
+func TestTailFileRotation(t *testing.T) {
+	s := newTestSession(t, "sess-tail-rotation")
+	defer s.close("test done")
+	sftpID := awaitTestPromise(t, sftpOpen(s.id, js.Undefined())).String()
+	ss, _ := getSFTPSession(sftpID)
+	write := func(content string) {
+		t.Helper()
+		f, err := ss.client.Create("/log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	poll := func(tf *tailFile, want string) {
+		t.Helper()
+		data, err := tf.poll(ss)
+		if err != nil || string(data) != want {
+			t.Fatalf("poll = %q, %v; want %q", data, err, want)
+		}
+	}
+
+	write("first line\n")
+	tf := &tailFile{path: "/log"}
+	tf.start(ss)
+	poll(tf, "")
+
+	write("first line\nsecond\n")
+	poll(tf, "second\n")
+
+	// Replaced by a file already longer than the old read position.
+	write("rotated: a new file that is longer than the old one\n")
+	poll(tf, "rotated: a new file that is longer than the old one\n")
+
+	// Truncated.
+	write("short\n")
+	poll(tf, "short\n")
+}
+
+// ────────────────────────────────────────────────────────────────────
+// ansi.go — escape sequence stripping
+// ────────────────────────────────────────────────────────────────────
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "hello world\r\n", "hello world\r\n"},
+		{"sgr", "\x1b[1;31merror\x1b[0m: bad", "error: bad"},
+		{"private mode", "\x1b[?25lhidden\x1b[?25h", "hidden"},
+		{"osc bel", "\x1b]0;title\x07prompt$ ", "prompt$ "},
+		{"osc st", "\x1b]8;;http://x\x1b\\link\x1b]8;;\x1b\\", "link"},
+		{"dcs", "\x1bPq#0;2;0;0;0\x1b\\after", "after"},
+		{"charset", "\x1b(Bascii\x1b)0", "ascii"},
+		{"two byte", "\x1b7saved\x1b8", "saved"},
+		{"bell and tab", "a\x07\tb", "a\tb"},
+		{"utf8 kept", "\x1b[32mżółw\x1b[0m", "żółw"},
+		{"unterminated csi", "text\x1b[31", "text"},
+		{"can aborts csi", "\x1b[31\x18ok", "ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(stripANSI([]byte(tt.in))); got != tt.want {
+				t.Errorf("stripANSI(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecOutputStripANSIStream(t *testing.T) {
+	var streamed []byte
+	onData := js.FuncOf(func(this js.Value, args []js.Value) any {
+		streamed = append(streamed, uint8ArrayToBytes(args[0])...)
+		return nil
+	})
+	defer onData.Release()
+	o := newExecOutput(onData.Value, true, true)
+	for _, chunk := range []string{"a\x1b[3", "1mb\x1b]0;ti", "tle\x1b", "\\c\x1b[0m"} {
+		if n, err := o.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+		}
+	}
+	if string(streamed) != "abc" || o.buf.String() != "abc" {
+		t.Errorf("streamed %q, aggregated %q; want \"abc\"", streamed, o.buf.String())
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// lines.go — line reassembly
+// ────────────────────────────────────────────────────────────────────
+
+func TestLineSplitter(t *testing.T) {
+	var got []string
+	l := newLineSplitter(8, func(line string) { got = append(got, line) })
+
+	l.Write([]byte("one\r\ntw"))
+	l.Write([]byte("o\nthree"))
+	l.Write([]byte("\r"))
+	l.Write([]byte("\n\nabcdefghij"))
+	l.Write([]byte("tail"))
+	l.Flush()
+
+	want := []string{"one", "two", "three", "", "abcdefgh", "ijtail"}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	got = nil
+	l.Flush()
+	if len(got) != 0 {
+		t.Errorf("flush of empty buffer emitted %q", got)
+	}
+}
+
+func TestLineSplitterUTF8(t *testing.T) {
+	var got []string
+	l := newLineSplitter(8, func(line string) { got = append(got, line) })
+	// "€" straddles the 8-byte limit in the first line, "é" in the second.
+	l.Write([]byte("abcdef\xe2"))
+	l.Write([]byte("\x82\xacgh"))
+	l.Write([]byte("\nabcdefgé"))
+	l.Flush()
+
+	want := []string{"abcdef", "€gh", "abcdefg", "é"}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// ssh.go — re-established shell PTY
+// ────────────────────────────────────────────────────────────────────
+
+// ptyReq is the payload of a pty-req channel request.
+type ptyReq struct {
+	Term                      string
+	Cols, Rows, Width, Height uint32
+	Modes                     string
+}
+
+// parseTestModes decodes encoded terminal modes (RFC 4254 §8).
+func parseTestModes(s string) ssh.TerminalModes {
+	modes := ssh.TerminalModes{}
+	for len(s) >= 5 && s[0] != 0 {
+		modes[s[0]] = binary.BigEndian.Uint32([]byte(s[1:5]))
+		s = s[5:]
+	}
+	return modes
+}
+
+func TestShellPtyReplaysLastSize(t *testing.T) {
+	ptyReqs := make(chan ptyReq, 2)
+	client := newTestSSHClientWith(t, testServer{request: func(req *ssh.Request, ch ssh.Channel) {
+		if req.Type == "pty-req" {
+			var p ptyReq
+			_ = ssh.Unmarshal(req.Payload, &p)
+			ptyReqs <- p
+		}
+	}})
+	defer client.Close()
+
+	pty, err := parsePtySettings(js.ValueOf(map[string]any{"term": "vt220"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shell, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shell.Close()
+	if err := requestPty(shell, pty, 80, 24); err != nil {
+		t.Fatal(err)
+	}
+	<-ptyReqs
+	s := &session{id: "sess-shell-pty", pty: pty}
+	s.registerPty(s.id, shell, 80, 24)
+	if err := s.resizePty(s.id, 132, 43); err != nil {
+		t.Fatal(err)
+	}
+
+	// A replacement shell asks for the same terminal at the new size.
+	replayed, cols, rows := s.shellPty()
+	next, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Close()
+	if err := requestPty(next, replayed, cols, rows); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-ptyReqs:
+		if p.Term != "vt220" || p.Cols != 132 || p.Rows != 43 || !maps.Equal(parseTestModes(p.Modes), pty.modes) {
+			t.Errorf("pty-req = %+v, want vt220 at 132x43 with the same modes", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no pty-req for the replacement shell")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// agent_forward.go — session binding and userauth sign data
+// ────────────────────────────────────────────────────────────────────
+
+func TestParseSessionBind(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID := []byte("0123456789abcdef0123456789abcdef")
+	sig, err := signer.Sign(rand.Reader, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bind := func(id []byte, sig *ssh.Signature) []byte {
+		return ssh.Marshal(struct {
+			HostKey    []byte
+			SessionID  []byte
+			Signature  []byte
+			Forwarding bool
+		}{signer.PublicKey().Marshal(), id, ssh.Marshal(sig), false})
+	}
+
+	hostKey, gotID, _, err := parseSessionBind(bind(sessionID, sig))
+	if err != nil {
+		t.Fatalf("valid bind: %v", err)
+	}
+	if !bytes.Equal(gotID, sessionID) {
+		t.Errorf("session id = %x, want %x", gotID, sessionID)
+	}
+	if ssh.FingerprintSHA256(hostKey) != ssh.FingerprintSHA256(signer.PublicKey()) {
+		t.Error("host key mismatch")
+	}
+
+	if _, _, _, err := parseSessionBind(bind([]byte("other-session"), sig)); err == nil {
+		t.Error("bind with signature over a different session id accepted")
+	}
+	if _, _, _, err := parseSessionBind([]byte{0, 0, 0, 9}); err == nil {
+		t.Error("truncated bind accepted")
+	}
+}
+
+func TestParseUserAuthSignData(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(priv)
+	pub := signer.PublicKey()
+	sessionID := []byte("session-id")
+
+	userauth := func(method string, extra ...[]byte) []byte {
+		data := ssh.Marshal(struct {
+			SessionID []byte
+			Type      byte
+			User      string
+			Service   string
+			Method    string
+			HasSig    bool
+			Algo      string
+			PubKey    []byte
+		}{sessionID, msgUserAuthRequest, "git", "ssh-connection", method, true, pub.Type(), pub.Marshal()})
+		for _, e := range extra {
+			data = append(data, ssh.Marshal(struct{ B []byte }{e})...)
+		}
+		return data
+	}
+
+	id, hk, ok := parseUserAuthSignData(userauth("publickey"))
+	if !ok || !bytes.Equal(id, sessionID) || hk != nil {
+		t.Errorf("publickey: id=%q hostKey=%v ok=%v", id, hk, ok)
+	}
+
+	id, hk, ok = parseUserAuthSignData(userauth("publickey-hostbound-v00@openssh.com", pub.Marshal()))
+	if !ok || !bytes.Equal(id, sessionID) || hk == nil {
+		t.Fatalf("hostbound: id=%q hostKey=%v ok=%v", id, hk, ok)
+	}
+	if !bytes.Equal(hk.Marshal(), pub.Marshal()) {
+		t.Error("hostbound: wrong host key")
+	}
+
+	for name, data := range map[string][]byte{
+		"arbitrary":       []byte("sign me"),
+		"other method":    userauth("password"),
+		"trailing bytes":  userauth("publickey", []byte("x")),
+		"bad hostbound":   userauth("publickey-hostbound-v00@openssh.com", []byte("nokey")),
+		"missing hostkey": userauth("publickey-hostbound-v00@openssh.com"),
+	} {
+		if _, _, ok := parseUserAuthSignData(data); ok {
+			t.Errorf("%s: recognized as userauth", name)
+		}
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// stall.go — outstanding write tracking
+// ────────────────────────────────────────────────────────────────────
+
+func TestMeteredConnPending(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	c := newMeteredConn(a)
+
+	go func() { _, _ = io.ReadFull(b, make([]byte, 4)) }()
+	if _, err := c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	first := c.pendingSince.Load()
+	if first == 0 {
+		t.Fatal("write did not mark data outstanding")
+	}
+
+	go func() { _, _ = io.ReadFull(b, make([]byte, 4)) }()
+	if _, err := c.Write([]byte("more")); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.pendingSince.Load(); got != first {
+		t.Error("second write moved the start of the outstanding window")
+	}
+
+	go func() { _, _ = b.Write([]byte("pong")) }()
+	if _, err := io.ReadFull(c, make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if c.pendingSince.Load() != 0 {
+		t.Error("read did not clear outstanding state")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// stall.go — stall detection
+// ────────────────────────────────────────────────────────────────────
+
+func TestWatchStall(t *testing.T) {
+	tests := []struct {
+		name    string
+		answers bool // the probe gets a reply
+		want    int  // onStall calls
+	}{
+		{"no echo, server alive", true, 0},
+		{"transport stalled", false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &meteredConn{}
+			c.pendingSince.Store(time.Now().UnixNano())
+			var mu sync.Mutex
+			stalls := 0
+			onStall := js.FuncOf(func(this js.Value, args []js.Value) any {
+				mu.Lock()
+				stalls++
+				mu.Unlock()
+				return nil
+			})
+			defer onStall.Release()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			watchStall(ctx, c, 40*time.Millisecond, js.ValueOf(onStall), func() {
+				if tt.answers {
+					c.pendingSince.Store(0)
+				}
+			})
+			mu.Lock()
+			defer mu.Unlock()
+			if stalls != tt.want {
+				t.Errorf("onStall called %d times, want %d", stalls, tt.want)
+			}
+		})
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp_transfer.go — streaming download idle timeout
+// ────────────────────────────────────────────────────────────────────
+
+func TestStreamStateWaitIdle(t *testing.T) {
+	newState := func() *streamState {
+		return &streamState{done: make(chan struct{}), activity: make(chan struct{}, 1)}
+	}
+
+	s := newState()
+	if s.wait(20 * time.Millisecond) {
+		t.Error("wait without activity did not time out")
+	}
+
+	// Pulls every 10ms keep a 30ms idle timeout from firing for 100ms.
+	s = newState()
+	go func() {
+		for i := 0; i < 10; i++ {
+			time.Sleep(10 * time.Millisecond)
+			s.touch()
+		}
+		s.closeDone()
+	}()
+	if !s.wait(30 * time.Millisecond) {
+		t.Error("active stream timed out")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// passthrough.go — request names and payloads
+// ────────────────────────────────────────────────────────────────────
+
+func TestValidateRequestName(t *testing.T) {
+	for _, name := range []string{"keepalive@openssh.com", "tcpip-forward", "x"} {
+		if err := validateRequestName(name); err != nil {
+			t.Errorf("%q rejected: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "has space", "tab\there", "ctl\x01", "caf\xc3\xa9", strings.Repeat("a", maxRequestNameLen+1)} {
+		if err := validateRequestName(name); err == nil {
+			t.Errorf("%q accepted", name)
+		}
+	}
+}
+
+func TestDecodePassthroughPayload(t *testing.T) {
+	if p, err := decodePassthroughPayload(""); err != nil || p != nil {
+		t.Errorf("empty payload: %v, %v", p, err)
+	}
+	if p, err := decodePassthroughPayload("aGVsbG8="); err != nil || string(p) != "hello" {
+		t.Errorf("valid payload: %q, %v", p, err)
+	}
+	if _, err := decodePassthroughPayload("not base64!"); err == nil {
+		t.Error("invalid base64 accepted")
+	}
+	max := base64.StdEncoding.EncodeToString(make([]byte, maxPassthroughPayload))
+	if _, err := decodePassthroughPayload(max); err != nil {
+		t.Errorf("payload at limit rejected: %v", err)
+	}
+	over := base64.StdEncoding.EncodeToString(make([]byte, maxPassthroughPayload+1))
+	if _, err := decodePassthroughPayload(over); err == nil {
+		t.Error("oversized payload accepted")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// ssh.go — server identification capture
+// ────────────────────────────────────────────────────────────────────
+
+func TestVersionConnObserve(t *testing.T) {
+	c := &versionConn{}
+	c.observe([]byte("hello from motd\r\nSSH-2.0-Open"))
+	if v := c.version(); v != "" {
+		t.Errorf("version before line end = %q", v)
+	}
+	c.observe([]byte("SSH_9.6\r\n\x00\x00\x01\x0c"))
+	if v := c.version(); v != "SSH-2.0-OpenSSH_9.6" {
+		t.Errorf("version = %q", v)
+	}
+	c.observe([]byte("SSH-2.0-Other\r\n"))
+	if v := c.version(); v != "SSH-2.0-OpenSSH_9.6" {
+		t.Errorf("version changed after capture: %q", v)
+	}
+
+	long := &versionConn{}
+	long.observe([]byte("SSH-2.0-" + strings.Repeat("x", 1000) + "\n"))
+	if v := long.version(); len(v) != maxVersionLineLen {
+		t.Errorf("long version length = %d, want %d", len(v), maxVersionLineLen)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp_tree.go — dir size and download with followSymlinks
+// ────────────────────────────────────────────────────────────────────
+
+func TestTreeFollowSymlinks(t *testing.T) {
+	s := newTestSession(t, "sess-tree-symlinks")
+	defer s.close("test done")
+	sftpID, err := openSFTPSession(s.id, js.Undefined())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _ := getSFTPSession(sftpID)
+	for _, dir := range []string{"/tree", "/tree/sub", "/outside"} {
+		if err := ss.client.Mkdir(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for p, content := range map[string]string{"/tree/a": "12345", "/tree/sub/b": "123", "/outside/c": "1234567"} {
+		f, err := ss.client.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = f.Write([]byte(content))
+		f.Close()
+	}
+	if err := ss.client.Symlink("/outside/c", "/tree/link"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, follow := range []bool{false, true} {
+		opts := js.ValueOf(map[string]any{"followSymlinks": follow})
+		got := awaitTestPromise(t, sftpDirSize(sftpID, "/tree", opts))
+		wantBytes, wantFiles := 8, 2
+		if follow {
+			wantBytes, wantFiles = 15, 3
+		}
+		if got.Get("bytes").Int() != wantBytes || got.Get("files").Int() != wantFiles || got.Get("dirs").Int() != 2 {
+			t.Errorf("follow=%v: dirSize = %d bytes, %d files, %d dirs; want %d, %d, 2", follow,
+				got.Get("bytes").Int(), got.Get("files").Int(), got.Get("dirs").Int(), wantBytes, wantFiles)
+		}
+
+		files := map[string]string{}
+		var dirs []string
+		onFile := js.FuncOf(func(this js.Value, args []js.Value) any {
+			files[args[0].String()] = string(uint8ArrayToBytes(args[1]))
+			return nil
+		})
+		onDir := js.FuncOf(func(this js.Value, args []js.Value) any {
+			dirs = append(dirs, args[0].String())
+			return nil
+		})
+		awaitTestPromise(t, sftpDownloadDir(sftpID, "/tree", js.ValueOf(map[string]any{
+			"followSymlinks": follow, "onFile": onFile, "onDir": onDir,
+		})))
+		onFile.Release()
+		onDir.Release()
+		want := map[string]string{"a": "12345", "sub/b": "123"}
+		if follow {
+			want["link"] = "1234567"
+		}
+		if !maps.Equal(files, want) || len(dirs) != 1 || dirs[0] != "sub" {
+			t.Errorf("follow=%v: downloadDir files = %v, dirs = %v; want %v, [sub]", follow, files, dirs, want)
+		}
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// ssh.go — exec output capture
+// ────────────────────────────────────────────────────────────────────
+
+func TestCappedBuffer(t *testing.T) {
+	b := &cappedBuffer{max: 8}
+	b.Write([]byte("12345"))
+	if b.truncated {
+		t.Fatal("truncated within cap")
+	}
+	if n, err := b.Write([]byte("6789")); n != 4 || err != nil {
+		t.Errorf("write past cap = %d, %v; want 4, nil", n, err)
+	}
+	b.Write([]byte("0"))
+	if !b.truncated {
+		t.Error("not marked truncated")
+	}
+	if got := b.String(); got != "12345678" {
+		t.Errorf("buffer = %q", got)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// ssh.go — exec PTY resize
+// ────────────────────────────────────────────────────────────────────
+
+func TestExecPtyResize(t *testing.T) {
+	windowChanges := make(chan []byte, 1)
+	resized := make(chan []byte, 1)
+	client := newTestSSHClientWith(t, testServer{request: func(req *ssh.Request, ch ssh.Channel) {
+		switch req.Type {
+		case "window-change":
+			windowChanges <- req.Payload
+		case "exec":
+			// Exit once resized.
+			go func() {
+				select {
+				case p := <-windowChanges:
+					resized <- p
+				case <-time.After(5 * time.Second):
+					resized <- nil
+				}
+				_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				ch.Close()
+			}()
+		}
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &session{id: "sess-exec-pty", ctx: ctx, cancel: cancel, sshClient: client}
+	sessionStore.Store(s.id, s)
+	defer s.close("test done")
+
+	opened := make(chan string, 1)
+	onPtyOpen := js.FuncOf(func(this js.Value, args []js.Value) any {
+		opened <- args[0].String()
+		return nil
+	})
+	defer onPtyOpen.Release()
+	promise := sshExec(s.id, "vim", js.ValueOf(map[string]any{
+		"pty":       map[string]any{"cols": 100, "rows": 30},
+		"onPtyOpen": onPtyOpen,
+	}))
+
+	var channelID string
+	select {
+	case channelID = <-opened:
+	case <-time.After(5 * time.Second):
+		t.Fatal("onPtyOpen not called")
+	}
+	if cols, rows, ok := s.ptySize(channelID); !ok || cols != 100 || rows != 30 {
+		t.Fatalf("ptySize = %dx%d, %v; want 100x30", cols, rows, ok)
+	}
+	sshResize(s.id, 132, 43, channelID)
+	awaitTestPromise(t, promise)
+
+	var size struct{ Cols, Rows, Width, Height uint32 }
+	if err := ssh.Unmarshal(<-resized, &size); err != nil || size.Cols != 132 || size.Rows != 43 {
+		t.Errorf("window-change = %+v, %v; want 132x43", size, err)
+	}
+	if _, _, ok := s.ptySize(channelID); ok {
+		t.Error("exec PTY still registered after the command exited")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// passthrough.go — close callbacks set after registration
+// ────────────────────────────────────────────────────────────────────
+
+func TestRawChannelSetOnClose(t *testing.T) {
+	for _, closeFirst := range []bool{false, true} {
+		a, b := net.Pipe()
+		defer b.Close()
+		rc := &rawChannel{id: generateID(), ch: a}
+		channelStore.Store(rc.id, rc)
+		calls := 0
+		onClose := js.FuncOf(func(this js.Value, args []js.Value) any {
+			calls++
+			return nil
+		})
+		if closeFirst {
+			rc.close()
+			rc.setOnClose(onClose.Value)
+		} else {
+			rc.setOnClose(onClose.Value)
+			rc.close()
+		}
+		rc.close()
+		onClose.Release()
+		if calls != 1 {
+			t.Errorf("closeFirst=%v: onClose called %d times, want 1", closeFirst, calls)
+		}
+		if storeHas(&channelStore, rc.id) {
+			t.Errorf("closeFirst=%v: channel still registered", closeFirst)
+		}
+	}
+}
+
+func storeHas(m *sync.Map, key string) bool {
+	_, ok := m.Load(key)
+	return ok
+}
+
+// ────────────────────────────────────────────────────────────────────
+// passthrough.go — openSubsystem
+// ────────────────────────────────────────────────────────────────────
+
+func TestOpenSubsystem(t *testing.T) {
+	client := newTestSSHClientWith(t, testServer{subsystem: func(_ ssh.Conn, req *ssh.Request, ch ssh.Channel) {
+		var sub struct{ Name string }
+		_ = ssh.Unmarshal(req.Payload, &sub)
+		if sub.Name != "echo" {
+			_ = req.Reply(false, nil)
+			return
+		}
+		_ = req.Reply(true, nil)
+		go func() { _, _ = io.Copy(ch, ch) }()
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &session{id: "sess-subsystem", ctx: ctx, cancel: cancel, cc: &clientConn{sshClient: client}, sshClient: client,
+		onData: js.Undefined(), onClose: js.Undefined()}
+	sessionStore.Store(s.id, s)
+	defer s.close("test done")
+
+	data := make(chan string, 1)
+	onData := js.FuncOf(func(this js.Value, args []js.Value) any {
+		b := make([]byte, args[0].Length())
+		js.CopyBytesToGo(b, args[0])
+		data <- string(b)
+		return nil
+	})
+	defer onData.Release()
+	channelID := awaitTestPromise(t, sshOpenSubsystem(s.id, "echo", js.ValueOf(map[string]any{"onData": onData}))).String()
+	awaitTestPromise(t, sshChannelWrite(channelID, bytesToUint8Array([]byte("hello"))))
+	select {
+	case got := <-data:
+		if got != "hello" {
+			t.Errorf("echoed %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no data from the subsystem")
+	}
+
+	actx, acancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer acancel()
+	if _, err := awaitPromise(actx, sshOpenSubsystem(s.id, "netconf", js.Undefined())); err == nil || !strings.Contains(err.Error(), "refused") {
+		t.Errorf("refused subsystem = %v", err)
+	}
+	if _, err := awaitPromise(actx, sshOpenSubsystem(s.id, "bad name", js.Undefined())); err == nil {
+		t.Error("invalid name accepted")
+	}
+
+	s.close("done")
+	if storeHas(&channelStore, channelID) {
+		t.Error("subsystem channel outlived its session")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// exec_time.go — remote timing
+// ────────────────────────────────────────────────────────────────────
+
+func TestTrailerSplitter(t *testing.T) {
+	var out bytes.Buffer
+	ts := &trailerSplitter{w: &out, marker: []byte("\nMARK\n")}
+	for _, chunk := range []string{"err one\n", "tail\n", "MA", "RK", "\n0m0.01s 0m0.00s\n", "0m1.50s 0m0.25s\n"} {
+		ts.Write([]byte(chunk))
+	}
+	ts.flush()
+	if got := out.String(); got != "err one\ntail" {
+		t.Errorf("passed through %q", got)
+	}
+	userMs, sysMs, ok := parseTimes(ts.trailer.String())
+	if !ok || userMs != 1500 || sysMs != 250 {
+		t.Errorf("parseTimes = %d, %d, %v", userMs, sysMs, ok)
+	}
+
+	// A partial marker at the end of the stream is ordinary output.
+	out.Reset()
+	ts = &trailerSplitter{w: &out, marker: []byte("\nMARK\n")}
+	ts.Write([]byte("done\nMA"))
+	ts.flush()
+	if got := out.String(); got != "done\nMA" {
+		t.Errorf("flushed %q", got)
+	}
+}
+
+func TestParseRealTime(t *testing.T) {
+	tests := []struct {
+		in     string
+		realMs int64
+		ok     bool
+	}{
+		{"1700000000.250000000 1700000002.000000000\n0m0.00s 0m0.00s\n", 1750, true},
+		{"1700000000.N 1700000003.N\n", 3000, true},   // date without %N
+		{"1700000000.%N 1700000001.%N\n", 1000, true}, // ... printed literally
+		{" \n0m0.00s 0m0.00s\n", 0, false},            // no date
+		{"5.0 4.0\n", 0, false},
+	}
+	for _, tt := range tests {
+		realMs, ok := parseRealTime(tt.in)
+		if realMs != tt.realMs || ok != tt.ok {
+			t.Errorf("parseRealTime(%q) = %d, %v; want %d, %v", tt.in, realMs, ok, tt.realMs, tt.ok)
+		}
+	}
+}
+
+func TestParseTimes(t *testing.T) {
+	tests := []struct {
+		in        string
+		user, sys int64
+		ok        bool
+	}{
+		{"0m0.001000s 0m0.002000s\n0m2.345000s 0m0.100000s\n", 2345, 100, true},
+		{"0m 0.00s 0m 0.00s\n1m 0.50s 0m 0.01s", 60500, 10, true},
+		{"garbage", 0, 0, false},
+	}
+	for _, tt := range tests {
+		user, sys, ok := parseTimes(tt.in)
+		if user != tt.user || sys != tt.sys || ok != tt.ok {
+			t.Errorf("parseTimes(%q) = %d, %d, %v", tt.in, user, sys, ok)
+		}
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// known_hosts.go — host key lookup
+// ────────────────────────────────────────────────────────────────────
+
+func TestKnownHostsCheck(t *testing.T) {
+	newKey := func() ssh.PublicKey {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	known, other, revoked := newKey(), newKey(), newKey()
+	line := func(hosts string, k ssh.PublicKey) string {
+		return hosts + " " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k)))
+	}
+	hashed := strings.Fields(knownhosts.Line([]string{knownhosts.HashHostname("hashed.example")}, known))[0]
+
+	db, err := parseKnownHosts(strings.Join([]string{
+		"# comment",
+		line("example.com,[example.com]:2222", known),
+		line("*.wild.example,!bad.wild.example", known),
+		line(hashed, known),
+		"@revoked * " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(revoked))),
+	}, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr string
+		key  ssh.PublicKey
+		want hostKeyVerdict
+	}{
+		{"example.com:22", known, hostKnown},
+		{"EXAMPLE.com:22", known, hostKnown},
+		{"example.com:2222", known, hostKnown},
+		{"example.com:22", other, hostChanged},
+		{"example.com:2200", known, hostUnknown},
+		{"a.wild.example:22", known, hostKnown},
+		{"bad.wild.example:22", known, hostUnknown},
+		{"hashed.example:22", known, hostKnown},
+		{"hashed.example:22", other, hostChanged},
+		{"elsewhere:22", other, hostUnknown},
+		{"elsewhere:22", revoked, hostRevoked},
+	}
+	for _, tt := range tests {
+		if got, _ := db.check(tt.addr, tt.key); got != tt.want {
+			t.Errorf("check(%s) = %d, want %d", tt.addr, got, tt.want)
+		}
+	}
+
+	if _, err := parseKnownHosts("example.com not-a-key"); err == nil {
+		t.Error("malformed entry parsed")
+	}
+}
+
+func TestHostKeyLookup(t *testing.T) {
+	newKey := func() ssh.PublicKey {
+		pub, _, _ := ed25519.GenerateKey(rand.Reader)
+		k, _ := ssh.NewPublicKey(pub)
+		return k
+	}
+	known, other := newKey(), newKey()
+	store := map[string]any{"known.example": knownhosts.Line([]string{"known.example"}, known), "bad.example": 42}
+	var learned []string
+	prompts := 0
+	funcs := map[string]js.Func{
+		"onHostKeyLookup": js.FuncOf(func(this js.Value, args []js.Value) any {
+			return store[args[0].String()] // a plain value; no Promise needed
+		}),
+		"onHostKeyLearn": js.FuncOf(func(this js.Value, args []js.Value) any {
+			learned = append(learned, args[0].String(), args[1].String())
+			return nil
+		}),
+		"onHostKey": js.FuncOf(func(this js.Value, args []js.Value) any {
+			prompts++
+			return js.Global().Get("Promise").Call("resolve", true)
+		}),
+	}
+	config := map[string]any{}
+	for name, f := range funcs {
+		defer f.Release()
+		config[name] = f
+	}
+	cb := makeHostKeyCallbackWithBanner(context.Background(), js.ValueOf(config), nil)
+
+	if err := cb("known.example:22", nil, known); err != nil || prompts != 0 {
+		t.Errorf("known key: err = %v, prompts = %d", err, prompts)
+	}
+	var ce *codedError
+	if err := cb("known.example:22", nil, other); !errors.As(err, &ce) || ce.code != errCodeHostKeyChanged || prompts != 0 {
+		t.Errorf("changed key: err = %v, prompts = %d", err, prompts)
+	}
+	if err := cb("new.example:2222", nil, known); err != nil || prompts != 1 {
+		t.Errorf("unknown host: err = %v, prompts = %d", err, prompts)
+	}
+	wantLine := knownhosts.Line([]string{"[new.example]:2222"}, known)
+	if len(learned) != 2 || learned[0] != "[new.example]:2222" || learned[1] != wantLine {
+		t.Errorf("learned %q, want [new.example]:2222 and %q", learned, wantLine)
+	}
+	if err := cb("bad.example:22", nil, known); err == nil || prompts != 1 {
+		t.Errorf("non-string lookup result: err = %v, prompts = %d", err, prompts)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// input.go — output notification
+// ────────────────────────────────────────────────────────────────────
+
+func TestOutputNotifier(t *testing.T) {
+	var n outputNotifier
+	n.notify() // no waiters: no-op
+	ch := n.next()
+	if n.next() != ch {
+		t.Error("waiters before the same output got different channels")
+	}
+	select {
+	case <-ch:
+		t.Fatal("closed before output")
+	default:
+	}
+	n.notify()
+	select {
+	case <-ch:
+	default:
+		t.Fatal("not closed after output")
+	}
+	if n.next() == ch {
+		t.Error("channel reused after notify")
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent writers, usable as a
+// shell's stdin.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Close() error { return nil }
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSendTextHoldsWrites(t *testing.T) {
+	stdin := &lockedBuffer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &session{id: "sess-send-text", ctx: ctx, cancel: cancel, stdin: stdin, onClose: js.Undefined()}
+	sessionStore.Store(s.id, s)
+	defer s.close("test done")
+
+	promise := sshSendText(s.id, strings.Repeat("a", 12), js.ValueOf(map[string]any{"chunkSize": 4, "interChunkDelayMs": 30}))
+	time.Sleep(15 * time.Millisecond) // after the first chunk
+	sshWrite(s.id, bytesToUint8Array([]byte("X")))
+	awaitTestPromise(t, promise)
+	if got := stdin.String(); got != "aaaaaaaaaaaaX" {
+		t.Errorf("stdin = %q, want the paste whole, then the keystroke", got)
+	}
+
+	sshWrite(s.id, bytesToUint8Array([]byte("Y")))
+	if got := stdin.String(); got != "aaaaaaaaaaaaXY" {
+		t.Errorf("stdin = %q after the paste, want writes to go straight through", got)
+	}
+}
+
+func TestInputRateLimit(t *testing.T) {
+	stdin := &lockedBuffer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &session{id: "sess-rate-limit", ctx: ctx, cancel: cancel, stdin: stdin, onClose: js.Undefined(),
+		inputLimit: newRateLimiter(100)}
+	sessionStore.Store(s.id, s)
+	defer s.close("test done")
+
+	if err := sshWrite(s.id, bytesToUint8Array(bytes.Repeat([]byte("a"), 60))); err != nil {
+		t.Fatalf("write within the burst: %v", err)
+	}
+	if err := sshWrite(s.id, bytesToUint8Array(bytes.Repeat([]byte("b"), 60))); err != errInputRateLimited {
+		t.Fatalf("write over the cap = %v, want errInputRateLimited", err)
+	}
+	if got := stdin.String(); got != strings.Repeat("a", 60) {
+		t.Errorf("stdin = %q, want only the first write", got)
+	}
+
+	// sendText waits for the bucket rather than failing: 40 bytes remain,
+	// so 60 more take about 0.2s at 100 bytes/s.
+	start := time.Now()
+	awaitTestPromise(t, sshSendText(s.id, strings.Repeat("c", 100), js.ValueOf(map[string]any{"chunkSize": 50, "interChunkDelayMs": 0})))
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("sendText took %v, want it paced by the limit", elapsed)
+	}
+	if got := len(stdin.String()); got != 160 {
+		t.Errorf("stdin has %d bytes, want 160", got)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// agent.go — key generation
+// ────────────────────────────────────────────────────────────────────
+
+func TestGenerateKey(t *testing.T) {
+	for _, tt := range []struct {
+		keyType string
+		bits    int
+		want    string
+	}{
+		{"ed25519", 0, ssh.KeyAlgoED25519},
+		{"ecdsa", 0, ssh.KeyAlgoECDSA256},
+		{"ecdsa", 384, ssh.KeyAlgoECDSA384},
+		{"ecdsa", 521, ssh.KeyAlgoECDSA521},
+	} {
+		priv, err := generateKey(tt.keyType, tt.bits)
+		if err != nil {
+			t.Errorf("generateKey(%s, %d): %v", tt.keyType, tt.bits, err)
+			continue
+		}
+		signer, err := ssh.NewSignerFromKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := signer.PublicKey().Type(); got != tt.want {
+			t.Errorf("generateKey(%s, %d) type = %s, want %s", tt.keyType, tt.bits, got, tt.want)
+		}
+	}
+
+	for _, bad := range []struct {
+		keyType string
+		bits    int
+	}{{"ed25519", 512}, {"ecdsa", 224}, {"rsa", 1024}, {"dsa", 0}} {
+		if _, err := generateKey(bad.keyType, bad.bits); err == nil {
+			t.Errorf("generateKey(%s, %d) succeeded", bad.keyType, bad.bits)
+		}
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// chunking.go — adaptive chunk sizing
+// ────────────────────────────────────────────────────────────────────
+
+func TestChunkSizer(t *testing.T) {
+	fixed := newChunkSizer(false)
+	fixed.observe(transferChunkSize, time.Millisecond)
+	if fixed.next() != transferChunkSize {
+		t.Errorf("fixed size changed to %d", fixed.next())
+	}
+
+	c := newChunkSizer(true)
+	if c.next() != minAdaptiveChunk {
+		t.Fatalf("initial size = %d, want %d", c.next(), minAdaptiveChunk)
+	}
+	c.observe(c.next(), time.Millisecond)
+	if c.next() != 2*minAdaptiveChunk {
+		t.Errorf("after a fast chunk size = %d, want %d", c.next(), 2*minAdaptiveChunk)
+	}
+	c.observe(100, time.Millisecond) // short read: no signal
+	if c.next() != 2*minAdaptiveChunk {
+		t.Errorf("short read changed size to %d", c.next())
+	}
+	for i := 0; i < 20; i++ {
+		c.observe(c.next(), time.Millisecond)
+	}
+	if c.next() != maxAdaptiveChunk {
+		t.Errorf("size = %d, want cap %d", c.next(), maxAdaptiveChunk)
+	}
+
+	c.observe(c.next(), adaptiveStallChunk)
+	if c.next() != maxAdaptiveChunk/2 {
+		t.Errorf("after a stall size = %d, want %d", c.next(), maxAdaptiveChunk/2)
+	}
+	// Past a stall, growth is linear.
+	c.observe(c.next(), time.Millisecond)
+	if want := maxAdaptiveChunk/2 + minAdaptiveChunk; c.next() != want {
+		t.Errorf("after recovery size = %d, want %d", c.next(), want)
+	}
+	for i := 0; i < 20; i++ {
+		c.observe(c.next(), 10*time.Second)
+	}
+	if c.next() != minAdaptiveChunk {
+		t.Errorf("size = %d, want floor %d", c.next(), minAdaptiveChunk)
+	}
+}
+
+// simulatedLink models an SFTP transfer: pkg/sftp pipelines a chunk's
+// packets, so a chunk costs one round trip plus its transmission time.
+// Every stallEvery-th chunk (if set) stalls for stall.
+type simulatedLink struct {
+	rtt        time.Duration
+	bytesPerS  float64
+	stallEvery int
+	stall      time.Duration
+}
+
+func (l simulatedLink) cost(n, i int) time.Duration {
+	d := l.rtt + time.Duration(float64(n)/l.bytesPerS*float64(time.Second))
+	if l.stallEvery > 0 && i%l.stallEvery == l.stallEvery-1 {
+		d += l.stall
+	}
+	return d
+}
+
+// BenchmarkChunkSizer transfers 64MB over simulated links on a virtual
+// clock and reports the resulting throughput as MB/s.
+func BenchmarkChunkSizer(b *testing.B) {
+	const total = 64 << 20
+	links := []struct {
+		name string
+		link simulatedLink
+	}{
+		{"lan", simulatedLink{rtt: time.Millisecond, bytesPerS: 100e6}},
+		{"broadband", simulatedLink{rtt: 30 * time.Millisecond, bytesPerS: 10e6}},
+		{"mobile", simulatedLink{rtt: 150 * time.Millisecond, bytesPerS: 1e6, stallEvery: 40, stall: 3 * time.Second}},
+	}
+	for _, l := range links {
+		for _, adaptive := range []bool{false, true} {
+			name := l.name + "/fixed"
+			if adaptive {
+				name = l.name + "/adaptive"
+			}
+			b.Run(name, func(b *testing.B) {
+				var elapsed time.Duration
+				for i := 0; i < b.N; i++ {
+					c := newChunkSizer(adaptive)
+					for sent, chunk := 0, 0; sent < total; chunk++ {
+						n := min(c.next(), total-sent)
+						d := l.link.cost(n, chunk)
+						c.observe(n, d)
+						elapsed += d
+						sent += n
+					}
+				}
+				b.ReportMetric(float64(total)*float64(b.N)/elapsed.Seconds()/1e6, "MB/s")
+			})
+		}
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// agent_confirm.go — confirm-before-use keys
+// ────────────────────────────────────────────────────────────────────
+
+func TestConfirmAgent(t *testing.T) {
+	a := newConfirmAgent()
+	plain, _ := generateKey("ed25519", 0)
+	guarded, _ := generateKey("ed25519", 0)
+	if err := a.Add(agent.AddedKey{PrivateKey: plain}); err != nil {
+		t.Fatal(err)
+	}
+	// A non-function callback can never approve, so signing is refused
+	// without reaching JS.
+	guardedSigner, _ := ssh.NewSignerFromKey(guarded)
+	fp := ssh.FingerprintSHA256(guardedSigner.PublicKey())
+	if err := a.addConfirmed(agent.AddedKey{PrivateKey: guarded, ConfirmBeforeUse: true}, fp, js.Null()); err != nil {
+		t.Fatal(err)
+	}
+
+	signers, err := a.Signers()
+	if err != nil || len(signers) != 2 {
+		t.Fatalf("Signers = %d, %v", len(signers), err)
+	}
+	for _, s := range signers {
+		_, sigErr := s.Sign(rand.Reader, []byte("data"))
+		_, agentErr := a.Sign(s.PublicKey(), []byte("data"))
+		if ssh.FingerprintSHA256(s.PublicKey()) == fp {
+			if sigErr != errAgentSignDenied || agentErr != errAgentSignDenied {
+				t.Errorf("guarded key signed: %v, %v", sigErr, agentErr)
+			}
+			if _, ok := s.(ssh.MultiAlgorithmSigner); !ok {
+				t.Error("guarded signer lost algorithm selection")
+			}
+		} else if sigErr != nil || agentErr != nil {
+			t.Errorf("plain key: %v, %v", sigErr, agentErr)
+		}
+	}
+
+	// Re-adding without the constraint lifts it.
+	if err := a.Add(agent.AddedKey{PrivateKey: guarded}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.needsConfirm(fp); ok {
+		t.Error("constraint kept after re-adding without it")
+	}
+}
+
+func TestConfirmAgentLock(t *testing.T) {
+	a := newConfirmAgent()
+	priv, _ := generateKey("ed25519", 0)
+	if err := a.Add(agent.AddedKey{PrivateKey: priv}); err != nil {
+		t.Fatal(err)
+	}
+	pass := []byte("hunter2")
+	if err := a.Lock(pass); err != nil {
+		t.Fatal(err)
+	}
+	scrubBytes(pass) // the keyring must not depend on the caller's copy
+
+	locked, keys := a.lockState()
+	if !locked || len(keys) != 1 {
+		t.Fatalf("lockState = %v, %d keys; want locked with 1 key", locked, len(keys))
+	}
+	if _, err := a.Signers(); err == nil {
+		t.Error("Signers succeeded while locked")
+	}
+	if err := a.Unlock([]byte("wrong")); err == nil {
+		t.Error("Unlock succeeded with the wrong passphrase")
+	}
+	if err := a.Unlock([]byte("hunter2")); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if locked, _ := a.lockState(); locked {
+		t.Error("still locked after Unlock")
+	}
+	if signers, err := a.Signers(); err != nil || len(signers) != 1 {
+		t.Errorf("Signers after unlock = %d, %v", len(signers), err)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// transport.go — read coalescing
+// ────────────────────────────────────────────────────────────────────
+
+// newQueuedWSConn returns a wsConn with frames already queued, as if the
+// browser had delivered them.
+func newQueuedWSConn(frames, size int, noCoalesce bool) *wsConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &wsConn{ctx: ctx, cancel: cancel, readCh: make(chan []byte, frames), noCoalesce: noCoalesce}
+	for i := 0; i < frames; i++ {
+		c.readCh <- make([]byte, size)
+	}
+	return c
+}
+
+func TestWSConnReadCoalescing(t *testing.T) {
+	buf := make([]byte, 1024)
+	if n, _ := newQueuedWSConn(4, 100, false).Read(buf); n != 400 {
+		t.Errorf("coalescing read = %d bytes, want 400", n)
+	}
+	if n, _ := newQueuedWSConn(4, 100, true).Read(buf); n != 100 {
+		t.Errorf("non-coalescing read = %d bytes, want 100", n)
+	}
+}
+
+func TestWSDialError(t *testing.T) {
+	for _, tt := range []struct {
+		err      error
+		code     string
+		contains string
+	}{
+		{&wsCloseError{code: 4401, reason: "unauthorized", dialing: true}, errCodeWSProxyRejected, "proxy rejected: 4401 unauthorized"},
+		{&wsCloseError{code: 1008}, errCodeWSProxyRejected, "proxy rejected: code 1008"},
+		{&wsCloseError{code: 1006, dialing: true}, errCodeWSDialFailed, "dial failed: code 1006 (unreachable"},
+		{&wsCloseError{code: 1011, reason: "upstream down", dialing: true}, errCodeWSDialFailed, "dial failed: 1011 upstream down"},
+		{errDialTimeout, errCodeWSDialTimeout, "timed out"},
+		{errDialFailed, errCodeWSDialFailed, "failed to establish WebSocket"},
+	} {
+		err := wsDialError("connect: failed to establish WebSocket", tt.err)
+		var ce *codedError
+		if !errors.As(err, &ce) || ce.code != tt.code || !strings.Contains(ce.msg, tt.contains) {
+			t.Errorf("%v: got %v, want code %s containing %q", tt.err, err, tt.code, tt.contains)
+		}
+	}
+	if !errors.Is(&wsCloseError{code: 1006, dialing: true}, errDialFailed) || !errors.Is(&wsCloseError{code: 1000}, errWSClosed) {
+		t.Error("close errors don't match the errors they replace")
+	}
+	if wsRejection(nil) != nil || wsRejection(&wsConn{closeEvent: &wsCloseError{code: 1000}}) != nil {
+		t.Error("normal close reported as a rejection")
+	}
+	if wsRejection(&wsConn{closeEvent: &wsCloseError{code: 4403}}) == nil {
+		t.Error("4403 close not reported as a rejection")
+	}
+}
+
+func TestWSConnOverflow(t *testing.T) {
+	c := newQueuedWSConn(0, 0, true)
+	c.readCh = make(chan []byte, 2)
+	c.overflowCap = 12
+	defer c.cancel()
+	for i := range 5 {
+		if err := c.enqueue([]byte{byte(i), byte(i), byte(i)}); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	if c.overflowBytes != 9 {
+		t.Errorf("overflow holds %d bytes, want 9", c.overflowBytes)
+	}
+	if err := c.enqueue(make([]byte, 4)); err != errWSBackpress {
+		t.Errorf("enqueue past the cap = %v, want errWSBackpress", err)
+	}
+
+	// Reading frees room, but later messages queue behind the overflow.
+	buf := make([]byte, 3)
+	if _, _ = c.Read(buf); buf[0] != 0 {
+		t.Fatalf("first read = %v", buf)
+	}
+	if err := c.enqueue([]byte{5, 5, 5}); err != nil {
+		t.Fatal(err)
+	}
+	for want := byte(1); want <= 5; want++ {
+		if n, _ := c.Read(buf); n != 3 || buf[0] != want {
+			t.Fatalf("read %v, want message %d", buf[:n], want)
+		}
+	}
+	if c.overflow != nil || c.overflowBytes != 0 {
+		t.Errorf("overflow not released: %d messages, %d bytes", len(c.overflow), c.overflowBytes)
+	}
+}
+
+func TestWSOptionsFromConfig(t *testing.T) {
+	for _, tt := range []struct {
+		transport any
+		want      WSOptions
+		wantErr   bool
+	}{
+		{nil, WSOptions{}, false},
+		{map[string]any{"readBufferFrames": 16384, "writeChunkBytes": 65536}, WSOptions{ReadBufferFrames: 16384, WriteChunkBytes: 65536}, false},
+		{map[string]any{"maxMessageBytes": 64 * 1024 * 1024}, WSOptions{MaxMessageBytes: 64 * 1024 * 1024}, false},
+		{map[string]any{"writeChunkBytes": 512}, WSOptions{}, true},
+		{map[string]any{"writeChunkBytes": 512 * 1024}, WSOptions{}, true},
+		{map[string]any{"readBufferFrames": 0}, WSOptions{}, true},
+		{map[string]any{"overflowBytes": 1024}, WSOptions{}, true},
+		{map[string]any{"maxMessageBytes": "8MB"}, WSOptions{}, true},
+	} {
+		got, err := wsOptionsFromConfig(js.ValueOf(map[string]any{"transport": tt.transport}))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: err = %v", tt.transport, err)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: options = %+v, want %+v", tt.transport, got, tt.want)
+		}
+	}
+	got, _ := wsOptionsFromConfig(js.ValueOf(map[string]any{"coalesceReads": false}))
+	if !got.NoReadCoalescing {
+		t.Error("coalesceReads: false not applied")
+	}
+}
+
+func TestWSSubprotocolsFromConfig(t *testing.T) {
+	for _, tt := range []struct {
+		config  map[string]any
+		want    []string
+		wantErr bool
+	}{
+		{map[string]any{}, nil, false},
+		{map[string]any{"wsSubprotocols": []any{"ssh", "v2.ssh"}}, []string{"ssh", "v2.ssh"}, false},
+		{map[string]any{"wsSubprotocols": []any{"ssh"}, "wsProtocolAuth": "a b/c"}, []string{"ssh", "base64url.bearer.YSBiL2M"}, false},
+		{map[string]any{"wsSubprotocols": []any{"has space"}}, nil, true},
+		{map[string]any{"wsSubprotocols": []any{""}}, nil, true},
+		{map[string]any{"wsSubprotocols": []any{"ssh", "ssh"}}, nil, true},
+		{map[string]any{"wsSubprotocols": "ssh"}, nil, true},
+	} {
+		got, err := wsSubprotocolsFromConfig(js.ValueOf(tt.config))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: err = %v", tt.config, err)
+			continue
+		}
+		if !tt.wantErr && !slices.Equal(got, tt.want) {
+			t.Errorf("%v: subprotocols = %q, want %q", tt.config, got, tt.want)
+		}
+	}
+}
+
+// BenchmarkWSConnRead drains a queue of small frames (typical interactive
+// traffic) with and without coalescing. Coalescing needs far fewer Read
+// calls per byte; without it every frame is delivered on its own, so the
+// first byte of each reaches SSH without waiting for the rest of the batch.
+func BenchmarkWSConnRead(b *testing.B) {
+	const frames, size = 256, 64
+	for _, bc := range []struct {
+		name       string
+		noCoalesce bool
+	}{{"coalesce", false}, {"noCoalesce", true}} {
+		b.Run(bc.name, func(b *testing.B) {
+			buf := make([]byte, 32*1024)
+			reads := 0
+			b.SetBytes(frames * size)
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				c := newQueuedWSConn(frames, size, bc.noCoalesce)
+				b.StartTimer()
+				for got := 0; got < frames*size; reads++ {
+					n, _ := c.Read(buf)
+					got += n
+				}
+				c.cancel()
+			}
+			b.ReportMetric(float64(reads)/float64(b.N), "reads/op")
+		})
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// teardown.go — session teardown
+// ────────────────────────────────────────────────────────────────────
+
+// TestSessionTeardown opens one of each per-session resource and checks
+// that closing the session releases them all, leaving no goroutines behind.
+func TestSessionTeardown(t *testing.T) {
+	before := liveGoroutines()
+
+	noop := js.FuncOf(func(js.Value, []js.Value) any { return nil })
+	defer noop.Release()
+
+	s := newTestSession(t, "sess-teardown")
+	client := s.sshClient
+	shell, err := openShell(&clientConn{sshClient: client}, js.ValueOf(map[string]any{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.sshSession, s.stdin = shell.session, shell.stdin
+	s.startShellReaders(shell, js.ValueOf(map[string]any{}))
+
+	sftpID, err := openSFTPSession(s.id, js.Undefined())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _ := getSFTPSession(sftpID)
+	f, err := ss.client.Create("/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	handleID := awaitTestPromise(t, sftpFileOpen(sftpID, "/data", "r+")).String()
+	uploadID := awaitTestPromise(t, sftpUploadStreamStart(sftpID, "/upload", 4, js.Undefined())).String()
+	tailID := awaitTestPromise(t, sftpTailMany(sftpID, js.ValueOf([]any{"/data"}),
+		js.ValueOf(map[string]any{"onData": noop}))).String()
+
+	streamFile, err := ss.client.Open("/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const streamID = "dddddddddddddddddddddddddddddddd"
+	stream := &streamState{sftpID: sftpID, file: streamFile, done: make(chan struct{})}
+	activeStreams.Store(streamID, stream)
+
+	fwdCtx, fwdCancel := context.WithCancel(context.Background())
+	tunnel, tunnelPeer := net.Pipe()
+	fwd := &portForward{id: "fwd-teardown", sessionID: s.id, ctx: fwdCtx, cancel: fwdCancel, tunnelConn: tunnel}
+	forwardStore.Store(fwd.id, fwd)
+	go func() { _, _ = io.Copy(io.Discard, tunnelPeer) }()
+
+	remote := awaitTestPromise(t, portForwardRemoteStart(s.id,
+		js.ValueOf(map[string]any{"remotePort": 0, "onConnection": noop})))
+	channelID := awaitTestPromise(t, sshOpenChannel(s.id, "session", "", js.Undefined())).String()
+
+	s.close("test teardown")
+
+	for name, gone := range map[string]bool{
+		"session":       !storeHas(&sessionStore, s.id),
+		"sftp":          !storeHas(&sftpStore, sftpID),
+		"file handle":   !storeHas(&fileHandleStore, handleID),
+		"upload":        !storeHas(&activeUploads, uploadID),
+		"tail":          !storeHas(&activeTails, tailID),
+		"stream":        !storeHas(&activeStreams, streamID) && stream.cancelled.Load(),
+		"forward":       !storeHas(&forwardStore, fwd.id) && fwdCtx.Err() != nil,
+		"remoteForward": !storeHas(&remoteForwardStore, remote.Get("id").String()),
+		"channel":       !storeHas(&channelStore, channelID),
+	} {
+		if !gone {
+			t.Errorf("%s not released", name)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for liveGoroutines() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := liveGoroutines(); n > before {
+		t.Errorf("%d goroutines after teardown, %d before", n, before)
+	}
+}
+
+// liveGoroutines counts goroutines, leaving out the one the runtime parks
+// to handle JS events, which comes and goes with JS callbacks.
+func liveGoroutines() int {
+	buf := make([]byte, 1<<20)
+	stacks := string(buf[:runtime.Stack(buf, true)])
+	return strings.Count("\n"+stacks, "\ngoroutine ") - strings.Count(stacks, "runtime.handleEvent(")
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp.go — ownership and timestamps
+// ────────────────────────────────────────────────────────────────────
+
+func TestParseMillis(t *testing.T) {
+	for _, v := range []js.Value{js.Undefined(), js.Null()} {
+		if _, ok, err := parseMillis(v); ok || err != nil {
+			t.Errorf("parseMillis(%v) = %v, %v; want unset", v, ok, err)
+		}
+	}
+	got, ok, err := parseMillis(js.ValueOf(1700000000123))
+	if !ok || err != nil || got.UnixMilli() != 1700000000123 {
+		t.Errorf("parseMillis(1700000000123) = %v, %v, %v", got, ok, err)
+	}
+	for _, bad := range []js.Value{js.ValueOf(-1), js.ValueOf(maxSFTPTimeMillis + 1), js.ValueOf(math.NaN()), js.ValueOf("0")} {
+		if _, _, err := parseMillis(bad); err == nil {
+			t.Errorf("parseMillis(%v) succeeded", bad)
+		}
+	}
+}
+
+// TestSFTPChtimesKeepsAtime checks that a null atime is filled in from
+// Stat; the in-memory server accepts but ignores the times themselves.
+func TestSFTPChtimesKeepsAtime(t *testing.T) {
+	s := newTestSession(t, "sess-chtimes")
+	defer s.close("test done")
+	sftpID, err := openSFTPSession(s.id, js.Undefined())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _ := getSFTPSession(sftpID)
+	f, err := ss.client.Create("/stamped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	awaitTestPromise(t, sftpChtimes(sftpID, "/stamped", js.Null(), js.ValueOf(1600000000000)))
+	promise := sftpChtimes(sftpID, "/missing", js.Null(), js.ValueOf(1600000000000))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := awaitPromise(ctx, promise); err == nil || !strings.Contains(err.Error(), "stat") {
+		t.Errorf("chtimes on a missing file = %v, want a stat error", err)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// diagnostics.go — goroutine accounting
+// ────────────────────────────────────────────────────────────────────
+
+func TestSpawnCounts(t *testing.T) {
+	count := func() int {
+		v := diagnostics().Get("goroutines").Get("test.block")
+		if v.IsUndefined() {
+			return 0
+		}
+		return v.Int()
+	}
+
+	release := make(chan struct{})
+	spawn("test.block", func() { <-release }) // before enabling: not counted
+	enableDiagnostics(true)
+	defer enableDiagnostics(false)
+	done := make(chan struct{})
+	spawn("test.block", func() { <-release; close(done) })
+	if n := count(); n != 1 {
+		t.Errorf("count while running = %d, want 1", n)
+	}
+
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("goroutine did not exit")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for count() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := count(); n != 0 {
+		t.Errorf("count after exit = %d, want 0", n)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp_tree.go — tree upload
+// ────────────────────────────────────────────────────────────────────
+
+func TestSFTPUploadTree(t *testing.T) {
+	s := newTestSession(t, "sess-upload-tree")
+	defer s.close("test done")
+	sftpID, err := openSFTPSession(s.id, js.Undefined())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _ := getSFTPSession(sftpID)
+	entry := func(rel, content string) any {
+		return map[string]any{"relativePath": rel, "data": bytesToUint8Array([]byte(content))}
+	}
+
+	var last [2]int
+	onProgress := js.FuncOf(func(this js.Value, args []js.Value) any {
+		last = [2]int{args[0].Int(), args[1].Int()}
+		return nil
+	})
+	defer onProgress.Release()
+	got := awaitTestPromise(t, sftpUploadTree(sftpID, "/backup", js.ValueOf([]any{
+		entry("README", "hello"),
+		entry("src/a/main.go", "package a"),
+		entry("src/b.go", "b"),
+	}), onProgress.Value, js.Undefined()))
+	if got.Get("files").Int() != 3 || got.Get("bytes").Int() != 15 || last != [2]int{15, 15} {
+		t.Errorf("result = %d files, %d bytes, last progress %v", got.Get("files").Int(), got.Get("bytes").Int(), last)
+	}
+	for p, want := range map[string]string{"/backup/README": "hello", "/backup/src/a/main.go": "package a", "/backup/src/b.go": "b"} {
+		f, err := ss.client.Open(p)
+		if err != nil {
+			t.Errorf("%s: %v", p, err)
+			continue
+		}
+		data, _ := io.ReadAll(f)
+		f.Close()
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", p, data, want)
+		}
+	}
+
+	// Entries that escape the base are refused before anything is written.
+	for _, bad := range []string{"../etc/passwd", "/abs", "a/../../x", ""} {
+		promise := sftpUploadTree(sftpID, "/backup", js.ValueOf([]any{entry("ok", "x"), entry(bad, "x")}), js.Undefined(), js.Undefined())
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := awaitPromise(ctx, promise)
+		cancel()
+		if err == nil {
+			t.Errorf("relativePath %q accepted", bad)
+		}
+	}
+	if _, err := ss.client.Stat("/backup/ok"); err == nil {
+		t.Error("a file was written before validation failed")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp_transfer.go — resumed streaming upload
+// ────────────────────────────────────────────────────────────────────
+
+func TestUploadStreamResume(t *testing.T) {
+	s := newTestSession(t, "sess-upload-resume")
+	defer s.close("test done")
+	sftpID, err := openSFTPSession(s.id, js.Undefined())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _ := getSFTPSession(sftpID)
+	f, err := ss.client.Create("/partial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("hello "))
+	f.Close()
+
+	resume := js.ValueOf(map[string]any{"resume": true})
+	started := awaitTestPromise(t, sftpUploadStreamStart(sftpID, "/partial", 11, resume))
+	if got := started.Get("offset").Int(); got != 6 {
+		t.Fatalf("offset = %d, want 6", got)
+	}
+	uploadID := started.Get("uploadId").String()
+	if got := sftpUploadStreamStatus(uploadID).Get("written").Int(); got != 6 {
+		t.Errorf("written before any write = %d, want 6", got)
+	}
+	awaitTestPromise(t, sftpUploadStreamWrite(uploadID, bytesToUint8Array([]byte("world"))))
+	awaitTestPromise(t, sftpUploadStreamEnd(uploadID))
+	f, err = ss.client.Open("/partial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "hello world" {
+		t.Errorf("resumed file = %q, want %q", data, "hello world")
+	}
+
+	// A missing file starts from zero.
+	started = awaitTestPromise(t, sftpUploadStreamStart(sftpID, "/fresh", 3, resume))
+	if got := started.Get("offset").Int(); got != 0 {
+		t.Errorf("offset for a missing file = %d, want 0", got)
+	}
+	sftpUploadStreamCancel(started.Get("uploadId").String())
+
+	// A remote file longer than the upload isn't a prefix of it.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := awaitPromise(ctx, sftpUploadStreamStart(sftpID, "/partial", 4, resume)); err == nil || !strings.Contains(err.Error(), "larger than the upload") {
+		t.Errorf("resume onto a longer file = %v, want a mismatch", err)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp_checksum.go — remote file digests
+// ────────────────────────────────────────────────────────────────────
+
+func TestSFTPChecksum(t *testing.T) {
+	s := newTestSession(t, "sess-checksum")
+	defer s.close("test done")
+	sftpID, err := openSFTPSession(s.id, js.Undefined())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _ := getSFTPSession(sftpID)
+	f, err := ss.client.Create("/sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("abc"), transferChunkSize) // three chunks
+	f.Write(data)
+	f.Close()
+
+	var calls int
+	var last float64
+	onProgress := js.FuncOf(func(this js.Value, args []js.Value) any {
+		calls++
+		last = args[0].Float()
+		return nil
+	})
+	defer onProgress.Release()
+	sha := sha256.Sum256(data)
+	for algo, want := range map[string]string{
+		"sha256": hex.EncodeToString(sha[:]),
+		"crc32":  fmt.Sprintf("%08x", crc32.ChecksumIEEE(data)),
+	} {
+		got := awaitTestPromise(t, sftpChecksum(sftpID, "/sum", algo, onProgress.Value, js.Undefined())).String()
+		if got != want {
+			t.Errorf("%s = %s, want %s", algo, got, want)
+		}
+	}
+	if calls != 6 || last != float64(len(data)) {
+		t.Errorf("progress: %d calls ending at %v, want 6 ending at %d", calls, last, len(data))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := awaitPromise(ctx, sftpChecksum(sftpID, "/sum", "sha1", js.Undefined(), js.Undefined())); err == nil {
+		t.Error("unsupported algorithm accepted")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// diagnostics.go — memory stats and collection
+// ────────────────────────────────────────────────────────────────────
+
+func TestMemStats(t *testing.T) {
+	before := heldBytes.exec.Load()
+	o := newExecOutput(js.Undefined(), true, false)
+	_, _ = o.Write([]byte("12345"))
+	defer heldBytes.exec.Add(-int64(o.buf.Len()))
+
+	m := memStats()
+	if m.Get("heapSys").Float() <= 0 || m.Get("heapAlloc").Float() <= 0 {
+		t.Errorf("heap stats missing: %v", m)
+	}
+	held := m.Get("held")
+	if got := int64(held.Get("exec").Float()); got != before+5 {
+		t.Errorf("held.exec = %d, want %d", got, before+5)
+	}
+	if held.Get("total").Float() < held.Get("exec").Float() {
+		t.Errorf("held.total = %v, less than held.exec", held.Get("total"))
+	}
+}
+
+func TestAfterTransferCollects(t *testing.T) {
+	numGC := func() uint32 {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return m.NumGC
+	}
+	defer setAutoCollectGarbage(0)
+
+	setAutoCollectGarbage(1 << 20)
+	before := numGC()
+	afterTransfer(1 << 20)
+	deadline := time.Now().Add(5 * time.Second)
+	for numGC() == before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if numGC() == before {
+		t.Error("no collection after a transfer at the threshold")
+	}
+
+	enableDiagnostics(true)
+	defer enableDiagnostics(false)
+	afterTransfer(1<<20 - 1)
+	setAutoCollectGarbage(0)
+	afterTransfer(1 << 30)
+	if n := diagnostics().Get("goroutines").Get("gc"); !n.IsUndefined() {
+		t.Errorf("collection scheduled below the threshold or while off (%v running)", n)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// x11.go — X11 channels and forwarding
+// ────────────────────────────────────────────────────────────────────
+
+func TestX11ChannelRejected(t *testing.T) {
+	openErr := make(chan error, 1)
+	client := newTestSSHClientWith(t, testServer{
+		subsystem: func(conn ssh.Conn, req *ssh.Request, ch ssh.Channel) {
+			_ = req.Reply(true, nil)
+			_, _, err := conn.OpenChannel(x11ChannelType, ssh.Marshal(x11ChannelData{"10.0.0.5", 6010}))
+			openErr <- err
+		},
+	})
+	defer client.Close()
+
+	reported := make(chan string, 1)
+	onRequest := js.FuncOf(func(this js.Value, args []js.Value) any {
+		reported <- fmt.Sprintf("%s:%d", args[0].Get("originatorAddress").String(), args[0].Get("originatorPort").Int())
+		return nil
+	})
+	defer onRequest.Release()
+	handleX11Channels(client, onRequest.Value, nil)
+
+	sess, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+	if err := sess.RequestSubsystem("x11-trigger"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-reported:
+		if got != "10.0.0.5:6010" {
+			t.Errorf("reported %s, want 10.0.0.5:6010", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("onX11Request not called")
+	}
+	var openChanErr *ssh.OpenChannelError
+	if err := <-openErr; !errors.As(err, &openChanErr) || openChanErr.Reason != ssh.Prohibited {
+		t.Errorf("x11 channel open = %v, want rejected as prohibited", err)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// x11.go — X11 forwarding
+// ────────────────────────────────────────────────────────────────────
+
+func TestX11RewriteSetup(t *testing.T) {
+	fake := bytes.Repeat([]byte{0xfa}, x11CookieLen)
+	real := bytes.Repeat([]byte{0x5e}, x11CookieLen)
+	setup := func(order binary.ByteOrder, name string, data []byte) []byte {
+		b := make([]byte, 12)
+		b[0] = 'l'
+		if order == binary.BigEndian {
+			b[0] = 'B'
+		}
+		order.PutUint16(b[2:], 11)
+		order.PutUint16(b[6:], uint16(len(name)))
+		order.PutUint16(b[8:], uint16(len(data)))
+		b = append(b, name...)
+		b = append(b, make([]byte, pad4(len(name))-len(name))...)
+		b = append(b, data...)
+		return append(b, make([]byte, pad4(len(data))-len(data))...)
+	}
+
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		f := &x11Forward{fakeCookie: fake, realCookie: real}
+		got, err := f.rewriteSetup(bytes.NewReader(setup(order, x11AuthProtocol, fake)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := setup(order, x11AuthProtocol, real); !bytes.Equal(got, want) {
+			t.Errorf("%v: rewritten setup = %x, want %x", order, got, want)
+		}
+
+		f.realCookie = nil
+		got, err = f.rewriteSetup(bytes.NewReader(setup(order, x11AuthProtocol, fake)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := setup(order, "", nil); !bytes.Equal(got, want) {
+			t.Errorf("%v: setup without a real cookie = %x, want %x", order, got, want)
+		}
+	}
+
+	f := &x11Forward{fakeCookie: fake, realCookie: real}
+	for name, msg := range map[string][]byte{
+		"wrong cookie":   setup(binary.BigEndian, x11AuthProtocol, real),
+		"no auth":        setup(binary.BigEndian, "", nil),
+		"other protocol": setup(binary.BigEndian, "XDM-AUTHORIZATION-1", fake),
+		"bad byte order": append([]byte{'x'}, setup(binary.BigEndian, x11AuthProtocol, fake)[1:]...),
+		"short":          setup(binary.BigEndian, x11AuthProtocol, fake)[:20],
+	} {
+		if _, err := f.rewriteSetup(bytes.NewReader(msg)); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestX11Bridge(t *testing.T) {
+	fake := bytes.Repeat([]byte{0xfa}, x11CookieLen)
+	f := &x11Forward{fakeCookie: fake}
+	remote, ch := net.Pipe()
+	display, conn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		f.bridge(ch, conn)
+		close(done)
+	}()
+
+	hdr := []byte{'B', 0, 0, 11, 0, 0, 0, 18, 0, 16, 0, 0}
+	msg := append(append(append(hdr, x11AuthProtocol...), 0, 0), fake...)
+	go func() { _, _ = remote.Write(append(msg, "req"...)) }()
+	got := make([]byte, 15)
+	if _, err := io.ReadFull(display, got); err != nil {
+		t.Fatal(err)
+	}
+	if want := append([]byte{'B', 0, 0, 11, 0, 0, 0, 0, 0, 0, 0, 0}, "req"...); !bytes.Equal(got, want) {
+		t.Errorf("display got %x, want %x", got, want)
+	}
+	go func() { _, _ = display.Write([]byte("reply")) }()
+	reply := make([]byte, 5)
+	if _, err := io.ReadFull(remote, reply); err != nil || string(reply) != "reply" {
+		t.Errorf("remote got %q, %v", reply, err)
+	}
+
+	remote.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("bridge still running after the channel closed")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp_tree.go — glob
+// ────────────────────────────────────────────────────────────────────
+
+func TestSFTPGlob(t *testing.T) {
+	s := newTestSession(t, "sess-glob")
+	defer s.close("test done")
+	sftpID, err := openSFTPSession(s.id, js.Undefined())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _ := getSFTPSession(sftpID)
+	for _, d := range []string{"/src/a", "/src/b", "/src/b.go"} {
+		if err := ss.client.MkdirAll(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []string{"/src/a/x.go", "/src/a/y.txt", "/src/b/z.go", "/src/main.go"} {
+		f, err := ss.client.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+
+	paths := func(v js.Value) []string {
+		var got []string
+		for i := 0; i < v.Get("matches").Length(); i++ {
+			got = append(got, v.Get("matches").Index(i).Get("path").String())
+		}
+		return got
+	}
+	for pattern, want := range map[string][]string{
+		"/src/*/*.go":   {"/src/a/x.go", "/src/b/z.go"},
+		"/src/*.go":     {"/src/b.go", "/src/main.go"},
+		"/src/[ab]/?.*": {"/src/a/x.go", "/src/a/y.txt", "/src/b/z.go"},
+		"/src/main.go":  {"/src/main.go"},
+		"/none/*":       nil,
+	} {
+		got := awaitTestPromise(t, sftpGlob(sftpID, pattern))
+		if !slices.Equal(paths(got), want) || got.Get("truncated").Bool() {
+			t.Errorf("%s = %v (truncated %v), want %v", pattern, paths(got), got.Get("truncated").Bool(), want)
+		}
+	}
+
+	// A walk that is already at the cap stops at the next match.
+	g := &globWalk{client: ss.client, matches: make([]js.Value, maxGlobResults)}
+	if g.expand("/", []string{"src", "*.go"}) || !g.truncated || len(g.matches) != maxGlobResults {
+		t.Errorf("walk at the cap: truncated %v with %d matches", g.truncated, len(g.matches))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := awaitPromise(ctx, sftpGlob(sftpID, "/src/[")); err == nil {
+		t.Error("malformed pattern accepted")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp_tree.go — find
+// ────────────────────────────────────────────────────────────────────
+
+func TestSFTPFind(t *testing.T) {
+	s := newTestSession(t, "sess-find")
+	defer s.close("test done")
+	sftpID, err := openSFTPSession(s.id, js.Undefined())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _ := getSFTPSession(sftpID)
+	if err := ss.client.MkdirAll("/src/a/deep"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/src/a/x.go", "/src/a/deep/y.go", "/src/a/deep/notes.txt", "/src/main.go"} {
+		f, err := ss.client.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+
+	find := func(opts map[string]any) (paths []string, truncated bool) {
+		t.Helper()
+		got := awaitTestPromise(t, sftpFind(sftpID, "/src", js.ValueOf(opts)))
+		for i := 0; i < got.Get("matches").Length(); i++ {
+			paths = append(paths, got.Get("matches").Index(i).Get("path").String())
+		}
+		slices.Sort(paths)
+		return paths, got.Get("truncated").Bool()
+	}
+	if got, trunc := find(map[string]any{"namePattern": "*.go"}); trunc ||
+		!slices.Equal(got, []string{"/src/a/deep/y.go", "/src/a/x.go", "/src/main.go"}) {
+		t.Errorf("*.go = %v (truncated %v)", got, trunc)
+	}
+	if got, _ := find(map[string]any{"nameRegex": `^(notes|deep)`}); !slices.Equal(got, []string{"/src/a/deep", "/src/a/deep/notes.txt"}) {
+		t.Errorf("regex = %v", got)
+	}
+	if got, trunc := find(map[string]any{"namePattern": "*.go", "maxResults": 2}); len(got) != 2 || !trunc {
+		t.Errorf("maxResults 2 = %v (truncated %v)", got, trunc)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, opts := range []map[string]any{
+		{},
+		{"namePattern": "*", "nameRegex": "."},
+		{"namePattern": "["},
+		{"nameRegex": "("},
+		{"namePattern": "*", "maxResults": 0},
+	} {
+		if _, err := awaitPromise(ctx, sftpFind(sftpID, "/src", js.ValueOf(opts))); err == nil {
+			t.Errorf("%v accepted", opts)
+		}
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// grep.go — content search
+// ────────────────────────────────────────────────────────────────────
+
+func TestGrepRemote(t *testing.T) {
+	var mu sync.Mutex
+	var commands []string
+	client := newTestSSHClientWith(t, testServer{request: func(req *ssh.Request, ch ssh.Channel) {
+		if req.Type != "exec" {
+			return
+		}
+		var cmd struct{ Command string }
+		_ = ssh.Unmarshal(req.Payload, &cmd)
+		mu.Lock()
+		commands = append(commands, cmd.Command)
+		mu.Unlock()
+		go func() {
+			status := uint32(0)
+			switch {
+			case strings.Contains(cmd.Command, "'/missing'"):
+				_, _ = ch.Write([]byte("grep\n"))
+				status = 2
+			case strings.Contains(cmd.Command, "'nothing'"):
+				_, _ = ch.Write([]byte("grep\n"))
+				status = 1
+			case strings.Contains(cmd.Command, " -l "):
+				_, _ = ch.Write([]byte("rg\n/src/a.go\x00/src/new\nline.go\x00"))
+			default:
+				_, _ = ch.Write([]byte("grep\n/src/a.go\x0012:x := it's\n/src/a:b.go\x003:x: y\n/src/c.go\x00garbled\n/src/c.go\x007:\xffx\n"))
+			}
+			_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			ch.Close()
+		}()
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &session{id: "sess-grep", ctx: ctx, cancel: cancel, cc: &clientConn{sshClient: client}, sshClient: client,
+		onData: js.Undefined(), onClose: js.Undefined()}
+	sessionStore.Store(s.id, s)
+	defer s.close("test done")
+
+	var streamed int
+	onMatch := js.FuncOf(func(this js.Value, args []js.Value) any {
+		streamed++
+		return nil
+	})
+	defer onMatch.Release()
+	got := awaitTestPromise(t, grepRemote(s.id, js.ValueOf(map[string]any{
+		"pattern": "it's", "path": "/src", "onMatch": onMatch,
+		"flags": map[string]any{"fixed": true, "ignoreCase": true},
+	})))
+	var matches []string
+	for i := 0; i < got.Get("matches").Length(); i++ {
+		m := got.Get("matches").Index(i)
+		matches = append(matches, fmt.Sprintf("%s:%d:%s", m.Get("file").String(), m.Get("line").Int(), m.Get("text").String()))
+	}
+	want := []string{"/src/a.go:12:x := it's", "/src/a:b.go:3:x: y", "/src/c.go:7:\uFFFDx"}
+	if !slices.Equal(matches, want) || got.Get("truncated").Bool() || got.Get("tool").String() != "grep" {
+		t.Errorf("matches = %q (truncated %v, tool %v)", matches, got.Get("truncated").Bool(), got.Get("tool"))
+	}
+	if streamed != len(want) {
+		t.Errorf("onMatch called %d times", streamed)
+	}
+	mu.Lock()
+	if !strings.Contains(commands[0], `grep -rnHIZs -F -i -e 'it'\''s' -- '/src'`) ||
+		!strings.Contains(commands[0], `rg --no-config`) {
+		t.Errorf("command = %s", commands[0])
+	}
+	mu.Unlock()
+
+	got = awaitTestPromise(t, grepRemote(s.id, js.ValueOf(map[string]any{"pattern": "x", "maxResults": 2})))
+	if got.Get("matches").Length() != 2 || !got.Get("truncated").Bool() {
+		t.Errorf("maxResults 2: %d matches, truncated %v", got.Get("matches").Length(), got.Get("truncated").Bool())
+	}
+	got = awaitTestPromise(t, grepRemote(s.id, js.ValueOf(map[string]any{"pattern": "x", "flags": map[string]any{"filesOnly": true}})))
+	if n := got.Get("matches").Length(); n != 2 || got.Get("matches").Index(1).Get("file").String() != "/src/new\nline.go" ||
+		!got.Get("matches").Index(0).Get("line").IsUndefined() || got.Get("tool").String() != "rg" {
+		t.Errorf("filesOnly: %d matches, tool %v", n, got.Get("tool"))
+	}
+	got = awaitTestPromise(t, grepRemote(s.id, js.ValueOf(map[string]any{"pattern": "nothing"})))
+	if got.Get("matches").Length() != 0 {
+		t.Errorf("no match: %d matches", got.Get("matches").Length())
+	}
+
+	actx, acancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer acancel()
+	if _, err := awaitPromise(actx, grepRemote(s.id, js.ValueOf(map[string]any{"pattern": "x", "path": "/missing"}))); err == nil {
+		t.Error("search error with no matches resolved")
+	}
+	if _, err := awaitPromise(actx, grepRemote(s.id, js.ValueOf(map[string]any{"path": "/src"}))); err == nil {
+		t.Error("missing pattern accepted")
+	}
+	controller := js.Global().Get("AbortController").New()
+	controller.Call("abort")
+	if _, err := awaitPromise(actx, grepRemote(s.id, js.ValueOf(map[string]any{"pattern": "x", "signal": controller.Get("signal")}))); err == nil {
+		t.Error("aborted search resolved")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp.go — filesystem capacity
+// ────────────────────────────────────────────────────────────────────
+
+func TestStatVFSToJS(t *testing.T) {
+	got := statVFSToJS(&sftp.StatVFS{Bsize: 4096, Frsize: 1024, Blocks: 1000, Bfree: 300, Bavail: 200, Files: 50, Ffree: 20})
+	want := map[string]any{"totalBytes": 1024000.0, "freeBytes": 307200.0, "availBytes": 204800.0, "files": 50.0, "ffree": 20.0}
+	if !maps.Equal(got, want) {
+		t.Errorf("statVFSToJS = %v, want %v", got, want)
+	}
+	// Without a fundamental block size, the counts are in Bsize units.
+	if got := statVFSToJS(&sftp.StatVFS{Bsize: 512, Blocks: 2})["totalBytes"]; got != 1024.0 {
+		t.Errorf("totalBytes with Frsize 0 = %v, want 1024", got)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// ssh.go — env report
+// ────────────────────────────────────────────────────────────────────
+
+func TestExecEnvReport(t *testing.T) {
+	client := newTestSSHClientWith(t, testServer{
+		refuse: func(req *ssh.Request) bool {
+			var e struct{ Name, Value string }
+			return req.Type == "env" && ssh.Unmarshal(req.Payload, &e) == nil && strings.HasPrefix(e.Name, "SECRET")
+		},
+		request: func(req *ssh.Request, ch ssh.Channel) {
+			if req.Type == "exec" {
+				_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				ch.Close()
+			}
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &session{id: "sess-exec-env-report", ctx: ctx, cancel: cancel, cc: &clientConn{sshClient: client}, sshClient: client}
+	sessionStore.Store(s.id, s)
+	defer s.close("test done")
+
+	env := map[string]any{"LANG": "C.UTF-8", "SECRET_TOKEN": "x", "TZ": "UTC"}
+	var report js.Value
+	onEnv := js.FuncOf(func(this js.Value, args []js.Value) any {
+		report = args[0]
+		return nil
+	})
+	defer onEnv.Release()
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel2()
+	if _, err := awaitPromise(ctx2, sshExec(s.id, "true", js.ValueOf(map[string]any{"env": env, "onEnv": onEnv}))); err != nil {
+		t.Fatalf("exec with onEnv: %v", err)
+	}
+
+	list := func(v js.Value) []string {
+		var out []string
+		for i := 0; i < v.Length(); i++ {
+			out = append(out, v.Index(i).String())
+		}
+		return out
+	}
+	if report.IsUndefined() {
+		t.Fatal("onEnv not called")
+	}
+	if got := list(report.Get("accepted")); !slices.Equal(got, []string{"LANG", "TZ"}) {
+		t.Errorf("accepted = %v, want [LANG TZ]", got)
+	}
+	if got := list(report.Get("rejected")); !slices.Equal(got, []string{"SECRET_TOKEN"}) {
+		t.Errorf("rejected = %v, want [SECRET_TOKEN]", got)
+	}
+
+	// Without onEnv a refused name still fails the call.
+	if _, err := awaitPromise(ctx2, sshExec(s.id, "true", js.ValueOf(map[string]any{"env": env}))); err == nil || !strings.Contains(err.Error(), "SECRET_TOKEN refused") {
+		t.Errorf("exec without onEnv = %v, want SECRET_TOKEN refused", err)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp.go — truncate
+// ────────────────────────────────────────────────────────────────────
+
+func TestSFTPTruncate(t *testing.T) {
+	s := newTestSession(t, "sess-truncate")
+	defer s.close("test done")
+	sftpID, err := openSFTPSession(s.id, js.Undefined())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _ := getSFTPSession(sftpID)
+	f, err := ss.client.Create("/log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("line 1\nline 2\n"))
+	f.Close()
+	if err := ss.client.Mkdir("/dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	awaitTestPromise(t, sftpTruncate(sftpID, "/log", 7))
+	if info, err := ss.client.Stat("/log"); err != nil || info.Size() != 7 {
+		t.Errorf("size after truncate = %v, %v; want 7", info, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, size := range []float64{-1, 1.5, math.Inf(1)} {
+		if _, err := awaitPromise(ctx, sftpTruncate(sftpID, "/log", size)); err == nil {
+			t.Errorf("size %v accepted", size)
+		}
+	}
+	if _, err := awaitPromise(ctx, sftpTruncate(sftpID, "/dir", 0)); err == nil || !strings.Contains(err.Error(), "not a regular file") {
+		t.Errorf("truncate of a directory = %v, want a not-a-regular-file error", err)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp.go — exists
+// ────────────────────────────────────────────────────────────────────
+
+func TestSFTPExists(t *testing.T) {
+	s := newTestSession(t, "sess-exists")
+	defer s.close("test done")
+	sftpID, err := openSFTPSession(s.id, js.Undefined())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _ := getSFTPSession(sftpID)
+	f, err := ss.client.Create("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := ss.client.Mkdir("/dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		path          string
+		exists, isDir bool
+	}{{"/file", true, false}, {"/dir", true, true}, {"/missing", false, false}} {
+		got := awaitTestPromise(t, sftpExists(sftpID, tt.path))
+		if got.Get("exists").Bool() != tt.exists {
+			t.Errorf("%s: exists = %v, want %v", tt.path, got.Get("exists"), tt.exists)
+		}
+		if tt.exists && got.Get("isDir").Bool() != tt.isDir {
+			t.Errorf("%s: isDir = %v, want %v", tt.path, got.Get("isDir"), tt.isDir)
+		}
+		if !tt.exists && !got.Get("isDir").IsUndefined() {
+			t.Errorf("%s: isDir set for a missing path", tt.path)
+		}
+	}
+
+	ss.client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := awaitPromise(ctx, sftpExists(sftpID, "/file")); err == nil {
+		t.Error("closed connection reported as not found")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp.go — ensure directory
+// ────────────────────────────────────────────────────────────────────
+
+func TestSFTPEnsureDir(t *testing.T) {
+	s := newTestSession(t, "sess-ensuredir")
+	defer s.close("test done")
+	sftpID, err := openSFTPSession(s.id, js.Undefined())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _ := getSFTPSession(sftpID)
+
+	awaitTestPromise(t, sftpEnsureDir(sftpID, "/a/b/c", js.Undefined()))
+	if info, err := ss.client.Stat("/a/b/c"); err != nil || !info.IsDir() {
+		t.Fatalf("/a/b/c after ensure = %v, %v", info, err)
+	}
+	// Existing is fine. (The in-memory server can't chmod directories, so
+	// mode isn't checked here.)
+	awaitTestPromise(t, sftpEnsureDir(sftpID, "/a/b/c", js.Undefined()))
+
+	f, err := ss.client.Create("/a/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, p := range []string{"/a/file", "/a/file/sub"} {
+		_, err := awaitPromise(ctx, sftpEnsureDir(sftpID, p, js.Undefined()))
+		if err == nil || !strings.Contains(err.Error(), "/a/file exists and is not a directory") {
+			t.Errorf("ensure %s = %v, want a not-a-directory error naming /a/file", p, err)
+		}
+	}
+	if _, err := awaitPromise(ctx, sftpEnsureDir(sftpID, "/x", js.ValueOf(map[string]any{"mode": 0o10000}))); err == nil {
+		t.Error("out-of-range mode accepted")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp.go — read-only sessions
+// ────────────────────────────────────────────────────────────────────
+
+func TestSFTPReadOnly(t *testing.T) {
+	s := newTestSession(t, "sess-readonly")
+	defer s.close("test done")
+	rwID, err := openSFTPSession(s.id, js.ValueOf(map[string]any{"reuse": true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roID, err := openSFTPSession(s.id, js.ValueOf(map[string]any{"reuse": true, "readOnly": true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roID == rwID {
+		t.Fatal("read-only open reused a writable session")
+	}
+	// Each test subsystem has its own in-memory tree; set this one up
+	// behind the guard's back.
+	ro, _ := getSFTPSession(roID)
+	f, err := ro.client.Create("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("data"))
+	f.Close()
+
+	// Reads work.
+	awaitTestPromise(t, sftpStat(roID, "/file", js.Undefined()))
+	if got := awaitTestPromise(t, sftpDownload(roID, "/file", js.Undefined(), js.Undefined(), js.Undefined())); got.Length() != 4 {
+		t.Errorf("download = %d bytes", got.Length())
+	}
+	h := awaitTestPromise(t, sftpFileOpen(roID, "/file", "r")).String()
+	sftpFileClose(h)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for name, p := range map[string]js.Value{
+		"mkdir":       sftpMkdir(roID, "/d", 0o755),
+		"remove":      sftpRemove(roID, "/file", false, js.Undefined()),
+		"rename":      sftpRename(roID, "/file", "/moved", js.Undefined()),
+		"chmod":       sftpChmod(roID, "/file", 0o600),
+		"truncate":    sftpTruncate(roID, "/file", 0),
+		"upload":      sftpUpload(roID, "/new", bytesToUint8Array([]byte("x")), js.Undefined(), js.Undefined(), js.Undefined()),
+		"uploadStart": sftpUploadStreamStart(roID, "/new", 1, js.Undefined()),
+		"openWrite":   sftpFileOpen(roID, "/file", "a"),
+		"batch":       sftpBatch(roID, js.ValueOf([]any{map[string]any{"op": "remove", "path": "/file"}}), js.Undefined()),
+	} {
+		if _, err := awaitPromise(ctx, p); err == nil || !strings.Contains(err.Error(), "read-only SFTP session") {
+			t.Errorf("%s = %v, want a read-only error", name, err)
+		}
+	}
+	if info, err := ro.client.Stat("/file"); err != nil || info.Size() != 4 {
+		t.Errorf("file after rejected changes = %v, %v", info, err)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp_root.go — rootPrefix confinement
+// ────────────────────────────────────────────────────────────────────
+
+// memLister is the part of sftp.InMemHandler's FileList the request
+// server uses.
+type memLister interface {
+	sftp.FileLister
+	sftp.LstatFileLister
+	sftp.ReadlinkFileLister
+}
+
+// symlinkRealPath makes the in-memory server's realpath follow a final
+// symlink, as OpenSSH's does; InMemHandler's only cleans the path.
+type symlinkRealPath struct{ memLister }
+
+func (l symlinkRealPath) RealPath(p string) (string, error) {
+	p = pathpkg.Clean("/" + p)
+	for range 8 {
+		target, err := l.Readlink(p)
+		if err != nil {
+			return p, nil
+		}
+		if !pathpkg.IsAbs(target) {
+			target = pathpkg.Join(pathpkg.Dir(p), target)
+		}
+		p = pathpkg.Clean(target)
+	}
+	return "", errors.New("too many symlinks")
+}
+
+func TestSFTPRootPrefix(t *testing.T) {
+	h := sftp.InMemHandler()
+	h.FileList = symlinkRealPath{h.FileList.(memLister)}
+	client := newTestSSHClientWith(t, testServer{subsystem: func(_ ssh.Conn, req *ssh.Request, ch ssh.Channel) {
+		_ = req.Reply(true, nil)
+		go func() {
+			_ = sftp.NewRequestServer(ch, h).Serve()
+			ch.Close()
+		}()
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &session{id: "sess-root", ctx: ctx, cancel: cancel, cc: &clientConn{sshClient: client}, sshClient: client,
+		onData: js.Undefined(), onClose: js.Undefined()}
+	sessionStore.Store(s.id, s)
+	defer s.close("test done")
+
+	rwID, err := openSFTPSession(s.id, js.Undefined())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw, _ := getSFTPSession(rwID)
+	for _, d := range []string{"/jail", "/outside"} {
+		if err := rw.client.Mkdir(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{"/jail/file", "/outside/secret"} {
+		w, err := rw.client.Create(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte("data"))
+		w.Close()
+	}
+	for link, target := range map[string]string{"/jail/ok": "file", "/jail/out": "/outside/secret", "/jail/rel": "../outside/secret"} {
+		if err := rw.client.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, root := range []string{"jail", "/missing", "/jail/file"} {
+		if _, err := openSFTPSession(s.id, js.ValueOf(map[string]any{"rootPrefix": root})); err == nil {
+			t.Errorf("rootPrefix %q opened", root)
+		}
+	}
+	id, err := openSFTPSession(s.id, js.ValueOf(map[string]any{"rootPrefix": "/jail/", "reuse": true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == rwID {
+		t.Fatal("confined open reused an unconfined session")
+	}
+
+	awaitTestPromise(t, sftpStat(id, "/jail/ok", js.Undefined()))
+	if got := awaitTestPromise(t, sftpDownload(id, "/jail/file", js.Undefined(), js.Undefined(), js.Undefined())); got.Length() != 4 {
+		t.Errorf("download = %d bytes", got.Length())
+	}
+	awaitTestPromise(t, sftpUpload(id, "/jail/new", bytesToUint8Array([]byte("x")), js.Undefined(), js.Undefined(), js.Undefined()))
+	awaitTestPromise(t, sftpRename(id, "/jail/new", "/jail/moved", js.Undefined()))
+	awaitTestPromise(t, sftpSymlink(id, "moved", "/jail/link"))
+
+	wctx, wcancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer wcancel()
+	for name, p := range map[string]js.Value{
+		"outside":      sftpStat(id, "/outside/secret", js.Undefined()),
+		"dotdot":       sftpStat(id, "/jail/../outside/secret", js.Undefined()),
+		"link":         sftpDownload(id, "/jail/out", js.Undefined(), js.Undefined(), js.Undefined()),
+		"relativeLink": sftpFileOpen(id, "/jail/rel", "r"),
+		"renameTo":     sftpRename(id, "/jail/file", "/outside/file", js.Undefined()),
+		"renameFrom":   sftpRename(id, "/outside/secret", "/jail/secret", js.Undefined()),
+		"symlink":      sftpSymlink(id, "/outside/secret", "/jail/l2"),
+		"relSymlink":   sftpSymlink(id, "../outside", "/jail/l3"),
+		"batch":        sftpBatch(id, js.ValueOf([]any{map[string]any{"op": "remove", "path": "/outside/secret"}}), js.ValueOf(map[string]any{"abortOnError": true})),
+	} {
+		v, err := awaitPromise(wctx, p)
+		if name == "batch" && err == nil {
+			err = errors.New(v.Index(0).Get("error").String())
+		}
+		if err == nil || !strings.Contains(err.Error(), "outside rootPrefix") {
+			t.Errorf("%s = %v, want an outside-rootPrefix error", name, err)
+		}
+	}
+	if _, err := awaitPromise(wctx, sftpStat(id, "file", js.Undefined())); err == nil {
+		t.Error("relative path accepted under rootPrefix")
+	}
+
+	// Links leading out are neither followed nor resolved.
+	follow := js.ValueOf(map[string]any{"followSymlinks": true})
+	if _, err := awaitPromise(wctx, sftpDirSize(id, "/jail", follow)); err == nil || !strings.Contains(err.Error(), "outside rootPrefix") {
+		t.Errorf("following walk = %v, want an outside-rootPrefix error", err)
+	}
+	found := awaitTestPromise(t, sftpFind(id, "/jail", js.ValueOf(map[string]any{"namePattern": "*", "followSymlinks": true})))
+	for i := 0; i < found.Get("matches").Length(); i++ {
+		if m := found.Get("matches").Index(i); m.Get("name").String() == "out" && !m.Get("isSymlink").Bool() {
+			t.Error("sftpFind followed a link out of the root")
+		}
+	}
+	if _, err := awaitPromise(wctx, sftpRealPath(id, "/jail/out")); err == nil {
+		t.Error("sftpRealPath resolved a link out of the root")
+	}
+	list := awaitTestPromise(t, sftpListDir(id, "/jail", js.ValueOf(map[string]any{"realPath": true})))
+	for i := 0; i < list.Length(); i++ {
+		e := list.Index(i)
+		switch e.Get("name").String() {
+		case "out", "rel":
+			if !e.Get("realPath").IsNull() {
+				t.Errorf("%s realPath = %v, want null", e.Get("name"), e.Get("realPath"))
+			}
+		case "ok":
+			if got := e.Get("realPath").String(); got != "/jail/file" {
+				t.Errorf("ok realPath = %q", got)
+			}
+		}
+	}
+	if _, err := rw.client.Stat("/outside/secret"); err != nil {
+		t.Errorf("secret after rejected changes: %v", err)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp_batch.go — batch operations
+// ────────────────────────────────────────────────────────────────────
+
+func TestSFTPBatch(t *testing.T) {
+	s := newTestSession(t, "sess-batch")
+	defer s.close("test done")
+	sftpID, err := openSFTPSession(s.id, js.Undefined())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _ := getSFTPSession(sftpID)
+	if err := ss.client.Mkdir("/d"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/a", "/b", "/d/f"} {
+		f, err := ss.client.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+
+	ops := js.ValueOf([]any{
+		map[string]any{"op": "rename", "oldPath": "/a", "newPath": "/a2"},
+		map[string]any{"op": "remove", "path": "/missing"},
+		map[string]any{"op": "chmod", "path": "/b", "mode": 0o600},
+		map[string]any{"op": "remove", "path": "/d", "recursive": true},
+		map[string]any{"op": "copy", "path": "/b"},
+	})
+	results := awaitTestPromise(t, sftpBatch(sftpID, ops, js.Undefined()))
+	if results.Length() != 5 {
+		t.Fatalf("got %d results, want 5", results.Length())
+	}
+	for i, wantOK := range []bool{true, false, true, true, false} {
+		r := results.Index(i)
+		if r.Get("ok").Bool() != wantOK {
+			t.Errorf("op %d: ok = %v, want %v (error %v)", i, r.Get("ok"), wantOK, r.Get("error"))
+		}
+		if !wantOK && r.Get("error").String() == "" {
+			t.Errorf("op %d failed without an error", i)
+		}
+	}
+	if _, err := ss.client.Stat("/a2"); err != nil {
+		t.Errorf("rename didn't happen: %v", err)
+	}
+	if _, err := ss.client.Stat("/d"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("/d after recursive remove: %v", err)
+	}
+
+	ops = js.ValueOf([]any{
+		map[string]any{"op": "remove", "path": "/missing"},
+		map[string]any{"op": "remove", "path": "/b"},
+	})
+	results = awaitTestPromise(t, sftpBatch(sftpID, ops, js.ValueOf(map[string]any{"abortOnError": true})))
+	if r := results.Index(1); r.Get("ok").Bool() || !r.Get("skipped").Bool() {
+		t.Errorf("op after a failure with abortOnError: %v, %v; want skipped", r.Get("ok"), r.Get("skipped"))
+	}
+	if _, err := ss.client.Stat("/b"); err != nil {
+		t.Errorf("skipped remove ran: %v", err)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// events.go — lifecycle events
+// ────────────────────────────────────────────────────────────────────
+
+// newTestShellSession registers a session with a shell, opened as connect
+// would with config, on an in-process server.
+func newTestShellSession(t *testing.T, id string, config js.Value) *session {
+	t.Helper()
+	client := newTestSSHClient(t)
+	shell, err := openShell(&clientConn{sshClient: client}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &session{
+		id: id, ctx: ctx, cancel: cancel, config: config,
+		cc: &clientConn{sshClient: client}, sshClient: client,
+		sshSession: shell.session, stdin: shell.stdin, pty: shell.pty, env: shell.env,
+		onData: js.Undefined(), onClose: js.Undefined(),
+	}
+	s.registerPty(s.id, shell.session, shell.cols, shell.rows)
+	sessionStore.Store(s.id, s)
+	return s
+}
+
+func TestSessionEvents(t *testing.T) {
+	s := newTestShellSession(t, "sess-events", js.ValueOf(map[string]any{}))
+	var events []js.Value
+	onEvent := js.FuncOf(func(this js.Value, args []js.Value) any {
+		events = append(events, args[0])
+		return nil
+	})
+	defer onEvent.Release()
+	s.onEvent = onEvent.Value
+
+	sshResize(s.id, 100, 40, "")
+	sshResize(s.id, 100, 40, "no-such-channel")
+	s.close("bye")
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want pty_resized and closed", len(events))
+	}
+	resized := events[0]
+	if resized.Get("type").String() != "pty_resized" || resized.Get("channelId").String() != s.id ||
+		resized.Get("cols").Int() != 100 || resized.Get("rows").Int() != 40 {
+		t.Errorf("first event = %v %v %vx%v", resized.Get("type"), resized.Get("channelId"), resized.Get("cols"), resized.Get("rows"))
+	}
+	if closed := events[1]; closed.Get("type").String() != "closed" || closed.Get("reason").String() != "bye" {
+		t.Errorf("second event = %v %v, want closed bye", closed.Get("type"), closed.Get("reason"))
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// ssh.go — shell exit status
+// ────────────────────────────────────────────────────────────────────
+
+func TestShellExitStatusOnClose(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		req      string
+		payload  []byte
+		wantCode int
+		wantSig  string
+	}{
+		{"status", "exit-status", ssh.Marshal(struct{ Status uint32 }{3}), 3, ""},
+		{"signal", "exit-signal", ssh.Marshal(struct {
+			Signal     string
+			CoreDumped bool
+			Error      string
+			Lang       string
+		}{"KILL", false, "", ""}), 137, "KILL"},
+	} {
+		client := newTestSSHClientWith(t, testServer{request: func(req *ssh.Request, ch ssh.Channel) {
+			if req.Type == "shell" {
+				go func() {
+					_, _ = ch.SendRequest(tt.req, false, tt.payload)
+					ch.Close()
+				}()
+			}
+		}})
+		config := js.ValueOf(map[string]any{})
+		shell, err := openShell(&clientConn{sshClient: client}, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		details := make(chan js.Value, 1)
+		onClose := js.FuncOf(func(this js.Value, args []js.Value) any {
+			details <- args[1]
+			return nil
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		s := &session{
+			id: "sess-exit-" + tt.name, ctx: ctx, cancel: cancel, config: config,
+			cc: &clientConn{sshClient: client}, sshClient: client,
+			sshSession: shell.session, stdin: shell.stdin,
+			onData: js.Undefined(), onClose: onClose.Value,
+		}
+		sessionStore.Store(s.id, s)
+		s.startShellReaders(shell, config)
+
+		select {
+		case d := <-details:
+			if d.Get("reason").String() != "session ended" || d.Get("exitCode").Int() != tt.wantCode {
+				t.Errorf("%s: onClose = %v, exit %v", tt.name, d.Get("reason"), d.Get("exitCode"))
+			}
+			if sig := d.Get("exitSignal"); tt.wantSig == "" && !sig.IsUndefined() || tt.wantSig != "" && sig.String() != tt.wantSig {
+				t.Errorf("%s: exitSignal = %v", tt.name, sig)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: onClose not called", tt.name)
+		}
+		onClose.Release()
+	}
+
+	if shellExit(&ssh.ExitMissingError{}) != nil || shellExit(io.EOF) != nil {
+		t.Error("exit fields reported without an exit status")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// ssh.go — separate stderr
+// ────────────────────────────────────────────────────────────────────
+
+func TestShellSeparateStderr(t *testing.T) {
+	client := newTestSSHClientWith(t, testServer{request: func(req *ssh.Request, ch ssh.Channel) {
+		if req.Type == "shell" {
+			go func() {
+				_, _ = ch.Write([]byte("out"))
+				_, _ = ch.Stderr().Write([]byte("err"))
+				_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				ch.Close()
+			}()
+		}
+	}})
+	config := js.ValueOf(map[string]any{"separateStderr": true})
+	shell, err := openShell(&clientConn{sshClient: client}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var stdout, stderr string
+	collect := func(dst *string) js.Func {
+		return js.FuncOf(func(this js.Value, args []js.Value) any {
+			b := make([]byte, args[0].Length())
+			js.CopyBytesToGo(b, args[0])
+			mu.Lock()
+			*dst += string(b)
+			mu.Unlock()
+			return nil
+		})
+	}
+	onData, onStderr := collect(&stdout), collect(&stderr)
+	defer onData.Release()
+	defer onStderr.Release()
+	closed := make(chan string, 1)
+	onClose := js.FuncOf(func(this js.Value, args []js.Value) any {
+		mu.Lock()
+		closed <- stderr
+		mu.Unlock()
+		return nil
+	})
+	defer onClose.Release()
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &session{
+		id: "sess-stderr", ctx: ctx, cancel: cancel, config: config,
+		cc: &clientConn{sshClient: client}, sshClient: client,
+		sshSession: shell.session, stdin: shell.stdin,
+		onData: onData.Value, onStderr: onStderr.Value, onClose: onClose.Value,
+	}
+	sessionStore.Store(s.id, s)
+	s.startShellReaders(shell, config)
+
+	select {
+	case errAtClose := <-closed:
+		if errAtClose != "err" {
+			t.Errorf("stderr at onClose = %q, want all of it", errAtClose)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("onClose not called")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if stdout != "out" {
+		t.Errorf("stdout = %q", stdout)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// reconnect.go — re-establishing the shell
+// ────────────────────────────────────────────────────────────────────
+
+func TestReconnectReplaysShell(t *testing.T) {
+	ptyReqs := make(chan ptyReq, 1)
+	envs := make(chan [2]string, 4)
+	client := newTestSSHClientWith(t, testServer{request: func(req *ssh.Request, ch ssh.Channel) {
+		switch req.Type {
+		case "pty-req":
+			var p ptyReq
+			_ = ssh.Unmarshal(req.Payload, &p)
+			ptyReqs <- p
+		case "env":
+			var e struct{ Name, Value string }
+			_ = ssh.Unmarshal(req.Payload, &e)
+			envs <- [2]string{e.Name, e.Value}
+		}
+	}})
+	config := js.ValueOf(map[string]any{"term": "vt220", "env": map[string]any{"LANG": "C.UTF-8", "TZ": "UTC"}})
+	s := newTestShellSession(t, "sess-reconnect", config)
+	defer s.close("test done")
+	pty := s.pty
+
+	if err := s.reconnectWith(&clientConn{sshClient: client}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-ptyReqs:
+		if p.Term != "vt220" || !maps.Equal(parseTestModes(p.Modes), pty.modes) {
+			t.Errorf("pty-req = %+v, want term vt220 with the same modes", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no pty-req on the new connection")
+	}
+	got := map[string]string{}
+	for range 2 {
+		select {
+		case e := <-envs:
+			got[e[0]] = e[1]
+		case <-time.After(5 * time.Second):
+			t.Fatalf("env requests = %v, want LANG and TZ", got)
+		}
+	}
+	if got["LANG"] != "C.UTF-8" || got["TZ"] != "UTC" {
+		t.Errorf("env = %v", got)
+	}
+	if s.client() != client {
+		t.Error("session still uses the old connection")
+	}
+
+	// The old shell's EOF must not end the session.
+	time.Sleep(50 * time.Millisecond)
+	if !storeHas(&sessionStore, s.id) {
+		t.Error("session closed with the replaced connection")
+	}
+}
+
+func TestReconnectReplaysSize(t *testing.T) {
+	ptyReqs := make(chan ptyReq, 1)
+	client := newTestSSHClientWith(t, testServer{request: func(req *ssh.Request, ch ssh.Channel) {
+		if req.Type == "pty-req" {
+			var p ptyReq
+			_ = ssh.Unmarshal(req.Payload, &p)
+			ptyReqs <- p
+		}
+	}})
+	s := newTestShellSession(t, "sess-reconnect-size", js.ValueOf(map[string]any{}))
+	defer s.close("test done")
+
+	sshResize(s.id, 132, 43, "")
+	if err := s.reconnectWith(&clientConn{sshClient: client}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-ptyReqs:
+		if p.Cols != 132 || p.Rows != 43 {
+			t.Errorf("pty-req size = %dx%d, want 132x43", p.Cols, p.Rows)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no pty-req on the new connection")
+	}
+	size := sshGetPtySize(s.id, "")
+	if size.IsNull() || size.Get("cols").Int() != 132 || size.Get("rows").Int() != 43 {
+		t.Errorf("getPtySize after reconnect = %v, want 132x43", size)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// reconnect.go — autoReconnect
+// ────────────────────────────────────────────────────────────────────
+
+func TestParseReconnectPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		v       any
+		want    *reconnectPolicy
+		wantErr bool
+	}{
+		{nil, nil, false},
+		{false, nil, false},
+		{true, &reconnectPolicy{defaultReconnectRetries, defaultReconnectBackoff}, false},
+		{map[string]any{"maxRetries": 3, "backoffMs": 250}, &reconnectPolicy{3, 250 * time.Millisecond}, false},
+		{map[string]any{"backoffMs": 120000}, &reconnectPolicy{defaultReconnectRetries, maxReconnectBackoff}, false},
+		{map[string]any{"maxRetries": 0}, nil, true},
+		{map[string]any{"backoffMs": -1}, nil, true},
+	} {
+		got, err := parseReconnectPolicy(js.ValueOf(map[string]any{"autoReconnect": tt.v}))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: err = %v", tt.v, err)
+			continue
+		}
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("%v: policy = %+v, want %+v", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestShellLost(t *testing.T) {
+	if shellLost(nil) || shellLost(&ssh.ExitError{}) {
+		t.Error("an exit counted as a lost connection")
+	}
+	if !shellLost(&ssh.ExitMissingError{}) || !shellLost(io.EOF) {
+		t.Error("a missing exit status didn't count as a lost connection")
+	}
+}
+
+func TestHostKeyPin(t *testing.T) {
+	newKey := func(keyType string) ssh.PublicKey {
+		priv, err := generateKey(keyType, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := ssh.NewSignerFromKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signer.PublicKey()
+	}
+	orig, swapped, downgraded := newKey("ed25519"), newKey("ed25519"), newKey("ecdsa")
+
+	s := newTestSession(t, "sess-hostkeypin")
+	if s.hostKeyPin() != nil {
+		t.Error("pinned without a host key")
+	}
+	s.hostKey = orig
+	var events []map[string]any
+	onEvent := js.FuncOf(func(this js.Value, args []js.Value) any {
+		events = append(events, map[string]any{"type": args[0].Get("type").String(), "keyType": jsString(args[0].Get("keyType"))})
+		return nil
+	})
+	defer onEvent.Release()
+	s.onEvent = onEvent.Value
+
+	pin := s.hostKeyPin()
+	if same, err := pin.check("h:22", orig); !same || err != nil {
+		t.Errorf("original key: same = %v, err = %v", same, err)
+	}
+	var ce *codedError
+	if _, err := pin.check("h:22", swapped); !errors.As(err, &ce) || ce.code != errCodeHostKeyChanged {
+		t.Errorf("swapped key: err = %v", err)
+	}
+	if _, err := pin.check("h:22", downgraded); err == nil || !strings.Contains(err.Error(), "key type") {
+		t.Errorf("changed key type: err = %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("reject policy emitted %v", events)
+	}
+
+	s.hostKeyWarn = true
+	if same, err := s.hostKeyPin().check("h:22", downgraded); same || err != nil {
+		t.Errorf("warn policy: same = %v, err = %v", same, err)
+	}
+	if len(events) != 1 || events[0]["type"] != "host_key_changed" || events[0]["keyType"] != ssh.KeyAlgoECDSA256 {
+		t.Errorf("events = %v, want one host_key_changed", events)
+	}
+
+	for v, want := range map[string]bool{"": false, "reject": false, "warn": true} {
+		if got, err := parseReconnectHostKeyPolicy(js.ValueOf(map[string]any{"reconnectHostKeyPolicy": v})); err != nil || got != want {
+			t.Errorf("reconnectHostKeyPolicy %q = %v, %v", v, got, err)
+		}
+	}
+	if _, err := parseReconnectHostKeyPolicy(js.ValueOf(map[string]any{"reconnectHostKeyPolicy": "ignore"})); err == nil {
+		t.Error("reconnectHostKeyPolicy 'ignore' accepted")
+	}
+}
+
+func TestAutoReconnectGivesUp(t *testing.T) {
+	s := newTestSession(t, "sess-autoreconnect")
+	// No proxyUrl, so every redial fails at once.
+	s.config = js.ValueOf(map[string]any{})
+	s.autoReconnect = &reconnectPolicy{maxRetries: 2, backoff: time.Millisecond}
+	var events []string
+	closed := make(chan string, 1)
+	onEvent := js.FuncOf(func(this js.Value, args []js.Value) any {
+		e := args[0]
+		name := e.Get("type").String()
+		if a := e.Get("attempt"); !a.IsUndefined() {
+			name += fmt.Sprintf("#%d", a.Int())
+		}
+		events = append(events, name)
+		if name == "closed" {
+			closed <- e.Get("reason").String()
+		}
+		return nil
+	})
+	defer onEvent.Release()
+	s.onEvent = onEvent.Value
+
+	if !s.connectionLost("keepalive failed") {
+		t.Fatal("connectionLost closed the session despite autoReconnect")
+	}
+	select {
+	case reason := <-closed:
+		if !strings.Contains(reason, "gave up after 2 reconnect attempts") {
+			t.Errorf("close reason = %q", reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("session not closed after the retries ran out")
+	}
+	want := []string{"connection_lost", "reconnecting#1", "reconnect_failed#1", "reconnecting#2", "reconnect_failed#2", "closed"}
+	if !slices.Equal(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// ssh.go — keepalive
+// ────────────────────────────────────────────────────────────────────
+
+func TestParseKeepalive(t *testing.T) {
+	def := keepalivePolicy{keepaliveInterval, keepaliveTimeout, keepaliveMaxFailures}
+	for _, tt := range []struct {
+		v       any
+		want    keepalivePolicy
+		wantErr bool
+	}{
+		{nil, def, false},
+		{map[string]any{"intervalMs": 0}, keepalivePolicy{}, false},
+		{map[string]any{"intervalMs": 5000, "maxFailures": 5}, keepalivePolicy{5 * time.Second, keepaliveTimeout, 5}, false},
+		{map[string]any{"timeoutMs": 2000}, keepalivePolicy{keepaliveInterval, 2 * time.Second, keepaliveMaxFailures}, false},
+		{map[string]any{"intervalMs": 500}, keepalivePolicy{}, true},
+		{map[string]any{"maxFailures": 0}, keepalivePolicy{}, true},
+		{30, keepalivePolicy{}, true},
+	} {
+		got, err := parseKeepalive(js.ValueOf(map[string]any{"keepalive": tt.v}))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: err = %v", tt.v, err)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("%v: policy = %+v, want %+v", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	// A server that never answers global requests.
+	release := make(chan struct{})
+	defer close(release)
+	clientSide, serverSide := net.Pipe()
+	_, hostKey, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, _ := ssh.NewSignerFromKey(hostKey)
+	serverCfg := &ssh.ServerConfig{NoClientAuth: true}
+	serverCfg.AddHostKey(hostSigner)
+	go func() {
+		sconn, _, reqs, err := ssh.NewServerConn(newAsyncConn(serverSide), serverCfg)
+		if err != nil {
+			return
+		}
+		defer sconn.Close()
+		<-reqs
+		<-release
+	}()
+	conn, chans, reqs, err := ssh.NewClientConn(newAsyncConn(clientSide), "test", &ssh.ClientConfig{
+		User: "u", HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := ssh.NewClient(conn, chans, reqs)
+	defer client.Close()
+
+	start := time.Now()
+	if err := ping(client, 50*time.Millisecond); err == nil {
+		t.Fatal("unanswered ping succeeded")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("ping took %v to time out", d)
+	}
+	if err := ping(newTestSSHClient(t), time.Second); err != nil {
+		t.Errorf("ping to a live server: %v", err)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// ssh.go — connect timeouts
+// ────────────────────────────────────────────────────────────────────
+
+func TestTimeoutFromConfig(t *testing.T) {
+	got, err := timeoutFromConfig(js.ValueOf(map[string]any{}), "dialTimeoutMs", dialTimeout)
+	if err != nil || got != dialTimeout {
+		t.Errorf("absent = %v, %v; want the default", got, err)
+	}
+	got, err = timeoutFromConfig(js.ValueOf(map[string]any{"dialTimeoutMs": 1500}), "dialTimeoutMs", dialTimeout)
+	if err != nil || got != 1500*time.Millisecond {
+		t.Errorf("1500 = %v, %v", got, err)
+	}
+	for _, bad := range []any{0, -5, "10", math.NaN(), 1e12} {
+		if _, err := timeoutFromConfig(js.ValueOf(map[string]any{"dialTimeoutMs": bad}), "dialTimeoutMs", dialTimeout); err == nil {
+			t.Errorf("%v accepted", bad)
+		}
+	}
+}
+
+func TestClientHandshakeTimeout(t *testing.T) {
+	// A server that never sends its version line.
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+	go func() { _, _ = io.Copy(io.Discard, serverSide) }()
+	cfg := &ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+	_, _, _, err := clientHandshake(context.Background(), newAsyncConn(clientSide), "test", cfg, 50*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "no host key") {
+		t.Fatalf("silent server = %v, want a timeout", err)
+	}
+
+	// Time spent verifying the host key doesn't count.
+	_, hostKey, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, _ := ssh.NewSignerFromKey(hostKey)
+	serverCfg := &ssh.ServerConfig{NoClientAuth: true}
+	serverCfg.AddHostKey(hostSigner)
+	clientSide, serverSide = net.Pipe()
+	go func() {
+		sconn, chans, reqs, err := ssh.NewServerConn(serverSide, serverCfg)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		go func() {
+			for nc := range chans {
+				_ = nc.Reject(ssh.Prohibited, "")
+			}
+		}()
+		_ = sconn.Wait()
+	}()
+	cfg.HostKeyCallback = func(string, net.Addr, ssh.PublicKey) error {
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	}
+	conn, _, _, err := clientHandshake(context.Background(), newAsyncConn(clientSide), "test", cfg, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("slow host key check = %v, want success", err)
+	}
+	conn.Close()
+}
+
+func TestClientHandshakeAbortMidPrompt(t *testing.T) {
+	_, hostKey, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, _ := ssh.NewSignerFromKey(hostKey)
+	serverCfg := &ssh.ServerConfig{NoClientAuth: true}
+	serverCfg.AddHostKey(hostSigner)
+	clientSide, serverSide := net.Pipe()
+	serverDone := make(chan error, 1)
+	go func() {
+		_, _, _, err := ssh.NewServerConn(newAsyncConn(serverSide), serverCfg)
+		serverDone <- err
+	}()
+
+	// onHostKey never settles, as if the user walked away from the dialog.
+	prompted := make(chan struct{})
+	onHostKey := js.FuncOf(func(this js.Value, args []js.Value) any {
+		close(prompted)
+		return js.Global().Get("Promise").New(js.FuncOf(func(js.Value, []js.Value) any { return nil }))
+	})
+	defer onHostKey.Release()
+	config := js.ValueOf(map[string]any{"onHostKey": onHostKey})
+
+	controller := js.Global().Get("AbortController").New()
+	ctx, stop := abortContext(controller.Get("signal"))
+	defer stop()
+	cfg := &ssh.ClientConfig{User: "test", HostKeyCallback: makeHostKeyCallbackWithBanner(ctx, config, nil)}
+	handshakeDone := make(chan error, 1)
+	go func() {
+		_, _, _, err := clientHandshake(ctx, newAsyncConn(clientSide), "test", cfg, time.Minute)
+		handshakeDone <- err
+	}()
+
+	select {
+	case <-prompted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("onHostKey was not called")
+	}
+	controller.Call("abort")
+	select {
+	case err := <-handshakeDone:
+		if !errors.Is(err, errConnectAborted) {
+			t.Errorf("handshake = %v, want errConnectAborted", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handshake still waiting on the prompt after abort")
+	}
+	// The transport is closed, so the server side fails too.
+	select {
+	case err := <-serverDone:
+		if err == nil {
+			t.Error("server handshake succeeded after abort")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("transport left open after abort")
+	}
+
+	// A signal aborted before the connect starts cancels it up front.
+	controller = js.Global().Get("AbortController").New()
+	controller.Call("abort")
+	ctx, stop = abortContext(controller.Get("signal"))
+	defer stop()
+	if ctx.Err() == nil {
+		t.Error("context live for an already aborted signal")
+	}
+	if _, err := connectSession(js.ValueOf(map[string]any{"signal": controller.Get("signal")})); !errors.Is(err, errConnectAborted) {
+		t.Errorf("connect with an aborted signal = %v", err)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// conninfo.go — negotiated connection details
+// ────────────────────────────────────────────────────────────────────
+
+func TestSSHSessionInfo(t *testing.T) {
+	s := newTestSession(t, "sess-info")
+	defer s.close("test done")
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(priv)
+	s.cc.info = newConnInfo(s.sshClient.Conn, signer.PublicKey())
+
+	info, err := sshSessionInfo(s.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Get("serverVersion").String(); !strings.HasPrefix(got, "SSH-2.0-") {
+		t.Errorf("serverVersion = %q", got)
+	}
+	for _, field := range []string{"clientVersion", "cipher", "readCipher", "kex", "hostKeyAlgorithm"} {
+		if info.Get(field).String() == "" {
+			t.Errorf("%s is empty", field)
+		}
+	}
+	if got := info.Get("hostKeyType").String(); got != ssh.KeyAlgoED25519 {
+		t.Errorf("hostKeyType = %q", got)
+	}
+	if got := info.Get("hostKeyFingerprint").String(); got != ssh.FingerprintSHA256(signer.PublicKey()) {
+		t.Errorf("hostKeyFingerprint = %q", got)
+	}
+	if got := info.Get("wsProtocol"); got.String() != "" {
+		t.Errorf("wsProtocol = %v without a WebSocket", got)
+	}
+
+	if _, err := sshSessionInfo("no-such-session"); err == nil {
+		t.Error("unknown session accepted")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// ssh.go — algorithm preferences
+// ────────────────────────────────────────────────────────────────────
+
+func TestAlgorithmsFromConfig(t *testing.T) {
+	prefs, err := algorithmsFromConfig(js.ValueOf(map[string]any{}))
+	if err != nil || prefs.ciphers != nil || prefs.keyExchanges != nil {
+		t.Fatalf("absent algorithms = %+v, %v; want defaults", prefs, err)
+	}
+
+	prefs, err = algorithmsFromConfig(js.ValueOf(map[string]any{"algorithms": map[string]any{
+		"ciphers":      []any{"aes256-ctr", "aes128-cbc"},
+		"keyExchanges": []any{"diffie-hellman-group14-sha1"},
+	}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg ssh.ClientConfig
+	prefs.apply(&cfg)
+	if !slices.Equal(cfg.Ciphers, []string{"aes256-ctr", "aes128-cbc"}) || !slices.Equal(cfg.KeyExchanges, []string{"diffie-hellman-group14-sha1"}) {
+		t.Errorf("applied ciphers %v, kex %v", cfg.Ciphers, cfg.KeyExchanges)
+	}
+	if cfg.MACs != nil || cfg.HostKeyAlgorithms != nil {
+		t.Errorf("unset lists changed: macs %v, host keys %v", cfg.MACs, cfg.HostKeyAlgorithms)
+	}
+
+	_, err = algorithmsFromConfig(js.ValueOf(map[string]any{"algorithms": map[string]any{"macs": []any{"hmac-md5"}}}))
+	if err == nil || !strings.Contains(err.Error(), "hmac-sha2-256") {
+		t.Errorf("unknown MAC: err = %v, want one listing supported MACs", err)
+	}
+	for _, bad := range []any{"aes256-ctr", []any{}} {
+		if _, err := algorithmsFromConfig(js.ValueOf(map[string]any{"algorithms": map[string]any{"ciphers": bad}})); err == nil {
+			t.Errorf("ciphers %v accepted", bad)
+		}
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// sftp_transfer.go — batch download
+// ────────────────────────────────────────────────────────────────────
+
+func TestSFTPDownloadBatch(t *testing.T) {
+	s := newTestSession(t, "sess-batch")
+	defer s.close("test done")
+	sftpID, err := openSFTPSession(s.id, js.Undefined())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, _ := getSFTPSession(sftpID)
+	if err := ss.client.Mkdir("/conf"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{}
+	for i := range 12 {
+		p := fmt.Sprintf("/conf/%02d.yml", i)
+		want[p] = strings.Repeat("x", i*100)
+		f, err := ss.client.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(want[p]))
+		f.Close()
+	}
+	paths := []any{"/conf/missing.yml"}
+	for p := range want {
+		paths = append(paths, p, p) // duplicates are fetched once
+	}
+
+	var calls, lastDone, lastTotal int
+	onProgress := js.FuncOf(func(this js.Value, args []js.Value) any {
+		calls++
+		lastDone, lastTotal = args[0].Int(), args[1].Int()
+		return nil
+	})
+	defer onProgress.Release()
+	got := awaitTestPromise(t, sftpDownloadBatch(sftpID, js.ValueOf(paths), js.ValueOf(map[string]any{"concurrency": 4}), onProgress.Value))
+	for p, content := range want {
+		v := got.Get("files").Get(p)
+		if v.IsUndefined() || string(uint8ArrayToBytes(v)) != content {
+			t.Errorf("%s: wrong or missing content", p)
+		}
+	}
+	if got.Get("errors").Get("/conf/missing.yml").IsUndefined() {
+		t.Error("missing file not reported in errors")
+	}
+	if calls != 13 || lastDone != 13 || lastTotal != 13 {
+		t.Errorf("progress: %d calls, last %d/%d; want 13, 13/13", calls, lastDone, lastTotal)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = awaitPromise(ctx, sftpDownloadBatch(sftpID, js.ValueOf(paths), js.ValueOf(map[string]any{"abortOnError": true}), js.Undefined()))
+	if err == nil || !strings.Contains(err.Error(), "missing.yml") {
+		t.Errorf("abortOnError = %v, want the missing file's error", err)
+	}
+	if _, err := awaitPromise(ctx, sftpDownloadBatch(sftpID, js.ValueOf(paths), js.ValueOf(map[string]any{"concurrency": 0}), js.Undefined())); err == nil {
+		t.Error("concurrency 0 accepted")
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// ssh.go — shell environment
+// ────────────────────────────────────────────────────────────────────
+
+func TestShellEnvReport(t *testing.T) {
+	client := newTestSSHClientWith(t, testServer{refuse: func(req *ssh.Request) bool {
+		var e struct{ Name, Value string }
+		return req.Type == "env" && ssh.Unmarshal(req.Payload, &e) == nil && strings.HasPrefix(e.Name, "SECRET")
+	}})
+	defer client.Close()
+
+	var report js.Value
+	onEnv := js.FuncOf(func(this js.Value, args []js.Value) any {
+		report = args[0]
+		return nil
+	})
+	defer onEnv.Release()
+	config := js.ValueOf(map[string]any{
+		"env":   map[string]any{"LANG": "C.UTF-8", "SECRET_TOKEN": "x", "TZ": "UTC"},
+		"onEnv": onEnv,
+	})
+	shell, err := openShell(&clientConn{sshClient: client}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shell.session.Close()
+	shell.reportEnv(config)
+
+	list := func(v js.Value) []string {
+		var out []string
+		for i := 0; i < v.Length(); i++ {
+			out = append(out, v.Index(i).String())
+		}
+		return out
+	}
+	if report.IsUndefined() {
+		t.Fatal("onEnv not called")
+	}
+	if got := list(report.Get("accepted")); !slices.Equal(got, []string{"LANG", "TZ"}) {
+		t.Errorf("accepted = %v, want [LANG TZ]", got)
+	}
+	if got := list(report.Get("rejected")); !slices.Equal(got, []string{"SECRET_TOKEN"}) {
+		t.Errorf("rejected = %v, want [SECRET_TOKEN]", got)
+	}
+}
+
+func TestExecEnvValidated(t *testing.T) {
+	var sent []string
+	var mu sync.Mutex
+	client := newTestSSHClientWith(t, testServer{request: func(req *ssh.Request, ch ssh.Channel) {
+		switch req.Type {
+		case "env":
+			mu.Lock()
+			sent = append(sent, string(req.Payload))
+			mu.Unlock()
+		case "exec":
+			_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+			ch.Close()
+		}
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &session{id: "sess-exec-env", ctx: ctx, cancel: cancel, cc: &clientConn{sshClient: client}, sshClient: client}
+	sessionStore.Store(s.id, s)
+	defer s.close("test done")
+
+	opts := js.ValueOf(map[string]any{"env": map[string]any{"A": "1", "B": "x\r\nexport EVIL=1"}})
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel2()
+	if _, err := awaitPromise(ctx2, sshExec(s.id, "true", opts)); err == nil || !strings.Contains(err.Error(), "CR, LF") {
+		t.Errorf("exec with CRLF in env = %v, want a rejection", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 0 {
+		t.Errorf("env sent despite the invalid value: %q", sent)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// portforward.go — HTTP response size limit
+// ────────────────────────────────────────────────────────────────────
+
+func TestHandleHTTPRequestResponseLimit(t *testing.T) {
+	body := strings.Repeat("x", 1000)
+	client := newTestSSHClientWith(t, testServer{direct: func(ch ssh.Channel) {
+		defer ch.Close()
+		r := bufio.NewReader(ch)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil || line == "\r\n" {
+				break
+			}
+		}
+		fmt.Fprintf(ch, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+	}})
+	s := &session{id: "sess-http-limit", sshClient: client, cc: &clientConn{sshClient: client}}
+
+	for _, tt := range []struct {
+		limit      int
+		wantStatus int
+	}{
+		{2000, 200},
+		{500, 502},
+	} {
+		tunnel, peer := net.Pipe()
+		fwd := &portForward{remoteHost: "localhost", remotePort: 80, ctx: context.Background(), tunnelConn: tunnel, maxResponse: tt.limit}
+		go fwd.handleHTTPRequest(s, "r1", "GET", "/file", nil, "", "")
+		var resp struct {
+			Status  int               `json:"status"`
+			Headers map[string]string `json:"headers"`
+			Body    string            `json:"body"`
+		}
+		if err := json.NewDecoder(peer).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		peer.Close()
+		if resp.Status != tt.wantStatus {
+			t.Errorf("limit %d: status %d, want %d", tt.limit, resp.Status, tt.wantStatus)
+		}
+		if tt.wantStatus == 200 && resp.Body != body {
+			t.Errorf("limit %d: body of %d bytes, want %d", tt.limit, len(resp.Body), len(body))
+		}
+		if tt.wantStatus == 502 && resp.Headers["X-GoSSH-Error"] != "response-too-large" {
+			t.Errorf("limit %d: headers %v", tt.limit, resp.Headers)
+		}
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────
+// portforward.go — body encoding
+// ────────────────────────────────────────────────────────────────────
+
+func TestHandleHTTPRequestBodyEncoding(t *testing.T) {
+	// The server echoes the request body under the request's Content-Type.
+	client := newTestSSHClientWith(t, testServer{direct: func(ch ssh.Channel) {
+		defer ch.Close()
+		req, err := http.ReadRequest(bufio.NewReader(ch))
+		if err != nil {
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		fmt.Fprintf(ch, "HTTP/1.1 200 OK\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s", req.Header.Get("Content-Type"), len(body), body)
+	}})
+	s := &session{id: "sess-http-encoding", sshClient: client, cc: &clientConn{sshClient: client}}
+
+	blob := string([]byte{0x89, 'P', 'N', 'G', 0, 0xff, 0xfe})
+	for _, tt := range []struct {
+		contentType, body, encoding string
+	}{
+		{"application/json", blob, "base64"},      // binary despite the type
+		{"application/octet-stream", "héllo", ""}, // text despite the type
+		{"", blob, "base64"},
+		{"text/plain", "plain\x00text", ""},
+	} {
+		tunnel, peer := net.Pipe()
+		fwd := &portForward{remoteHost: "localhost", remotePort: 80, ctx: context.Background(), tunnelConn: tunnel, maxResponse: defaultMaxHTTPResponse}
+		headers := map[string]string{}
+		if tt.contentType != "" {
+			headers["Content-Type"] = tt.contentType
+		}
+		go fwd.handleHTTPRequest(s, "r1", "POST", "/echo", headers, base64.StdEncoding.EncodeToString([]byte(tt.body)), "base64")
+		var resp struct {
+			Body         string `json:"body"`
+			BodyEncoding string `json:"bodyEncoding"`
+		}
+		if err := json.NewDecoder(peer).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		peer.Close()
+		got := resp.Body
+		if resp.BodyEncoding == "base64" {
+			raw, _ := base64.StdEncoding.DecodeString(got)
+			got = string(raw)
+		}
+		if resp.BodyEncoding != tt.encoding || got != tt.body {
+			t.Errorf("%q as %q: bodyEncoding %q, body %q", tt.body, tt.contentType, resp.BodyEncoding, got)
+		}
+	}
+
+	tunnel, peer := net.Pipe()
+	defer peer.Close()
+	fwd := &portForward{remoteHost: "localhost", remotePort: 80, ctx: context.Background(), tunnelConn: tunnel, maxResponse: defaultMaxHTTPResponse}
+	go fwd.handleHTTPRequest(s, "r1", "POST", "/echo", nil, "not base64!", "base64")
+	var resp struct {
+		Status int `json:"status"`
+	}
+	if err := json.NewDecoder(peer).Decode(&resp); err != nil || resp.Status != 400 {
+		t.Errorf("invalid base64 body: status %d, %v", resp.Status, err)
+	}
+}
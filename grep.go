@@ -0,0 +1,227 @@
+// grep.go searches file contents on the server over exec, the counterpart
+// to sftpFind's name search: searching in Go would mean reading every file
+// of the tree over SFTP. ripgrep is used when the server has it, grep
+// otherwise; both are run to print "file\0line:text" records, so one
+// parser handles either.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"syscall/js"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var errGrepAborted = errors.New("grepRemote: aborted")
+
+// maxGrepLine caps the text of one match; minified files can have lines
+// of megabytes.
+const maxGrepLine = 4096
+
+// grepOptions is grepRemote's options object.
+type grepOptions struct {
+	pattern string
+	path    string
+	// flags
+	fixed      bool
+	ignoreCase bool
+	word       bool
+	filesOnly  bool
+	maxResults int
+}
+
+func parseGrepOptions(opts js.Value) (grepOptions, error) {
+	o := grepOptions{
+		pattern:    jsString(jsGet(opts, "pattern")),
+		path:       jsString(jsGet(opts, "path")),
+		maxResults: jsInt(jsGet(opts, "maxResults"), defaultFindResults),
+	}
+	if o.pattern == "" {
+		return o, fmt.Errorf("pattern is required")
+	}
+	if o.path == "" {
+		o.path = "."
+	}
+	if o.maxResults < 1 || o.maxResults > maxGlobResults {
+		return o, fmt.Errorf("maxResults must be between 1 and %d", maxGlobResults)
+	}
+	flags := jsGet(opts, "flags")
+	o.fixed = jsBool(jsGet(flags, "fixed"))
+	o.ignoreCase = jsBool(jsGet(flags, "ignoreCase"))
+	o.word = jsBool(jsGet(flags, "word"))
+	o.filesOnly = jsBool(jsGet(flags, "filesOnly"))
+	return o, nil
+}
+
+// grepScript is the shell command grepRemote runs. It prints the tool's
+// name on a line of its own, then the tool's output: rg and grep are
+// flagged alike, recursive with a NUL after each file name (names may
+// contain newlines or colons), no error messages, and binary files
+// skipped. rg is told to ignore its config and .gitignore files so it
+// searches what grep would.
+func grepScript(o grepOptions) string {
+	rg := []string{"rg", "--no-config", "--hidden", "--no-ignore", "--color", "never", "--no-heading", "--null", "-nH", "--no-messages"}
+	grep := []string{"grep", "-rnHIZs"}
+	if o.fixed {
+		rg = append(rg, "-F")
+		grep = append(grep, "-F")
+	} else {
+		grep = append(grep, "-E")
+	}
+	if o.ignoreCase {
+		rg = append(rg, "-i")
+		grep = append(grep, "-i")
+	}
+	if o.word {
+		rg = append(rg, "-w")
+		grep = append(grep, "-w")
+	}
+	if o.filesOnly {
+		rg = append(rg, "-l")
+		grep = append(grep, "-l")
+	}
+	args := " -e " + shellQuote(o.pattern) + " -- " + shellQuote(o.path)
+	return "if command -v rg >/dev/null 2>&1; then echo rg; exec " + strings.Join(rg, " ") + args +
+		"; else echo grep; exec " + strings.Join(grep, " ") + args + "; fi"
+}
+
+// grepReader parses grepScript's output.
+type grepReader struct {
+	r         *bufio.Reader
+	filesOnly bool
+}
+
+// tool reads the first line, the name of the tool that ran.
+func (g *grepReader) tool() (string, error) {
+	line, err := g.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+// next returns the next match: {file} with filesOnly, else {file, line,
+// text}. A record whose "line:" prefix doesn't parse is skipped.
+func (g *grepReader) next() (map[string]any, error) {
+	for {
+		file, err := g.r.ReadString(0)
+		if err != nil {
+			return nil, err
+		}
+		file = strings.TrimSuffix(file, "\x00")
+		if g.filesOnly {
+			return map[string]any{"file": file}, nil
+		}
+		rest, err := g.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		num, text, ok := strings.Cut(strings.TrimSuffix(rest, "\n"), ":")
+		line, convErr := strconv.Atoi(num)
+		if !ok || convErr != nil {
+			if err == io.EOF {
+				return nil, err
+			}
+			continue
+		}
+		if len(text) > maxGrepLine {
+			text = text[:maxGrepLine]
+		}
+		return map[string]any{"file": file, "line": line, "text": strings.ToValidUTF8(text, "\uFFFD")}, nil
+	}
+}
+
+// grepRemote searches the files under opts.path (default: the login
+// directory) for opts.pattern with rg, or grep where rg isn't installed,
+// and resolves with up to maxResults (default 1000, at most 10000) matches
+// as {file, line, text}, or {file} with flags.filesOnly. onMatch receives
+// each match as it arrives. The search is stopped once maxResults are
+// found, with truncated set. Binary and unreadable files are skipped; it
+// rejects only when the tool fails having found nothing, e.g. when path
+// doesn't exist.
+// Called from JS as:
+//
+//	GoSSH.grepRemote(sessionId, {pattern, path?, flags?: {fixed, ignoreCase, word, filesOnly}, maxResults?, onMatch?, signal?}) → Promise<{matches, truncated, tool}>
+func grepRemote(sessionID string, opts js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		sess, err := getSession(sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("grepRemote: %w", err)
+		}
+		o, err := parseGrepOptions(opts)
+		if err != nil {
+			return nil, fmt.Errorf("grepRemote: %w", err)
+		}
+		onMatch, hasOnMatch := getCallback(opts, "onMatch")
+		ctx, stop := abortContext(jsGet(opts, "signal"))
+		defer stop()
+		if ctx.Err() != nil {
+			return nil, errGrepAborted
+		}
+
+		s, err := sess.newExecSession(false)
+		if err != nil {
+			return nil, fmt.Errorf("grepRemote: %w", err)
+		}
+		defer closeQuietly(s)
+		stdout, err := s.StdoutPipe()
+		if err != nil {
+			return nil, fmt.Errorf("grepRemote: %w", err)
+		}
+		if err := s.Start(grepScript(o)); err != nil {
+			return nil, fmt.Errorf("grepRemote: %w", err)
+		}
+		stopAbort := context.AfterFunc(ctx, func() { closeQuietly(s) })
+		defer stopAbort()
+
+		g := &grepReader{r: bufio.NewReader(stdout), filesOnly: o.filesOnly}
+		tool, _ := g.tool()
+		matches := []any{}
+		truncated := false
+		for {
+			m, err := g.next()
+			if err != nil {
+				break
+			}
+			if len(matches) == o.maxResults {
+				truncated = true
+				break
+			}
+			matches = append(matches, m)
+			if hasOnMatch {
+				onMatch.Invoke(m)
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, errGrepAborted
+		}
+		result := map[string]any{"matches": matches, "truncated": truncated, "tool": tool}
+		if truncated {
+			// Stop the search; its exit status no longer matters.
+			closeQuietly(s)
+			return result, nil
+		}
+		_, _ = io.Copy(io.Discard, stdout)
+		// Both tools exit 1 when nothing matched, and 2 on errors, which
+		// are otherwise silent here.
+		var exitErr *ssh.ExitError
+		if err := s.Wait(); err != nil {
+			if !errors.As(err, &exitErr) || exitErr.ExitStatus() > 2 || exitErr.ExitStatus() == 2 && len(matches) == 0 {
+				return nil, fmt.Errorf("grepRemote: %w", err)
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, errGrepAborted
+		}
+		return result, nil
+	})
+}
@@ -0,0 +1,253 @@
+// input.go paces large input to the interactive shell. Line-editing shells
+// (readline, zle) process input as it arrives and can drop characters when
+// a big paste lands in one burst, so sendText writes it in small chunks
+// with a delay between them, optionally waiting for the shell to echo each
+// chunk before sending the next. Keystrokes written while a paste is in
+// progress are held and sent after it, so they can't land in its middle.
+//
+// A session connected with inputRateLimit also caps its input rate: write
+// rejects input over the cap, and sendText slows down to stay under it.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"syscall/js"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultSendTextChunk = 256
+	maxSendTextChunk     = 64 * 1024
+	defaultSendTextDelay = 10 * time.Millisecond
+	maxSendTextDelay     = 10 * time.Second
+	// defaultEchoTimeout bounds the wait for echo, so input that produces
+	// no output (e.g. a password prompt) doesn't stall the paste.
+	defaultEchoTimeout = time.Second
+	// maxHeldInput bounds the keystrokes held during a paste.
+	maxHeldInput = 64 * 1024
+)
+
+// inputQueue serializes shell input: one sendText at a time, and write
+// calls made during it held until it ends. write never waits for a paste,
+// since it runs on the JS event loop.
+type inputQueue struct {
+	pasteMu sync.Mutex // held for the whole of a sendText
+
+	mu      sync.Mutex // guards pasting and held
+	pasting bool
+	held    []byte
+}
+
+// write sends p to w, or holds it while a paste is in progress.
+func (q *inputQueue) write(w io.Writer, p []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.pasting {
+		_, _ = w.Write(p)
+		return
+	}
+	if len(q.held)+len(p) > maxHeldInput {
+		logWarnf("write: too much input held during sendText, dropped bytes:", len(p))
+		return
+	}
+	q.held = append(q.held, p...)
+}
+
+// beginPaste waits for any other paste to finish and starts holding writes.
+func (q *inputQueue) beginPaste() {
+	q.pasteMu.Lock()
+	q.mu.Lock()
+	q.pasting = true
+	q.mu.Unlock()
+}
+
+// endPaste sends the writes held during the paste to w (if not nil) and
+// lets the next paste start.
+func (q *inputQueue) endPaste(w io.Writer) {
+	q.mu.Lock()
+	if len(q.held) > 0 && w != nil {
+		_, _ = w.Write(q.held)
+	}
+	q.held = nil
+	q.pasting = false
+	q.mu.Unlock()
+	q.pasteMu.Unlock()
+}
+
+// rateLimiter is a token bucket over input bytes, holding up to one
+// second's worth. A nil *rateLimiter is unlimited.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter for bytesPerSec, or nil for 0.
+func newRateLimiter(bytesPerSec int) *rateLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: float64(bytesPerSec), tokens: float64(bytesPerSec), last: time.Now()}
+}
+
+func (l *rateLimiter) refill(now time.Time) {
+	l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+}
+
+// allow takes n bytes from the bucket if they are all there.
+func (l *rateLimiter) allow(n int) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	if l.tokens < float64(n) {
+		return false
+	}
+	l.tokens -= float64(n)
+	return true
+}
+
+// wait takes n bytes from the bucket, going into debt if need be, and
+// sleeps until the debt is paid off or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	l.refill(time.Now())
+	l.tokens -= float64(n)
+	deficit := -l.tokens
+	l.mu.Unlock()
+	if deficit <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(deficit / l.rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// outputNotifier lets writers wait for the next shell output.
+type outputNotifier struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// next returns a channel closed when output next arrives.
+func (n *outputNotifier) next() <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ch == nil {
+		n.ch = make(chan struct{})
+	}
+	return n.ch
+}
+
+// notify wakes everyone waiting in next.
+func (n *outputNotifier) notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ch != nil {
+		close(n.ch)
+		n.ch = nil
+	}
+}
+
+// sshSendText writes text to the shell's stdin in paced chunks. Chunks end
+// on UTF-8 character boundaries. With waitForEcho, each chunk waits (up to
+// echoTimeoutMs) for shell output before the delay and the next chunk.
+// Called from JS as:
+//
+//	GoSSH.sendText(sessionId, text, opts?: {chunkSize, interChunkDelayMs, waitForEcho, echoTimeoutMs, signal}) → Promise<void>
+func sshSendText(sessionID, text string, opts js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		sess, err := getSession(sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("sendText: %w", err)
+		}
+		if sess.shellStdin() == nil {
+			return nil, fmt.Errorf("sendText: session has no shell")
+		}
+		chunkSize := jsInt(jsGet(opts, "chunkSize"), defaultSendTextChunk)
+		if chunkSize < utf8.UTFMax || chunkSize > maxSendTextChunk {
+			return nil, fmt.Errorf("sendText: chunkSize must be between %d and %d", utf8.UTFMax, maxSendTextChunk)
+		}
+		delay := time.Duration(jsInt(jsGet(opts, "interChunkDelayMs"), int(defaultSendTextDelay/time.Millisecond))) * time.Millisecond
+		if delay < 0 || delay > maxSendTextDelay {
+			return nil, fmt.Errorf("sendText: interChunkDelayMs must be between 0 and %d", maxSendTextDelay.Milliseconds())
+		}
+		waitForEcho := jsBool(jsGet(opts, "waitForEcho"))
+		echoTimeout := defaultEchoTimeout
+		if ms := jsInt(jsGet(opts, "echoTimeoutMs"), 0); ms > 0 {
+			echoTimeout = time.Duration(ms) * time.Millisecond
+		}
+		signal := jsGet(opts, "signal")
+
+		sess.input.beginPaste()
+		defer func() { sess.input.endPaste(sess.shellStdin()) }()
+
+		data := []byte(text)
+		for len(data) > 0 {
+			if isAborted(signal) {
+				return nil, fmt.Errorf("sendText: aborted")
+			}
+			n := len(data)
+			if n > chunkSize {
+				n = chunkSize
+				for n > 0 && !utf8.RuneStart(data[n]) {
+					n--
+				}
+				if n == 0 { // not UTF-8 after all
+					n = chunkSize
+				}
+			}
+
+			if err := sess.inputLimit.wait(sess.ctx, n); err != nil {
+				return nil, fmt.Errorf("sendText: session closed")
+			}
+			echoed := sess.output.next()
+			if _, err := sess.shellStdin().Write(data[:n]); err != nil {
+				return nil, fmt.Errorf("sendText: %w", err)
+			}
+			data = data[n:]
+			if len(data) == 0 {
+				break
+			}
+
+			if waitForEcho {
+				timer := time.NewTimer(echoTimeout)
+				select {
+				case <-echoed:
+				case <-timer.C:
+				case <-sess.ctx.Done():
+				}
+				timer.Stop()
+			}
+			if delay > 0 {
+				select {
+				case <-time.After(delay):
+				case <-sess.ctx.Done():
+				}
+			}
+			if sess.ctx.Err() != nil {
+				return nil, fmt.Errorf("sendText: session closed")
+			}
+		}
+		return nil, nil
+	})
+}
@@ -24,14 +24,14 @@ var errAwaitTimeout = errors.New("jsutil: await timed out")
 func newPromise(fn func() (any, error)) js.Value {
 	handler := js.FuncOf(func(this js.Value, args []js.Value) any {
 		resolve, reject := args[0], args[1]
-		go func() {
+		spawn("promise", func() {
 			result, err := fn()
 			if err != nil {
 				reject.Invoke(jsError(err))
 			} else {
 				resolve.Invoke(result)
 			}
-		}()
+		})
 		return nil
 	})
 	// Promise constructor invokes handler synchronously, so it's safe to
@@ -81,9 +81,39 @@ func awaitPromise(ctx context.Context, promise js.Value) (js.Value, error) {
 	}
 }
 
-// jsError creates a JS Error object from a Go error.
+// abortContext returns a context cancelled when signal (an AbortSignal,
+// possibly undefined) aborts, or already cancelled if it has. stop
+// removes the listener and must be called once the work is done.
+func abortContext(signal js.Value) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if signal.Type() != js.TypeObject {
+		return ctx, cancel
+	}
+	if isAborted(signal) {
+		cancel()
+		return ctx, cancel
+	}
+	onAbort := js.FuncOf(func(this js.Value, args []js.Value) any {
+		cancel()
+		return nil
+	})
+	signal.Call("addEventListener", "abort", onAbort)
+	return ctx, func() {
+		signal.Call("removeEventListener", "abort", onAbort)
+		onAbort.Release()
+		cancel()
+	}
+}
+
+// jsError creates a JS Error object from a Go error. If the error chain
+// contains a codedError, its code is exposed as err.code.
 func jsError(err error) js.Value {
-	return js.Global().Get("Error").New(err.Error())
+	jsErr := js.Global().Get("Error").New(err.Error())
+	var ce *codedError
+	if errors.As(err, &ce) {
+		jsErr.Set("code", ce.code)
+	}
+	return jsErr
 }
 
 // uint8ArrayToBytes copies a JS Uint8Array into a Go byte slice.
@@ -128,6 +158,15 @@ func jsBool(v js.Value) bool {
 	return v.Bool()
 }
 
+// jsGet safely reads a property from an optional JS options object,
+// returning undefined if the object itself is undefined, null, or not an object.
+func jsGet(obj js.Value, key string) js.Value {
+	if obj.Type() != js.TypeObject && obj.Type() != js.TypeFunction {
+		return js.Undefined()
+	}
+	return obj.Get(key)
+}
+
 // maskControl sanitizes SSH banner and prompt output by replacing
 // dangerous control characters that could be used for terminal injection.
 // Preserves CR, LF, TAB, and standard printable characters.
@@ -153,8 +192,9 @@ func maskControl(s string) string {
 
 // getCallback safely retrieves a JS callback function from a config object.
 // Returns the function and true if it exists, or (undefined, false) otherwise.
+// An undefined or null config (an omitted opts argument) has no callbacks.
 func getCallback(config js.Value, name string) (js.Value, bool) {
-	fn := config.Get(name)
+	fn := jsGet(config, name)
 	if fn.IsUndefined() || fn.IsNull() {
 		return js.Undefined(), false
 	}
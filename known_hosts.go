@@ -0,0 +1,245 @@
+// known_hosts.go checks server host keys against an OpenSSH known_hosts
+// document supplied by the app (connect config knownHosts), giving
+// trust-on-first-use semantics without a filesystem: a known key connects
+// silently, an unknown host goes to the onHostKey prompt (and, once
+// accepted, back to the app as a line to persist via onHostKeyAdd), and a
+// changed key fails with code HOST_KEY_CHANGED instead of prompting.
+// Apps that store keys per host can answer onHostKeyLookup(host) instead
+// of passing the whole document up front, and persist with
+// onHostKeyLearn(host, line).
+//
+// knownhosts.New only reads files, so lines are parsed here with
+// ssh.ParseKnownHosts. Hashed hosts (|1|salt|hash), wildcard and negated
+// patterns, and @revoked markers are supported; @cert-authority lines are
+// ignored.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1" // #nosec G505 -- required by the hashed known_hosts format.
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"syscall/js"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// knownHostEntry is one parsed known_hosts line.
+type knownHostEntry struct {
+	marker string // "", "revoked", or "cert-authority"
+	hosts  []string
+	key    ssh.PublicKey
+}
+
+// knownHostsDB is a parsed known_hosts document.
+type knownHostsDB []knownHostEntry
+
+// hostKeyVerdict is the result of looking up a host key.
+type hostKeyVerdict int
+
+const (
+	hostUnknown hostKeyVerdict = iota // no entry for this host and key type
+	hostKnown                         // the key is listed for the host
+	hostChanged                       // a different key of the same type is listed
+	hostRevoked                       // the key is marked @revoked
+)
+
+// parseKnownHosts parses an OpenSSH known_hosts document. It returns nil
+// for an empty document.
+func parseKnownHosts(data string) (knownHostsDB, error) {
+	var db knownHostsDB
+	rest := []byte(data)
+	for line := 1; len(rest) > 0; line++ {
+		marker, hosts, key, _, next, err := ssh.ParseKnownHosts(rest)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", line, err)
+		}
+		db = append(db, knownHostEntry{marker: marker, hosts: hosts, key: key})
+		rest = next
+	}
+	return db, nil
+}
+
+// check looks up key for address (host:port, as given to the host key
+// callback). It also returns the listed key when the verdict is hostChanged.
+func (db knownHostsDB) check(address string, key ssh.PublicKey) (hostKeyVerdict, ssh.PublicKey) {
+	host := strings.ToLower(knownhosts.Normalize(address))
+	keyBytes := key.Marshal()
+
+	verdict := hostUnknown
+	var want ssh.PublicKey
+	for _, e := range db {
+		if e.marker == "cert-authority" || !matchKnownHost(e.hosts, host) {
+			continue
+		}
+		same := bytes.Equal(e.key.Marshal(), keyBytes)
+		switch {
+		case e.marker == "revoked":
+			if same {
+				return hostRevoked, nil
+			}
+		case same:
+			verdict = hostKnown
+		case e.key.Type() == key.Type() && verdict == hostUnknown:
+			verdict, want = hostChanged, e.key
+		}
+	}
+	if verdict == hostKnown {
+		want = nil
+	}
+	return verdict, want
+}
+
+// matchKnownHost reports whether host (normalized, lowercase) matches a
+// line's host list. A matching negated pattern (!pattern) excludes the
+// host regardless of the others.
+func matchKnownHost(patterns []string, host string) bool {
+	matched := false
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "|1|") {
+			if matchHashedHost(p, host) {
+				matched = true
+			}
+			continue
+		}
+		negate := strings.HasPrefix(p, "!")
+		if negate {
+			p = p[1:]
+		}
+		if wildcardMatch(strings.ToLower(p), host) {
+			if negate {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchHashedHost checks a |1|salt|hash entry: hash is HMAC-SHA1 of the
+// host keyed with salt, both base64.
+func matchHashedHost(entry, host string) bool {
+	parts := strings.Split(entry[len("|1|"):], "|")
+	if len(parts) != 2 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	want, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// wildcardMatch matches s against an OpenSSH pattern, where '*' matches
+// any run of characters and '?' exactly one.
+func wildcardMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if wildcardMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
+
+// knownHostsCallback wraps prompt with a known_hosts check. Keys already
+// listed skip the prompt; changed or revoked keys fail without prompting.
+// When prompt accepts an unknown key, onAdd (if set) gets the host, as
+// written in known_hosts, and the matching line for persisting.
+func knownHostsCallback(db knownHostsDB, prompt ssh.HostKeyCallback, onAdd func(host, line string)) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		verdict, want := db.check(hostname, key)
+		switch verdict {
+		case hostKnown:
+			return nil
+		case hostRevoked:
+			return fmt.Errorf("connect: host key %s for %s is revoked", ssh.FingerprintSHA256(key), hostname)
+		case hostChanged:
+			return &codedError{
+				code: errCodeHostKeyChanged,
+				msg: fmt.Sprintf("connect: host key for %s has changed (known %s, got %s); possible man-in-the-middle attack",
+					hostname, ssh.FingerprintSHA256(want), ssh.FingerprintSHA256(key)),
+			}
+		}
+		if err := prompt(hostname, remote, key); err != nil {
+			return err
+		}
+		if onAdd != nil {
+			host := knownhosts.Normalize(hostname)
+			onAdd(host, knownhosts.Line([]string{host}, key))
+		}
+		return nil
+	}
+}
+
+// hostKeyLookupTimeout bounds the wait for onHostKeyLookup.
+const hostKeyLookupTimeout = 30 * time.Second
+
+// lookupKnownHostsCallback is knownHostsCallback with the host's entries
+// fetched from the app when its key is checked: lookup(host) returns
+// known_hosts lines, or null for a host it has never seen. They are
+// checked together with static. A lookup that fails or returns something
+// unparsable fails the connection rather than prompting, which would
+// offer the user a key the app may already hold a different one for.
+func lookupKnownHostsCallback(ctx context.Context, lookup js.Value, static knownHostsDB, prompt ssh.HostKeyCallback, onAdd func(host, line string)) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		host := knownhosts.Normalize(hostname)
+		lookupCtx, cancel := context.WithTimeout(ctx, hostKeyLookupTimeout)
+		defer cancel()
+		result, err := awaitPromise(lookupCtx, js.Global().Get("Promise").Call("resolve", lookup.Invoke(host)))
+		if ctx.Err() != nil {
+			return fmt.Errorf("host key verification failed: %w", errConnectAborted)
+		}
+		if err != nil {
+			return fmt.Errorf("connect: onHostKeyLookup: %w", err)
+		}
+		var lines string
+		switch result.Type() {
+		case js.TypeString:
+			lines = result.String()
+		case js.TypeNull, js.TypeUndefined:
+		default:
+			return fmt.Errorf("connect: onHostKeyLookup must return a known_hosts string or null")
+		}
+		db, err := parseKnownHosts(lines)
+		if err != nil {
+			return fmt.Errorf("connect: onHostKeyLookup: %w", err)
+		}
+		return knownHostsCallback(append(slices.Clip(static), db...), prompt, onAdd)(hostname, remote, key)
+	}
+}
@@ -0,0 +1,80 @@
+// lines.go reassembles a byte stream into complete lines for consumers that
+// want line-oriented output instead of arbitrary read-sized chunks.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// defaultMaxLineLength caps how much a line without a newline may buffer
+// before it is force-emitted.
+const defaultMaxLineLength = 64 * 1024
+
+// lineSplitter buffers bytes until '\n' and emits each line without its
+// terminator. Both "\r\n" and bare "\n" end a line. A line longer than max
+// is emitted in pieces of at most max bytes, cut on UTF-8 character
+// boundaries, so a stream without newlines can't grow the buffer without
+// bound.
+type lineSplitter struct {
+	buf  []byte
+	max  int
+	emit func(line string)
+}
+
+func newLineSplitter(max int, emit func(string)) *lineSplitter {
+	if max <= 0 {
+		max = defaultMaxLineLength
+	}
+	return &lineSplitter{max: max, emit: emit}
+}
+
+// Write consumes p, emitting every line it completes.
+func (l *lineSplitter) Write(p []byte) {
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			l.buf = append(l.buf, p...)
+			p = nil
+		} else {
+			l.buf = append(l.buf, p[:i]...)
+			p = p[i+1:]
+			l.emitLine()
+		}
+		for len(l.buf) >= l.max {
+			n := l.cut()
+			l.emit(string(l.buf[:n]))
+			l.buf = append(l.buf[:0], l.buf[n:]...)
+		}
+	}
+}
+
+// cut returns where to split an over-long buffer: at max, backed off to
+// the start of a character split there.
+func (l *lineSplitter) cut() int {
+	for n := l.max; n > 0 && l.max-n < utf8.UTFMax; n-- {
+		if n == len(l.buf) || utf8.RuneStart(l.buf[n]) {
+			return n
+		}
+	}
+	return l.max // not UTF-8 after all
+}
+
+// Flush emits any partial line left in the buffer.
+func (l *lineSplitter) Flush() {
+	if len(l.buf) > 0 {
+		l.emitLine()
+	}
+}
+
+func (l *lineSplitter) emitLine() {
+	line := l.buf
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	l.emit(string(line))
+	l.buf = l.buf[:0]
+}
@@ -6,6 +6,7 @@ package gossh
 
 import (
 	"fmt"
+	"math"
 	"syscall/js"
 )
 
@@ -23,19 +24,95 @@ func RegisterAPI() {
 		return sshConnect(args[0])
 	})
 
+	gossh["connectFull"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 1 {
+			return jsError(errMissingConfig)
+		}
+		return sshConnectFull(args[0])
+	})
+
 	gossh["write"] = js.FuncOf(func(this js.Value, args []js.Value) any {
 		if len(args) < 2 {
 			return nil
 		}
-		sshWrite(args[0].String(), args[1])
+		if err := sshWrite(args[0].String(), args[1]); err != nil {
+			return jsError(err)
+		}
 		return nil
 	})
 
+	gossh["sendText"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		var opts js.Value
+		if len(args) > 2 {
+			opts = args[2]
+		}
+		return sshSendText(args[0].String(), args[1].String(), opts)
+	})
+
 	gossh["resize"] = js.FuncOf(func(this js.Value, args []js.Value) any {
 		if len(args) < 3 {
 			return nil
 		}
-		sshResize(args[0].String(), args[1].Int(), args[2].Int())
+		channelID := ""
+		if len(args) > 3 {
+			channelID = jsString(args[3])
+		}
+		sshResize(args[0].String(), args[1].Int(), args[2].Int(), channelID)
+		return nil
+	})
+
+	gossh["getPtySize"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 1 {
+			return js.Null()
+		}
+		channelID := ""
+		if len(args) > 1 {
+			channelID = jsString(args[1])
+		}
+		return sshGetPtySize(args[0].String(), channelID)
+	})
+
+	gossh["reconnect"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 1 {
+			return jsError(errMissingConfig)
+		}
+		return sshReconnect(args[0].String())
+	})
+
+	gossh["sshSessionInfo"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 1 {
+			return jsError(errMissingConfig)
+		}
+		info, err := sshSessionInfo(args[0].String())
+		if err != nil {
+			return jsError(err)
+		}
+		return info
+	})
+
+	gossh["exec"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		var opts js.Value
+		if len(args) > 2 {
+			opts = args[2]
+		}
+		return sshExec(args[0].String(), args[1].String(), opts)
+	})
+
+	gossh["grepRemote"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		return grepRemote(args[0].String(), args[1])
+	})
+
+	gossh["poolFlush"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		poolFlush()
 		return nil
 	})
 
@@ -47,6 +124,67 @@ func RegisterAPI() {
 		return nil
 	})
 
+	gossh["stripAnsi"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 1 {
+			return js.Undefined()
+		}
+		return jsStripANSI(args[0])
+	})
+
+	// === Raw protocol passthrough ===
+
+	gossh["sendGlobalRequest"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 3 {
+			return jsError(errMissingConfig)
+		}
+		payload := ""
+		if len(args) > 3 {
+			payload = jsString(args[3])
+		}
+		return sshSendGlobalRequest(args[0].String(), args[1].String(), jsBool(args[2]), payload)
+	})
+
+	gossh["openChannel"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		payload := ""
+		if len(args) > 2 {
+			payload = jsString(args[2])
+		}
+		opts := js.Undefined()
+		if len(args) > 3 {
+			opts = args[3]
+		}
+		return sshOpenChannel(args[0].String(), args[1].String(), payload, opts)
+	})
+
+	gossh["openSubsystem"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		opts := js.Undefined()
+		if len(args) > 2 {
+			opts = args[2]
+		}
+		return sshOpenSubsystem(args[0].String(), args[1].String(), opts)
+	})
+
+	gossh["channelWrite"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		return sshChannelWrite(args[0].String(), args[1])
+	})
+
+	gossh["channelClose"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 1 {
+			return nil
+		}
+		sshChannelClose(args[0].String())
+		return nil
+	})
+
 	// === SSH Agent ===
 
 	gossh["agentAddKey"] = js.FuncOf(func(this js.Value, args []js.Value) any {
@@ -57,7 +195,19 @@ func RegisterAPI() {
 		if len(args) > 1 && !args[1].IsUndefined() && !args[1].IsNull() {
 			passphrase = args[1].String()
 		}
-		return agentAddKey(args[0].String(), passphrase)
+		var opts js.Value
+		if len(args) > 2 {
+			opts = args[2]
+		}
+		return agentAddKey(args[0].String(), passphrase, opts)
+	})
+
+	gossh["agentGenerateKey"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		var opts js.Value
+		if len(args) > 0 {
+			opts = args[0]
+		}
+		return agentGenerateKey(opts)
 	})
 
 	gossh["agentRemoveKey"] = js.FuncOf(func(this js.Value, args []js.Value) any {
@@ -67,6 +217,27 @@ func RegisterAPI() {
 		return agentRemoveKey(args[0].String())
 	})
 
+	gossh["agentGetPublicKey"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 1 {
+			return jsError(fmt.Errorf("agentGetPublicKey: fingerprint required"))
+		}
+		return agentGetPublicKey(args[0].String())
+	})
+
+	gossh["agentLock"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 1 {
+			return jsError(fmt.Errorf("agentLock: passphrase required"))
+		}
+		return agentLock(args[0].String())
+	})
+
+	gossh["agentUnlock"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 1 {
+			return jsError(fmt.Errorf("agentUnlock: passphrase required"))
+		}
+		return agentUnlock(args[0].String())
+	})
+
 	gossh["agentRemoveAll"] = js.FuncOf(func(this js.Value, args []js.Value) any {
 		agentRemoveAll()
 		return nil
@@ -76,13 +247,37 @@ func RegisterAPI() {
 		return agentListKeys()
 	})
 
+	gossh["randomArt"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 1 {
+			return jsError(errMissingConfig)
+		}
+		var opts js.Value
+		if len(args) > 1 {
+			opts = args[1]
+		}
+		art, err := randomArtForKey(args[0].String(), opts)
+		if err != nil {
+			return jsError(err)
+		}
+		return js.ValueOf(art)
+	})
+
+	gossh["clearRandomArtCache"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		clearRandomArtCache()
+		return nil
+	})
+
 	// === SFTP ===
 
 	gossh["sftpOpen"] = js.FuncOf(func(this js.Value, args []js.Value) any {
 		if len(args) < 1 {
 			return jsError(errMissingConfig)
 		}
-		return sftpOpen(args[0].String())
+		opts := js.Undefined()
+		if len(args) > 1 {
+			opts = args[1]
+		}
+		return sftpOpen(args[0].String(), opts)
 	})
 
 	gossh["sftpClose"] = js.FuncOf(func(this js.Value, args []js.Value) any {
@@ -97,21 +292,68 @@ func RegisterAPI() {
 		if len(args) < 2 {
 			return jsError(errMissingConfig)
 		}
-		return sftpListDir(args[0].String(), args[1].String())
+		var opts js.Value
+		if len(args) > 2 {
+			opts = args[2]
+		}
+		return sftpListDir(args[0].String(), args[1].String(), opts)
+	})
+
+	gossh["sftpGlob"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		return sftpGlob(args[0].String(), args[1].String())
+	})
+
+	gossh["sftpFind"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 3 {
+			return jsError(errMissingConfig)
+		}
+		return sftpFind(args[0].String(), args[1].String(), args[2])
 	})
 
 	gossh["sftpStat"] = js.FuncOf(func(this js.Value, args []js.Value) any {
 		if len(args) < 2 {
 			return jsError(errMissingConfig)
 		}
-		return sftpStat(args[0].String(), args[1].String())
+		var opts js.Value
+		if len(args) > 2 {
+			opts = args[2]
+		}
+		return sftpStat(args[0].String(), args[1].String(), opts)
+	})
+
+	gossh["sftpExists"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		return sftpExists(args[0].String(), args[1].String())
 	})
 
 	gossh["sftpMkdir"] = js.FuncOf(func(this js.Value, args []js.Value) any {
 		if len(args) < 2 {
 			return jsError(errMissingConfig)
 		}
-		return sftpMkdir(args[0].String(), args[1].String())
+		mode := -1
+		if len(args) > 2 && !args[2].IsUndefined() && !args[2].IsNull() {
+			mode = args[2].Int()
+			if mode < 0 || mode > 0o7777 {
+				return jsError(fmt.Errorf("sftpMkdir: mode must be between 0 and 07777"))
+			}
+		}
+		return sftpMkdir(args[0].String(), args[1].String(), mode)
+	})
+
+	gossh["sftpEnsureDir"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		var opts js.Value
+		if len(args) > 2 {
+			opts = args[2]
+		}
+		return sftpEnsureDir(args[0].String(), args[1].String(), opts)
 	})
 
 	gossh["sftpRemove"] = js.FuncOf(func(this js.Value, args []js.Value) any {
@@ -122,14 +364,68 @@ func RegisterAPI() {
 		if len(args) > 2 && !args[2].IsUndefined() {
 			recursive = args[2].Bool()
 		}
-		return sftpRemove(args[0].String(), args[1].String(), recursive)
+		var opts js.Value
+		if len(args) > 3 {
+			opts = args[3]
+		}
+		return sftpRemove(args[0].String(), args[1].String(), recursive, opts)
 	})
 
 	gossh["sftpRename"] = js.FuncOf(func(this js.Value, args []js.Value) any {
 		if len(args) < 3 {
 			return jsError(errMissingConfig)
 		}
-		return sftpRename(args[0].String(), args[1].String(), args[2].String())
+		var opts js.Value
+		if len(args) > 3 {
+			opts = args[3]
+		}
+		return sftpRename(args[0].String(), args[1].String(), args[2].String(), opts)
+	})
+
+	gossh["sftpHardlink"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 3 {
+			return jsError(errMissingConfig)
+		}
+		return sftpHardlink(args[0].String(), args[1].String(), args[2].String())
+	})
+
+	gossh["sftpStatVFS"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		return sftpStatVFS(args[0].String(), args[1].String())
+	})
+
+	gossh["sftpReadlink"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		return sftpReadlink(args[0].String(), args[1].String())
+	})
+
+	gossh["sftpSymlink"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 3 {
+			return jsError(errMissingConfig)
+		}
+		return sftpSymlink(args[0].String(), args[1].String(), args[2].String())
+	})
+
+	gossh["sftpTruncate"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 3 {
+			return jsError(errMissingConfig)
+		}
+		return sftpTruncate(args[0].String(), args[1].String(), args[2].Float())
+	})
+
+	gossh["sftpBatch"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		var opts js.Value
+		if len(args) > 2 {
+			opts = args[2]
+		}
+		return sftpBatch(args[0].String(), args[1], opts)
 	})
 
 	gossh["sftpChmod"] = js.FuncOf(func(this js.Value, args []js.Value) any {
@@ -143,6 +439,82 @@ func RegisterAPI() {
 		return sftpChmod(args[0].String(), args[1].String(), uint32(mode))
 	})
 
+	gossh["sftpChown"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 4 {
+			return jsError(errMissingConfig)
+		}
+		ids := [2]int{}
+		for i, name := range []string{"uid", "gid"} {
+			v := args[2+i]
+			if v.Type() != js.TypeNumber || v.Float() != math.Trunc(v.Float()) || v.Float() < 0 || v.Float() > math.MaxUint32 {
+				return jsError(fmt.Errorf("sftpChown: %s must be an integer between 0 and %d", name, uint32(math.MaxUint32)))
+			}
+			ids[i] = int(v.Float())
+		}
+		return sftpChown(args[0].String(), args[1].String(), ids[0], ids[1])
+	})
+
+	gossh["sftpChtimes"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 4 {
+			return jsError(errMissingConfig)
+		}
+		return sftpChtimes(args[0].String(), args[1].String(), args[2], args[3])
+	})
+
+	gossh["sftpChmodRecursive"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 3 {
+			return jsError(errMissingConfig)
+		}
+		modes := [2]int{-1, -1}
+		for i, key := range []string{"fileMode", "dirMode"} {
+			v := jsGet(args[2], key)
+			if v.IsUndefined() || v.IsNull() {
+				continue
+			}
+			modes[i] = v.Int()
+			if modes[i] < 0 || modes[i] > 0o7777 {
+				return jsError(fmt.Errorf("sftpChmodRecursive: %s must be between 0 and 07777", key))
+			}
+		}
+		if modes[0] < 0 && modes[1] < 0 {
+			return jsError(fmt.Errorf("sftpChmodRecursive: fileMode or dirMode required"))
+		}
+		return sftpChmodRecursive(args[0].String(), args[1].String(), modes[0], modes[1], args[2])
+	})
+
+	gossh["sftpDirSize"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		var opts js.Value
+		if len(args) > 2 {
+			opts = args[2]
+		}
+		return sftpDirSize(args[0].String(), args[1].String(), opts)
+	})
+
+	gossh["sftpDownloadDir"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 3 {
+			return jsError(errMissingConfig)
+		}
+		return sftpDownloadDir(args[0].String(), args[1].String(), args[2])
+	})
+
+	gossh["sftpChecksum"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 3 {
+			return jsError(errMissingConfig)
+		}
+		onProgress := js.Undefined()
+		if len(args) > 3 {
+			onProgress = args[3]
+		}
+		signal := js.Undefined()
+		if len(args) > 4 {
+			signal = args[4]
+		}
+		return sftpChecksum(args[0].String(), args[1].String(), args[2].String(), onProgress, signal)
+	})
+
 	gossh["sftpGetwd"] = js.FuncOf(func(this js.Value, args []js.Value) any {
 		if len(args) < 1 {
 			return jsError(errMissingConfig)
@@ -157,6 +529,38 @@ func RegisterAPI() {
 		return sftpRealPath(args[0].String(), args[1].String())
 	})
 
+	gossh["sftpFileOpen"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		flags := ""
+		if len(args) > 2 {
+			flags = jsString(args[2])
+		}
+		return sftpFileOpen(args[0].String(), args[1].String(), flags)
+	})
+
+	gossh["sftpFileReadAt"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 3 {
+			return jsError(errMissingConfig)
+		}
+		return sftpFileReadAt(args[0].String(), args[1].Float(), args[2].Int())
+	})
+
+	gossh["sftpFileWriteAt"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 3 {
+			return jsError(errMissingConfig)
+		}
+		return sftpFileWriteAt(args[0].String(), args[1].Float(), args[2])
+	})
+
+	gossh["sftpFileClose"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 1 {
+			return jsError(errMissingConfig)
+		}
+		return sftpFileClose(args[0].String())
+	})
+
 	gossh["sftpUpload"] = js.FuncOf(func(this js.Value, args []js.Value) any {
 		if len(args) < 3 {
 			return jsError(errMissingConfig)
@@ -169,7 +573,26 @@ func RegisterAPI() {
 		if len(args) > 4 {
 			signal = args[4]
 		}
-		return sftpUpload(args[0].String(), args[1].String(), args[2], onProgress, signal)
+		var opts js.Value
+		if len(args) > 5 {
+			opts = args[5]
+		}
+		return sftpUpload(args[0].String(), args[1].String(), args[2], onProgress, signal, opts)
+	})
+
+	gossh["sftpUploadTree"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 3 {
+			return jsError(errMissingConfig)
+		}
+		onProgress := js.Undefined()
+		if len(args) > 3 {
+			onProgress = args[3]
+		}
+		signal := js.Undefined()
+		if len(args) > 4 {
+			signal = args[4]
+		}
+		return sftpUploadTree(args[0].String(), args[1].String(), args[2], onProgress, signal)
 	})
 
 	gossh["sftpDownload"] = js.FuncOf(func(this js.Value, args []js.Value) any {
@@ -184,7 +607,26 @@ func RegisterAPI() {
 		if len(args) > 3 {
 			signal = args[3]
 		}
-		return sftpDownload(args[0].String(), args[1].String(), onProgress, signal)
+		var opts js.Value
+		if len(args) > 4 {
+			opts = args[4]
+		}
+		return sftpDownload(args[0].String(), args[1].String(), onProgress, signal, opts)
+	})
+
+	gossh["sftpDownloadBatch"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		opts := js.Undefined()
+		if len(args) > 2 {
+			opts = args[2]
+		}
+		onProgress := js.Undefined()
+		if len(args) > 3 {
+			onProgress = args[3]
+		}
+		return sftpDownloadBatch(args[0].String(), args[1], opts, onProgress)
 	})
 
 	gossh["sftpDownloadStream"] = js.FuncOf(func(this js.Value, args []js.Value) any {
@@ -195,7 +637,70 @@ func RegisterAPI() {
 		if len(args) > 2 {
 			onProgress = args[2]
 		}
-		return sftpDownloadStream(args[0].String(), args[1].String(), onProgress)
+		opts := js.Undefined()
+		if len(args) > 3 {
+			opts = args[3]
+		}
+		return sftpDownloadStream(args[0].String(), args[1].String(), onProgress, opts)
+	})
+
+	gossh["sftpDownloadStreamCancel"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return nil
+		}
+		sftpDownloadStreamCancel(args[0].String(), args[1].String())
+		return nil
+	})
+
+	gossh["sftpTailMany"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 3 {
+			return jsError(errMissingConfig)
+		}
+		return sftpTailMany(args[0].String(), args[1], args[2])
+	})
+
+	gossh["sftpTailStop"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 1 {
+			return nil
+		}
+		sftpTailStop(args[0].String())
+		return nil
+	})
+
+	// === SCP (fallback when the SFTP subsystem is unavailable) ===
+
+	gossh["scpUpload"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 3 {
+			return jsError(errMissingConfig)
+		}
+		onProgress := js.Undefined()
+		if len(args) > 3 {
+			onProgress = args[3]
+		}
+		signal := js.Undefined()
+		if len(args) > 4 {
+			signal = args[4]
+		}
+		opts := js.Undefined()
+		if len(args) > 5 {
+			opts = args[5]
+		}
+		return scpUpload(args[0].String(), args[1].String(), args[2], onProgress, signal, opts)
+	})
+
+	gossh["scpDownload"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		onProgress := js.Undefined()
+		if len(args) > 2 {
+			onProgress = args[2]
+		}
+		signal := js.Undefined()
+		if len(args) > 3 {
+			signal = args[3]
+		}
+		return scpDownload(args[0].String(), args[1].String(), onProgress, signal)
 	})
 
 	// === Streaming Upload ===
@@ -204,7 +709,11 @@ func RegisterAPI() {
 		if len(args) < 3 {
 			return jsError(errMissingConfig)
 		}
-		return sftpUploadStreamStart(args[0].String(), args[1].String(), int64(args[2].Float()))
+		opts := js.Undefined()
+		if len(args) > 3 {
+			opts = args[3]
+		}
+		return sftpUploadStreamStart(args[0].String(), args[1].String(), int64(args[2].Float()), opts)
 	})
 
 	gossh["sftpUploadStreamWrite"] = js.FuncOf(func(this js.Value, args []js.Value) any {
@@ -214,6 +723,13 @@ func RegisterAPI() {
 		return sftpUploadStreamWrite(args[0].String(), args[1])
 	})
 
+	gossh["sftpUploadStreamStatus"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 1 {
+			return js.Null()
+		}
+		return sftpUploadStreamStatus(args[0].String())
+	})
+
 	gossh["sftpUploadStreamEnd"] = js.FuncOf(func(this js.Value, args []js.Value) any {
 		if len(args) < 1 {
 			return jsError(errMissingConfig)
@@ -269,6 +785,49 @@ func RegisterAPI() {
 		return portForwardList(args[0].String())
 	})
 
+	gossh["portForwardRemoteStart"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 2 {
+			return jsError(errMissingConfig)
+		}
+		return portForwardRemoteStart(args[0].String(), args[1])
+	})
+
+	gossh["portForwardRemoteStop"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 1 {
+			return nil
+		}
+		portForwardRemoteStop(args[0].String())
+		return nil
+	})
+
+	// ──── Diagnostics ────
+
+	gossh["enableDiagnostics"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		enableDiagnostics(len(args) < 1 || args[0].Truthy())
+		return nil
+	})
+
+	gossh["diagnostics"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		return diagnostics()
+	})
+
+	gossh["memStats"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		return memStats()
+	})
+
+	gossh["collectGarbage"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		collectGarbage()
+		return nil
+	})
+
+	gossh["setAutoCollectGarbage"] = js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 1 {
+			return nil
+		}
+		setAutoCollectGarbage(int64(jsInt(args[0], 0)))
+		return nil
+	})
+
 	// Register as window.GoSSH
 	js.Global().Set("GoSSH", js.ValueOf(gossh))
 }
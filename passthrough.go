@@ -0,0 +1,292 @@
+// passthrough.go exposes raw SSH protocol escape hatches — global requests
+// and custom channel types — so apps can speak protocol extensions the
+// package doesn't model with dedicated APIs. Request payloads cross the JS
+// boundary base64-encoded; channel data is passed as Uint8Array.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"syscall/js"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// maxRequestNameLen bounds global request and channel type names.
+	maxRequestNameLen = 64
+	// maxPassthroughPayload bounds a request payload. It stays well under
+	// the transport's packet limit, leaving room for framing.
+	maxPassthroughPayload = 32 * 1024
+)
+
+// sshSendGlobalRequest sends an SSH_MSG_GLOBAL_REQUEST on the connection.
+// Called from JS as:
+//
+//	GoSSH.sendGlobalRequest(sessionId, name, wantReply, payloadBase64?) → Promise<{ok, responseBase64}>
+func sshSendGlobalRequest(sessionID, name string, wantReply bool, payloadB64 string) js.Value {
+	return newPromise(func() (any, error) {
+		sess, err := getSession(sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("sendGlobalRequest: %w", err)
+		}
+		if err := validateRequestName(name); err != nil {
+			return nil, fmt.Errorf("sendGlobalRequest: %w", err)
+		}
+		payload, err := decodePassthroughPayload(payloadB64)
+		if err != nil {
+			return nil, fmt.Errorf("sendGlobalRequest: %w", err)
+		}
+
+		ok, resp, err := sess.client().SendRequest(name, wantReply, payload)
+		if err != nil {
+			return nil, fmt.Errorf("sendGlobalRequest: %w", err)
+		}
+		return map[string]any{
+			"ok":             ok,
+			"responseBase64": base64.StdEncoding.EncodeToString(resp),
+		}, nil
+	})
+}
+
+// validateRequestName checks an SSH request or channel type name: printable
+// US-ASCII without spaces (RFC 4251 §6), bounded in length.
+func validateRequestName(name string) error {
+	if name == "" || len(name) > maxRequestNameLen {
+		return fmt.Errorf("name must be 1-%d characters", maxRequestNameLen)
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c <= ' ' || c >= 0x7f {
+			return fmt.Errorf("name must be printable ASCII without spaces")
+		}
+	}
+	return nil
+}
+
+// decodePassthroughPayload decodes an optional base64 payload.
+func decodePassthroughPayload(b64 string) ([]byte, error) {
+	if b64 == "" {
+		return nil, nil
+	}
+	if base64.StdEncoding.DecodedLen(len(b64)) > maxPassthroughPayload+2 {
+		return nil, fmt.Errorf("payload too large (max %d bytes)", maxPassthroughPayload)
+	}
+	payload, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, fmt.Errorf("payload: invalid base64")
+	}
+	if len(payload) > maxPassthroughPayload {
+		return nil, fmt.Errorf("payload too large (max %d bytes)", maxPassthroughPayload)
+	}
+	return payload, nil
+}
+
+// channelStore tracks raw channels opened with openChannel.
+var channelStore sync.Map // channelID → *rawChannel
+
+// rawChannel is a byte stream driven from JS: a custom-type SSH channel,
+// or a connection accepted on a remote forward.
+type rawChannel struct {
+	id        string
+	sessionID string
+	forwardID string // remote forward that accepted it, if any
+	ch        io.ReadWriteCloser
+	closeOnce sync.Once
+
+	mu      sync.Mutex // guards onClose and closed
+	onClose js.Value   // optional callback()
+	closed  bool
+}
+
+// sshOpenChannel opens a channel of an arbitrary type on the connection.
+// Channel data goes to opts.onData, extended data (stderr) to
+// opts.onExtendedData, and channel requests from the server to
+// opts.onRequest({type, wantReply, payloadBase64}) → boolean, whose result
+// is the reply (false when unset). The channel closes with the session.
+// Called from JS as:
+//
+//	GoSSH.openChannel(sessionId, channelType, payloadBase64?, opts?) → Promise<channelId>
+func sshOpenChannel(sessionID, channelType, payloadB64 string, opts js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		sess, err := getSession(sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("openChannel: %w", err)
+		}
+		if err := validateRequestName(channelType); err != nil {
+			return nil, fmt.Errorf("openChannel: %w", err)
+		}
+		payload, err := decodePassthroughPayload(payloadB64)
+		if err != nil {
+			return nil, fmt.Errorf("openChannel: %w", err)
+		}
+		ch, reqs, err := sess.client().OpenChannel(channelType, payload)
+		if err != nil {
+			var openErr *ssh.OpenChannelError
+			if errors.As(err, &openErr) {
+				return nil, fmt.Errorf("openChannel: rejected (%s): %s", openErr.Reason, maskControl(openErr.Message))
+			}
+			return nil, fmt.Errorf("openChannel: %w", err)
+		}
+		return startRawChannel(sessionID, ch, reqs, opts).id, nil
+	})
+}
+
+// sshOpenSubsystem starts a subsystem other than SFTP (e.g. netconf) on a
+// new session channel and returns it as a raw channel: data goes through
+// channelWrite and opts.onData, and the handlers are openChannel's.
+// Called from JS as:
+//
+//	GoSSH.openSubsystem(sessionId, name, opts?: {onData, onExtendedData, onRequest, onClose}) → Promise<channelId>
+func sshOpenSubsystem(sessionID, name string, opts js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		sess, err := getSession(sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("openSubsystem: %w", err)
+		}
+		if err := validateRequestName(name); err != nil {
+			return nil, fmt.Errorf("openSubsystem: %w", err)
+		}
+		ch, reqs, err := sess.client().OpenChannel("session", nil)
+		if err != nil {
+			return nil, fmt.Errorf("openSubsystem: %w", err)
+		}
+		ok, err := ch.SendRequest("subsystem", true, ssh.Marshal(struct{ Name string }{name}))
+		if err == nil && !ok {
+			err = fmt.Errorf("the server refused subsystem %q", name)
+		}
+		if err != nil {
+			closeQuietly(ch)
+			spawn("channel.requests", func() { ssh.DiscardRequests(reqs) })
+			return nil, fmt.Errorf("openSubsystem: %w", err)
+		}
+		return startRawChannel(sessionID, ch, reqs, opts).id, nil
+	})
+}
+
+// startRawChannel tracks an open channel and starts delivering its data,
+// extended data, and requests to the callbacks in opts. It closes when the
+// server ends the data stream.
+func startRawChannel(sessionID string, ch ssh.Channel, reqs <-chan *ssh.Request, opts js.Value) *rawChannel {
+	onData, _ := getCallback(opts, "onData")
+	onExtended, _ := getCallback(opts, "onExtendedData")
+	onRequest, _ := getCallback(opts, "onRequest")
+	onClose, _ := getCallback(opts, "onClose")
+
+	rc := &rawChannel{
+		id:        generateID(),
+		sessionID: sessionID,
+		ch:        ch,
+		onClose:   onClose,
+	}
+	channelStore.Store(rc.id, rc)
+
+	spawn("channel.requests", func() { rc.handleRequests(reqs, onRequest) })
+	spawn("channel.stderr", func() {
+		// Unread extended data would stall the channel window.
+		if onExtended.Type() == js.TypeFunction {
+			pumpToJS(ch.Stderr(), onExtended)
+		} else {
+			_, _ = io.Copy(io.Discard, ch.Stderr())
+		}
+	})
+	spawn("channel.data", func() {
+		if onData.Type() == js.TypeFunction {
+			pumpToJS(ch, onData)
+		} else {
+			_, _ = io.Copy(io.Discard, ch)
+		}
+		rc.close()
+	})
+	return rc
+}
+
+// pumpToJS delivers everything read from r to fn as Uint8Array chunks.
+func pumpToJS(r io.Reader, fn js.Value) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			fn.Invoke(bytesToUint8Array(buf[:n]))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handleRequests answers channel requests via onRequest, or refuses them.
+func (rc *rawChannel) handleRequests(reqs <-chan *ssh.Request, onRequest js.Value) {
+	for req := range reqs {
+		ok := false
+		if onRequest.Type() == js.TypeFunction {
+			result := onRequest.Invoke(js.ValueOf(map[string]any{
+				"type":          maskControl(req.Type),
+				"wantReply":     req.WantReply,
+				"payloadBase64": base64.StdEncoding.EncodeToString(req.Payload),
+			}))
+			ok = result.Type() == js.TypeBoolean && result.Bool()
+		}
+		if req.WantReply {
+			_ = req.Reply(ok, nil)
+		}
+	}
+}
+
+// setOnClose sets the close callback once the channel's handlers are
+// known. If the channel has already closed, fn is called right away
+// instead, so it fires exactly once either way.
+func (rc *rawChannel) setOnClose(fn js.Value) {
+	rc.mu.Lock()
+	closed := rc.closed
+	if !closed {
+		rc.onClose = fn
+	}
+	rc.mu.Unlock()
+	if closed && fn.Type() == js.TypeFunction {
+		fn.Invoke()
+	}
+}
+
+// close closes the channel, untracks it, and notifies JS once.
+func (rc *rawChannel) close() {
+	rc.closeOnce.Do(func() {
+		closeQuietly(rc.ch)
+		channelStore.Delete(rc.id)
+		rc.mu.Lock()
+		rc.closed = true
+		onClose := rc.onClose
+		rc.mu.Unlock()
+		if onClose.Type() == js.TypeFunction {
+			onClose.Invoke()
+		}
+	})
+}
+
+// sshChannelWrite writes data to a raw channel.
+// Called from JS as: GoSSH.channelWrite(channelId, data: Uint8Array) → Promise<void>
+func sshChannelWrite(channelID string, data js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		val, ok := channelStore.Load(channelID)
+		if !ok {
+			return nil, fmt.Errorf("channelWrite: channel %q not found", channelID)
+		}
+		if _, err := val.(*rawChannel).ch.Write(uint8ArrayToBytes(data)); err != nil {
+			return nil, fmt.Errorf("channelWrite: %w", err)
+		}
+		return nil, nil
+	})
+}
+
+// sshChannelClose closes a raw channel.
+// Called from JS as: GoSSH.channelClose(channelId)
+func sshChannelClose(channelID string) {
+	if val, ok := channelStore.Load(channelID); ok {
+		val.(*rawChannel).close()
+	}
+}
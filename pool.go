@@ -0,0 +1,200 @@
+// pool.go shares SSH connections between sessions. A connect with
+// config.pool reuses a live connection to the same destination made with
+// the same identity, opening only a new shell channel on it, and skips the
+// WebSocket dial, key exchange, and authentication. A pooled connection
+// stays open for a TTL after its last session closes, so poll-style
+// workloads that connect, run a command, and disconnect reuse it too.
+//
+// Only the connection is shared: each session still has its own shell,
+// forwards, SFTP sessions, and onData/onClose. Connection-level options
+// (host key callbacks, onBanner, onStall, rekeyThreshold, coalesceReads)
+// come from the connect that dialed it.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+const (
+	// defaultPoolTTL is how long an unused pooled connection stays open.
+	defaultPoolTTL = time.Minute
+	// maxPoolTTL bounds the configured TTL.
+	maxPoolTTL = time.Hour
+)
+
+// pooledConn is a clientConn shared through the pool.
+type pooledConn struct {
+	key  string
+	cc   *clientConn
+	ttl  time.Duration
+	refs int         // sessions using the connection
+	idle *time.Timer // pending close while refs is 0
+	// pooled is cleared when the connection leaves the pool (flushed or
+	// dead); it then closes as soon as it is unused.
+	pooled bool
+}
+
+var (
+	// poolMu guards connPool and every pooledConn's fields.
+	poolMu   sync.Mutex
+	connPool = map[string]*pooledConn{}
+	// poolSecret keys the pool key MAC, so no credential-derived value
+	// is kept in memory in a form that could be checked offline.
+	poolSecret = func() []byte {
+		b := make([]byte, 32)
+		_, _ = rand.Read(b)
+		return b
+	}()
+)
+
+// poolOptions reads config.pool (true or {ttlMs}). It returns an empty key
+// when pooling is off or the config can't be pooled: keyboard-interactive
+// auth needs the user for every login, and scoped agent forwarding carries
+// per-connect callbacks.
+func poolOptions(config js.Value) (key string, ttl time.Duration, err error) {
+	opt := config.Get("pool")
+	if opt.Type() != js.TypeObject && !jsBool(opt) {
+		return "", 0, nil
+	}
+	ttl = defaultPoolTTL
+	if ms := jsInt(jsGet(opt, "ttlMs"), 0); ms != 0 {
+		ttl = time.Duration(ms) * time.Millisecond
+		if ttl < 0 || ttl > maxPoolTTL {
+			return "", 0, fmt.Errorf("pool.ttlMs must be between 0 and %d", maxPoolTTL.Milliseconds())
+		}
+	}
+	if jsString(config.Get("authMethod")) == "keyboard-interactive" {
+		return "", 0, nil
+	}
+	if jsBool(config.Get("agentForward")) {
+		if scope, _ := parseAgentForwardScope(config); scope != nil {
+			return "", 0, nil
+		}
+	}
+
+	mac := hmac.New(sha256.New, poolSecret)
+	writeIdentity(mac, config)
+	mac.Write([]byte(strconv.FormatBool(jsBool(config.Get("agentForward")))))
+	if jump := config.Get("jumpHost"); jump.Type() == js.TypeObject {
+		if jsString(jump.Get("authMethod")) == "keyboard-interactive" {
+			return "", 0, nil
+		}
+		mac.Write([]byte("jump\x00"))
+		writeIdentity(mac, jump)
+	}
+	return hex.EncodeToString(mac.Sum(nil)), ttl, nil
+}
+
+// writeIdentity writes the fields naming a destination and login to w,
+// each terminated by NUL.
+func writeIdentity(w io.Writer, config js.Value) {
+	for _, field := range []string{
+		"proxyUrl", "token", "host", "username", "authMethod",
+		"password", "keyPEM", "keyPassphrase", "agentKeyFingerprint",
+	} {
+		w.Write([]byte(jsString(config.Get(field))))
+		w.Write([]byte{0})
+	}
+	w.Write([]byte(strconv.Itoa(jsInt(config.Get("port"), 22))))
+	w.Write([]byte{0})
+}
+
+// acquirePooled returns the live pooled connection for key with a
+// reference taken, or nil.
+func acquirePooled(key string) *pooledConn {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	pc := connPool[key]
+	if pc == nil {
+		return nil
+	}
+	pc.refs++
+	if pc.idle != nil {
+		pc.idle.Stop()
+		pc.idle = nil
+	}
+	return pc
+}
+
+// addPooled pools a freshly dialed connection with one reference taken.
+// A connection already pooled under key (from a concurrent connect) is
+// left in place; the new one is still shared by its own sessions.
+func addPooled(key string, ttl time.Duration, cc *clientConn) *pooledConn {
+	pc := &pooledConn{key: key, cc: cc, ttl: ttl, refs: 1}
+	poolMu.Lock()
+	if connPool[key] == nil {
+		connPool[key] = pc
+		pc.pooled = true
+	}
+	poolMu.Unlock()
+
+	spawn("pool.watch", func() {
+		_ = cc.sshClient.Wait()
+		poolMu.Lock()
+		defer poolMu.Unlock()
+		pc.unpoolLocked()
+	})
+	return pc
+}
+
+// release drops a reference. An unused connection closes after the TTL,
+// or at once if it is no longer pooled.
+func (pc *pooledConn) release() {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	pc.refs--
+	if pc.refs > 0 {
+		return
+	}
+	if !pc.pooled {
+		pc.cc.close()
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(pc.ttl, func() {
+		poolMu.Lock()
+		defer poolMu.Unlock()
+		if pc.idle == timer {
+			pc.unpoolLocked()
+		}
+	})
+	pc.idle = timer
+}
+
+// unpoolLocked removes pc from the pool, closing it if unused.
+func (pc *pooledConn) unpoolLocked() {
+	if pc.pooled && connPool[pc.key] == pc {
+		delete(connPool, pc.key)
+	}
+	pc.pooled = false
+	if pc.idle != nil {
+		pc.idle.Stop()
+		pc.idle = nil
+	}
+	if pc.refs == 0 {
+		pc.cc.close()
+	}
+}
+
+// poolFlush empties the pool: unused connections close now, and ones in
+// use close with their last session instead of being kept for reuse.
+// Called from JS as: GoSSH.poolFlush()
+func poolFlush() {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	for _, pc := range connPool {
+		pc.unpoolLocked()
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"sync"
 	"syscall/js"
 	"time"
+	"unicode/utf8"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -33,6 +34,12 @@ const (
 	maxConcurrentHandlers = 100
 	// tcpInboundQueueSize bounds per-connection pending proxy frames.
 	tcpInboundQueueSize = 256
+	// defaultMaxHTTPResponse is the largest forwarded HTTP response read
+	// unless maxResponseBytes says otherwise; the whole response is held in
+	// memory, and sent base64-encoded when binary.
+	defaultMaxHTTPResponse = 10 << 20
+	minMaxHTTPResponse     = 64 << 10
+	maxMaxHTTPResponse     = 256 << 20
 )
 
 // portForward represents an active port forwarding tunnel.
@@ -46,6 +53,8 @@ type portForward struct {
 	ctx        context.Context
 	cancel     context.CancelFunc
 	tunnelConn net.Conn // WebSocket to proxy /tunnel endpoint
+	// maxResponse bounds a forwarded HTTP response, headers included.
+	maxResponse int
 
 	// wsMu serializes writes to tunnelConn (concurrent goroutines write frames).
 	wsMu sync.Mutex
@@ -68,7 +77,7 @@ var forwardStore sync.Map
 //
 //	GoSSH.portForwardStart(sessionId, config) → Promise<TunnelInfo>
 //
-// Config: { remoteHost, remotePort, proxyTunnelUrl, token? }
+// Config: { remoteHost, remotePort, proxyTunnelUrl, token?, maxResponseBytes? }
 func portForwardStart(sessionID string, config js.Value) js.Value {
 	return newPromise(func() (any, error) {
 		val, ok := sessionStore.Load(sessionID)
@@ -91,6 +100,10 @@ func portForwardStart(sessionID string, config js.Value) js.Value {
 		if remotePort < 1 || remotePort > 65535 {
 			return nil, fmt.Errorf("portForwardStart: invalid remotePort %d (must be 1-65535)", remotePort)
 		}
+		maxResponse := jsInt(config.Get("maxResponseBytes"), defaultMaxHTTPResponse)
+		if maxResponse < minMaxHTTPResponse || maxResponse > maxMaxHTTPResponse {
+			return nil, fmt.Errorf("portForwardStart: maxResponseBytes must be between %d and %d", minMaxHTTPResponse, maxMaxHTTPResponse)
+		}
 
 		// Build tunnel WebSocket URL with properly encoded query parameters.
 		u, err := parseWebSocketURL(proxyTunnelURL, allowInsecureWS)
@@ -134,22 +147,23 @@ func portForwardStart(sessionID string, config js.Value) js.Value {
 
 		forwardID := generateID()
 		fwd := &portForward{
-			id:         forwardID,
-			sessionID:  sessionID,
-			remoteHost: remoteHost,
-			remotePort: remotePort,
-			tunnelURL:  ready.TunnelURL,
-			rawPort:    ready.RawPort,
-			ctx:        ctx,
-			cancel:     cancel,
-			tunnelConn: tunnelConn,
-			sem:        make(chan struct{}, maxConcurrentHandlers),
+			id:          forwardID,
+			sessionID:   sessionID,
+			remoteHost:  remoteHost,
+			remotePort:  remotePort,
+			tunnelURL:   ready.TunnelURL,
+			rawPort:     ready.RawPort,
+			ctx:         ctx,
+			cancel:      cancel,
+			tunnelConn:  tunnelConn,
+			maxResponse: maxResponse,
+			sem:         make(chan struct{}, maxConcurrentHandlers),
 		}
 
 		forwardStore.Store(forwardID, fwd)
 
 		// Start goroutine to handle incoming tunnel messages.
-		go fwd.handleTunnelMessages(sess)
+		spawn("forward.tunnel", func() { fwd.handleTunnelMessages(sess) })
 
 		result := map[string]any{
 			"id":         forwardID,
@@ -210,6 +224,8 @@ func (fwd *portForward) handleTunnelMessages(sess *session) {
 			Path    string            `json:"path"`
 			Headers map[string]string `json:"headers"`
 			Body    string            `json:"body"`
+			// BodyEncoding is "base64" for a body that isn't UTF-8 text.
+			BodyEncoding string `json:"bodyEncoding"`
 		}
 
 		if err := json.Unmarshal(data, &msg); err != nil {
@@ -222,27 +238,28 @@ func (fwd *portForward) handleTunnelMessages(sess *session) {
 		path := msg.Path
 		headers := msg.Headers
 		body := msg.Body
+		bodyEncoding := msg.BodyEncoding
 		connID := msg.ConnID
 
 		switch msg.Type {
 		case "http_request":
 			select {
 			case fwd.sem <- struct{}{}:
-				go func() {
+				spawn("forward.http", func() {
 					defer func() { <-fwd.sem }()
-					fwd.handleHTTPRequest(sess, reqID, method, path, headers, body)
-				}()
+					fwd.handleHTTPRequest(sess, reqID, method, path, headers, body, bodyEncoding)
+				})
 			default:
-				fwd.sendHTTPResponse(reqID, 503, map[string]string{}, "too many concurrent requests", "")
+				fwd.sendHTTPResponse(reqID, 503, nil, "too many concurrent requests", "")
 			}
 
 		case "tcp_open":
 			select {
 			case fwd.sem <- struct{}{}:
-				go func() {
+				spawn("forward.tcp", func() {
 					defer func() { <-fwd.sem }()
 					fwd.handleTCPOpen(sess, connID)
-				}()
+				})
 			default:
 				fwd.sendTCPClose(connID)
 			}
@@ -286,10 +303,10 @@ func sshDialWithTimeout(ctx context.Context, client *ssh.Client, network, addr s
 		err  error
 	}
 	ch := make(chan result, 1)
-	go func() {
+	spawn("forward.dial", func() {
 		c, err := client.Dial(network, addr)
 		ch <- result{c, err}
-	}()
+	})
 
 	timer := time.NewTimer(timeout)
 	defer timer.Stop()
@@ -299,37 +316,55 @@ func sshDialWithTimeout(ctx context.Context, client *ssh.Client, network, addr s
 		return r.conn, r.err
 	case <-timer.C:
 		// Close any late connection to prevent leak.
-		go func() {
+		spawn("forward.dialCleanup", func() {
 			if r := <-ch; r.conn != nil {
 				closeQuietly(r.conn)
 			}
-		}()
+		})
 		return nil, fmt.Errorf("ssh dial %s timed out after %v", addr, timeout)
 	case <-ctx.Done():
-		go func() {
+		spawn("forward.dialCleanup", func() {
 			if r := <-ch; r.conn != nil {
 				closeQuietly(r.conn)
 			}
-		}()
+		})
 		return nil, ctx.Err()
 	}
 }
 
 // handleHTTPRequest forwards an HTTP request from the proxy through an SSH
 // direct-tcpip channel to the remote service.
-func (fwd *portForward) handleHTTPRequest(sess *session, reqID, method, path string, headers map[string]string, body string) {
+//
+// Bodies travel in JSON strings, which carry only UTF-8. Either way, a body
+// that isn't valid UTF-8 is base64-encoded and marked with bodyEncoding
+// "base64"; the decision rests on the bytes alone, since a Content-Type
+// can be missing or wrong (a blob served as application/json, say).
+func (fwd *portForward) handleHTTPRequest(sess *session, reqID, method, path string, headers map[string]string, body, bodyEncoding string) {
 	var err error
 	method, path, err = validateForwardRequestLine(method, path)
 	if err != nil {
-		fwd.sendHTTPResponse(reqID, 400, map[string]string{}, "invalid forwarded request", "")
+		fwd.sendHTTPResponse(reqID, 400, nil, "invalid forwarded request", "")
+		return
+	}
+	switch bodyEncoding {
+	case "":
+	case "base64":
+		raw, err := base64.StdEncoding.DecodeString(body)
+		if err != nil {
+			fwd.sendHTTPResponse(reqID, 400, nil, "invalid base64 request body", "")
+			return
+		}
+		body = string(raw)
+	default:
+		fwd.sendHTTPResponse(reqID, 400, nil, "unknown request bodyEncoding", "")
 		return
 	}
 
 	// Open SSH direct-tcpip channel to the remote service.
 	addr := fmt.Sprintf("%s:%d", fwd.remoteHost, fwd.remotePort)
-	channel, err := sshDialWithTimeout(fwd.ctx, sess.sshClient, "tcp", addr, 30*time.Second)
+	channel, err := sshDialWithTimeout(fwd.ctx, sess.client(), "tcp", addr, 30*time.Second)
 	if err != nil {
-		fwd.sendHTTPResponse(reqID, 502, map[string]string{}, "upstream connection failed", "")
+		fwd.sendHTTPResponse(reqID, 502, nil, "upstream connection failed", "")
 		return
 	}
 	defer closeQuietly(channel)
@@ -366,21 +401,29 @@ func (fwd *portForward) handleHTTPRequest(sess *session, reqID, method, path str
 	}
 
 	if _, err := channel.Write([]byte(reqBuilder.String())); err != nil {
-		fwd.sendHTTPResponse(reqID, 502, map[string]string{}, "request write failed", "")
+		fwd.sendHTTPResponse(reqID, 502, nil, "request write failed", "")
 		return
 	}
 
-	// Read the entire response.
-	respBytes, err := io.ReadAll(io.LimitReader(channel, 10*1024*1024)) // 10MB limit
+	// Read the entire response. One past the limit is read to tell a
+	// response that fills it from one cut off by it: a truncated body would
+	// reach the client as a complete, corrupt one, so it fails instead.
+	respBytes, err := io.ReadAll(io.LimitReader(channel, int64(fwd.maxResponse)+1))
 	if err != nil {
-		fwd.sendHTTPResponse(reqID, 502, map[string]string{}, "read failed", "")
+		fwd.sendHTTPResponse(reqID, 502, nil, "read failed", "")
+		return
+	}
+	if len(respBytes) > fwd.maxResponse {
+		logWarnf("port forward: response to", method, path, "exceeds maxResponseBytes", fwd.maxResponse)
+		fwd.sendHTTPResponse(reqID, 502, []httpHeader{{"X-GoSSH-Error", "response-too-large"}},
+			fmt.Sprintf("upstream response exceeds the tunnel's maxResponseBytes (%d)", fwd.maxResponse), "")
 		return
 	}
 
 	// Parse HTTP response (simple parsing — find header/body boundary).
 	respStr := string(respBytes)
 	status := 200
-	respHeaders := map[string]string{}
+	var respHeaders []httpHeader
 	respBody := respStr
 
 	if headerEnd := findHeaderEnd(respStr); headerEnd >= 0 {
@@ -395,34 +438,26 @@ func (fwd *portForward) handleHTTPRequest(sess *session, reqID, method, path str
 			}
 		}
 
-		for _, line := range lines[1:] { // Skip status line
-			if colonIdx := findColon(line); colonIdx > 0 {
-				key := line[:colonIdx]
-				val := ""
-				if colonIdx+2 < len(line) {
-					val = line[colonIdx+2:]
-				}
-				respHeaders[strings.TrimSpace(key)] = strings.TrimSpace(val)
-			}
+		if len(lines) > 0 {
+			respHeaders = parseResponseHeaders(lines[1:]) // Skip status line
 		}
 	}
 
-	// Encode binary response bodies as base64.
-	bodyEncoding := ""
-	contentType := getHeaderValue(respHeaders, "content-type")
-	if contentType != "" && !isTextContentType(contentType) {
-		bodyEncoding = "base64"
+	// A body that isn't UTF-8 goes as base64 (see above).
+	respEncoding := ""
+	if !utf8.ValidString(respBody) {
+		respEncoding = "base64"
 		respBody = base64.StdEncoding.EncodeToString([]byte(respBody))
 	}
 
-	fwd.sendHTTPResponse(reqID, status, respHeaders, respBody, bodyEncoding)
+	fwd.sendHTTPResponse(reqID, status, respHeaders, respBody, respEncoding)
 }
 
 // handleTCPOpen handles a raw TCP connection forwarding through SSH.
 // Data is multiplexed via binary frames tagged with connID.
 func (fwd *portForward) handleTCPOpen(sess *session, connID string) {
 	addr := fmt.Sprintf("%s:%d", fwd.remoteHost, fwd.remotePort)
-	channel, err := sshDialWithTimeout(fwd.ctx, sess.sshClient, "tcp", addr, 30*time.Second)
+	channel, err := sshDialWithTimeout(fwd.ctx, sess.client(), "tcp", addr, 30*time.Second)
 	if err != nil {
 		fwd.sendTCPClose(connID)
 		return
@@ -437,7 +472,7 @@ func (fwd *portForward) handleTCPOpen(sess *session, connID string) {
 	done := make(chan struct{}, 2)
 
 	// Proxy → SSH: read multiplexed frames from inCh, write to SSH channel.
-	go func() {
+	spawn("forward.tcpToSSH", func() {
 		defer func() { done <- struct{}{} }()
 		for {
 			select {
@@ -452,10 +487,10 @@ func (fwd *portForward) handleTCPOpen(sess *session, connID string) {
 				return
 			}
 		}
-	}()
+	})
 
 	// SSH → Proxy: read from SSH channel, write as binary frames to tunnel WS.
-	go func() {
+	spawn("forward.sshToTunnel", func() {
 		defer func() { done <- struct{}{} }()
 		buf := make([]byte, 32*1024)
 		for {
@@ -474,7 +509,7 @@ func (fwd *portForward) handleTCPOpen(sess *session, connID string) {
 				return
 			}
 		}
-	}()
+	})
 
 	// Wait for both goroutines, but don't block forever if SSH hangs.
 	for i := 0; i < 2; i++ {
@@ -512,14 +547,23 @@ func (fwd *portForward) writeTunnel(data []byte) error {
 	return err
 }
 
+// httpHeader is one response header field, as [name, value] in JSON.
+type httpHeader [2]string
+
 // sendHTTPResponse sends an HTTP response back through the tunnel WebSocket.
-func (fwd *portForward) sendHTTPResponse(reqID string, status int, headers map[string]string, body string, bodyEncoding string) {
+// headerList carries the fields in order, repeats included; headers is the
+// older map form, which can't hold them all (see headerMap).
+func (fwd *portForward) sendHTTPResponse(reqID string, status int, headers []httpHeader, body string, bodyEncoding string) {
+	if headers == nil {
+		headers = []httpHeader{}
+	}
 	resp := map[string]any{
-		"type":    "http_response",
-		"id":      reqID,
-		"status":  status,
-		"headers": headers,
-		"body":    body,
+		"type":       "http_response",
+		"id":         reqID,
+		"status":     status,
+		"headers":    headerMap(headers),
+		"headerList": headers,
+		"body":       body,
 	}
 	if bodyEncoding != "" {
 		resp["bodyEncoding"] = bodyEncoding
@@ -616,6 +660,58 @@ func splitLines(s string) []string {
 	return lines
 }
 
+// parseResponseHeaders parses header lines in order, keeping repeated
+// fields (Set-Cookie above all) as separate entries. A line starting with
+// space or tab continues the previous field's value (obsolete folding, RFC
+// 9110 section 5.5) and is joined with a space; values lose surrounding
+// spaces and tabs only. Lines without a name are dropped.
+func parseResponseHeaders(lines []string) []httpHeader {
+	var headers []httpHeader
+	for _, line := range lines {
+		if line != "" && (line[0] == ' ' || line[0] == '\t') {
+			if n := len(headers); n > 0 {
+				if v := strings.Trim(line, " \t"); v != "" {
+					headers[n-1][1] = strings.TrimLeft(headers[n-1][1]+" "+v, " ")
+				}
+			}
+			continue
+		}
+		colonIdx := findColon(line)
+		if colonIdx <= 0 {
+			continue
+		}
+		name := line[:colonIdx]
+		if !isHTTPToken(name) {
+			continue
+		}
+		headers = append(headers, httpHeader{name, strings.Trim(line[colonIdx+1:], " \t")})
+	}
+	return headers
+}
+
+// headerMap folds headers into the map form: repeated fields are joined
+// with ", " as RFC 9110 allows, except Set-Cookie, whose values may
+// contain commas, so the map keeps only the last (headerList has all).
+// The first spelling of a name is kept.
+func headerMap(headers []httpHeader) map[string]string {
+	m := make(map[string]string, len(headers))
+	names := make(map[string]string, len(headers))
+	for _, h := range headers {
+		lower := strings.ToLower(h[0])
+		name, seen := names[lower]
+		switch {
+		case !seen:
+			names[lower] = h[0]
+			m[h[0]] = h[1]
+		case lower == "set-cookie":
+			m[name] = h[1]
+		default:
+			m[name] += ", " + h[1]
+		}
+	}
+	return m
+}
+
 func findColon(s string) int {
 	for i := 0; i < len(s); i++ {
 		if s[i] == ':' {
@@ -625,16 +721,6 @@ func findColon(s string) int {
 	return -1
 }
 
-// isTextContentType returns true for text-based content types that can be sent as plain strings.
-func isTextContentType(ct string) bool {
-	ct = strings.ToLower(ct)
-	return strings.HasPrefix(ct, "text/") ||
-		strings.Contains(ct, "json") ||
-		strings.Contains(ct, "xml") ||
-		strings.Contains(ct, "javascript") ||
-		strings.Contains(ct, "html")
-}
-
 func parseHTTPStatusCode(statusLine string) (int, bool) {
 	fields := strings.Fields(statusLine)
 	if len(fields) < 2 {
@@ -647,15 +733,6 @@ func parseHTTPStatusCode(statusLine string) (int, bool) {
 	return code, true
 }
 
-func getHeaderValue(headers map[string]string, want string) string {
-	for k, v := range headers {
-		if strings.EqualFold(k, want) {
-			return v
-		}
-	}
-	return ""
-}
-
 func isHTTPToken(s string) bool {
 	if s == "" {
 		return false
@@ -12,10 +12,14 @@
 package gossh
 
 import (
+	"container/list"
 	"crypto/md5" // #nosec G501 -- OpenSSH-compatible randomart intentionally uses MD5 visualization bytes.
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"strings"
+	"sync"
+	"syscall/js"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -35,8 +39,9 @@ var (
 	artEndMarker   = byte(len(artChars) - 1) // #nosec G115 -- bounded static table.
 )
 
-// RandomArt generates an ASCII art representation of an SSH public key fingerprint.
-// The output matches OpenSSH's visual host key format.
+// RandomArt generates an ASCII art representation of an SSH public key's
+// MD5 fingerprint, as OpenSSH drew it before 6.8. It's kept for
+// compatibility; RandomArtSHA256FromKey matches what ssh shows today.
 //
 // Example output:
 //
@@ -50,12 +55,157 @@ var (
 //	|    . =+o=.o     |
 //	|   . +.*+o+      |
 //	|    E.=*BOo.     |
-//	+----[SHA256]-----+
+//	+------[MD5]------+
+//
+// Results are cached (see artCache), since agentListKeys renders every key
+// on every call.
 func RandomArt(pubKey ssh.PublicKey) string {
-	// Use MD5 hash of the raw public key for the bishop walk
-	// (matches OpenSSH's original randomart implementation).
-	rawHash := md5.Sum(pubKey.Marshal()) // #nosec G401 -- visualization only, not cryptographic security.
-	return randomArtFromHash(rawHash[:], pubKey.Type(), keyBits(pubKey), "MD5")
+	return cachedArt(pubKey, "MD5")
+}
+
+// RandomArtSHA256FromKey generates the randomart of an SSH public key's
+// SHA256 fingerprint with the [SHA256] footer: OpenSSH's visual host key
+// since 6.8. Results are cached like RandomArt's.
+func RandomArtSHA256FromKey(pubKey ssh.PublicKey) string {
+	return cachedArt(pubKey, "SHA256")
+}
+
+// RandomArtSized draws RandomArtSHA256FromKey's art on a width×height
+// grid, for displays that want more detail or less room than 17×9. Both
+// dimensions must be odd, so the walk starts on a center cell: 9 to 65
+// wide and 5 to 33 high. Unlike the standard size it isn't cached.
+func RandomArtSized(pubKey ssh.PublicKey, width, height int) (string, error) {
+	if !validArtSize(width, height) {
+		return "", fmt.Errorf("randomart: width must be odd, %d to %d, and height odd, %d to %d",
+			minArtWidth, maxArtWidth, minArtHeight, maxArtHeight)
+	}
+	return randomArtSized(keyHash(pubKey, "SHA256"), pubKey.Type(), keyBits(pubKey), "SHA256", width, height, false), nil
+}
+
+// keyHash hashes a key's wire encoding for the walk: hashName is "MD5" or
+// "SHA256".
+func keyHash(pubKey ssh.PublicKey, hashName string) []byte {
+	if hashName == "MD5" {
+		h := md5.Sum(pubKey.Marshal()) // #nosec G401 -- visualization only, not cryptographic security.
+		return h[:]
+	}
+	h := sha256.Sum256(pubKey.Marshal())
+	return h[:]
+}
+
+// cachedArt draws the standard-size art of pubKey under hashName, through
+// artCache.
+func cachedArt(pubKey ssh.PublicKey, hashName string) string {
+	key := hashName + "\x00" + string(pubKey.Marshal())
+	if art, ok := artCache.get(key); ok {
+		return art
+	}
+	art := randomArtFromHash(keyHash(pubKey, hashName), pubKey.Type(), keyBits(pubKey), hashName)
+	artCache.add(key, art)
+	return art
+}
+
+// randomArtForKey draws randomart for a public key in authorized_keys
+// format, at OpenSSH's 17×9 unless opts gives another odd size. The walk
+// follows the SHA256 fingerprint as ssh shows it, or with opts.hash 'md5'
+// the legacy MD5 one. With opts.format 'grid' it returns the cells as data
+// (see randomArtGrid) rather than text; with opts.color the text is
+// colored with ANSI escapes for a terminal (see artColor).
+// Called from JS as: GoSSH.randomArt(publicKey, opts?: {width, height, format, hash, color}) → string | RandomArtGrid
+func randomArtForKey(publicKey string, opts js.Value) (any, error) {
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return nil, fmt.Errorf("randomArt: %w", err)
+	}
+	width := jsInt(jsGet(opts, "width"), artWidth)
+	height := jsInt(jsGet(opts, "height"), artHeight)
+	if !validArtSize(width, height) {
+		return nil, fmt.Errorf("randomArt: width must be odd, %d to %d, and height odd, %d to %d",
+			minArtWidth, maxArtWidth, minArtHeight, maxArtHeight)
+	}
+	var hashName string
+	switch h := jsString(jsGet(opts, "hash")); h {
+	case "", "sha256":
+		hashName = "SHA256"
+	case "md5":
+		hashName = "MD5"
+	default:
+		return nil, fmt.Errorf("randomArt: unknown hash %q (use sha256 or md5)", h)
+	}
+	color := jsBool(jsGet(opts, "color"))
+	format := jsString(jsGet(opts, "format"))
+	switch format {
+	case "", "text":
+		if width == artWidth && height == artHeight && !color {
+			return cachedArt(pubKey, hashName), nil
+		}
+	case "grid":
+	default:
+		return nil, fmt.Errorf("randomArt: unknown format %q (use text or grid)", format)
+	}
+	hash := keyHash(pubKey, hashName)
+	if format == "grid" {
+		return randomArtGrid(hash, pubKey.Type(), keyBits(pubKey), hashName, width, height), nil
+	}
+	return randomArtSized(hash, pubKey.Type(), keyBits(pubKey), hashName, width, height, color), nil
+}
+
+// artCacheSize bounds the cached randomart: enough for a full agent and the
+// hosts of a session, both hashes, small enough not to matter for memory.
+const artCacheSize = 256
+
+// artLRU caches randomart by hash name and the key's wire encoding, which
+// determine it as the fingerprint does without hashing on every lookup.
+// The least recently used entry goes when it's full.
+type artLRU struct {
+	mu    sync.Mutex
+	order *list.List // of *artEntry, most recently used first
+	byKey map[string]*list.Element
+}
+
+type artEntry struct {
+	key, art string
+}
+
+var artCache = &artLRU{order: list.New(), byKey: make(map[string]*list.Element)}
+
+func (c *artLRU) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.byKey[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*artEntry).art, true
+}
+
+func (c *artLRU) add(key, art string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.byKey[key]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+	c.byKey[key] = c.order.PushFront(&artEntry{key: key, art: art})
+	if c.order.Len() > artCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.byKey, oldest.Value.(*artEntry).key)
+	}
+}
+
+func (c *artLRU) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.byKey)
+}
+
+// clearRandomArtCache empties the randomart cache.
+// Called from JS as: GoSSH.clearRandomArtCache()
+func clearRandomArtCache() {
+	artCache.clear()
 }
 
 // RandomArtSHA256 generates randomart from a SHA256 fingerprint.
@@ -64,110 +214,185 @@ func RandomArtSHA256(hash []byte, keyType string, bits int) string {
 	return randomArtFromHash(hash, keyType, bits, "SHA256")
 }
 
-// randomArtFromHash implements the core Bishop algorithm.
+// randomArtFromHash implements the core Bishop algorithm at OpenSSH's
+// 17×9.
 func randomArtFromHash(hash []byte, keyType string, bits int, hashName string) string {
-	var field [artHeight][artWidth]byte
+	return randomArtSized(hash, keyType, bits, hashName, artWidth, artHeight, false)
+}
+
+// Bounds for randomArtSized. Both dimensions are odd so the start has a
+// center cell.
+const (
+	minArtWidth, maxArtWidth   = 9, 65
+	minArtHeight, maxArtHeight = 5, 33
+)
+
+// validArtSize reports whether width×height is a size randomArtSized
+// draws: odd dimensions within the bounds.
+func validArtSize(width, height int) bool {
+	return width%2 == 1 && height%2 == 1 &&
+		width >= minArtWidth && width <= maxArtWidth &&
+		height >= minArtHeight && height <= maxArtHeight
+}
+
+// randomArtSized draws the Bishop walk on a width×height grid, starting at
+// the center. A larger grid spreads the same walk out, so similar keys are
+// easier to tell apart; the borders are laid out as OpenSSH does at any size.
+// With color, each visited cell is wrapped in the SGR escape artColor gives
+// it; the characters are the same.
+func randomArtSized(hash []byte, keyType string, bits int, hashName string, width, height int, color bool) string {
+	field := bishopWalk(hash, width, height)
+
+	// Render the grid.
+	var sb strings.Builder
+
+	// Top border with key info; just the type if the bits don't fit.
+	writeArtBorder(&sb, artTitle(keyType, bits, width), width)
+	sb.WriteByte('\n')
+
+	// Grid rows.
+	for _, row := range field {
+		sb.WriteByte('|')
+		for _, visits := range row {
+			if sgr := artColor(visits); color && sgr != "" {
+				sb.WriteString("\x1b[" + sgr + "m")
+				sb.WriteByte(artChars[visits])
+				sb.WriteString("\x1b[0m")
+				continue
+			}
+			sb.WriteByte(artChars[visits])
+		}
+		sb.WriteString("|\n")
+	}
+
+	// Bottom border with hash type.
+	writeArtBorder(&sb, "["+hashName+"]", width)
+
+	return sb.String()
+}
+
+// artColor is the SGR parameters for a cell with visits: the walk's
+// density runs from blue through cyan, green, and yellow to red, with the
+// start and end in bold magenta. Unvisited cells get none.
+func artColor(visits byte) string {
+	switch {
+	case visits == 0:
+		return ""
+	case visits >= artStartMarker:
+		return "1;35"
+	case visits <= 2:
+		return "34"
+	case visits <= 4:
+		return "36"
+	case visits <= 7:
+		return "32"
+	case visits <= 10:
+		return "33"
+	default:
+		return "31"
+	}
+}
+
+// bishopWalk returns the visit count of each cell, by row, after the walk
+// for hash, with artStartMarker and artEndMarker at the ends.
+func bishopWalk(hash []byte, width, height int) [][]byte {
+	field := make([][]byte, height)
+	for i := range field {
+		field[i] = make([]byte, width)
+	}
 
 	// Start at the center.
-	x, y := artWidth/2, artHeight/2
+	startX, startY := width/2, height/2
+	x, y := startX, startY
 
 	// Walk the grid based on bit-pairs from the hash.
 	for _, b := range hash {
 		for shift := 0; shift < 8; shift += 2 {
 			// Extract 2-bit direction: bits 0-1, 2-3, 4-5, 6-7 (LSB first).
+			// Bit 0 moves right if set, left if not; bit 1 down or up.
 			dir := (b >> shift) & 0x03
-
-			// Move the bishop.
-			switch dir {
-			case 0: // ↖ up-left
-				x--
-				y--
-			case 1: // ↗ up-right
+			if dir&1 != 0 {
 				x++
-				y--
-			case 2: // ↙ down-left
+			} else {
 				x--
+			}
+			if dir&2 != 0 {
 				y++
-			case 3: // ↘ down-right
-				x++
-				y++
+			} else {
+				y--
 			}
 
 			// Clamp to grid bounds.
-			if x < 0 {
-				x = 0
-			}
-			if x >= artWidth {
-				x = artWidth - 1
-			}
-			if y < 0 {
-				y = 0
-			}
-			if y >= artHeight {
-				y = artHeight - 1
-			}
+			x = max(0, min(x, width-1))
+			y = max(0, min(y, height-1))
 
-			field[y][x]++
+			if field[y][x] < artStartMarker-1 {
+				field[y][x]++
+			}
 		}
 	}
 
 	// Mark start and end positions with special values.
-	startX, startY := artWidth/2, artHeight/2
 	field[startY][startX] = artStartMarker // 'S'
 	field[y][x] = artEndMarker             // 'E'
+	return field
+}
 
-	// Render the grid.
-	var sb strings.Builder
-
-	// Top border with key info.
-	header := fmt.Sprintf("%s %d", strings.ToUpper(keyType), bits)
-	topPad := (artWidth - len(header) - 4) / 2
-	if topPad < 0 {
-		topPad = 0
+// artTitle is the top border's title: type and bits, or just the type if
+// that doesn't fit in width.
+func artTitle(keyType string, bits, width int) string {
+	title := fmt.Sprintf("[%s %d]", strings.ToUpper(keyType), bits)
+	if len(title) > width {
+		title = "[" + strings.ToUpper(keyType) + "]"
 	}
-	sb.WriteString("+")
-	sb.WriteString(strings.Repeat("-", topPad))
-	sb.WriteString("[")
-	sb.WriteString(header)
-	sb.WriteString("]")
-	rightPad := artWidth - topPad - len(header) - 2
-	if rightPad < 0 {
-		rightPad = 0
-	}
-	sb.WriteString(strings.Repeat("-", rightPad))
-	sb.WriteString("+\n")
+	return title
+}
 
-	// Grid rows.
-	for row := 0; row < artHeight; row++ {
-		sb.WriteByte('|')
-		for col := 0; col < artWidth; col++ {
-			idx := int(field[row][col])
-			if idx >= len(artChars) {
-				idx = len(artChars) - 3 // Cap at max visit char.
+// randomArtGrid is the walk as data for a UI to draw, in color say: rows of
+// {char, visits, intensity}, where intensity is visits scaled to 0–1 and the
+// start and end cells carry marker 'start' or 'end' instead.
+func randomArtGrid(hash []byte, keyType string, bits int, hashName string, width, height int) map[string]any {
+	maxVisits := float64(artStartMarker - 1)
+	rows := make([]any, height)
+	for y, row := range bishopWalk(hash, width, height) {
+		cells := make([]any, width)
+		for x, visits := range row {
+			cell := map[string]any{"char": string(artChars[visits])}
+			switch visits {
+			case artStartMarker:
+				cell["marker"] = "start"
+			case artEndMarker:
+				cell["marker"] = "end"
+			default:
+				cell["visits"] = int(visits)
+				cell["intensity"] = float64(visits) / maxVisits
 			}
-			sb.WriteByte(artChars[idx])
+			cells[x] = cell
 		}
-		sb.WriteString("|\n")
+		rows[y] = cells
 	}
+	title := artTitle(keyType, bits, width)
+	return map[string]any{
+		"width":  width,
+		"height": height,
+		"title":  title[1 : len(title)-1],
+		"hash":   hashName,
+		"rows":   rows,
+	}
+}
 
-	// Bottom border with hash type.
-	botPad := (artWidth - len(hashName) - 2) / 2
-	if botPad < 0 {
-		botPad = 0
-	}
-	sb.WriteString("+")
-	sb.WriteString(strings.Repeat("-", botPad))
-	sb.WriteString("[")
-	sb.WriteString(hashName)
-	sb.WriteString("]")
-	rightBotPad := artWidth - botPad - len(hashName) - 2
-	if rightBotPad < 0 {
-		rightBotPad = 0
-	}
-	sb.WriteString(strings.Repeat("-", rightBotPad))
-	sb.WriteString("+")
-
-	return sb.String()
+// writeArtBorder writes a border line with title centered, rounding left
+// as OpenSSH does. A title wider than the grid is cut to fit.
+func writeArtBorder(sb *strings.Builder, title string, width int) {
+	if len(title) > width {
+		title = title[:width]
+	}
+	left := (width - len(title)) / 2
+	sb.WriteByte('+')
+	sb.WriteString(strings.Repeat("-", left))
+	sb.WriteString(title)
+	sb.WriteString(strings.Repeat("-", width-left-len(title)))
+	sb.WriteByte('+')
 }
 
 // RandomArtFromFingerprint generates randomart from a hex-encoded fingerprint string.
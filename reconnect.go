@@ -0,0 +1,277 @@
+// reconnect.go re-establishes a session's connection in place: a new dial
+// with the connect config, and a new shell with the terminal type, modes,
+// environment, and last size of the one it replaces. The session ID stays
+// the same, so callbacks and the terminal carry on.
+//
+// With autoReconnect in the connect config this also happens on its own
+// when the connection is lost, retrying with backoff before giving up and
+// closing the session. The new shell is a fresh login: the remote end has
+// no scrollback or running programs to restore.
+//
+// Every reconnect expects the host key the session was opened with. The
+// same key is accepted without asking onHostKey again; a different one —
+// a downgrade from ed25519 to ssh-rsa, say, or a key swapped behind a
+// familiar name — fails before authenticating, or with
+// reconnectHostKeyPolicy 'warn' is reported and then verified as on a
+// first connect.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"syscall/js"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshReconnect dials the session's destination again and swaps the new
+// connection in. SFTP sessions, forwards, and channels opened on the old
+// connection are closed; the caller opens them again.
+// Called from JS as: GoSSH.reconnect(sessionId) → Promise<void>
+func sshReconnect(sessionID string) js.Value {
+	return newPromise(func() (any, error) {
+		sess, err := getSession(sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("reconnect: %w", err)
+		}
+		sess.emit("reconnecting", nil)
+		cc, err := dialClient(sess.ctx, sess.config, sess.hostKeyPin())
+		if err == nil {
+			err = sess.reconnectWith(cc)
+			if err != nil {
+				err = fmt.Errorf("reconnect: %w", err)
+			}
+		}
+		if err != nil {
+			sess.emit("reconnect_failed", map[string]any{"error": err.Error()})
+			return nil, err
+		}
+		sess.emit("reconnected", nil)
+		return nil, nil
+	})
+}
+
+// reconnectWith replaces the session's connection with cc, which it takes
+// ownership of. If the session had a shell, a new one is requested with the
+// same PTY settings and environment at the size last sent by resize (see
+// shellPty).
+func (s *session) reconnectWith(cc *clientConn) error {
+	s.reconnectMu.Lock()
+	defer s.reconnectMu.Unlock()
+
+	s.connMu.Lock()
+	hadShell := s.sshSession != nil
+	env := s.env
+	s.connMu.Unlock()
+
+	var shell *shellChannel
+	if hadShell {
+		pty, cols, rows := s.shellPty()
+		var err error
+		shell, err = startShell(cc, pty, env, cols, rows, jsBool(s.config.Get("separateStderr")))
+		if err != nil {
+			cc.close()
+			return err
+		}
+		shell.reportEnv(s.config)
+	}
+
+	connCtx, connCancel := context.WithCancel(s.ctx)
+	s.connMu.Lock()
+	if s.ctx.Err() != nil {
+		s.connMu.Unlock()
+		connCancel()
+		if shell != nil {
+			closeQuietly(shell.session)
+		}
+		cc.close()
+		return fmt.Errorf("session closed")
+	}
+	old := &session{id: s.id, cc: s.cc, pooled: s.pooled, sshSession: s.sshSession, stdin: s.stdin}
+	if s.connCancel != nil {
+		s.connCancel()
+	}
+	s.cc, s.pooled, s.sshClient, s.agentForward, s.connCancel = cc, nil, cc.sshClient, cc.agentForward, connCancel
+	if shell != nil {
+		s.sshSession, s.stdin = shell.session, shell.stdin
+		s.registerPty(s.id, shell.session, shell.cols, shell.rows)
+	}
+	s.connMu.Unlock()
+
+	// Everything on the old connection goes with it.
+	for _, c := range sessionClosers {
+		c.close(old)
+	}
+	s.watchConn(connCtx, cc, shell, true)
+	return nil
+}
+
+const (
+	defaultReconnectRetries = 5
+	defaultReconnectBackoff = time.Second
+	// maxReconnectBackoff caps the doubling delay between attempts.
+	maxReconnectBackoff = 30 * time.Second
+)
+
+// reconnectPolicy is the connect config's autoReconnect.
+type reconnectPolicy struct {
+	maxRetries int
+	backoff    time.Duration // before the first attempt, doubling after
+}
+
+// parseReconnectPolicy reads autoReconnect: true or {maxRetries, backoffMs}.
+// It returns nil when the option is absent or false.
+func parseReconnectPolicy(config js.Value) (*reconnectPolicy, error) {
+	v := config.Get("autoReconnect")
+	if v.Type() == js.TypeBoolean {
+		if !v.Bool() {
+			return nil, nil
+		}
+		return &reconnectPolicy{maxRetries: defaultReconnectRetries, backoff: defaultReconnectBackoff}, nil
+	}
+	if v.Type() != js.TypeObject {
+		return nil, nil
+	}
+	p := &reconnectPolicy{maxRetries: jsInt(v.Get("maxRetries"), defaultReconnectRetries)}
+	if p.maxRetries < 1 || p.maxRetries > 100 {
+		return nil, fmt.Errorf("autoReconnect.maxRetries must be between 1 and 100")
+	}
+	backoff, err := timeoutFromConfig(v, "backoffMs", defaultReconnectBackoff)
+	if err != nil {
+		return nil, fmt.Errorf("autoReconnect: %w", err)
+	}
+	p.backoff = min(backoff, maxReconnectBackoff)
+	return p, nil
+}
+
+// hostKeyPin is what a redial expects of the server's host key.
+type hostKeyPin struct {
+	key ssh.PublicKey
+	// warn reports a changed key through onChange and leaves it to the
+	// usual verification, instead of failing.
+	warn     bool
+	onChange func(old, key ssh.PublicKey)
+}
+
+// parseReconnectHostKeyPolicy reads reconnectHostKeyPolicy: "reject"
+// (the default) or "warn", returning whether it is "warn".
+func parseReconnectHostKeyPolicy(config js.Value) (bool, error) {
+	switch v := jsString(config.Get("reconnectHostKeyPolicy")); v {
+	case "", "reject":
+		return false, nil
+	case "warn":
+		return true, nil
+	default:
+		return false, fmt.Errorf("reconnectHostKeyPolicy must be 'reject' or 'warn', not %q", v)
+	}
+}
+
+// hostKeyPin pins the session's redials to the key it was opened with,
+// or returns nil if that isn't known.
+func (s *session) hostKeyPin() *hostKeyPin {
+	if s.hostKey == nil {
+		return nil
+	}
+	return &hostKeyPin{key: s.hostKey, warn: s.hostKeyWarn, onChange: func(old, key ssh.PublicKey) {
+		logWarnf("host key changed on reconnect:", old.Type(), ssh.FingerprintSHA256(old), "→", key.Type(), ssh.FingerprintSHA256(key))
+		s.emit("host_key_changed", map[string]any{
+			"previousKeyType":     old.Type(),
+			"previousFingerprint": ssh.FingerprintSHA256(old),
+			"keyType":             key.Type(),
+			"fingerprint":         ssh.FingerprintSHA256(key),
+		})
+	}}
+}
+
+// check compares key with the pinned one. same is true for the pinned
+// key, which needs no further verification; otherwise err is the
+// HOST_KEY_CHANGED failure, or nil under the warn policy.
+func (p *hostKeyPin) check(hostname string, key ssh.PublicKey) (same bool, err error) {
+	if bytes.Equal(key.Marshal(), p.key.Marshal()) {
+		return true, nil
+	}
+	if p.warn {
+		if p.onChange != nil {
+			p.onChange(p.key, key)
+		}
+		return false, nil
+	}
+	what := "key"
+	if key.Type() != p.key.Type() {
+		what = "key type"
+	}
+	return false, &codedError{
+		code: errCodeHostKeyChanged,
+		msg: fmt.Sprintf("reconnect: host %s for %s changed since the session was opened (was %s %s, now %s %s); possible man-in-the-middle attack",
+			what, hostname, p.key.Type(), ssh.FingerprintSHA256(p.key), key.Type(), ssh.FingerprintSHA256(key)),
+	}
+}
+
+// shellLost reports whether a shell's Wait error means the connection went
+// rather than the shell exiting: no exit status arrived.
+func shellLost(err error) bool {
+	var exitErr *ssh.ExitError
+	return err != nil && !errors.As(err, &exitErr)
+}
+
+// connectionLost handles the loss of the session's connection: without
+// autoReconnect it closes the session with reason; with it, it starts
+// reconnecting unless that's already under way. It reports whether the
+// session lives on.
+func (s *session) connectionLost(reason string) bool {
+	if s.autoReconnect == nil {
+		s.close(reason)
+		return false
+	}
+	if s.reconnecting.CompareAndSwap(false, true) {
+		spawn("session.autoReconnect", func() {
+			defer s.reconnecting.Store(false)
+			s.autoReconnectLoop(reason)
+		})
+	}
+	return true
+}
+
+// autoReconnectLoop redials until it succeeds, the session is closed, or
+// maxRetries attempts fail, when it closes the session. onReconnect(attempt)
+// is called as each attempt starts.
+func (s *session) autoReconnectLoop(reason string) {
+	policy := s.autoReconnect
+	s.emit("connection_lost", map[string]any{"reason": reason})
+	onReconnect, hasOnReconnect := getCallback(s.config, "onReconnect")
+	delay := policy.backoff
+	for attempt := 1; attempt <= policy.maxRetries; attempt++ {
+		timer := time.NewTimer(delay)
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		delay = min(2*delay, maxReconnectBackoff)
+
+		s.emit("reconnecting", map[string]any{"attempt": attempt})
+		if hasOnReconnect {
+			onReconnect.Invoke(attempt)
+		}
+		cc, err := dialClient(s.ctx, s.config, s.hostKeyPin())
+		if err == nil {
+			err = s.reconnectWith(cc)
+		}
+		if err == nil {
+			s.emit("reconnected", map[string]any{"attempt": attempt})
+			return
+		}
+		if s.ctx.Err() != nil {
+			return
+		}
+		s.emit("reconnect_failed", map[string]any{"attempt": attempt, "error": err.Error()})
+	}
+	s.close(fmt.Sprintf("%s; gave up after %d reconnect attempts", reason, policy.maxRetries))
+}
@@ -0,0 +1,176 @@
+// remoteforward.go implements SSH remote port forwarding (-R) into the
+// browser: the SSH server listens on a port, and each connection it accepts
+// there is handed to JS as a byte stream. This exposes a browser-hosted
+// service to the remote host.
+//
+// Accepted connections are tracked as raw channels, so JS writes to and
+// closes them with channelWrite/channelClose, like channels from openChannel.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall/js"
+	"time"
+)
+
+// remoteConnectionTimeout bounds how long onConnection may take to accept
+// or refuse a connection.
+const remoteConnectionTimeout = 30 * time.Second
+
+// remoteForward is an active listener on the SSH server.
+type remoteForward struct {
+	id        string
+	sessionID string
+	bindAddr  string
+	port      int
+	listener  net.Listener
+	active    atomic.Int32 // accepted connections still open
+	closeOnce sync.Once
+}
+
+// remoteForwardStore tracks active remote forwards.
+var remoteForwardStore sync.Map // forwardID → *remoteForward
+
+// portForwardRemoteStart asks the server to listen on remoteBindAddr:
+// remotePort (port 0 lets the server choose) and hands each accepted
+// connection to onConnection({channelId, originAddr, originPort}). The
+// callback returns {onData?, onClose?} (or a Promise of it) to accept, or
+// a falsy value to refuse.
+// Called from JS as:
+//
+//	GoSSH.portForwardRemoteStart(sessionId, {remoteBindAddr?, remotePort, onConnection}) → Promise<{id, bindAddr, port}>
+func portForwardRemoteStart(sessionID string, config js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		sess, err := getSession(sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("portForwardRemoteStart: %w", err)
+		}
+		bindAddr := jsString(config.Get("remoteBindAddr"))
+		if bindAddr == "" {
+			bindAddr = "localhost"
+		}
+		if containsCRLF(bindAddr) || containsCTL(bindAddr) || strings.ContainsAny(bindAddr, " \t") {
+			return nil, fmt.Errorf("portForwardRemoteStart: invalid remoteBindAddr")
+		}
+		port := jsInt(config.Get("remotePort"), -1)
+		if port < 0 || port > 65535 {
+			return nil, fmt.Errorf("portForwardRemoteStart: invalid remotePort %d (must be 0-65535)", port)
+		}
+		onConnection, ok := getCallback(config, "onConnection")
+		if !ok {
+			return nil, fmt.Errorf("portForwardRemoteStart: onConnection required")
+		}
+
+		ln, err := sess.client().Listen("tcp", net.JoinHostPort(bindAddr, strconv.Itoa(port)))
+		if err != nil {
+			return nil, fmt.Errorf("portForwardRemoteStart: %w", err)
+		}
+		if addr, ok := ln.Addr().(*net.TCPAddr); ok {
+			port = addr.Port
+		}
+
+		rf := &remoteForward{
+			id:        generateID(),
+			sessionID: sessionID,
+			bindAddr:  bindAddr,
+			port:      port,
+			listener:  ln,
+		}
+		remoteForwardStore.Store(rf.id, rf)
+		spawn("remoteForward.accept", func() { rf.acceptLoop(onConnection) })
+
+		return map[string]any{
+			"id":       rf.id,
+			"bindAddr": bindAddr,
+			"port":     port,
+		}, nil
+	})
+}
+
+// acceptLoop hands accepted connections to JS until the listener closes.
+func (rf *remoteForward) acceptLoop(onConnection js.Value) {
+	defer rf.stop()
+	for {
+		conn, err := rf.listener.Accept()
+		if err != nil {
+			return
+		}
+		if rf.active.Load() >= maxConcurrentHandlers {
+			closeQuietly(conn)
+			continue
+		}
+		rf.active.Add(1)
+		spawn("remoteForward.serve", func() { rf.serve(conn, onConnection) })
+	}
+}
+
+// serve offers one connection to JS and, if accepted, pumps its data.
+func (rf *remoteForward) serve(conn net.Conn, onConnection js.Value) {
+	defer rf.active.Add(-1)
+
+	rc := &rawChannel{
+		id:        generateID(),
+		sessionID: rf.sessionID,
+		forwardID: rf.id,
+		ch:        conn,
+	}
+	info := map[string]any{"channelId": rc.id, "originAddr": "", "originPort": 0}
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		info["originAddr"] = addr.IP.String()
+		info["originPort"] = addr.Port
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), remoteConnectionTimeout)
+	defer cancel()
+	// Register first so the callback can write immediately.
+	channelStore.Store(rc.id, rc)
+	promise := js.Global().Get("Promise").Call("resolve", onConnection.Invoke(info))
+	handlers, err := awaitPromise(ctx, promise)
+	if err != nil || !handlers.Truthy() {
+		rc.close()
+		return
+	}
+	onData, _ := getCallback(handlers, "onData")
+	// The forward or session may have closed rc while JS decided.
+	onClose, _ := getCallback(handlers, "onClose")
+	rc.setOnClose(onClose)
+
+	if onData.Type() == js.TypeFunction {
+		pumpToJS(conn, onData)
+	} else {
+		_, _ = io.Copy(io.Discard, conn)
+	}
+	rc.close()
+}
+
+// stop cancels the server-side listener and closes its connections.
+func (rf *remoteForward) stop() {
+	rf.closeOnce.Do(func() {
+		closeQuietly(rf.listener)
+		remoteForwardStore.Delete(rf.id)
+		channelStore.Range(func(key, val any) bool {
+			if rc := val.(*rawChannel); rc.forwardID == rf.id {
+				rc.close()
+			}
+			return true
+		})
+	})
+}
+
+// portForwardRemoteStop stops a remote forward.
+// Called from JS as: GoSSH.portForwardRemoteStop(forwardId)
+func portForwardRemoteStop(forwardID string) {
+	if val, ok := remoteForwardStore.Load(forwardID); ok {
+		val.(*remoteForward).stop()
+	}
+}
@@ -0,0 +1,317 @@
+// scp.go implements a minimal SCP client (the classic rcp-style protocol
+// spoken by `scp -t` / `scp -f`) over an SSH exec channel. It is a fallback
+// for servers that allow command execution but not the SFTP subsystem
+// (sftpOpen rejects with code SFTP_SUBSYSTEM_UNAVAILABLE).
+//
+// Protocol summary (one regular file, no recursion):
+//
+//	upload:   remote → \0                    (ready)
+//	          local  → C<mode> <size> <name>\n
+//	          remote → \0
+//	          local  → <size bytes> \0
+//	          remote → \0
+//
+//	download: local  → \0
+//	          remote → C<mode> <size> <name>\n  (or T... first when -p)
+//	          local  → \0
+//	          remote → <size bytes> <status byte>
+//	          local  → \0
+//
+// A status byte of 1 (warning) or 2 (fatal) is followed by a message line.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	pathpkg "path"
+	"strconv"
+	"strings"
+	"syscall/js"
+)
+
+// scpMaxHeaderLen bounds a single protocol line from the remote.
+const scpMaxHeaderLen = 4096
+
+// scpUpload uploads data from a JS Uint8Array to a remote file via SCP.
+// Called from JS as:
+//
+//	GoSSH.scpUpload(sessionId, remotePath, data: Uint8Array, onProgress?, signal?, opts?: {mode}) → Promise<void>
+func scpUpload(sessionID string, remotePath string, data js.Value, onProgress js.Value, signal js.Value, opts js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		sess, err := getSession(sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("scpUpload: %w", err)
+		}
+		remotePath, err = validateSFTPPath(remotePath, sess.strictSFTPPaths)
+		if err != nil {
+			return nil, fmt.Errorf("scpUpload: %w", err)
+		}
+		name := pathpkg.Base(remotePath)
+		if name == "/" || name == "." || strings.ContainsAny(name, "\n\r") {
+			return nil, fmt.Errorf("scpUpload: remote path must name a file")
+		}
+		mode := jsInt(jsGet(opts, "mode"), 0o644)
+		if mode < 0 || mode > 0o7777 {
+			return nil, fmt.Errorf("scpUpload: mode must be between 0 and 07777")
+		}
+
+		totalSize := data.Get("byteLength").Int()
+		if totalSize > maxUploadSize {
+			return nil, fmt.Errorf("scpUpload: file too large (%d bytes, max %d)", totalSize, maxUploadSize)
+		}
+		defer afterTransfer(int64(totalSize))
+
+		// scp itself never needs the agent, so it is not forwarded here.
+		s, err := sess.newExecSession(false)
+		if err != nil {
+			return nil, fmt.Errorf("scpUpload: %w", err)
+		}
+		defer closeQuietly(s)
+		stdin, err := s.StdinPipe()
+		if err != nil {
+			return nil, fmt.Errorf("scpUpload: %w", err)
+		}
+		stdout, err := s.StdoutPipe()
+		if err != nil {
+			return nil, fmt.Errorf("scpUpload: %w", err)
+		}
+		if err := s.Start("scp -t -- " + shellQuote(remotePath)); err != nil {
+			return nil, fmt.Errorf("scpUpload: start scp: %w", err)
+		}
+		r := bufio.NewReader(stdout)
+
+		if err := scpReadAck(r); err != nil {
+			return nil, fmt.Errorf("scpUpload: %w", err)
+		}
+		if _, err := fmt.Fprintf(stdin, "C%04o %d %s\n", mode, totalSize, name); err != nil {
+			return nil, fmt.Errorf("scpUpload: write header: %w", err)
+		}
+		if err := scpReadAck(r); err != nil {
+			return nil, fmt.Errorf("scpUpload: %w", err)
+		}
+
+		hasProgress := hasProgressFn(onProgress)
+		written := 0
+		for written < totalSize {
+			if isAborted(signal) {
+				return nil, errTransferCancelled
+			}
+			end := written + transferChunkSize
+			if end > totalSize {
+				end = totalSize
+			}
+			chunk := make([]byte, end-written)
+			js.CopyBytesToGo(chunk, data.Call("subarray", written, end))
+
+			n, err := stdin.Write(chunk)
+			scrubBytes(chunk)
+			if err != nil {
+				return nil, fmt.Errorf("scpUpload: write at %d: %w", written, err)
+			}
+			written += n
+
+			if hasProgress {
+				onProgress.Invoke(float64(written), float64(totalSize))
+			}
+		}
+
+		if _, err := stdin.Write([]byte{0}); err != nil {
+			return nil, fmt.Errorf("scpUpload: write trailer: %w", err)
+		}
+		if err := scpReadAck(r); err != nil {
+			return nil, fmt.Errorf("scpUpload: %w", err)
+		}
+		closeQuietly(stdin)
+		_ = s.Wait()
+		return nil, nil
+	})
+}
+
+// scpDownload downloads a remote file into a JS Uint8Array via SCP.
+// Called from JS as:
+//
+//	GoSSH.scpDownload(sessionId, remotePath, onProgress?, signal?) → Promise<Uint8Array>
+func scpDownload(sessionID string, remotePath string, onProgress js.Value, signal js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		sess, err := getSession(sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("scpDownload: %w", err)
+		}
+		remotePath, err = validateSFTPPath(remotePath, sess.strictSFTPPaths)
+		if err != nil {
+			return nil, fmt.Errorf("scpDownload: %w", err)
+		}
+
+		// scp itself never needs the agent, so it is not forwarded here.
+		s, err := sess.newExecSession(false)
+		if err != nil {
+			return nil, fmt.Errorf("scpDownload: %w", err)
+		}
+		defer closeQuietly(s)
+		stdin, err := s.StdinPipe()
+		if err != nil {
+			return nil, fmt.Errorf("scpDownload: %w", err)
+		}
+		stdout, err := s.StdoutPipe()
+		if err != nil {
+			return nil, fmt.Errorf("scpDownload: %w", err)
+		}
+		if err := s.Start("scp -f -- " + shellQuote(remotePath)); err != nil {
+			return nil, fmt.Errorf("scpDownload: start scp: %w", err)
+		}
+		r := bufio.NewReader(stdout)
+
+		if _, err := stdin.Write([]byte{0}); err != nil {
+			return nil, fmt.Errorf("scpDownload: %w", err)
+		}
+
+		// Read the file header, skipping an optional T (timestamps) record.
+		var size int64
+		for {
+			line, err := scpReadLine(r)
+			if err != nil {
+				return nil, fmt.Errorf("scpDownload: %w", err)
+			}
+			if strings.HasPrefix(line, "T") {
+				if _, err := stdin.Write([]byte{0}); err != nil {
+					return nil, fmt.Errorf("scpDownload: %w", err)
+				}
+				continue
+			}
+			_, size, _, err = parseSCPHeader(line)
+			if err != nil {
+				return nil, fmt.Errorf("scpDownload: %w", err)
+			}
+			break
+		}
+		if size > maxDownloadSize {
+			return nil, fmt.Errorf("scpDownload: file too large (%d bytes, max %d)", size, maxDownloadSize)
+		}
+		if _, err := stdin.Write([]byte{0}); err != nil {
+			return nil, fmt.Errorf("scpDownload: %w", err)
+		}
+
+		hasProgress := hasProgressFn(onProgress)
+		buf := make([]byte, size)
+		defer afterTransfer(size)
+		var totalRead int64
+		for totalRead < size {
+			if isAborted(signal) {
+				return nil, errTransferCancelled
+			}
+			end := totalRead + transferChunkSize
+			if end > size {
+				end = size
+			}
+			n, err := io.ReadFull(r, buf[totalRead:end])
+			totalRead += int64(n)
+			if err != nil {
+				return nil, fmt.Errorf("scpDownload: read at %d: %w", totalRead, err)
+			}
+			if hasProgress {
+				onProgress.Invoke(float64(totalRead), float64(size))
+			}
+		}
+
+		if err := scpReadAck(r); err != nil {
+			return nil, fmt.Errorf("scpDownload: %w", err)
+		}
+		_, _ = stdin.Write([]byte{0})
+		closeQuietly(stdin)
+		_ = s.Wait()
+
+		return bytesToUint8Array(buf), nil
+	})
+}
+
+// scpReadAck reads one SCP status byte. 0 is success; 1 and 2 are followed
+// by an error message line from the remote.
+func scpReadAck(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("read status: %w", err)
+	}
+	switch b {
+	case 0:
+		return nil
+	case 1, 2:
+		msg, _ := scpReadRawLine(r)
+		return fmt.Errorf("remote error: %s", maskControl(strings.TrimSpace(msg)))
+	default:
+		return fmt.Errorf("unexpected status byte 0x%02x", b)
+	}
+}
+
+// scpReadLine reads a protocol record. A leading status byte of 1 or 2 turns
+// the record into an error carrying the remote's message.
+func scpReadLine(r *bufio.Reader) (string, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return "", fmt.Errorf("read header: %w", err)
+	}
+	if b == 1 || b == 2 {
+		msg, _ := scpReadRawLine(r)
+		return "", fmt.Errorf("remote error: %s", maskControl(strings.TrimSpace(msg)))
+	}
+	if err := r.UnreadByte(); err != nil {
+		return "", err
+	}
+	return scpReadRawLine(r)
+}
+
+// scpReadRawLine reads up to a newline, bounded by scpMaxHeaderLen.
+func scpReadRawLine(r *bufio.Reader) (string, error) {
+	var sb strings.Builder
+	for sb.Len() < scpMaxHeaderLen {
+		b, err := r.ReadByte()
+		if err != nil {
+			return sb.String(), err
+		}
+		if b == '\n' {
+			return sb.String(), nil
+		}
+		sb.WriteByte(b)
+	}
+	return "", errors.New("protocol line too long")
+}
+
+// parseSCPHeader parses a "C<mode> <size> <name>" file record.
+func parseSCPHeader(line string) (mode uint32, size int64, name string, err error) {
+	if line == "" {
+		return 0, 0, "", errors.New("empty header")
+	}
+	switch line[0] {
+	case 'C':
+	case 'D':
+		return 0, 0, "", errors.New("remote path is a directory")
+	default:
+		return 0, 0, "", fmt.Errorf("unexpected record %q", maskControl(line[:1]))
+	}
+	parts := strings.SplitN(line[1:], " ", 3)
+	if len(parts) != 3 {
+		return 0, 0, "", errors.New("malformed file header")
+	}
+	m, err := strconv.ParseUint(parts[0], 8, 32)
+	if err != nil || m > 0o7777 {
+		return 0, 0, "", errors.New("malformed file mode")
+	}
+	size, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || size < 0 {
+		return 0, 0, "", errors.New("malformed file size")
+	}
+	name = parts[2]
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return 0, 0, "", errors.New("malformed file name")
+	}
+	return uint32(m), size, name, nil
+}
+
+// shellQuote single-quotes s for a POSIX shell command line.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
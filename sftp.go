@@ -7,14 +7,20 @@
 package gossh
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"math"
 	pathpkg "path"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall/js"
+	"time"
 
 	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
 )
 
 // sftpSession holds an active SFTP client tied to an SSH session.
@@ -23,58 +29,210 @@ type sftpSession struct {
 	sessionID string
 	client    *sftp.Client
 	strict    bool
+	// readOnly makes every operation that changes the remote fail; see
+	// writable.
+	readOnly bool
+	// root is the rootPrefix the session is confined to ("" for none), and
+	// realRoot the same directory as the server resolves it; see
+	// sftp_root.go.
+	root     string
+	realRoot string
+	// refs counts sftpOpen calls not yet matched by sftpClose; the client
+	// closes when it reaches zero. Guarded by sftpOpenMu.
+	refs int
+	// handles counts file handles open or being opened (see sftp_file.go).
+	handles atomic.Int32
 }
 
 // sftpStore tracks all active SFTP sessions.
 var sftpStore sync.Map
 
+// sftpOpenMu serializes reuse lookups so concurrent sftpOpen({reuse: true})
+// calls for one SSH session share a subsystem instead of racing to open two.
+// It also guards every sftpSession's refs.
+var sftpOpenMu sync.Mutex
+
 // sftpOpen opens an SFTP subsystem on an existing SSH session.
-// Called from JS as: GoSSH.sftpOpen(sessionId) → Promise<sftpId>
-func sftpOpen(sessionID string) js.Value {
+// With opts.reuse, an SFTP session already open on the same SSH session is
+// returned instead of starting another subsystem (servers often cap these).
+// A reused ID is shared: it stays open until every sftpOpen that returned
+// it has been matched by an sftpClose. With opts.readOnly, operations that
+// would change the remote reject (see writable); only a session opened
+// with the same readOnly setting is reused. With opts.rootPrefix, every
+// path must lie under that directory (see sftp_root.go); again only a
+// session with the same rootPrefix is reused.
+// Called from JS as: GoSSH.sftpOpen(sessionId, opts?: {reuse, readOnly, rootPrefix}) → Promise<sftpId>
+func sftpOpen(sessionID string, opts js.Value) js.Value {
 	return newPromise(func() (any, error) {
-		val, ok := sessionStore.Load(sessionID)
-		if !ok {
-			return nil, fmt.Errorf("sftpOpen: session %q not found", sessionID)
+		return openSFTPSession(sessionID, opts)
+	})
+}
+
+// openSFTPSession implements sftpOpen, returning the SFTP session ID.
+func openSFTPSession(sessionID string, opts js.Value) (string, error) {
+	val, ok := sessionStore.Load(sessionID)
+	if !ok {
+		return "", fmt.Errorf("sftpOpen: session %q not found", sessionID)
+	}
+	sess := val.(*session)
+	readOnly := jsBool(jsGet(opts, "readOnly"))
+	root, err := parseRootPrefix(jsString(jsGet(opts, "rootPrefix")))
+	if err != nil {
+		return "", fmt.Errorf("sftpOpen: %w", err)
+	}
+
+	if jsBool(jsGet(opts, "reuse")) {
+		sftpOpenMu.Lock()
+		defer sftpOpenMu.Unlock()
+		if existing := findSFTPSession(sessionID, readOnly, root); existing != nil {
+			existing.refs++
+			return existing.id, nil
 		}
-		sess := val.(*session)
+	}
 
-		client, err := sftp.NewClient(sess.sshClient)
+	client, err := newSFTPClient(sess.client())
+	if err != nil {
+		if errors.Is(err, errSFTPUnavailable) {
+			return "", err
+		}
+		return "", fmt.Errorf("sftpOpen: %w", err)
+	}
+	var realRoot string
+	if root != "" {
+		realRoot, err = resolveRoot(client, root)
 		if err != nil {
-			return nil, fmt.Errorf("sftpOpen: %w", err)
+			closeQuietly(client)
+			return "", fmt.Errorf("sftpOpen: rootPrefix: %w", err)
 		}
+	}
 
-		sftpID := generateID()
-		sftpStore.Store(sftpID, &sftpSession{
-			id:        sftpID,
-			sessionID: sessionID,
-			client:    client,
-			strict:    sess.strictSFTPPaths,
-		})
-
-		return sftpID, nil
+	sftpID := generateID()
+	sftpStore.Store(sftpID, &sftpSession{
+		id:        sftpID,
+		sessionID: sessionID,
+		client:    client,
+		strict:    sess.strictSFTPPaths,
+		readOnly:  readOnly,
+		root:      root,
+		realRoot:  realRoot,
+		refs:      1,
 	})
+
+	return sftpID, nil
 }
 
-// sftpClose closes an SFTP session.
+// newSFTPClient starts the sftp subsystem on a new channel. Unlike
+// sftp.NewClient, it reports a refused subsystem request (SFTP disabled on
+// the server) as errSFTPUnavailable and closes the channel on failure.
+// Failures on a connection that has dropped are returned as they are.
+// Agent forwarding is never requested: the sftp-server does not use it.
+func newSFTPClient(client *ssh.Client) (*sftp.Client, error) {
+	s, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := s.StdinPipe()
+	if err != nil {
+		closeQuietly(s)
+		return nil, err
+	}
+	stdout, err := s.StdoutPipe()
+	if err != nil {
+		closeQuietly(s)
+		return nil, err
+	}
+
+	if err := s.RequestSubsystem("sftp"); err != nil {
+		closeQuietly(s)
+		if !errors.Is(err, io.EOF) && connAlive(client) {
+			return nil, errSFTPUnavailable
+		}
+		return nil, err
+	}
+
+	c, err := sftp.NewClientPipe(stdout, &sessionWriteCloser{WriteCloser: stdin, session: s})
+	if err != nil {
+		closeQuietly(s)
+		// Some servers accept the request but exit before the SFTP version
+		// handshake when no sftp-server binary is installed.
+		if (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) && connAlive(client) {
+			return nil, errSFTPUnavailable
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// connAlive reports whether the connection still answers requests, telling
+// a channel the server closed apart from a dropped connection.
+func connAlive(client *ssh.Client) bool {
+	_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+	return err == nil
+}
+
+// sessionWriteCloser closes the owning ssh.Session along with its stdin pipe,
+// so closing an SFTP client releases its channel.
+type sessionWriteCloser struct {
+	io.WriteCloser
+	session *ssh.Session
+}
+
+func (w *sessionWriteCloser) Close() error {
+	err := w.WriteCloser.Close()
+	closeQuietly(w.session)
+	return err
+}
+
+// sftpClose releases an SFTP session. The subsystem closes, stopping the
+// transfers, tails, and file handles using it, once every holder of a
+// reused ID has released it.
 // Called from JS as: GoSSH.sftpClose(sftpId)
 func sftpClose(sftpID string) {
-	val, ok := sftpStore.LoadAndDelete(sftpID)
+	sftpOpenMu.Lock()
+	val, ok := sftpStore.Load(sftpID)
 	if !ok {
+		sftpOpenMu.Unlock()
 		return
 	}
-	s := val.(*sftpSession)
-	closeQuietly(s.client)
+	ss := val.(*sftpSession)
+	ss.refs--
+	if ss.refs > 0 {
+		sftpOpenMu.Unlock()
+		return
+	}
+	sftpStore.Delete(sftpID)
+	sftpOpenMu.Unlock()
+	ss.shutdown()
+}
+
+// closeSFTPSession closes an SFTP session regardless of its holders, as
+// when its SSH session closes.
+func closeSFTPSession(sftpID string) {
+	if val, ok := sftpStore.LoadAndDelete(sftpID); ok {
+		val.(*sftpSession).shutdown()
+	}
 }
 
-// sftpListDir lists the contents of a remote directory.
-// Called from JS as: GoSSH.sftpListDir(sftpId, path) → Promise<FileInfo[]>
-func sftpListDir(sftpID string, remotePath string) js.Value {
+// shutdown stops everything using the SFTP session and closes its client.
+func (ss *sftpSession) shutdown() {
+	stopStreamsForSFTP(ss.id)
+	cancelUploadsForSFTP(ss.id)
+	stopTailsForSFTP(ss.id)
+	closeFileHandlesForSFTP(ss.id)
+	closeQuietly(ss.client)
+}
+
+// sftpListDir lists the contents of a remote directory. With
+// opts.realPath, each entry also carries its canonical path (see
+// resolveRealPaths).
+// Called from JS as: GoSSH.sftpListDir(sftpId, path, opts?: {realPath}) → Promise<FileInfo[]>
+func sftpListDir(sftpID string, remotePath string, opts js.Value) js.Value {
 	return newPromise(func() (any, error) {
 		ss, err := getSFTPSession(sftpID)
 		if err != nil {
 			return nil, err
 		}
-		remotePath, err = validateSFTPPath(remotePath, ss.strict)
+		remotePath, err = ss.validatePath(remotePath)
 		if err != nil {
 			return nil, fmt.Errorf("sftpListDir: %w", err)
 		}
@@ -84,24 +242,84 @@ func sftpListDir(sftpID string, remotePath string) js.Value {
 			return nil, fmt.Errorf("sftpListDir: %w", err)
 		}
 
+		var realPaths []string
+		if jsBool(jsGet(opts, "realPath")) {
+			realPaths, err = resolveRealPaths(ss.client, remotePath, entries)
+			if err != nil {
+				return nil, fmt.Errorf("sftpListDir: %w", err)
+			}
+			ss.hideOutsideRoot(realPaths)
+		}
+
 		result := js.Global().Get("Array").New(len(entries))
 		for i, entry := range entries {
-			result.SetIndex(i, fileInfoToJS(remotePath, entry))
+			info := fileInfoToJS(remotePath, entry)
+			if realPaths != nil {
+				setRealPath(info, realPaths[i])
+			}
+			result.SetIndex(i, info)
 		}
 		return result, nil
 	})
 }
 
+// realPathConcurrency bounds the RealPath requests a listing keeps in
+// flight. pkg/sftp pipelines concurrent requests on the one connection.
+const realPathConcurrency = 16
+
+// resolveRealPaths returns the canonical path of each entry in dir. The
+// directory itself is resolved once; only symlink entries need their own
+// RealPath round-trip, and those are issued concurrently. A link that
+// can't be resolved (e.g. dangling) gets "".
+func resolveRealPaths(client *sftp.Client, dir string, entries []fs.FileInfo) ([]string, error) {
+	realDir, err := client.RealPath(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, len(entries))
+	sem := make(chan struct{}, realPathConcurrency)
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		if entry.Mode()&fs.ModeSymlink == 0 {
+			paths[i] = pathpkg.Join(realDir, entry.Name())
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		p := pathpkg.Join(dir, entry.Name())
+		spawn("sftp.realPath", func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if real, err := client.RealPath(p); err == nil {
+				paths[i] = real
+			}
+		})
+	}
+	wg.Wait()
+	return paths, nil
+}
+
+// setRealPath adds realPath to a FileInfo object; "" becomes null.
+func setRealPath(info js.Value, realPath string) {
+	if realPath == "" {
+		info.Set("realPath", js.Null())
+		return
+	}
+	info.Set("realPath", realPath)
+}
+
 // sftpStat returns file info for a single path.
 // Uses Lstat to correctly identify symlinks (Stat follows them).
-// Called from JS as: GoSSH.sftpStat(sftpId, path) → Promise<FileInfo>
-func sftpStat(sftpID string, remotePath string) js.Value {
+// With opts.realPath, the result also carries the canonical path.
+// Called from JS as: GoSSH.sftpStat(sftpId, path, opts?: {realPath}) → Promise<FileInfo>
+func sftpStat(sftpID string, remotePath string, opts js.Value) js.Value {
 	return newPromise(func() (any, error) {
 		ss, err := getSFTPSession(sftpID)
 		if err != nil {
 			return nil, err
 		}
-		remotePath, err = validateSFTPPath(remotePath, ss.strict)
+		remotePath, err = ss.validatePath(remotePath)
 		if err != nil {
 			return nil, fmt.Errorf("sftpStat: %w", err)
 		}
@@ -111,45 +329,183 @@ func sftpStat(sftpID string, remotePath string) js.Value {
 			return nil, fmt.Errorf("sftpStat: %w", err)
 		}
 
-		return fileInfoToJS(remotePath, info), nil
+		result := fileInfoToJS(remotePath, info)
+		if jsBool(jsGet(opts, "realPath")) {
+			// A dangling link stats fine but doesn't resolve.
+			realPath, _ := ss.client.RealPath(remotePath)
+			setRealPath(result, realPath)
+		}
+		return result, nil
+	})
+}
+
+// sftpExists reports whether a path exists, following symlinks like
+// sftpStat doesn't, so a dangling link doesn't exist. Only not-found is
+// false; permission and connection errors still reject.
+// Called from JS as: GoSSH.sftpExists(sftpId, path) → Promise<{exists, isDir?}>
+func sftpExists(sftpID string, remotePath string) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpExists: %w", err)
+		}
+
+		info, err := ss.client.Stat(remotePath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return map[string]any{"exists": false}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sftpExists: %w", err)
+		}
+		return map[string]any{"exists": true, "isDir": info.IsDir()}, nil
 	})
 }
 
-// sftpMkdir creates a remote directory.
-// Called from JS as: GoSSH.sftpMkdir(sftpId, path) → Promise<void>
-func sftpMkdir(sftpID string, remotePath string) js.Value {
+// sftpMkdir creates a remote directory and any missing parents. mode, if
+// not -1, is applied with chmod to each directory created by this call, so
+// the result doesn't depend on the server's umask; existing directories are
+// left alone.
+// Called from JS as: GoSSH.sftpMkdir(sftpId, path, mode?) → Promise<void>
+func sftpMkdir(sftpID string, remotePath string, mode int) js.Value {
 	return newPromise(func() (any, error) {
 		ss, err := getSFTPSession(sftpID)
 		if err != nil {
 			return nil, err
 		}
-		remotePath, err = validateSFTPPath(remotePath, ss.strict)
+		if err := ss.writable("sftpMkdir"); err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
 		if err != nil {
 			return nil, fmt.Errorf("sftpMkdir: %w", err)
 		}
 
-		if err := ss.client.MkdirAll(remotePath); err != nil {
+		if err := mkdirAll(ss.client, remotePath, mode); err != nil {
 			return nil, fmt.Errorf("sftpMkdir: %w", err)
 		}
 		return nil, nil
 	})
 }
 
+// mkdirAll is MkdirAll that chmods the directories it creates to mode
+// (unless mode is -1).
+func mkdirAll(client *sftp.Client, remotePath string, mode int) error {
+	// Collect the missing directories, deepest first.
+	var missing []string
+	if mode >= 0 {
+		for dir := remotePath; ; dir = pathpkg.Dir(dir) {
+			if _, err := client.Stat(dir); !errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+			missing = append(missing, dir)
+			if parent := pathpkg.Dir(dir); parent == dir {
+				break
+			}
+		}
+	}
+
+	if err := client.MkdirAll(remotePath); err != nil {
+		return err
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := client.Chmod(missing[i], fs.FileMode(mode)); err != nil {
+			return fmt.Errorf("chmod %s: %w", missing[i], err)
+		}
+	}
+	return nil
+}
+
+// sftpEnsureDir makes sure path is a directory: it creates it and any
+// missing parents, errors naming the path component that exists but isn't a
+// directory, and with opts.mode applies the mode to the directory even when
+// it already existed (directories it creates get it too).
+// Called from JS as: GoSSH.sftpEnsureDir(sftpId, path, opts?: {mode}) → Promise<void>
+func sftpEnsureDir(sftpID string, remotePath string, opts js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		if err := ss.writable("sftpEnsureDir"); err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpEnsureDir: %w", err)
+		}
+		mode := jsInt(jsGet(opts, "mode"), -1)
+		if mode < -1 || mode > 0o7777 {
+			return nil, fmt.Errorf("sftpEnsureDir: mode must be between 0 and 07777")
+		}
+
+		if err := mkdirAll(ss.client, remotePath, mode); err != nil {
+			if file := firstNonDir(ss.client, remotePath); file != "" {
+				return nil, fmt.Errorf("sftpEnsureDir: %s exists and is not a directory", file)
+			}
+			return nil, fmt.Errorf("sftpEnsureDir: %w", err)
+		}
+		// MkdirAll accepts an existing path only if it's a directory, but
+		// it may have been replaced since; check what's there now.
+		info, err := ss.client.Stat(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpEnsureDir: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("sftpEnsureDir: %s exists and is not a directory", remotePath)
+		}
+		if mode >= 0 {
+			if err := ss.client.Chmod(remotePath, fs.FileMode(mode)); err != nil {
+				return nil, fmt.Errorf("sftpEnsureDir: chmod: %w", err)
+			}
+		}
+		return nil, nil
+	})
+}
+
+// firstNonDir returns the first component of remotePath, from the root
+// down, that exists but isn't a directory, or "" if there's none.
+func firstNonDir(client *sftp.Client, remotePath string) string {
+	var dirs []string
+	for dir := remotePath; ; dir = pathpkg.Dir(dir) {
+		dirs = append(dirs, dir)
+		if parent := pathpkg.Dir(dir); parent == dir {
+			break
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		info, err := client.Stat(dirs[i])
+		if err != nil {
+			return ""
+		}
+		if !info.IsDir() {
+			return dirs[i]
+		}
+	}
+	return ""
+}
+
 // sftpRemove removes a file or directory (optionally recursive).
-// Called from JS as: GoSSH.sftpRemove(sftpId, path, recursive) → Promise<void>
-func sftpRemove(sftpID string, remotePath string, recursive bool) js.Value {
+// Called from JS as: GoSSH.sftpRemove(sftpId, path, recursive, opts?) → Promise<void>
+func sftpRemove(sftpID string, remotePath string, recursive bool, opts js.Value) js.Value {
 	return newPromise(func() (any, error) {
 		ss, err := getSFTPSession(sftpID)
 		if err != nil {
 			return nil, err
 		}
-		remotePath, err = validateSFTPPath(remotePath, ss.strict)
+		if err := ss.writable("sftpRemove"); err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
 		if err != nil {
 			return nil, fmt.Errorf("sftpRemove: %w", err)
 		}
 
 		if recursive {
-			return nil, removeRecursive(ss.client, remotePath)
+			return nil, removeRecursive(ss.client, remotePath, ss.walkOptions(opts))
 		}
 		if err := ss.client.Remove(remotePath); err != nil {
 			return nil, fmt.Errorf("sftpRemove: %w", err)
@@ -159,56 +515,237 @@ func sftpRemove(sftpID string, remotePath string, recursive bool) js.Value {
 }
 
 // removeRecursive removes a directory and all its contents.
-// Uses Lstat to avoid following symlinks (prevents symlink traversal attacks).
-func removeRecursive(client *sftp.Client, remotePath string) error {
-	info, err := client.Lstat(remotePath)
-	if err != nil {
-		return err
-	}
+// By default symlinks are removed as links and never followed (prevents
+// symlink traversal attacks). With followSymlinks, the contents of linked
+// directories are removed too, but the link itself is still only unlinked.
+func removeRecursive(client *sftp.Client, remotePath string, opts walkOptions) error {
+	return walkPostOrder(client, remotePath, opts, func(p string, info fs.FileInfo, isLink bool) error {
+		if info.IsDir() && !isLink {
+			return client.RemoveDirectory(p)
+		}
+		return client.Remove(p)
+	})
+}
 
-	// If it's a symlink, just remove the link itself — don't follow it.
-	if info.Mode()&fs.ModeSymlink != 0 {
-		return client.Remove(remotePath)
-	}
+// sftpRename renames/moves a remote file or directory. With
+// opts.overwrite, posix-rename@openssh.com replaces an existing newPath
+// atomically; plain SFTP rename fails on many servers when it exists.
+// Called from JS as: GoSSH.sftpRename(sftpId, oldPath, newPath, opts?: {overwrite}) → Promise<void>
+func sftpRename(sftpID string, oldPath, newPath string, opts js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		if err := ss.writable("sftpRename"); err != nil {
+			return nil, err
+		}
+		oldPath, err = ss.validatePath(oldPath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpRename: oldPath: %w", err)
+		}
+		newPath, err = ss.validatePath(newPath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpRename: newPath: %w", err)
+		}
 
-	if !info.IsDir() {
-		return client.Remove(remotePath)
-	}
+		if err := renamePath(ss.client, "sftpRename", oldPath, newPath, jsBool(jsGet(opts, "overwrite"))); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	})
+}
 
-	entries, err := client.ReadDir(remotePath)
-	if err != nil {
-		return err
+// renamePath renames oldPath to newPath, replacing an existing newPath with
+// posix-rename@openssh.com when overwrite is set. Errors are prefixed with op.
+func renamePath(client *sftp.Client, op, oldPath, newPath string, overwrite bool) error {
+	if overwrite {
+		if err := requireExtension(client, op, "posix-rename@openssh.com"); err != nil {
+			return err
+		}
+		if err := client.PosixRename(oldPath, newPath); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
 	}
+	if err := client.Rename(oldPath, newPath); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
 
-	for _, entry := range entries {
-		childPath := pathpkg.Join(remotePath, entry.Name())
-		if err := removeRecursive(client, childPath); err != nil {
-			return err
+// sftpHardlink creates newPath as a hard link to oldPath using the
+// hardlink@openssh.com extension.
+// Called from JS as: GoSSH.sftpHardlink(sftpId, oldPath, newPath) → Promise<void>
+func sftpHardlink(sftpID string, oldPath, newPath string) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		if err := ss.writable("sftpHardlink"); err != nil {
+			return nil, err
+		}
+		oldPath, err = ss.validatePath(oldPath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpHardlink: oldPath: %w", err)
+		}
+		newPath, err = ss.validatePath(newPath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpHardlink: newPath: %w", err)
 		}
+		if err := requireExtension(ss.client, "sftpHardlink", "hardlink@openssh.com"); err != nil {
+			return nil, err
+		}
+
+		if err := ss.client.Link(oldPath, newPath); err != nil {
+			return nil, fmt.Errorf("sftpHardlink: %w", err)
+		}
+		return nil, nil
+	})
+}
+
+// sftpStatVFS reports the capacity of the filesystem holding path, via the
+// statvfs@openssh.com extension. Block counts are converted to bytes using
+// the fundamental block size, as df does.
+// Called from JS as: GoSSH.sftpStatVFS(sftpId, path) → Promise<{totalBytes, freeBytes, availBytes, files, ffree}>
+func sftpStatVFS(sftpID string, remotePath string) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpStatVFS: %w", err)
+		}
+		if err := requireExtension(ss.client, "sftpStatVFS", "statvfs@openssh.com"); err != nil {
+			return nil, err
+		}
+
+		st, err := ss.client.StatVFS(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpStatVFS: %w", err)
+		}
+		return statVFSToJS(st), nil
+	})
+}
+
+// statVFSToJS converts block counts to bytes. Frsize is the unit of the
+// counts; some servers leave it 0, in which case Bsize is.
+func statVFSToJS(st *sftp.StatVFS) map[string]any {
+	unit := st.Frsize
+	if unit == 0 {
+		unit = st.Bsize
 	}
+	return map[string]any{
+		"totalBytes": float64(st.Blocks * unit),
+		"freeBytes":  float64(st.Bfree * unit),
+		"availBytes": float64(st.Bavail * unit),
+		"files":      float64(st.Files),
+		"ffree":      float64(st.Ffree),
+	}
+}
 
-	return client.RemoveDirectory(remotePath)
+// sftpReadlink returns the target of a symbolic link, as stored (it may
+// be relative to the link's directory).
+// Called from JS as: GoSSH.sftpReadlink(sftpId, path) → Promise<string>
+func sftpReadlink(sftpID string, remotePath string) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpReadlink: %w", err)
+		}
+
+		target, err := ss.client.ReadLink(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpReadlink: %w", err)
+		}
+		return target, nil
+	})
 }
 
-// sftpRename renames/moves a remote file or directory.
-// Called from JS as: GoSSH.sftpRename(sftpId, oldPath, newPath) → Promise<void>
-func sftpRename(sftpID string, oldPath, newPath string) js.Value {
+// sftpSymlink creates newPath as a symbolic link to target. The target is
+// stored verbatim and resolved only when the link is followed, so in
+// strict mode it must itself pass the path rules: a relative or ".."
+// target could lead outside what strict mode allows. With a rootPrefix,
+// the target must also lead somewhere under the root.
+// Called from JS as: GoSSH.sftpSymlink(sftpId, target, newPath) → Promise<void>
+func sftpSymlink(sftpID string, target, newPath string) js.Value {
 	return newPromise(func() (any, error) {
 		ss, err := getSFTPSession(sftpID)
 		if err != nil {
 			return nil, err
 		}
-		oldPath, err = validateSFTPPath(oldPath, ss.strict)
+		if err := ss.writable("sftpSymlink"); err != nil {
+			return nil, err
+		}
+		// The target is checked against the root below, from the link.
+		target, err = validateSFTPPath(target, ss.strict)
 		if err != nil {
-			return nil, fmt.Errorf("sftpRename: oldPath: %w", err)
+			if ss.strict {
+				return nil, fmt.Errorf("sftpSymlink: target: %w (strict mode requires absolute link targets)", err)
+			}
+			return nil, fmt.Errorf("sftpSymlink: target: %w", err)
 		}
-		newPath, err = validateSFTPPath(newPath, ss.strict)
+		newPath, err = ss.validatePath(newPath)
 		if err != nil {
-			return nil, fmt.Errorf("sftpRename: newPath: %w", err)
+			return nil, fmt.Errorf("sftpSymlink: newPath: %w", err)
+		}
+		if err := ss.confineLinkTarget(target, newPath); err != nil {
+			return nil, fmt.Errorf("sftpSymlink: target: %w", err)
+		}
+
+		if err := ss.client.Symlink(target, newPath); err != nil {
+			return nil, fmt.Errorf("sftpSymlink: %w", err)
+		}
+		return nil, nil
+	})
+}
+
+// requireExtension fails with SFTP_EXTENSION_UNSUPPORTED when the server
+// didn't advertise the named protocol extension.
+func requireExtension(client *sftp.Client, op, name string) error {
+	if _, ok := client.HasExtension(name); ok {
+		return nil
+	}
+	return &codedError{
+		code: errCodeSFTPExtension,
+		msg:  fmt.Sprintf("%s: not supported by the server (no %s extension)", op, name),
+	}
+}
+
+// sftpTruncate sets the size of a remote file, shrinking it or extending it
+// with zeros.
+// Called from JS as: GoSSH.sftpTruncate(sftpId, path, size) → Promise<void>
+func sftpTruncate(sftpID string, remotePath string, size float64) js.Value {
+	return newPromise(func() (any, error) {
+		if size < 0 || size > maxSafeOffset || size != math.Trunc(size) {
+			return nil, fmt.Errorf("sftpTruncate: size must be a non-negative integer")
+		}
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		if err := ss.writable("sftpTruncate"); err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpTruncate: %w", err)
 		}
 
-		if err := ss.client.Rename(oldPath, newPath); err != nil {
-			return nil, fmt.Errorf("sftpRename: %w", err)
+		if err := ss.client.Truncate(remotePath, int64(size)); err != nil {
+			// Servers report truncating a directory as a generic failure;
+			// say what was wrong when that's the cause.
+			if info, serr := ss.client.Stat(remotePath); serr == nil && !info.Mode().IsRegular() {
+				return nil, fmt.Errorf("sftpTruncate: %s is not a regular file", remotePath)
+			}
+			return nil, fmt.Errorf("sftpTruncate: %w", err)
 		}
 		return nil, nil
 	})
@@ -222,7 +759,10 @@ func sftpChmod(sftpID string, remotePath string, mode uint32) js.Value {
 		if err != nil {
 			return nil, err
 		}
-		remotePath, err = validateSFTPPath(remotePath, ss.strict)
+		if err := ss.writable("sftpChmod"); err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
 		if err != nil {
 			return nil, fmt.Errorf("sftpChmod: %w", err)
 		}
@@ -234,6 +774,97 @@ func sftpChmod(sftpID string, remotePath string, mode uint32) js.Value {
 	})
 }
 
+// sftpChown changes the owner and group of a remote file.
+// Called from JS as: GoSSH.sftpChown(sftpId, path, uid, gid) → Promise<void>
+func sftpChown(sftpID string, remotePath string, uid, gid int) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		if err := ss.writable("sftpChown"); err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpChown: %w", err)
+		}
+
+		if err := ss.client.Chown(remotePath, uid, gid); err != nil {
+			return nil, fmt.Errorf("sftpChown: %w", err)
+		}
+		return nil, nil
+	})
+}
+
+// maxSFTPTimeMillis is the latest time SFTP v3 can carry: attributes hold
+// unsigned 32-bit seconds.
+const maxSFTPTimeMillis = math.MaxUint32 * 1000
+
+// parseMillis reads a JS millisecond timestamp. ok is false for
+// null/undefined.
+func parseMillis(v js.Value) (t time.Time, ok bool, err error) {
+	if v.IsUndefined() || v.IsNull() {
+		return time.Time{}, false, nil
+	}
+	if v.Type() != js.TypeNumber {
+		return time.Time{}, false, fmt.Errorf("timestamp must be a number of milliseconds")
+	}
+	ms := v.Float()
+	if math.IsNaN(ms) || ms < 0 || ms > maxSFTPTimeMillis {
+		return time.Time{}, false, fmt.Errorf("timestamp must be between 0 and %d", int64(maxSFTPTimeMillis))
+	}
+	return time.UnixMilli(int64(ms)), true, nil
+}
+
+// sftpChtimes sets the access and modification times of a remote file.
+// atime may be null to keep the current access time. SFTP v3 stores whole
+// seconds, so milliseconds are truncated.
+// Called from JS as: GoSSH.sftpChtimes(sftpId, path, atimeMs | null, mtimeMs) → Promise<void>
+func sftpChtimes(sftpID string, remotePath string, atimeMs, mtimeMs js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		if err := ss.writable("sftpChtimes"); err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpChtimes: %w", err)
+		}
+		mtime, ok, err := parseMillis(mtimeMs)
+		if err != nil {
+			return nil, fmt.Errorf("sftpChtimes: mtime: %w", err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("sftpChtimes: mtime is required")
+		}
+		atime, ok, err := parseMillis(atimeMs)
+		if err != nil {
+			return nil, fmt.Errorf("sftpChtimes: atime: %w", err)
+		}
+		if !ok {
+			// The protocol sets both times at once; keep the current atime.
+			info, err := ss.client.Stat(remotePath)
+			if err != nil {
+				return nil, fmt.Errorf("sftpChtimes: stat: %w", err)
+			}
+			st, isStat := info.Sys().(*sftp.FileStat)
+			if !isStat {
+				return nil, fmt.Errorf("sftpChtimes: server did not report the access time")
+			}
+			atime = time.Unix(int64(st.Atime), 0)
+		}
+
+		if err := ss.client.Chtimes(remotePath, atime, mtime); err != nil {
+			return nil, fmt.Errorf("sftpChtimes: %w", err)
+		}
+		return nil, nil
+	})
+}
+
 // sftpGetwd returns the current working directory (home) for an SFTP session.
 // Called from JS as: GoSSH.sftpGetwd(sftpId) → Promise<string>
 func sftpGetwd(sftpID string) js.Value {
@@ -252,6 +883,7 @@ func sftpGetwd(sftpID string) js.Value {
 }
 
 // sftpRealPath resolves a path to its absolute form on the remote server.
+// With a rootPrefix, a path resolving outside it rejects.
 // Called from JS as: GoSSH.sftpRealPath(sftpId, path) → Promise<string>
 func sftpRealPath(sftpID string, remotePath string) js.Value {
 	return newPromise(func() (any, error) {
@@ -259,6 +891,11 @@ func sftpRealPath(sftpID string, remotePath string) js.Value {
 		if err != nil {
 			return nil, err
 		}
+		if ss.root != "" {
+			if remotePath, err = ss.validatePath(remotePath); err != nil {
+				return nil, fmt.Errorf("sftpRealPath: %w", err)
+			}
+		}
 
 		resolved, err := ss.client.RealPath(remotePath)
 		if err != nil {
@@ -268,6 +905,31 @@ func sftpRealPath(sftpID string, remotePath string) js.Value {
 	})
 }
 
+// findSFTPSession returns any open SFTP session on the given SSH session
+// with the given readOnly setting, or nil if there is none.
+func findSFTPSession(sessionID string, readOnly bool, root string) *sftpSession {
+	var found *sftpSession
+	sftpStore.Range(func(key, val any) bool {
+		ss := val.(*sftpSession)
+		if ss.sessionID == sessionID && ss.readOnly == readOnly && ss.root == root {
+			found = ss
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// writable fails with an SFTP_READ_ONLY error naming op if the session
+// was opened read-only. Every operation that changes the remote calls it
+// before doing anything else.
+func (ss *sftpSession) writable(op string) error {
+	if ss.readOnly {
+		return &codedError{code: errCodeSFTPReadOnly, msg: op + ": read-only SFTP session"}
+	}
+	return nil
+}
+
 // getSFTPSession retrieves an SFTP session by ID.
 func getSFTPSession(sftpID string) (*sftpSession, error) {
 	val, ok := sftpStore.Load(sftpID)
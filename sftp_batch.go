@@ -0,0 +1,130 @@
+// sftp_batch.go runs a list of SFTP file operations in one call: removes,
+// chmods, and renames, in order, over the one connection. A file manager
+// acting on a selection makes one JS→Go call instead of one per file and
+// gets back a result per operation, so a partial failure is easy to report.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall/js"
+)
+
+// maxBatchOps bounds the operations in one sftpBatch.
+const maxBatchOps = 10000
+
+// errBatchSkipped is the result of an operation not run because an earlier
+// one failed with abortOnError, or the batch was aborted.
+var errBatchSkipped = errors.New("skipped")
+
+// sftpBatch runs ops in order. Each op is one of
+//
+//	{op: 'remove', path, recursive?}
+//	{op: 'chmod', path, mode}
+//	{op: 'rename', oldPath, newPath, overwrite?}
+//
+// and gets a result at the same index: {ok: true}, or {ok: false, error,
+// code?}. A failed op doesn't stop the rest unless opts.abortOnError is set;
+// ops not run then, or after opts.signal aborts, are {ok: false, skipped: true}.
+// Called from JS as:
+//
+//	GoSSH.sftpBatch(sftpId, ops, opts?: {abortOnError, signal}) → Promise<{ok, error?, code?, skipped?}[]>
+func sftpBatch(sftpID string, ops js.Value, opts js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		if err := ss.writable("sftpBatch"); err != nil {
+			return nil, err
+		}
+		if ops.Type() != js.TypeObject || ops.Get("length").IsUndefined() {
+			return nil, fmt.Errorf("sftpBatch: ops must be an array")
+		}
+		if ops.Length() > maxBatchOps {
+			return nil, fmt.Errorf("sftpBatch: at most %d ops", maxBatchOps)
+		}
+		abortOnError := jsBool(jsGet(opts, "abortOnError"))
+		signal := jsGet(opts, "signal")
+
+		results := js.Global().Get("Array").New(ops.Length())
+		stopped := false
+		for i := 0; i < ops.Length(); i++ {
+			err := errBatchSkipped
+			if !stopped && !isAborted(signal) {
+				err = ss.runBatchOp(ops.Index(i), signal)
+				stopped = err != nil && abortOnError
+			}
+			results.SetIndex(i, batchResult(err))
+		}
+		return results, nil
+	})
+}
+
+// runBatchOp runs one sftpBatch operation.
+func (ss *sftpSession) runBatchOp(op js.Value, signal js.Value) error {
+	path := func(name string) (string, error) {
+		p, err := ss.validatePath(jsString(jsGet(op, name)))
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+		return p, nil
+	}
+
+	switch kind := jsString(jsGet(op, "op")); kind {
+	case "remove":
+		p, err := path("path")
+		if err != nil {
+			return err
+		}
+		if jsBool(jsGet(op, "recursive")) {
+			return removeRecursive(ss.client, p, walkOptions{signal: signal})
+		}
+		return ss.client.Remove(p)
+
+	case "chmod":
+		p, err := path("path")
+		if err != nil {
+			return err
+		}
+		mode := jsInt(jsGet(op, "mode"), -1)
+		if mode < 0 || mode > 0o7777 {
+			return fmt.Errorf("mode must be between 0 and 07777")
+		}
+		return ss.client.Chmod(p, fs.FileMode(mode))
+
+	case "rename":
+		oldPath, err := path("oldPath")
+		if err != nil {
+			return err
+		}
+		newPath, err := path("newPath")
+		if err != nil {
+			return err
+		}
+		return renamePath(ss.client, "rename", oldPath, newPath, jsBool(jsGet(op, "overwrite")))
+
+	default:
+		return fmt.Errorf("unknown op %q (use remove, chmod, or rename)", kind)
+	}
+}
+
+// batchResult is the JS result for an operation that returned err.
+func batchResult(err error) map[string]any {
+	if err == nil {
+		return map[string]any{"ok": true}
+	}
+	if err == errBatchSkipped {
+		return map[string]any{"ok": false, "skipped": true}
+	}
+	result := map[string]any{"ok": false, "error": err.Error()}
+	var ce *codedError
+	if errors.As(err, &ce) {
+		result["code"] = ce.code
+	}
+	return result
+}
@@ -0,0 +1,96 @@
+// sftp_checksum.go computes digests of remote files so a transfer can be
+// verified without a second full download into JS. The file is streamed
+// through the hash in transfer-sized chunks; nothing is buffered whole.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"syscall/js"
+)
+
+// newChecksumHash returns the hash for a checksum algorithm name.
+func newChecksumHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "md5":
+		return md5.New(), nil
+	case "crc32":
+		return crc32.NewIEEE(), nil
+	}
+	return nil, fmt.Errorf("unsupported algorithm %q (want sha256, sha512, md5, or crc32)", algorithm)
+}
+
+// sftpChecksum returns the lowercase hex digest of a remote file. crc32 is
+// the IEEE polynomial, as used by zip and gzip.
+// Called from JS as:
+//
+//	GoSSH.sftpChecksum(sftpId, path, algorithm, onProgress?, signal?: AbortSignal) → Promise<string>
+func sftpChecksum(sftpID, remotePath, algorithm string, onProgress js.Value, signal js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		h, err := newChecksumHash(algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("sftpChecksum: %w", err)
+		}
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpChecksum: %w", err)
+		}
+		f, err := ss.client.Open(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpChecksum: open: %w", err)
+		}
+		defer closeQuietly(f)
+		info, err := f.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("sftpChecksum: stat: %w", err)
+		}
+		if err := hashReader(h, f, info.Size(), onProgress, signal); err != nil {
+			return nil, fmt.Errorf("sftpChecksum: %w", err)
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	})
+}
+
+// hashReader feeds r into h chunk by chunk, reporting onProgress(read, total)
+// after each and stopping when signal is aborted.
+func hashReader(h hash.Hash, r io.Reader, total int64, onProgress js.Value, signal js.Value) error {
+	hasProgress := hasProgressFn(onProgress)
+	chunk := make([]byte, transferChunkSize)
+	var read int64
+	for {
+		if isAborted(signal) {
+			return errTransferCancelled
+		}
+		n, err := r.Read(chunk)
+		if n > 0 {
+			h.Write(chunk[:n])
+			read += int64(n)
+			if hasProgress {
+				onProgress.Invoke(float64(read), float64(total))
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read: %w", err)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// sftp_file.go exposes open SFTP file handles for random access: reading a
+// byte range of a large file, or patching part of one in place, without
+// transferring the whole file.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"syscall/js"
+
+	"github.com/pkg/sftp"
+)
+
+const (
+	// maxFileIOLength bounds one sftpFileReadAt or sftpFileWriteAt.
+	maxFileIOLength = 16 * 1024 * 1024
+	// maxFileHandles bounds open handles per SFTP session.
+	maxFileHandles = 64
+	// maxSafeOffset is the largest offset a JS number holds exactly.
+	maxSafeOffset = 1<<53 - 1
+)
+
+// fileHandleStore tracks open file handles.
+var fileHandleStore sync.Map // handleID → *fileHandle
+
+// fileHandle is a remote file opened with sftpFileOpen.
+type fileHandle struct {
+	id     string
+	sftpID string
+	ss     *sftpSession // holds the handle's slot in ss.handles
+	file   *sftp.File
+}
+
+// openFlags maps an fopen-style mode to os.OpenFile flags: "r", "r+",
+// "w", "w+", "a", "a+", with an optional "x" after the first letter
+// ("wx", "wx+") to fail if the file exists.
+func openFlags(mode string) (int, error) {
+	flags := map[string]int{
+		"r":   os.O_RDONLY,
+		"r+":  os.O_RDWR,
+		"w":   os.O_WRONLY | os.O_CREATE | os.O_TRUNC,
+		"w+":  os.O_RDWR | os.O_CREATE | os.O_TRUNC,
+		"wx":  os.O_WRONLY | os.O_CREATE | os.O_EXCL,
+		"wx+": os.O_RDWR | os.O_CREATE | os.O_EXCL,
+		"a":   os.O_WRONLY | os.O_CREATE | os.O_APPEND,
+		"a+":  os.O_RDWR | os.O_CREATE | os.O_APPEND,
+		"ax":  os.O_WRONLY | os.O_CREATE | os.O_APPEND | os.O_EXCL,
+		"ax+": os.O_RDWR | os.O_CREATE | os.O_APPEND | os.O_EXCL,
+	}
+	f, ok := flags[mode]
+	if !ok {
+		return 0, fmt.Errorf("unsupported flags %q (use r, r+, w, w+, a, a+; x after w or a for exclusive create)", mode)
+	}
+	return f, nil
+}
+
+// validateOffset checks a byte offset passed from JS.
+func validateOffset(offset float64) (int64, error) {
+	if offset < 0 || offset > maxSafeOffset || offset != math.Trunc(offset) {
+		return 0, fmt.Errorf("offset must be a non-negative integer")
+	}
+	return int64(offset), nil
+}
+
+// sftpFileOpen opens a remote file and returns a handle ID for
+// sftpFileReadAt/WriteAt. flags defaults to "r".
+// Called from JS as: GoSSH.sftpFileOpen(sftpId, path, flags?) → Promise<handleId>
+func sftpFileOpen(sftpID, remotePath, mode string) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpFileOpen: %w", err)
+		}
+		if mode == "" {
+			mode = "r"
+		}
+		flags, err := openFlags(mode)
+		if err != nil {
+			return nil, fmt.Errorf("sftpFileOpen: %w", err)
+		}
+		if flags != os.O_RDONLY {
+			if err := ss.writable("sftpFileOpen"); err != nil {
+				return nil, err
+			}
+		}
+		// Reserve the slot before opening, so concurrent opens can't all
+		// pass the check.
+		if ss.handles.Add(1) > maxFileHandles {
+			ss.handles.Add(-1)
+			return nil, fmt.Errorf("sftpFileOpen: too many open files (max %d per SFTP session)", maxFileHandles)
+		}
+
+		f, err := ss.client.OpenFile(remotePath, flags)
+		if err != nil {
+			ss.handles.Add(-1)
+			return nil, fmt.Errorf("sftpFileOpen: %w", err)
+		}
+		h := &fileHandle{id: generateID(), sftpID: sftpID, ss: ss, file: f}
+		fileHandleStore.Store(h.id, h)
+		return h.id, nil
+	})
+}
+
+// getFileHandle retrieves an open file handle by ID.
+func getFileHandle(handleID string) (*fileHandle, error) {
+	val, ok := fileHandleStore.Load(handleID)
+	if !ok {
+		return nil, fmt.Errorf("file handle %q not found", handleID)
+	}
+	return val.(*fileHandle), nil
+}
+
+// sftpFileReadAt reads up to length bytes at offset. The result is shorter
+// than length only at end of file, and empty past it.
+// Called from JS as: GoSSH.sftpFileReadAt(handleId, offset, length) → Promise<Uint8Array>
+func sftpFileReadAt(handleID string, offset float64, length int) js.Value {
+	return newPromise(func() (any, error) {
+		h, err := getFileHandle(handleID)
+		if err != nil {
+			return nil, fmt.Errorf("sftpFileReadAt: %w", err)
+		}
+		off, err := validateOffset(offset)
+		if err != nil {
+			return nil, fmt.Errorf("sftpFileReadAt: %w", err)
+		}
+		if length < 0 || length > maxFileIOLength {
+			return nil, fmt.Errorf("sftpFileReadAt: length must be between 0 and %d", maxFileIOLength)
+		}
+
+		buf := make([]byte, length)
+		n, err := h.file.ReadAt(buf, off)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("sftpFileReadAt: %w", err)
+		}
+		return bytesToUint8Array(buf[:n]), nil
+	})
+}
+
+// sftpFileWriteAt writes data at offset.
+// Called from JS as: GoSSH.sftpFileWriteAt(handleId, offset, data: Uint8Array) → Promise<void>
+func sftpFileWriteAt(handleID string, offset float64, data js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		h, err := getFileHandle(handleID)
+		if err != nil {
+			return nil, fmt.Errorf("sftpFileWriteAt: %w", err)
+		}
+		off, err := validateOffset(offset)
+		if err != nil {
+			return nil, fmt.Errorf("sftpFileWriteAt: %w", err)
+		}
+		if n := data.Get("byteLength").Int(); n > maxFileIOLength {
+			return nil, fmt.Errorf("sftpFileWriteAt: data too large (%d bytes, max %d)", n, maxFileIOLength)
+		}
+
+		buf := uint8ArrayToBytes(data)
+		defer scrubBytes(buf)
+		if _, err := h.file.WriteAt(buf, off); err != nil {
+			return nil, fmt.Errorf("sftpFileWriteAt: %w", err)
+		}
+		return nil, nil
+	})
+}
+
+// sftpFileClose closes a file handle. Unknown IDs are ignored.
+// Called from JS as: GoSSH.sftpFileClose(handleId) → Promise<void>
+func sftpFileClose(handleID string) js.Value {
+	return newPromise(func() (any, error) {
+		val, ok := fileHandleStore.LoadAndDelete(handleID)
+		if !ok {
+			return nil, nil
+		}
+		h := val.(*fileHandle)
+		h.ss.handles.Add(-1)
+		if err := h.file.Close(); err != nil {
+			return nil, fmt.Errorf("sftpFileClose: %w", err)
+		}
+		return nil, nil
+	})
+}
+
+// closeFileHandlesForSFTP closes every handle opened on an SFTP session.
+func closeFileHandlesForSFTP(sftpID string) {
+	fileHandleStore.Range(func(key, val any) bool {
+		if h := val.(*fileHandle); h.sftpID == sftpID {
+			if _, ok := fileHandleStore.LoadAndDelete(key); ok {
+				h.ss.handles.Add(-1)
+				closeQuietly(h.file)
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,137 @@
+// sftp_root.go confines an SFTP session to a subtree: with sftpOpen's
+// rootPrefix, every path an operation names must lie under the prefix,
+// both as written and once the server has resolved its symlinks. Links
+// met along the way are held to the same rule: a tree walk won't follow
+// one that leads out, and a resolved path outside is never reported. The
+// check happens before each request, so it guards against links already
+// present, not against another process swapping one in between the check
+// and the operation; a hard boundary needs a chroot on the server.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	pathpkg "path"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// parseRootPrefix cleans sftpOpen's rootPrefix. "" means no confinement.
+func parseRootPrefix(rootPrefix string) (string, error) {
+	if rootPrefix == "" {
+		return "", nil
+	}
+	if strings.Contains(rootPrefix, "\x00") || containsCRLF(rootPrefix) {
+		return "", fmt.Errorf("rootPrefix contains invalid characters")
+	}
+	if !pathpkg.IsAbs(rootPrefix) {
+		return "", fmt.Errorf("rootPrefix must be an absolute path")
+	}
+	return pathpkg.Clean(rootPrefix), nil
+}
+
+// withinRoot reports whether p is root or below it. Both are clean.
+func withinRoot(p, root string) bool {
+	return p == root || root == "/" || strings.HasPrefix(p, root+"/")
+}
+
+// outsideRoot is the error for a path that escapes the session's root.
+func (ss *sftpSession) outsideRoot(p string) error {
+	return &codedError{code: errCodeSFTPOutsideRoot, msg: fmt.Sprintf("%s is outside rootPrefix %s", p, ss.root)}
+}
+
+// validatePath applies validateSFTPPath and, with a rootPrefix, requires
+// the path to be absolute and to stay under the root (see confine). The
+// returned path is the one to use.
+func (ss *sftpSession) validatePath(remotePath string) (string, error) {
+	remotePath, err := validateSFTPPath(remotePath, ss.strict)
+	if err != nil || ss.root == "" {
+		return remotePath, err
+	}
+	if !pathpkg.IsAbs(remotePath) {
+		return "", fmt.Errorf("rootPrefix: absolute path required")
+	}
+	remotePath = pathpkg.Clean(remotePath)
+	if err := ss.confine(remotePath); err != nil {
+		return "", err
+	}
+	return remotePath, nil
+}
+
+// confine checks a clean absolute path against the root: lexically, then
+// as the server resolves it. A path that doesn't exist yet is judged by
+// its deepest existing ancestor, so a file created through a symlinked
+// directory is caught too. A link the server can't resolve (dangling, or
+// a loop) is rejected, since where it leads can't be checked.
+func (ss *sftpSession) confine(p string) error {
+	if !withinRoot(p, ss.root) {
+		return ss.outsideRoot(p)
+	}
+	q := p
+	real := ss.realRoot
+	for q != ss.root {
+		r, err := ss.client.RealPath(q)
+		if err == nil {
+			real = pathpkg.Clean(r)
+			break
+		}
+		if _, lerr := ss.client.Lstat(q); !errors.Is(lerr, fs.ErrNotExist) {
+			if lerr == nil {
+				return fmt.Errorf("%s: can't be resolved to check it against rootPrefix: %w", q, err)
+			}
+			return lerr
+		}
+		q = pathpkg.Dir(q)
+	}
+	if !withinRoot(real, ss.realRoot) {
+		return ss.outsideRoot(p)
+	}
+	return nil
+}
+
+// confineLinkTarget checks where a symlink created at linkPath would
+// lead. A relative target is taken from the link's directory.
+func (ss *sftpSession) confineLinkTarget(target, linkPath string) error {
+	if ss.root == "" {
+		return nil
+	}
+	if !pathpkg.IsAbs(target) {
+		target = pathpkg.Join(pathpkg.Dir(linkPath), target)
+	}
+	return ss.confine(pathpkg.Clean(target))
+}
+
+// resolveRoot returns the server's canonical path for the root directory,
+// which must exist.
+func resolveRoot(client *sftp.Client, root string) (string, error) {
+	info, err := client.Stat(root)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", root)
+	}
+	real, err := client.RealPath(root)
+	if err != nil {
+		return "", err
+	}
+	return pathpkg.Clean(real), nil
+}
+
+// hideOutsideRoot blanks the resolved paths that lie outside the root, so
+// a listing doesn't reveal where links inside it lead.
+func (ss *sftpSession) hideOutsideRoot(realPaths []string) {
+	if ss.root == "" {
+		return
+	}
+	for i, p := range realPaths {
+		if p != "" && !withinRoot(pathpkg.Clean(p), ss.realRoot) {
+			realPaths[i] = ""
+		}
+	}
+}
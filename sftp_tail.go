@@ -0,0 +1,273 @@
+// sftp_tail.go implements polling-based `tail -f` over SFTP for one or more
+// remote files, multiplexed into a single subscription.
+//
+// Each poll Stats every file and only opens it when it has grown, so an idle
+// tail costs one round-trip per file per interval. A file that shrinks below
+// the last read offset is treated as truncated or rotated and re-read from
+// the start.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+const (
+	// defaultTailPollInterval is the default time between size checks.
+	defaultTailPollInterval = time.Second
+	// minTailPollInterval keeps a tail from hammering the server.
+	minTailPollInterval = 100 * time.Millisecond
+	// maxTailFiles bounds the number of files in one subscription.
+	maxTailFiles = 32
+	// maxTailReadPerPoll bounds bytes delivered per file per poll so a
+	// fast-growing log can't starve the others or balloon WASM memory.
+	maxTailReadPerPoll = 1024 * 1024
+	// tailCheckBytes is how much of the data before the read position is
+	// kept and compared on each change, to notice a replaced file.
+	tailCheckBytes = 64
+)
+
+// activeTails tracks running tail subscriptions.
+var activeTails sync.Map // tailID → *tailState
+
+type tailState struct {
+	id      string
+	sftpID  string
+	cancel  context.CancelFunc
+	onData  js.Value // callback({path, bytes: Uint8Array})
+	onError js.Value // optional callback({path, message})
+}
+
+// tailFile is the per-path read position.
+type tailFile struct {
+	path   string
+	offset int64
+	mtime  time.Time
+	// last holds up to tailCheckBytes ending at offset. SFTP reports no
+	// inode, so a rotated file is recognized by these bytes changing.
+	last   []byte
+	failed bool // last poll failed; suppresses repeated onError calls
+}
+
+// sftpTailMany starts tailing several remote files, delivering new bytes
+// tagged with their source path. Tailing starts at each file's current end;
+// files that don't exist yet are picked up when they appear.
+// Called from JS as:
+//
+//	GoSSH.sftpTailMany(sftpId, paths: string[], {pollMs?, onData, onError?}) → Promise<tailId>
+func sftpTailMany(sftpID string, paths js.Value, opts js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		onData, ok := getCallback(opts, "onData")
+		if !ok {
+			return nil, fmt.Errorf("sftpTailMany: onData callback required")
+		}
+		onError, _ := getCallback(opts, "onError")
+
+		interval := defaultTailPollInterval
+		if ms := jsInt(jsGet(opts, "pollMs"), 0); ms > 0 {
+			interval = time.Duration(ms) * time.Millisecond
+		}
+		if interval < minTailPollInterval {
+			interval = minTailPollInterval
+		}
+
+		if paths.Type() != js.TypeObject || paths.Get("length").IsUndefined() {
+			return nil, fmt.Errorf("sftpTailMany: paths must be an array")
+		}
+		n := paths.Length()
+		if n == 0 || n > maxTailFiles {
+			return nil, fmt.Errorf("sftpTailMany: between 1 and %d paths required", maxTailFiles)
+		}
+
+		seen := make(map[string]bool, n)
+		files := make([]*tailFile, 0, n)
+		for i := 0; i < n; i++ {
+			p, err := ss.validatePath(jsString(paths.Index(i)))
+			if err != nil {
+				return nil, fmt.Errorf("sftpTailMany: paths[%d]: %w", i, err)
+			}
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+
+			tf := &tailFile{path: p}
+			tf.start(ss)
+			files = append(files, tf)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		tailID := generateID()
+		t := &tailState{
+			id:      tailID,
+			sftpID:  sftpID,
+			cancel:  cancel,
+			onData:  onData,
+			onError: onError,
+		}
+		activeTails.Store(tailID, t)
+
+		spawn("sftp.tail", func() { t.run(ctx, files, interval) })
+
+		return tailID, nil
+	})
+}
+
+// run polls all files until the tail is stopped or its SFTP session closes.
+func (t *tailState) run(ctx context.Context, files []*tailFile, interval time.Duration) {
+	defer t.stop()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ss, err := getSFTPSession(t.sftpID)
+		if err != nil {
+			return
+		}
+		for _, tf := range files {
+			if ctx.Err() != nil {
+				return
+			}
+			data, err := tf.poll(ss)
+			if err != nil {
+				if !tf.failed && t.onError.Type() == js.TypeFunction {
+					t.onError.Invoke(js.ValueOf(map[string]any{
+						"path":    tf.path,
+						"message": err.Error(),
+					}))
+				}
+				tf.failed = true
+				continue
+			}
+			tf.failed = false
+			if len(data) > 0 {
+				t.onData.Invoke(js.ValueOf(map[string]any{
+					"path":  tf.path,
+					"bytes": bytesToUint8Array(data),
+				}))
+			}
+		}
+	}
+}
+
+// start positions tf at the current end of the file, if it exists.
+func (tf *tailFile) start(ss *sftpSession) {
+	info, err := ss.client.Stat(tf.path)
+	if err != nil {
+		return
+	}
+	tf.offset, tf.mtime = info.Size(), info.ModTime()
+	f, err := ss.client.Open(tf.path)
+	if err != nil {
+		return
+	}
+	defer closeQuietly(f)
+	n := min(tf.offset, tailCheckBytes)
+	buf := make([]byte, n)
+	if _, err := f.ReadAt(buf, tf.offset-n); err == nil {
+		tf.last = buf
+	}
+}
+
+// poll returns bytes appended since the last poll. When the file was
+// truncated or replaced (it shrank, or the bytes before the read position
+// changed, as after copytruncate or rename-and-recreate), it restarts from
+// offset 0.
+func (tf *tailFile) poll(ss *sftpSession) ([]byte, error) {
+	info, err := ss.client.Stat(tf.path)
+	if err != nil {
+		return nil, err
+	}
+	size, mtime := info.Size(), info.ModTime()
+	if size == tf.offset && mtime.Equal(tf.mtime) {
+		return nil, nil
+	}
+	tf.mtime = mtime
+
+	f, err := ss.client.Open(tf.path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeQuietly(f)
+	if size < tf.offset || !tf.unchanged(f) {
+		tf.offset, tf.last = 0, nil
+	}
+	if size == tf.offset {
+		return nil, nil
+	}
+
+	want := size - tf.offset
+	if want > maxTailReadPerPoll {
+		want = maxTailReadPerPoll
+	}
+	buf := make([]byte, want)
+	n, err := f.ReadAt(buf, tf.offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	tf.offset += int64(n)
+	tf.remember(buf[:n])
+	return buf[:n], nil
+}
+
+// unchanged reports whether the bytes before the read position are still
+// the ones last read from them.
+func (tf *tailFile) unchanged(f io.ReaderAt) bool {
+	if len(tf.last) == 0 {
+		return true
+	}
+	buf := make([]byte, len(tf.last))
+	n, err := f.ReadAt(buf, tf.offset-int64(len(tf.last)))
+	if n < len(buf) && err != nil {
+		return false
+	}
+	return bytes.Equal(buf, tf.last)
+}
+
+// remember keeps the last tailCheckBytes read.
+func (tf *tailFile) remember(data []byte) {
+	last := append(tf.last, data...)
+	tf.last = append([]byte(nil), last[max(0, len(last)-tailCheckBytes):]...)
+}
+
+// stop ends the tail and removes it from activeTails. Safe to call repeatedly.
+func (t *tailState) stop() {
+	t.cancel()
+	activeTails.Delete(t.id)
+}
+
+// sftpTailStop stops a tail subscription started by sftpTailMany.
+// Called from JS as: GoSSH.sftpTailStop(tailId)
+func sftpTailStop(tailID string) {
+	if val, ok := activeTails.Load(tailID); ok {
+		val.(*tailState).stop()
+	}
+}
+
+// stopTailsForSFTP stops every tail running on the given SFTP session.
+func stopTailsForSFTP(sftpID string) {
+	activeTails.Range(func(key, val any) bool {
+		if t := val.(*tailState); t.sftpID == sftpID {
+			t.stop()
+		}
+		return true
+	})
+}
@@ -10,12 +10,17 @@
 package gossh
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"sync"
 	"sync/atomic"
 	"syscall/js"
 	"time"
+
+	"github.com/pkg/sftp"
 )
 
 const (
@@ -29,19 +34,31 @@ const (
 	// maxUploadSize is the maximum file size for non-streaming sftpUpload.
 	// For larger files use sftpUploadStream* APIs.
 	maxUploadSize = 512 * 1024 * 1024 // 512 MB
+
+	// defaultStreamIdleTimeout is how long sftpDownloadStream waits without
+	// a _streamPull before giving up. It covers the browser's save dialog
+	// before the first pull, so it is generous; an active download never
+	// hits it regardless of size.
+	defaultStreamIdleTimeout = 5 * time.Minute
+	// streamProgressInterval throttles onProgress during streaming downloads.
+	streamProgressInterval = 250 * time.Millisecond
 )
 
 // sftpUpload uploads data from a JS Uint8Array to a remote file.
+// opts.adaptiveChunks sizes chunks from measured throughput (see chunking.go).
 // Called from JS as:
 //
-//	GoSSH.sftpUpload(sftpId, remotePath, data: Uint8Array, onProgress?, signal?: AbortSignal) → Promise<void>
-func sftpUpload(sftpID string, remotePath string, data js.Value, onProgress js.Value, signal js.Value) js.Value {
+//	GoSSH.sftpUpload(sftpId, remotePath, data: Uint8Array, onProgress?, signal?: AbortSignal, opts?: {adaptiveChunks}) → Promise<void>
+func sftpUpload(sftpID string, remotePath string, data js.Value, onProgress js.Value, signal js.Value, opts js.Value) js.Value {
 	return newPromise(func() (any, error) {
 		ss, err := getSFTPSession(sftpID)
 		if err != nil {
 			return nil, err
 		}
-		remotePath, err = validateSFTPPath(remotePath, ss.strict)
+		if err := ss.writable("sftpUpload"); err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
 		if err != nil {
 			return nil, fmt.Errorf("sftpUpload: %w", err)
 		}
@@ -51,6 +68,7 @@ func sftpUpload(sftpID string, remotePath string, data js.Value, onProgress js.V
 		if totalSize > maxUploadSize {
 			return nil, fmt.Errorf("sftpUpload: file too large (%d bytes, max %d). Use sftpUploadStreamStart for large files", totalSize, maxUploadSize)
 		}
+		defer afterTransfer(int64(totalSize))
 
 		// Create remote file.
 		f, err := ss.client.Create(remotePath)
@@ -60,50 +78,68 @@ func sftpUpload(sftpID string, remotePath string, data js.Value, onProgress js.V
 		defer closeQuietly(f)
 
 		hasProgress := hasProgressFn(onProgress)
-
-		// Copy/write in chunks directly from JS Uint8Array to avoid a full extra buffer.
-		written := 0
-		for written < totalSize {
-			if isAborted(signal) {
-				return nil, errTransferCancelled
-			}
-			end := written + transferChunkSize
-			if end > totalSize {
-				end = totalSize
-			}
-
-			jsChunk := data.Call("subarray", written, end)
-			chunk := make([]byte, end-written)
-			js.CopyBytesToGo(chunk, jsChunk)
-
-			n, err := f.Write(chunk)
-			scrubBytes(chunk)
-			if err != nil {
-				return nil, fmt.Errorf("sftpUpload: write at %d: %w", written, err)
-			}
-			written += n
-
+		chunks := newChunkSizer(jsBool(jsGet(opts, "adaptiveChunks")))
+		err = writeUint8Array(f, data, chunks, signal, func(written int) {
 			if hasProgress {
 				onProgress.Invoke(float64(written), float64(totalSize))
 			}
+		})
+		if err != nil {
+			if err == errTransferCancelled {
+				return nil, err
+			}
+			return nil, fmt.Errorf("sftpUpload: %w", err)
 		}
-
 		return nil, nil
 	})
 }
 
+// writeUint8Array writes a JS Uint8Array to w in chunks copied straight
+// from JS, avoiding a full extra buffer, and calls progress with the
+// running total after each one. It stops with errTransferCancelled once
+// signal is aborted.
+func writeUint8Array(w io.Writer, data js.Value, chunks *chunkSizer, signal js.Value, progress func(written int)) error {
+	totalSize := data.Get("byteLength").Int()
+	written := 0
+	for written < totalSize {
+		if isAborted(signal) {
+			return errTransferCancelled
+		}
+		end := written + chunks.next()
+		if end > totalSize {
+			end = totalSize
+		}
+
+		jsChunk := data.Call("subarray", written, end)
+		chunk := make([]byte, end-written)
+		js.CopyBytesToGo(chunk, jsChunk)
+
+		start := time.Now()
+		n, err := w.Write(chunk)
+		chunks.observe(n, time.Since(start))
+		scrubBytes(chunk)
+		if err != nil {
+			return fmt.Errorf("write at %d: %w", written, err)
+		}
+		written += n
+		progress(written)
+	}
+	return nil
+}
+
 // sftpDownload downloads a remote file into a JS Uint8Array.
 // Suitable for files that fit in WASM memory (< ~1-2 GB).
+// opts.adaptiveChunks sizes chunks from measured throughput (see chunking.go).
 // Called from JS as:
 //
-//	GoSSH.sftpDownload(sftpId, remotePath, onProgress?, signal?: AbortSignal) → Promise<Uint8Array>
-func sftpDownload(sftpID string, remotePath string, onProgress js.Value, signal js.Value) js.Value {
+//	GoSSH.sftpDownload(sftpId, remotePath, onProgress?, signal?: AbortSignal, opts?: {adaptiveChunks}) → Promise<Uint8Array>
+func sftpDownload(sftpID string, remotePath string, onProgress js.Value, signal js.Value, opts js.Value) js.Value {
 	return newPromise(func() (any, error) {
 		ss, err := getSFTPSession(sftpID)
 		if err != nil {
 			return nil, err
 		}
-		remotePath, err = validateSFTPPath(remotePath, ss.strict)
+		remotePath, err = ss.validatePath(remotePath)
 		if err != nil {
 			return nil, fmt.Errorf("sftpDownload: %w", err)
 		}
@@ -133,17 +169,25 @@ func sftpDownload(sftpID string, remotePath string, onProgress js.Value, signal
 			initCap = 1024 * 1024 // Cap initial alloc at 1 MB.
 		}
 		buf := make([]byte, 0, initCap)
-		chunk := make([]byte, transferChunkSize)
+		chunks := newChunkSizer(jsBool(jsGet(opts, "adaptiveChunks")))
+		chunk := make([]byte, chunks.max())
 		totalRead := int64(0)
+		defer func() {
+			heldBytes.downloads.Add(-totalRead)
+			afterTransfer(totalRead)
+		}()
 
 		for {
 			if isAborted(signal) {
 				return nil, errTransferCancelled
 			}
-			n, err := f.Read(chunk)
+			start := time.Now()
+			n, err := f.Read(chunk[:chunks.next()])
+			chunks.observe(n, time.Since(start))
 			if n > 0 {
 				buf = append(buf, chunk[:n]...)
 				totalRead += int64(n)
+				heldBytes.downloads.Add(int64(n))
 
 				if hasProgress {
 					onProgress.Invoke(float64(totalRead), float64(totalSize))
@@ -161,6 +205,189 @@ func sftpDownload(sftpID string, remotePath string, onProgress js.Value, signal
 	})
 }
 
+const (
+	// defaultBatchConcurrency is the files sftpDownloadBatch reads at once.
+	defaultBatchConcurrency = 8
+	// maxBatchConcurrency bounds the concurrency option.
+	maxBatchConcurrency = 64
+	// maxBatchFiles bounds the paths in one sftpDownloadBatch.
+	maxBatchFiles = 10000
+)
+
+// sftpDownloadBatch downloads many files concurrently over the one SFTP
+// connection, so small files aren't each paying a round trip in turn. A
+// file that fails is reported under errors and the rest carry on, unless
+// abortOnError is set. Like sftpDownload, the files are held in memory:
+// together they may not exceed maxDownloadSize.
+// onProgress(filesDone, filesTotal, bytes) fires as each file completes.
+// Called from JS as:
+//
+//	GoSSH.sftpDownloadBatch(sftpId, paths, opts?: {concurrency, abortOnError, signal}, onProgress?) → Promise<{files: {path: Uint8Array}, errors: {path: string}}>
+func sftpDownloadBatch(sftpID string, paths js.Value, opts js.Value, onProgress js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		if paths.Type() != js.TypeObject || paths.Get("length").IsUndefined() {
+			return nil, fmt.Errorf("sftpDownloadBatch: paths must be an array")
+		}
+		if paths.Length() > maxBatchFiles {
+			return nil, fmt.Errorf("sftpDownloadBatch: at most %d paths", maxBatchFiles)
+		}
+		var list []string
+		seen := make(map[string]bool)
+		for i := 0; i < paths.Length(); i++ {
+			p, err := ss.validatePath(jsString(paths.Index(i)))
+			if err != nil {
+				return nil, fmt.Errorf("sftpDownloadBatch: paths[%d]: %w", i, err)
+			}
+			if !seen[p] {
+				seen[p] = true
+				list = append(list, p)
+			}
+		}
+		concurrency := jsInt(jsGet(opts, "concurrency"), defaultBatchConcurrency)
+		if concurrency < 1 || concurrency > maxBatchConcurrency {
+			return nil, fmt.Errorf("sftpDownloadBatch: concurrency must be between 1 and %d", maxBatchConcurrency)
+		}
+		b := &downloadBatch{
+			client:       ss.client,
+			abortOnError: jsBool(jsGet(opts, "abortOnError")),
+			signal:       jsGet(opts, "signal"),
+			onProgress:   onProgress,
+			total:        len(list),
+			data:         make(map[string][]byte),
+			errs:         make(map[string]error),
+		}
+		defer func() {
+			heldBytes.downloads.Add(-b.reserved.Load())
+			afterTransfer(b.reserved.Load())
+		}()
+		b.run(list, concurrency)
+
+		if b.stopErr != nil {
+			return nil, fmt.Errorf("sftpDownloadBatch: %w", b.stopErr)
+		}
+		files := js.Global().Get("Object").New()
+		for p, data := range b.data {
+			files.Set(p, bytesToUint8Array(data))
+		}
+		errs := js.Global().Get("Object").New()
+		for p, err := range b.errs {
+			errs.Set(p, err.Error())
+		}
+		return map[string]any{"files": files, "errors": errs}, nil
+	})
+}
+
+// downloadBatch is the state of one sftpDownloadBatch.
+type downloadBatch struct {
+	client       *sftp.Client
+	abortOnError bool
+	signal       js.Value
+	onProgress   js.Value
+	total        int
+	// reserved counts the bytes of files stat'ed so far, against
+	// maxDownloadSize.
+	reserved atomic.Int64
+
+	mu      sync.Mutex
+	data    map[string][]byte
+	errs    map[string]error
+	done    int
+	bytes   int64
+	stopErr error // set to end the batch early
+}
+
+// run downloads list with up to concurrency workers.
+func (b *downloadBatch) run(list []string, concurrency int) {
+	next := make(chan string)
+	var wg sync.WaitGroup
+	for range min(concurrency, len(list)) {
+		wg.Add(1)
+		spawn("sftp.batchWorker", func() {
+			defer wg.Done()
+			for p := range next {
+				data, err := b.download(p)
+				b.finish(p, data, err)
+			}
+		})
+	}
+	for _, p := range list {
+		if isAborted(b.signal) {
+			b.stop(errTransferCancelled)
+		}
+		if b.stopped() {
+			break
+		}
+		next <- p
+	}
+	close(next)
+	wg.Wait()
+}
+
+func (b *downloadBatch) stopped() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stopErr != nil
+}
+
+func (b *downloadBatch) stop(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stopErr == nil {
+		b.stopErr = err
+	}
+}
+
+// finish records one file's outcome and reports progress.
+func (b *downloadBatch) finish(p string, data []byte, err error) {
+	b.mu.Lock()
+	b.done++
+	if err != nil {
+		b.errs[p] = err
+		if b.abortOnError && b.stopErr == nil {
+			b.stopErr = fmt.Errorf("%s: %w", p, err)
+		}
+	} else {
+		b.data[p] = data
+		b.bytes += int64(len(data))
+	}
+	done, total, n := b.done, b.total, b.bytes
+	b.mu.Unlock()
+	if hasProgressFn(b.onProgress) {
+		b.onProgress.Invoke(done, total, float64(n))
+	}
+}
+
+// download reads one file whole. pkg/sftp's WriteTo keeps several reads
+// in flight for a large file.
+func (b *downloadBatch) download(p string) ([]byte, error) {
+	f, err := b.client.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer closeQuietly(f)
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file")
+	}
+	if b.reserved.Add(info.Size()) > maxDownloadSize {
+		b.reserved.Add(-info.Size())
+		return nil, fmt.Errorf("batch exceeds %d bytes; use sftpDownloadStream for large files", maxDownloadSize)
+	}
+	heldBytes.downloads.Add(info.Size())
+	buf := bytes.NewBuffer(make([]byte, 0, info.Size()))
+	if _, err := f.WriteTo(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // ────────────────────────────────────────────────────────────────────
 // Streaming download via Service Worker
 // ────────────────────────────────────────────────────────────────────
@@ -180,6 +407,12 @@ type streamState struct {
 	progress   atomic.Int64
 	done       chan struct{}
 	doneOnce   sync.Once
+	// cancelled is set when the app cancels via sftpDownloadStreamCancel.
+	cancelled atomic.Bool
+	// activity is poked by every _streamPull to reset the idle timeout.
+	activity chan struct{}
+	// chunks sizes each pull. Pulls are serialized by the Service Worker.
+	chunks *chunkSizer
 }
 
 // closeDone safely signals completion. Multiple calls are harmless.
@@ -187,6 +420,53 @@ func (s *streamState) closeDone() {
 	s.doneOnce.Do(func() { close(s.done) })
 }
 
+// touch records pull activity without blocking.
+func (s *streamState) touch() {
+	select {
+	case s.activity <- struct{}{}:
+	default:
+	}
+}
+
+// reportProgress calls onProgress(read, total) at most once per
+// streamProgressInterval while progress advances, until stop is closed.
+func (s *streamState) reportProgress(onProgress js.Value, stop <-chan struct{}) {
+	ticker := time.NewTicker(streamProgressInterval)
+	defer ticker.Stop()
+	last := int64(-1)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if read := s.progress.Load(); read != last {
+			last = read
+			onProgress.Invoke(float64(read), float64(s.totalSize))
+		}
+	}
+}
+
+// wait blocks until the stream completes, or returns false once idle passes
+// with no pull activity.
+func (s *streamState) wait(idle time.Duration) bool {
+	timer := time.NewTimer(idle)
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.done:
+			return true
+		case <-s.activity:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(idle)
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
 // sftpDownloadStream initiates a streaming download via Service Worker.
 // This avoids buffering the entire file in WASM memory.
 //
@@ -197,16 +477,26 @@ func (s *streamState) closeDone() {
 // 4. Go returns chunks until EOF
 // 5. Browser saves the file progressively
 //
+// onProgress fires periodically during the transfer and once more at the end.
+// The download fails if the Service Worker stops pulling for idleTimeoutMs
+// (default 5 minutes); the timer restarts on every pull, so a large download
+// that keeps progressing never times out.
+//
 // Called from JS as:
 //
-//	GoSSH.sftpDownloadStream(sftpId, remotePath, onProgress?) → Promise<void>
-func sftpDownloadStream(sftpID string, remotePath string, onProgress js.Value) js.Value {
+//	GoSSH.sftpDownloadStream(sftpId, remotePath, onProgress?, opts?: {idleTimeoutMs, adaptiveChunks}) → Promise<void>
+func sftpDownloadStream(sftpID string, remotePath string, onProgress js.Value, opts js.Value) js.Value {
 	return newPromise(func() (any, error) {
+		idleTimeout := defaultStreamIdleTimeout
+		if ms := jsInt(jsGet(opts, "idleTimeoutMs"), 0); ms > 0 {
+			idleTimeout = time.Duration(ms) * time.Millisecond
+		}
+
 		ss, err := getSFTPSession(sftpID)
 		if err != nil {
 			return nil, err
 		}
-		remotePath, err = validateSFTPPath(remotePath, ss.strict)
+		remotePath, err = ss.validatePath(remotePath)
 		if err != nil {
 			return nil, fmt.Errorf("sftpDownloadStream: %w", err)
 		}
@@ -230,6 +520,8 @@ func sftpDownloadStream(sftpID string, remotePath string, onProgress js.Value) j
 			totalSize:  info.Size(),
 			file:       f,
 			done:       make(chan struct{}),
+			activity:   make(chan struct{}, 1),
+			chunks:     newChunkSizer(jsBool(jsGet(opts, "adaptiveChunks"))),
 		}
 		activeStreams.Store(streamID, state)
 
@@ -259,16 +551,27 @@ func sftpDownloadStream(sftpID string, remotePath string, onProgress js.Value) j
 			}),
 		)
 
-		// Wait for download to complete or timeout (30 min max for large files).
-		timeout := time.NewTimer(30 * time.Minute)
-		defer timeout.Stop()
-		select {
-		case <-state.done:
-		case <-timeout.C:
+		// Report progress while the Service Worker pulls chunks.
+		stopProgress := func() {}
+		if hasProgressFn(onProgress) {
+			stop := make(chan struct{})
+			spawn("sftp.streamProgress", func() { state.reportProgress(onProgress, stop) })
+			stopProgress = func() { close(stop) }
+		}
+
+		// Wait for the download to complete or stop making progress.
+		completed := state.wait(idleTimeout)
+		stopProgress()
+		if !completed {
 			closeQuietly(state.file)
 			state.closeDone()
 			activeStreams.Delete(streamID)
-			return nil, fmt.Errorf("sftpDownloadStream: timed out after 30 minutes")
+			return nil, fmt.Errorf("sftpDownloadStream: no progress for %s", idleTimeout)
+		}
+
+		if state.cancelled.Load() {
+			activeStreams.Delete(streamID)
+			return nil, errTransferCancelled
 		}
 
 		// Report final progress.
@@ -289,12 +592,18 @@ func sftpDownloadStream(sftpID string, remotePath string, onProgress js.Value) j
 var activeUploads sync.Map // uploadID → *uploadState
 
 type uploadState struct {
+	sftpID   string
 	dataCh   chan []byte   // JS pushes chunks here
 	doneCh   chan struct{} // Signals upload completion
 	doneOnce sync.Once
 	written  atomic.Int64
 	size     int64
 
+	// serial rejects a write issued while another is still pending.
+	serial bool
+	// pending counts sftpUploadStreamWrite calls that have not resolved.
+	pending atomic.Int32
+
 	// writeErr is a sticky error from the writer goroutine.
 	// Once set, all subsequent sftpUploadStreamWrite calls fail immediately.
 	writeErrMu sync.Mutex
@@ -321,10 +630,21 @@ func (u *uploadState) getErr() error {
 
 // sftpUploadStreamStart begins a streaming upload.
 // Returns a stream ID that JS uses to push chunks.
+//
+// Backpressure only works if JS awaits each sftpUploadStreamWrite: writes
+// fired without awaiting each park a goroutine and a chunk copy. With
+// serialWrites, an overlapping write fails the upload with code
+// UPLOAD_WRITE_OVERLAP instead; sftpUploadStreamStatus exposes the buffer
+// fill level for apps that pace themselves.
+//
+// With resume, an existing remote file is kept and written after its last
+// byte, and the promise resolves to {uploadId, offset}: JS skips the first
+// offset bytes of its data. written in sftpUploadStreamStatus starts there.
+//
 // Called from JS as:
 //
-//	GoSSH.sftpUploadStreamStart(sftpId, remotePath, size) → Promise<string>
-func sftpUploadStreamStart(sftpID string, remotePath string, size int64) js.Value {
+//	GoSSH.sftpUploadStreamStart(sftpId, remotePath, size, opts?: {serialWrites, resume}) → Promise<string | {uploadId, offset}>
+func sftpUploadStreamStart(sftpID string, remotePath string, size int64, opts js.Value) js.Value {
 	return newPromise(func() (any, error) {
 		if size < 0 {
 			return nil, fmt.Errorf("sftpUploadStreamStart: size must be non-negative")
@@ -333,46 +653,100 @@ func sftpUploadStreamStart(sftpID string, remotePath string, size int64) js.Valu
 		if err != nil {
 			return nil, err
 		}
-		remotePath, err = validateSFTPPath(remotePath, ss.strict)
+		if err := ss.writable("sftpUploadStreamStart"); err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
 		if err != nil {
 			return nil, fmt.Errorf("sftpUploadStreamStart: %w", err)
 		}
 
-		f, err := ss.client.Create(remotePath)
+		resume := jsBool(jsGet(opts, "resume"))
+		var f *sftp.File
+		var offset int64
+		if resume {
+			f, offset, err = openForResume(ss.client, remotePath, size)
+		} else {
+			f, err = ss.client.Create(remotePath)
+		}
 		if err != nil {
-			return nil, fmt.Errorf("sftpUploadStreamStart: create: %w", err)
+			return nil, fmt.Errorf("sftpUploadStreamStart: %w", err)
 		}
 
 		uploadID := generateID()
 		state := &uploadState{
+			sftpID: sftpID,
 			dataCh: make(chan []byte, 16), // Buffer up to 16 chunks (1 MB at 64KB chunks).
 			doneCh: make(chan struct{}),
 			size:   size,
+			serial: jsBool(jsGet(opts, "serialWrites")),
 		}
+		state.written.Store(offset)
 		activeUploads.Store(uploadID, state)
 
 		// Background writer goroutine: drains dataCh and writes to SFTP file.
-		go func() {
+		spawn("sftp.uploadWriter", func() {
 			defer f.Close()
 			defer state.closeDone()
 
 			for chunk := range state.dataCh {
 				n, err := f.Write(chunk)
+				heldBytes.uploads.Add(-int64(len(chunk)))
 				if err != nil {
 					state.setErr(fmt.Errorf("sftpUploadStream: write: %w", err))
 					// Drain remaining chunks to unblock pushers.
-					for range state.dataCh {
+					for chunk := range state.dataCh {
+						heldBytes.uploads.Add(-int64(len(chunk)))
 					}
 					return
 				}
 				state.written.Add(int64(n))
 			}
-		}()
+		})
 
+		if resume {
+			return map[string]any{"uploadId": uploadID, "offset": float64(offset)}, nil
+		}
 		return uploadID, nil
 	})
 }
 
+// openForResume opens remotePath for writing at the end of what's already
+// there, creating it if missing, and returns that offset. A remote file
+// longer than size can't be a prefix of this upload and is rejected.
+func openForResume(client *sftp.Client, remotePath string, size int64) (*sftp.File, int64, error) {
+	fi, err := client.Stat(remotePath)
+	if errors.Is(err, os.ErrNotExist) {
+		f, err := client.Create(remotePath)
+		if err != nil {
+			return nil, 0, fmt.Errorf("create: %w", err)
+		}
+		return f, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("stat: %w", err)
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, 0, fmt.Errorf("%s is not a regular file", remotePath)
+	}
+	if fi.Size() > size {
+		return nil, 0, &codedError{
+			code: errCodeUploadResumeMismatch,
+			msg:  fmt.Sprintf("remote file is %d bytes, larger than the upload (%d bytes)", fi.Size(), size),
+		}
+	}
+	// O_APPEND isn't honored by every server, so write at an explicit offset.
+	f, err := client.OpenFile(remotePath, os.O_WRONLY)
+	if err != nil {
+		return nil, 0, fmt.Errorf("open: %w", err)
+	}
+	if _, err := f.Seek(fi.Size(), io.SeekStart); err != nil {
+		f.Close()
+		return nil, 0, fmt.Errorf("seek: %w", err)
+	}
+	return f, fi.Size(), nil
+}
+
 // sftpUploadStreamWrite pushes a chunk to an active streaming upload.
 // Called from JS as:
 //
@@ -385,17 +759,28 @@ func sftpUploadStreamWrite(uploadID string, chunk js.Value) js.Value {
 		}
 		state := val.(*uploadState)
 
+		pending := state.pending.Add(1)
+		defer state.pending.Add(-1)
+
 		// Check for sticky writer error — persists across all subsequent calls.
 		if err := state.getErr(); err != nil {
 			return nil, err
 		}
 
+		// An overlapping write can't be dropped without leaving a gap in the
+		// file, so it fails the whole upload.
+		if state.serial && pending > 1 {
+			state.setErr(errUploadOverlap)
+			return nil, errUploadOverlap
+		}
+
 		// Copy JS Uint8Array to Go bytes.
 		length := chunk.Get("byteLength").Int()
 		data := make([]byte, length)
 		js.CopyBytesToGo(data, chunk)
 
 		// Send to writer goroutine.
+		heldBytes.uploads.Add(int64(length))
 		state.dataCh <- data
 
 		// Re-check: the write may have failed while we were blocked on send.
@@ -406,6 +791,27 @@ func sftpUploadStreamWrite(uploadID string, chunk js.Value) js.Value {
 	})
 }
 
+// sftpUploadStreamStatus reports buffer state for an active streaming upload
+// so JS can pace writes: buffered/capacity are queued chunks, pendingWrites
+// are unresolved sftpUploadStreamWrite calls. Returns null if not found.
+// Called from JS as:
+//
+//	GoSSH.sftpUploadStreamStatus(uploadId) → {buffered, capacity, pendingWrites, written, size} | null
+func sftpUploadStreamStatus(uploadID string) js.Value {
+	val, ok := activeUploads.Load(uploadID)
+	if !ok {
+		return js.Null()
+	}
+	state := val.(*uploadState)
+	return js.ValueOf(map[string]any{
+		"buffered":      len(state.dataCh),
+		"capacity":      cap(state.dataCh),
+		"pendingWrites": int(state.pending.Load()),
+		"written":       float64(state.written.Load()),
+		"size":          float64(state.size),
+	})
+}
+
 // sftpUploadStreamEnd finalizes a streaming upload.
 // Called from JS as:
 //
@@ -444,24 +850,45 @@ func sftpUploadStreamCancel(uploadID string) {
 	close(state.dataCh) // Unblocks writer goroutine, which will close file.
 }
 
-// streamPull is called by the Service Worker to pull the next chunk.
-// Called from JS as: GoSSH._streamPull(streamId, streamToken) → {data: Uint8Array|null, done: bool}
-func streamPull(streamID, streamToken string) js.Value {
+// cancelUploadsForSFTP cancels every streaming upload on an SFTP session.
+func cancelUploadsForSFTP(sftpID string) {
+	activeUploads.Range(func(key, val any) bool {
+		if val.(*uploadState).sftpID == sftpID {
+			sftpUploadStreamCancel(key.(string))
+		}
+		return true
+	})
+}
+
+// lookupStream returns the active stream matching both ID and token.
+func lookupStream(streamID, streamToken string) (*streamState, bool) {
 	if !isHexID(streamID, 32) || !isHexID(streamToken, 32) {
-		return js.ValueOf(map[string]any{"data": js.Null(), "done": true})
+		return nil, false
 	}
-
 	val, ok := activeStreams.Load(streamID)
 	if !ok {
-		return js.ValueOf(map[string]any{"data": js.Null(), "done": true})
+		return nil, false
 	}
 	state := val.(*streamState)
 	if state.token != streamToken {
+		return nil, false
+	}
+	return state, true
+}
+
+// streamPull is called by the Service Worker to pull the next chunk.
+// Called from JS as: GoSSH._streamPull(streamId, streamToken) → {data: Uint8Array|null, done: bool}
+func streamPull(streamID, streamToken string) js.Value {
+	state, ok := lookupStream(streamID, streamToken)
+	if !ok {
 		return js.ValueOf(map[string]any{"data": js.Null(), "done": true})
 	}
+	state.touch()
 
-	chunk := make([]byte, transferChunkSize)
+	chunk := make([]byte, state.chunks.next())
+	start := time.Now()
 	n, err := state.file.Read(chunk)
+	state.chunks.observe(n, time.Since(start))
 
 	if n > 0 {
 		state.progress.Add(int64(n))
@@ -486,24 +913,45 @@ func streamPull(streamID, streamToken string) js.Value {
 // streamCancel cancels a streaming download.
 // Called from JS as: GoSSH._streamCancel(streamId, streamToken)
 func streamCancel(streamID, streamToken string) {
-	if !isHexID(streamID, 32) || !isHexID(streamToken, 32) {
-		return
-	}
-
-	val, ok := activeStreams.Load(streamID)
+	state, ok := lookupStream(streamID, streamToken)
 	if !ok {
 		return
 	}
-	state := val.(*streamState)
-	if state.token != streamToken {
-		return
-	}
 
 	activeStreams.Delete(streamID)
 	closeQuietly(state.file)
 	state.closeDone()
 }
 
+// stopStreamsForSFTP cancels every streaming download on an SFTP session;
+// their sftpDownloadStream promises reject with "transfer cancelled".
+func stopStreamsForSFTP(sftpID string) {
+	activeStreams.Range(func(key, val any) bool {
+		if state := val.(*streamState); state.sftpID == sftpID {
+			state.cancelled.Store(true)
+			activeStreams.Delete(key)
+			closeQuietly(state.file)
+			state.closeDone()
+		}
+		return true
+	})
+}
+
+// sftpDownloadStreamCancel cancels a streaming download from the app,
+// without relying on the Service Worker to report it. The file handle is
+// closed immediately and the pending sftpDownloadStream promise rejects
+// with "transfer cancelled". The ID and token come from the
+// gossh-stream-download event.
+// Called from JS as: GoSSH.sftpDownloadStreamCancel(streamId, streamToken)
+func sftpDownloadStreamCancel(streamID, streamToken string) {
+	state, ok := lookupStream(streamID, streamToken)
+	if !ok {
+		return
+	}
+	state.cancelled.Store(true)
+	streamCancel(streamID, streamToken)
+}
+
 func hasProgressFn(v js.Value) bool {
 	return !v.IsUndefined() && !v.IsNull() && v.Type() == js.TypeFunction
 }
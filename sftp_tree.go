@@ -0,0 +1,668 @@
+// sftp_tree.go implements recursive operations over remote directory trees.
+// Walks run in Go over the one SFTP connection, which is far cheaper than
+// issuing a call per entry from JS.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	pathpkg "path"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall/js"
+
+	"github.com/pkg/sftp"
+)
+
+// treeVisitor is called for each entry of a walk. info describes the
+// entry itself (Lstat) unless it is a followed symlink, in which case it
+// describes the target and isLink is true.
+type treeVisitor func(p string, info fs.FileInfo, isLink bool) error
+
+// walkOptions controls a tree walk.
+type walkOptions struct {
+	// signal is an AbortSignal checked before each entry; may be undefined.
+	signal js.Value
+	// followSymlinks descends into symlinked directories. Off by default:
+	// a link is then visited as a link and never resolved.
+	followSymlinks bool
+	// skipUnreadable visits a directory that can't be listed without its
+	// contents instead of failing the walk.
+	skipUnreadable bool
+	// confine, if set, vets a symlink before it is followed. A link it
+	// rejects fails the walk, or with skipUnreadable is visited as a
+	// plain link.
+	confine func(p string) error
+}
+
+// walkOptionsFromJS reads {signal, followSymlinks} from a JS options object.
+func walkOptionsFromJS(opts js.Value) walkOptions {
+	return walkOptions{
+		signal:         jsGet(opts, "signal"),
+		followSymlinks: jsBool(jsGet(opts, "followSymlinks")),
+	}
+}
+
+// walkOptions is walkOptionsFromJS for a walk on ss: with a rootPrefix,
+// a followed symlink must resolve under it.
+func (ss *sftpSession) walkOptions(opts js.Value) walkOptions {
+	w := walkOptionsFromJS(opts)
+	if ss.root != "" {
+		w.confine = ss.confine
+	}
+	return w
+}
+
+// maxWalkDepth bounds directory nesting in a walk. Loop detection catches
+// cycles through symlinks; this is the backstop for anything it can't see,
+// such as a server that resolves paths inconsistently.
+const maxWalkDepth = 256
+
+// errWalkTooDeep is returned when a walk exceeds maxWalkDepth.
+var errWalkTooDeep = fmt.Errorf("directory tree deeper than %d levels", maxWalkDepth)
+
+// dirState tracks a directory reached while following symlinks.
+type dirState int
+
+const (
+	dirWalking dirState = iota + 1 // an ancestor of the current entry
+	dirDone                        // fully walked
+)
+
+// treeWalk is the state of one walk.
+type treeWalk struct {
+	client *sftp.Client
+	opts   walkOptions
+	visit  treeVisitor
+	// dirs holds directories reached when following symlinks, keyed by
+	// resolved path: SFTP exposes no inode numbers, so the canonical path
+	// from RealPath stands in for one. Reaching a directory that is still
+	// being walked is a loop; reaching a finished one is not, and it is
+	// skipped.
+	dirs map[string]dirState
+}
+
+// walkPostOrder visits root and everything below it, children before
+// their parent directory, so a visitor may remove or restrict a directory
+// after its contents are done.
+func walkPostOrder(client *sftp.Client, root string, opts walkOptions, visit treeVisitor) error {
+	w := &treeWalk{client: client, opts: opts, visit: visit}
+	if opts.followSymlinks {
+		w.dirs = make(map[string]dirState)
+	}
+	info, err := client.Lstat(root)
+	if err != nil {
+		return err
+	}
+	return w.entry(root, info, 0)
+}
+
+func (w *treeWalk) entry(p string, info fs.FileInfo, depth int) error {
+	if isAborted(w.opts.signal) {
+		return errTransferCancelled
+	}
+	isLink := info.Mode()&fs.ModeSymlink != 0
+	follow := isLink && w.opts.followSymlinks
+	if follow && w.opts.confine != nil {
+		if err := w.opts.confine(p); err != nil {
+			if !w.opts.skipUnreadable {
+				return err
+			}
+			follow = false
+		}
+	}
+	if follow {
+		// A dangling link is visited as a plain link.
+		if target, err := w.client.Stat(p); err == nil {
+			info = target
+		}
+	}
+	if info.IsDir() {
+		if depth >= maxWalkDepth {
+			return fmt.Errorf("%s: %w", p, errWalkTooDeep)
+		}
+		real, descend, err := w.enterDir(p)
+		if err != nil {
+			return err
+		}
+		if descend {
+			entries, err := w.client.ReadDir(p)
+			if err != nil && !w.opts.skipUnreadable {
+				return err
+			}
+			for _, entry := range entries {
+				if err := w.entry(pathpkg.Join(p, entry.Name()), entry, depth+1); err != nil {
+					return err
+				}
+			}
+			if w.dirs != nil {
+				w.dirs[real] = dirDone
+			}
+		}
+	}
+	return w.visit(p, info, isLink)
+}
+
+// enterDir resolves directory p and reports whether it should be walked.
+// Without followSymlinks every directory is reached exactly once, so no
+// tracking is needed.
+func (w *treeWalk) enterDir(p string) (real string, descend bool, err error) {
+	if w.dirs == nil {
+		return "", true, nil
+	}
+	real, err = w.client.RealPath(p)
+	if err != nil {
+		return "", false, err
+	}
+	switch w.dirs[real] {
+	case dirWalking:
+		return "", false, &codedError{
+			code: errCodeSymlinkLoop,
+			msg:  fmt.Sprintf("symlink loop detected: %s resolves to %s, which contains it", p, real),
+		}
+	case dirDone:
+		return real, false, nil
+	}
+	w.dirs[real] = dirWalking
+	return real, true, nil
+}
+
+// sftpChmodRecursive applies fileMode to regular files and dirMode to
+// directories throughout a tree. Symlinks are skipped unless
+// followSymlinks is set, in which case their targets are changed. Either
+// mode may be omitted (-1) to leave that kind of entry unchanged.
+// Directories are changed after their contents, so a restrictive dirMode
+// doesn't block the walk.
+// Called from JS as:
+//
+//	GoSSH.sftpChmodRecursive(sftpId, path, {fileMode?, dirMode?, followSymlinks?, onProgress?, signal?}) → Promise<{files, dirs}>
+func sftpChmodRecursive(sftpID string, remotePath string, fileMode, dirMode int, opts js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		if err := ss.writable("sftpChmodRecursive"); err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpChmodRecursive: %w", err)
+		}
+		onProgress, hasProgress := getCallback(opts, "onProgress")
+
+		files, dirs := 0, 0
+		err = walkPostOrder(ss.client, remotePath, ss.walkOptions(opts), func(p string, info fs.FileInfo, isLink bool) error {
+			mode := -1
+			switch {
+			case info.Mode().IsRegular():
+				mode = fileMode
+			case info.IsDir():
+				mode = dirMode
+			}
+			if mode < 0 {
+				return nil
+			}
+			if err := ss.client.Chmod(p, fs.FileMode(mode)); err != nil {
+				return fmt.Errorf("%s: %w", p, err)
+			}
+			if info.IsDir() {
+				dirs++
+			} else {
+				files++
+			}
+			if hasProgress {
+				onProgress.Invoke(files+dirs, p)
+			}
+			return nil
+		})
+		if err != nil {
+			if err == errTransferCancelled {
+				return nil, err
+			}
+			return nil, fmt.Errorf("sftpChmodRecursive: %w", err)
+		}
+		return map[string]any{"files": files, "dirs": dirs}, nil
+	})
+}
+
+// sftpDirSize totals the regular files in a tree, like du. Symlinks are
+// not counted unless followSymlinks is set, in which case their targets
+// are; a file reached through several links counts each time.
+// Called from JS as:
+//
+//	GoSSH.sftpDirSize(sftpId, path, {followSymlinks?, signal?}?) → Promise<{bytes, files, dirs}>
+func sftpDirSize(sftpID string, remotePath string, opts js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpDirSize: %w", err)
+		}
+
+		var size int64
+		files, dirs := 0, 0
+		err = walkPostOrder(ss.client, remotePath, ss.walkOptions(opts), func(p string, info fs.FileInfo, isLink bool) error {
+			switch {
+			case info.Mode().IsRegular():
+				size += info.Size()
+				files++
+			case info.IsDir():
+				dirs++
+			}
+			return nil
+		})
+		if err != nil {
+			if err == errTransferCancelled {
+				return nil, err
+			}
+			return nil, fmt.Errorf("sftpDirSize: %w", err)
+		}
+		return map[string]any{"bytes": float64(size), "files": files, "dirs": dirs}, nil
+	})
+}
+
+// sftpDownloadDir reads every regular file in a tree and passes each to
+// onFile with its path relative to the root, one at a time so only one
+// file is held in memory. Each file is limited to maxDownloadSize.
+// Symlinks are skipped unless followSymlinks is set, in which case their
+// targets are downloaded under the link's path. onDir is called for each
+// directory after its contents, so empty directories can be recreated.
+// Called from JS as:
+//
+//	GoSSH.sftpDownloadDir(sftpId, path, {onFile, onDir?, followSymlinks?, signal?}) → Promise<{files, bytes}>
+func sftpDownloadDir(sftpID string, remotePath string, opts js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		remotePath, err = ss.validatePath(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpDownloadDir: %w", err)
+		}
+		onFile, ok := getCallback(opts, "onFile")
+		if !ok {
+			return nil, fmt.Errorf("sftpDownloadDir: onFile is required")
+		}
+		onDir, hasDir := getCallback(opts, "onDir")
+
+		var size int64
+		files := 0
+		defer func() { afterTransfer(size) }()
+		err = walkPostOrder(ss.client, remotePath, ss.walkOptions(opts), func(p string, info fs.FileInfo, isLink bool) error {
+			rel := strings.TrimPrefix(strings.TrimPrefix(p, remotePath), "/")
+			switch {
+			case info.Mode().IsRegular():
+				if rel == "" {
+					rel = pathpkg.Base(p)
+				}
+				if info.Size() > maxDownloadSize {
+					return fmt.Errorf("%s: file too large (%d bytes, max %d)", p, info.Size(), maxDownloadSize)
+				}
+				f, err := ss.client.Open(p)
+				if err != nil {
+					return fmt.Errorf("%s: %w", p, err)
+				}
+				data, err := io.ReadAll(io.LimitReader(f, maxDownloadSize+1))
+				closeQuietly(f)
+				if err != nil {
+					return fmt.Errorf("%s: %w", p, err)
+				}
+				if len(data) > maxDownloadSize {
+					return fmt.Errorf("%s: file too large (max %d bytes)", p, maxDownloadSize)
+				}
+				onFile.Invoke(rel, bytesToUint8Array(data))
+				size += int64(len(data))
+				files++
+			case info.IsDir() && hasDir && rel != "":
+				onDir.Invoke(rel)
+			}
+			return nil
+		})
+		if err != nil {
+			if err == errTransferCancelled {
+				return nil, err
+			}
+			return nil, fmt.Errorf("sftpDownloadDir: %w", err)
+		}
+		return map[string]any{"files": files, "bytes": float64(size)}, nil
+	})
+}
+
+// maxUploadTreeEntries bounds the files in one sftpUploadTree call.
+const maxUploadTreeEntries = 10000
+
+// treeEntry is one file of an sftpUploadTree call.
+type treeEntry struct {
+	relPath string
+	remote  string
+	data    js.Value
+	mode    int // -1 to keep the server's default
+}
+
+// parseTreeEntries validates the entries of an sftpUploadTree call before
+// anything is written. Relative paths must stay below base.
+func parseTreeEntries(ss *sftpSession, base string, entries js.Value) ([]treeEntry, int64, error) {
+	if entries.Type() != js.TypeObject || !js.Global().Get("Array").Call("isArray", entries).Bool() {
+		return nil, 0, fmt.Errorf("entries must be an array")
+	}
+	n := entries.Length()
+	if n > maxUploadTreeEntries {
+		return nil, 0, fmt.Errorf("too many entries (%d, max %d)", n, maxUploadTreeEntries)
+	}
+	out := make([]treeEntry, 0, n)
+	var total int64
+	for i := 0; i < n; i++ {
+		e := entries.Index(i)
+		rel := jsString(jsGet(e, "relativePath"))
+		clean := pathpkg.Clean(rel)
+		if rel == "" || pathpkg.IsAbs(rel) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, 0, fmt.Errorf("entry %d: relativePath %q must be a relative path below the base", i, rel)
+		}
+		remote, err := ss.validatePath(pathpkg.Join(base, clean))
+		if err != nil {
+			return nil, 0, fmt.Errorf("entry %d: %w", i, err)
+		}
+		data := jsGet(e, "data")
+		if data.Type() != js.TypeObject || data.Get("byteLength").Type() != js.TypeNumber {
+			return nil, 0, fmt.Errorf("entry %d: data must be a Uint8Array", i)
+		}
+		size := data.Get("byteLength").Int()
+		if size > maxUploadSize {
+			return nil, 0, fmt.Errorf("entry %d: file too large (%d bytes, max %d)", i, size, maxUploadSize)
+		}
+		mode := -1
+		if v := jsGet(e, "mode"); !v.IsUndefined() && !v.IsNull() {
+			if mode = jsInt(v, -1); mode < 0 || mode > 0o7777 {
+				return nil, 0, fmt.Errorf("entry %d: mode must be between 0 and 07777", i)
+			}
+		}
+		out = append(out, treeEntry{relPath: clean, remote: remote, data: data, mode: mode})
+		total += int64(size)
+	}
+	return out, total, nil
+}
+
+// sftpUploadTree uploads a set of files below remoteBasePath, creating
+// parent directories as needed. onProgress receives the bytes written and
+// the total across all files. All entries are validated before the first
+// write. On abort or error the file being written is closed and removed;
+// files already finished are kept.
+// Called from JS as:
+//
+//	GoSSH.sftpUploadTree(sftpId, remoteBasePath, entries: {relativePath, data, mode?}[], onProgress?, signal?) → Promise<{files, bytes}>
+func sftpUploadTree(sftpID string, remoteBasePath string, entries js.Value, onProgress js.Value, signal js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		if err := ss.writable("sftpUploadTree"); err != nil {
+			return nil, err
+		}
+		remoteBasePath, err = ss.validatePath(remoteBasePath)
+		if err != nil {
+			return nil, fmt.Errorf("sftpUploadTree: %w", err)
+		}
+		files, total, err := parseTreeEntries(ss, remoteBasePath, entries)
+		if err != nil {
+			return nil, fmt.Errorf("sftpUploadTree: %w", err)
+		}
+
+		hasProgress := hasProgressFn(onProgress)
+		chunks := newChunkSizer(false)
+		made := make(map[string]bool)
+		var done int64
+		defer func() { afterTransfer(done) }()
+		for _, e := range files {
+			if isAborted(signal) {
+				return nil, errTransferCancelled
+			}
+			if dir := pathpkg.Dir(e.remote); !made[dir] {
+				if err := ss.client.MkdirAll(dir); err != nil {
+					return nil, fmt.Errorf("sftpUploadTree: %s: mkdir: %w", e.relPath, err)
+				}
+				made[dir] = true
+			}
+			if err := uploadTreeFile(ss.client, e, chunks, signal, func(written int) {
+				if hasProgress {
+					onProgress.Invoke(float64(done+int64(written)), float64(total))
+				}
+			}); err != nil {
+				if err == errTransferCancelled {
+					return nil, err
+				}
+				return nil, fmt.Errorf("sftpUploadTree: %s: %w", e.relPath, err)
+			}
+			done += int64(e.data.Get("byteLength").Int())
+		}
+		return map[string]any{"files": len(files), "bytes": float64(done)}, nil
+	})
+}
+
+// uploadTreeFile writes one entry, removing the partial file if the write
+// doesn't complete, and then applies its mode.
+func uploadTreeFile(client *sftp.Client, e treeEntry, chunks *chunkSizer, signal js.Value, progress func(int)) error {
+	f, err := client.Create(e.remote)
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	err = writeUint8Array(f, e.data, chunks, signal, progress)
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("close: %w", cerr)
+	}
+	if err != nil {
+		_ = client.Remove(e.remote)
+		return err
+	}
+	if e.mode >= 0 {
+		if err := client.Chmod(e.remote, fs.FileMode(e.mode)); err != nil {
+			return fmt.Errorf("chmod: %w", err)
+		}
+	}
+	return nil
+}
+
+// maxGlobResults caps the matches sftpGlob returns.
+const maxGlobResults = 10000
+
+// hasGlobMeta reports whether a path component is a pattern rather than a
+// literal name.
+func hasGlobMeta(s string) bool {
+	return strings.ContainsAny(s, `*?[\`)
+}
+
+// globWalk is the state of one sftpGlob.
+type globWalk struct {
+	client    *sftp.Client
+	matches   []js.Value
+	truncated bool
+}
+
+// add records a match, or returns false once maxGlobResults is reached.
+func (g *globWalk) add(dir string, info fs.FileInfo) bool {
+	if len(g.matches) == maxGlobResults {
+		g.truncated = true
+		return false
+	}
+	g.matches = append(g.matches, fileInfoToJS(dir, info))
+	return true
+}
+
+// expand matches comps (the remaining pattern components) under dir,
+// returning false if it stopped at the cap. Like filepath.Glob, it skips
+// directories it can't read. Patterns match within one component: there
+// is no **.
+func (g *globWalk) expand(dir string, comps []string) bool {
+	comp, last := comps[0], len(comps) == 1
+	if !hasGlobMeta(comp) {
+		p := pathpkg.Join(dir, comp)
+		if !last {
+			return g.expand(p, comps[1:])
+		}
+		if info, err := g.client.Lstat(p); err == nil {
+			return g.add(dir, info)
+		}
+		return true
+	}
+
+	entries, err := g.client.ReadDir(dir)
+	if err != nil {
+		return true
+	}
+	slices.SortFunc(entries, func(a, b fs.FileInfo) int { return strings.Compare(a.Name(), b.Name()) })
+	for _, e := range entries {
+		if ok, _ := pathpkg.Match(comp, e.Name()); !ok {
+			continue
+		}
+		var more bool
+		switch {
+		case last:
+			more = g.add(dir, e)
+		case e.IsDir():
+			more = g.expand(pathpkg.Join(dir, e.Name()), comps[1:])
+		default:
+			more = true
+		}
+		if !more {
+			return false
+		}
+	}
+	return true
+}
+
+// sftpGlob returns the entries matching a path.Match pattern (*, ?, [...]),
+// in name order, up to maxGlobResults. Only components with wildcards cost
+// a directory listing. A relative pattern is matched from the working
+// directory.
+// Called from JS as: GoSSH.sftpGlob(sftpId, pattern) → Promise<{matches: FileInfo[], truncated}>
+func sftpGlob(sftpID string, pattern string) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		pattern, err = ss.validatePath(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("sftpGlob: %w", err)
+		}
+		if _, err := pathpkg.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("sftpGlob: %w", err)
+		}
+		if !pathpkg.IsAbs(pattern) {
+			wd, err := ss.client.Getwd()
+			if err != nil {
+				return nil, fmt.Errorf("sftpGlob: %w", err)
+			}
+			pattern = pathpkg.Join(wd, pattern)
+		}
+
+		g := &globWalk{client: ss.client}
+		if comps := strings.Split(strings.Trim(pathpkg.Clean(pattern), "/"), "/"); comps[0] != "" {
+			g.expand("/", comps)
+		}
+		matches := js.Global().Get("Array").New(len(g.matches))
+		for i, m := range g.matches {
+			matches.SetIndex(i, m)
+		}
+		return map[string]any{"matches": matches, "truncated": g.truncated}, nil
+	})
+}
+
+// defaultFindResults is sftpFind's maxResults when none is given.
+const defaultFindResults = 1000
+
+// errFindDone ends an sftpFind walk once maxResults is reached.
+var errFindDone = errors.New("find: result limit reached")
+
+// findMatcher reads sftpFind's name test: namePattern, a path.Match glob,
+// or nameRegex, an RE2 regular expression. Either is matched against the
+// entry's name, not its path.
+func findMatcher(opts js.Value) (func(name string) bool, error) {
+	glob, re := jsGet(opts, "namePattern"), jsGet(opts, "nameRegex")
+	switch {
+	case glob.Type() == js.TypeString && re.Type() == js.TypeString:
+		return nil, fmt.Errorf("namePattern and nameRegex are exclusive")
+	case glob.Type() == js.TypeString:
+		pattern := glob.String()
+		if _, err := pathpkg.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("namePattern: %w", err)
+		}
+		return func(name string) bool {
+			ok, _ := pathpkg.Match(pattern, name)
+			return ok
+		}, nil
+	case re.Type() == js.TypeString:
+		compiled, err := regexp.Compile(re.String())
+		if err != nil {
+			return nil, fmt.Errorf("nameRegex: %w", err)
+		}
+		return compiled.MatchString, nil
+	}
+	return nil, fmt.Errorf("namePattern or nameRegex required")
+}
+
+// sftpFind walks a tree for entries whose name matches namePattern (a
+// glob) or nameRegex, stopping at maxResults (default 1000, at most
+// 10000) with truncated set. Directories that can't be listed are
+// skipped. Matches come in walk order, a directory after its contents.
+// Called from JS as:
+//
+//	GoSSH.sftpFind(sftpId, root, {namePattern? | nameRegex?, maxResults?, followSymlinks?, signal?}) → Promise<{matches: FileInfo[], truncated}>
+func sftpFind(sftpID string, root string, opts js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		ss, err := getSFTPSession(sftpID)
+		if err != nil {
+			return nil, err
+		}
+		root, err = ss.validatePath(root)
+		if err != nil {
+			return nil, fmt.Errorf("sftpFind: %w", err)
+		}
+		match, err := findMatcher(opts)
+		if err != nil {
+			return nil, fmt.Errorf("sftpFind: %w", err)
+		}
+		limit := jsInt(jsGet(opts, "maxResults"), defaultFindResults)
+		if limit < 1 || limit > maxGlobResults {
+			return nil, fmt.Errorf("sftpFind: maxResults must be between 1 and %d", maxGlobResults)
+		}
+
+		walk := ss.walkOptions(opts)
+		walk.skipUnreadable = true
+		var matches []js.Value
+		truncated := false
+		err = walkPostOrder(ss.client, root, walk, func(p string, info fs.FileInfo, isLink bool) error {
+			if !match(pathpkg.Base(p)) {
+				return nil
+			}
+			if len(matches) == limit {
+				truncated = true
+				return errFindDone
+			}
+			matches = append(matches, fileInfoToJS(pathpkg.Dir(p), info))
+			return nil
+		})
+		if err != nil && err != errFindDone {
+			if err == errTransferCancelled {
+				return nil, err
+			}
+			return nil, fmt.Errorf("sftpFind: %w", err)
+		}
+		result := js.Global().Get("Array").New(len(matches))
+		for i, m := range matches {
+			result.SetIndex(i, m)
+		}
+		return map[string]any{"matches": result, "truncated": truncated}, nil
+	})
+}
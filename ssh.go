@@ -7,49 +7,138 @@
 package gossh
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha1" // #nosec G505 -- optional SHA1 host key fingerprints for external inventories.
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall/js"
 	"time"
 
+	"golang.org/x/crypto/blake2b"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 )
 
 const (
-	// keepaliveInterval is the time between SSH keepalive pings.
+	// keepaliveInterval is the default time between SSH keepalive pings.
 	keepaliveInterval = 30 * time.Second
-	// keepaliveTimeout is how long to wait for a keepalive response.
+	// keepaliveTimeout is the default wait for a keepalive response.
 	keepaliveTimeout = 15 * time.Second
-	// dialTimeout is the maximum time to establish a WebSocket connection.
+	// keepaliveMaxFailures is the default number of keepalives in a row
+	// that may fail before the connection counts as lost.
+	keepaliveMaxFailures = 3
+	// minKeepaliveInterval keeps a configured interval from flooding the
+	// server.
+	minKeepaliveInterval = time.Second
+	// dialTimeout is the default maximum time to establish a WebSocket
+	// connection (dialTimeoutMs).
 	dialTimeout = 30 * time.Second
-	// sshHandshakeTimeout is the maximum time for the SSH handshake.
+	// sshHandshakeTimeout is the default maximum time for the SSH handshake
+	// up to host key verification (handshakeTimeoutMs).
 	sshHandshakeTimeout = 30 * time.Second
+	// maxConnectTimeout bounds dialTimeoutMs and handshakeTimeoutMs.
+	maxConnectTimeout = time.Hour
+	// minRekeyThreshold matches x/crypto/ssh's lower bound, below which a
+	// configured threshold would be silently raised.
+	minRekeyThreshold = 256
+	// maxRekeyThreshold is the largest integer a JS number holds exactly.
+	maxRekeyThreshold = 1<<53 - 1
+	// shellExitGrace is how long a shell's stdout EOF waits for its exit
+	// status, to tell an exit from a lost connection.
+	shellExitGrace = 5 * time.Second
+	// maxExecOutput bounds each of stdout and stderr captured by exec.
+	maxExecOutput = 16 * 1024 * 1024
 )
 
 // session holds all state for a single SSH connection.
 type session struct {
-	id         string
-	ctx        context.Context
-	cancel     context.CancelFunc
-	conn       *wsConn
-	sshClient  *ssh.Client
-	sshSession *ssh.Session
-	stdin      io.WriteCloser
-	onData     js.Value // callback(Uint8Array)
-	onClose    js.Value // callback(string)
-	closeOnce  sync.Once
+	id        string
+	ctx       context.Context
+	cancel    context.CancelFunc
+	onData    js.Value // callback(Uint8Array)
+	onStderr  js.Value // callback(Uint8Array), with separateStderr
+	onClose   js.Value // callback(string)
+	onEvent   js.Value // callback({type, ...}); see events.go
+	closeOnce sync.Once
 	// strictSFTPPaths enables optional conservative path policy checks.
 	strictSFTPPaths bool
+	// config is the connect config, kept so reconnect can dial again.
+	config js.Value
+
+	// connMu guards the connection and shell, which reconnect replaces.
+	// Read them through client, shellStdin, and forwardsAgent.
+	connMu     sync.Mutex
+	cc         *clientConn
+	pooled     *pooledConn // non-nil when cc is shared through the pool
+	sshClient  *ssh.Client
+	sshSession *ssh.Session // nil when connected with shell: false
+	stdin      io.WriteCloser
+	// agentForward is set when the connection was configured with
+	// agentForward and the forwarding handler was installed. Exec channels
+	// request forwarding by default when it is set.
+	agentForward bool
+	// connCancel stops the goroutines watching the current connection.
+	connCancel context.CancelFunc
+	// reconnectMu serializes reconnects.
+	reconnectMu sync.Mutex
+	// autoReconnect is set when the session was connected with
+	// autoReconnect; reconnecting while a reconnect loop runs.
+	autoReconnect *reconnectPolicy
+	reconnecting  atomic.Bool
+	// hostKey is the server's host key when the session was opened; every
+	// reconnect must present it (see hostKeyPin). hostKeyWarn is
+	// reconnectHostKeyPolicy 'warn'.
+	hostKey     ssh.PublicKey
+	hostKeyWarn bool
+
+	// ptys routes window changes to PTY-backed channels. The interactive
+	// shell is registered under the session ID; other PTY channels (exec
+	// with a PTY, multiplexed shells) use their own channel IDs.
+	ptyMu sync.Mutex
+	ptys  map[string]*ptyChannel
+
+	// pty and env are the shell's terminal settings and environment, so a
+	// reconnected shell requests the same terminal (at the last known size).
+	pty ptySettings
+	env map[string]string
+
+	// output is notified whenever the shell produces output; sendText
+	// uses it to wait for echo.
+	output outputNotifier
+	// input orders write calls with an in-progress sendText.
+	input inputQueue
+	// inputLimit caps the rate of write and sendText input; nil when the
+	// session was connected without inputRateLimit.
+	inputLimit *rateLimiter
+}
 
-	// Jump host resources (non-nil if ProxyJump was used).
-	jumpConn   *wsConn
-	jumpClient *ssh.Client
+// ptyChannel is one PTY-backed SSH channel and the last size sent for it.
+type ptyChannel struct {
+	session *ssh.Session
+	cols    int
+	rows    int
+}
+
+// ptySettings are the terminal parameters requested for the shell.
+type ptySettings struct {
+	term  string
+	modes ssh.TerminalModes
 }
 
+// defaultTerm is the TERM requested for the shell PTY unless overridden.
+const defaultTerm = "xterm-256color"
+
 // sessionStore is the global map of active sessions, keyed by session ID.
 var sessionStore sync.Map
 
@@ -57,322 +146,1472 @@ var sessionStore sync.Map
 // Called from JS as: GoSSH.connect(config) → Promise<sessionId>
 func sshConnect(config js.Value) js.Value {
 	return newPromise(func() (any, error) {
-		sessionID := generateID()
+		return connectSession(config)
+	})
+}
 
-		proxyURL := jsString(config.Get("proxyUrl"))
-		host := jsString(config.Get("host"))
-		port := jsInt(config.Get("port"), 22)
-		username := jsString(config.Get("username"))
-		allowInsecureWS := jsBool(config.Get("allowInsecureWS"))
-		strictSFTPPaths := jsBool(config.Get("strictSFTPPaths"))
+// sshConnectFull connects and, when config.sftp is set, opens an SFTP
+// session in the same call. config.sftp may be true or an sftpOpen options
+// object. If SFTP can't be opened the new SSH session is closed and the
+// promise rejects with the sftpOpen error (including its code).
+// Called from JS as: GoSSH.connectFull(config) → Promise<{sessionId, sftpId}>
+func sshConnectFull(config js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		sftpOpt := config.Get("sftp")
+		wantSFTP := sftpOpt.Type() == js.TypeObject || jsBool(sftpOpt)
 
-		if proxyURL == "" || host == "" || username == "" {
-			return nil, fmt.Errorf("connect: proxyUrl, host, and username are required")
+		sessionID, err := connectSession(config)
+		if err != nil {
+			return nil, err
+		}
+		result := map[string]any{"sessionId": sessionID, "sftpId": nil}
+		if !wantSFTP {
+			return result, nil
 		}
 
-		// Build auth methods for the final host.
-		authMethods, err := buildAuthMethods(config)
+		sftpID, err := openSFTPSession(sessionID, sftpOpt)
 		if err != nil {
-			return nil, fmt.Errorf("connect: %w", err)
+			if sess, lookupErr := getSession(sessionID); lookupErr == nil {
+				sess.close("connectFull: SFTP open failed")
+			}
+			return nil, err
 		}
+		result["sftpId"] = sftpID
+		return result, nil
+	})
+}
 
-		// Determine the transport: direct WS or through a jump host.
-		var netConn net.Conn
-		var jumpConn *wsConn
-		var jumpClient *ssh.Client
+// connectSession dials, authenticates, and starts the shell for config,
+// returning the new session ID. Shared by connect and connectFull.
+func connectSession(config js.Value) (string, error) {
+	sessionID := generateID()
+	if isAborted(config.Get("signal")) {
+		return "", errConnectAborted
+	}
+	strictSFTPPaths := jsBool(config.Get("strictSFTPPaths"))
+	inputRateLimit := jsInt(config.Get("inputRateLimit"), 0)
+	if inputRateLimit < 0 {
+		return "", fmt.Errorf("connect: inputRateLimit must not be negative")
+	}
+	autoReconnect, err := parseReconnectPolicy(config)
+	if err != nil {
+		return "", fmt.Errorf("connect: %w", err)
+	}
+	keepalive, err := parseKeepalive(config)
+	if err != nil {
+		return "", fmt.Errorf("connect: %w", err)
+	}
+	hostKeyWarn, err := parseReconnectHostKeyPolicy(config)
+	if err != nil {
+		return "", fmt.Errorf("connect: %w", err)
+	}
 
-		jumpConfig := config.Get("jumpHost")
-		hasJump := !jumpConfig.IsUndefined() && !jumpConfig.IsNull()
+	// With config.pool, reuse a live connection to the same destination
+	// and identity instead of dialing a new one.
+	poolKey, poolTTL, err := poolOptions(config)
+	if err != nil {
+		return "", fmt.Errorf("connect: %w", err)
+	}
+	var pooled *pooledConn
+	if poolKey != "" {
+		pooled = acquirePooled(poolKey)
+	}
+	dialed := pooled == nil
+	var cc *clientConn
+	if pooled != nil {
+		cc = pooled.cc
+	} else {
+		ctx, stop := abortContext(config.Get("signal"))
+		cc, err = dialClient(ctx, config, nil)
+		stop()
+		if err != nil {
+			return "", err
+		}
+		if poolKey != "" {
+			pooled = addPooled(poolKey, poolTTL, cc)
+		}
+	}
+	// Open the interactive shell unless the session is for SFTP/exec only.
+	var shell *shellChannel
+	if v := config.Get("shell"); v.Type() != js.TypeBoolean || v.Bool() {
+		shell, err = openShell(cc, config)
+		if err != nil {
+			if pooled != nil {
+				pooled.release()
+			} else {
+				cc.close()
+			}
+			return "", err
+		}
+		js.Global().Get("console").Call("log", "[gossh] Shell started OK, session:", sessionID)
+		shell.reportEnv(config)
+	}
 
-		if hasJump {
-			// Jump host (ProxyJump) — connect to bastion first, then tunnel through.
-			jumpHost := jsString(jumpConfig.Get("host"))
-			jumpPort := jsInt(jumpConfig.Get("port"), 22)
-			jumpUser := jsString(jumpConfig.Get("username"))
-			if jumpHost == "" || jumpUser == "" {
-				return nil, fmt.Errorf("connect: jumpHost requires host and username")
+	// Create session context for lifecycle management.
+	sessCtx, sessCancel := context.WithCancel(context.Background())
+	connCtx, connCancel := context.WithCancel(sessCtx)
+
+	sess := &session{
+		id:              sessionID,
+		ctx:             sessCtx,
+		cancel:          sessCancel,
+		config:          config,
+		cc:              cc,
+		pooled:          pooled,
+		sshClient:       cc.sshClient,
+		onData:          config.Get("onData"),
+		onStderr:        config.Get("onStderr"),
+		onClose:         config.Get("onClose"),
+		onEvent:         config.Get("onEvent"),
+		strictSFTPPaths: strictSFTPPaths,
+		agentForward:    cc.agentForward,
+		connCancel:      connCancel,
+		inputLimit:      newRateLimiter(inputRateLimit),
+		autoReconnect:   autoReconnect,
+		hostKey:         cc.info.hostKey,
+		hostKeyWarn:     hostKeyWarn,
+	}
+	if shell != nil {
+		sess.sshSession = shell.session
+		sess.stdin = shell.stdin
+		sess.pty = shell.pty
+		sess.env = shell.env
+		sess.registerPty(sessionID, shell.session, shell.cols, shell.rows)
+	}
+
+	sessionStore.Store(sessionID, sess)
+
+	// A reused connection is already watched by the session that dialed it.
+	sess.watchConn(connCtx, cc, shell, dialed)
+
+	if keepalive.interval > 0 {
+		spawn("session.keepalive", func() { sess.keepalive(keepalive) })
+	}
+
+	return sessionID, nil
+}
+
+// keepalivePolicy is the connect config's keepalive option.
+type keepalivePolicy struct {
+	interval    time.Duration // 0 disables keepalives
+	timeout     time.Duration
+	maxFailures int
+}
+
+// parseKeepalive reads keepalive: {intervalMs, timeoutMs, maxFailures},
+// each defaulting to today's 30 s, 15 s, and 3. intervalMs 0 disables
+// keepalives.
+func parseKeepalive(config js.Value) (keepalivePolicy, error) {
+	p := keepalivePolicy{interval: keepaliveInterval, timeout: keepaliveTimeout, maxFailures: keepaliveMaxFailures}
+	v := config.Get("keepalive")
+	if v.IsUndefined() || v.IsNull() {
+		return p, nil
+	}
+	if v.Type() != js.TypeObject {
+		return p, fmt.Errorf("keepalive must be an object")
+	}
+	if ms := v.Get("intervalMs"); ms.Type() == js.TypeNumber && ms.Float() == 0 {
+		return keepalivePolicy{}, nil
+	}
+	var err error
+	if p.interval, err = timeoutFromConfig(v, "intervalMs", keepaliveInterval); err != nil {
+		return p, fmt.Errorf("keepalive: %w", err)
+	}
+	if p.interval < minKeepaliveInterval {
+		return p, fmt.Errorf("keepalive: intervalMs must be 0 or at least %d", minKeepaliveInterval.Milliseconds())
+	}
+	if p.timeout, err = timeoutFromConfig(v, "timeoutMs", keepaliveTimeout); err != nil {
+		return p, fmt.Errorf("keepalive: %w", err)
+	}
+	p.maxFailures = jsInt(v.Get("maxFailures"), keepaliveMaxFailures)
+	if p.maxFailures < 1 || p.maxFailures > 100 {
+		return p, fmt.Errorf("keepalive: maxFailures must be between 1 and 100")
+	}
+	return p, nil
+}
+
+// keepalive pings the server every interval until the session closes. A
+// ping with no reply within the timeout fails; maxFailures in a row mean
+// the connection is lost (see connectionLost).
+func (s *session) keepalive(p keepalivePolicy) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if s.reconnecting.Load() {
+				failures = 0
+				continue
+			}
+			if err := ping(s.client(), p.timeout); err != nil {
+				failures++
+				s.emit("keepalive_failed", map[string]any{"attempt": failures, "error": err.Error()})
+				if failures >= p.maxFailures {
+					failures = 0
+					if !s.connectionLost(fmt.Sprintf("keepalive failed after %d attempts", p.maxFailures)) {
+						return
+					}
+				}
+				continue
+			}
+			if failures > 0 {
+				s.emit("keepalive_recovered", map[string]any{"attempts": failures})
+			}
+			failures = 0
+		}
+	}
+}
+
+// ping sends a keepalive request and waits up to timeout for the reply. A
+// hung connection never answers; its request goroutine ends when the
+// connection is closed.
+func ping(client *ssh.Client, timeout time.Duration) error {
+	done := make(chan error, 1)
+	spawn("session.ping", func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		done <- err
+	})
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("no reply in %v", timeout)
+	}
+}
+
+// watchConn starts the goroutines tied to the session's current connection
+// and shell: the shell readers, or without a shell a watcher that closes
+// the session with the connection, and the onStall watcher when stall is
+// set. Those that poll stop with ctx.
+func (s *session) watchConn(ctx context.Context, cc *clientConn, shell *shellChannel, stall bool) {
+	if shell != nil {
+		s.startShellReaders(shell, s.config)
+	} else {
+		// Without a shell there is no stdout EOF to signal the end of the
+		// connection, so watch the client itself.
+		spawn("session.connWatch", func() {
+			_ = cc.sshClient.Wait()
+			if s.client() == cc.sshClient {
+				s.connectionLost("connection closed")
 			}
+		})
+	}
+	if onStall, ok := getCallback(s.config, "onStall"); ok && stall && cc.metered != nil {
+		probe := func() {
+			_, _, _ = cc.sshClient.SendRequest("keepalive@openssh.com", true, nil)
+		}
+		timeout := stallTimeoutFromConfig(s.config)
+		spawn("session.stall", func() { watchStall(ctx, cc.metered, timeout, onStall, probe) })
+	}
+}
 
-			jumpAuth, err := buildAuthMethods(jumpConfig)
-			if err != nil {
-				return nil, fmt.Errorf("connect: jump host: %w", err)
+// client returns the session's current SSH client.
+func (s *session) client() *ssh.Client {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	return s.sshClient
+}
+
+// shellStdin returns the shell's stdin, or nil without a shell.
+func (s *session) shellStdin() io.WriteCloser {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	return s.stdin
+}
+
+// isShell reports whether sshSession is the session's current shell.
+func (s *session) isShell(sshSession *ssh.Session) bool {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	return s.sshSession == sshSession
+}
+
+// forwardsAgent reports whether agent forwarding is set up on the current
+// connection.
+func (s *session) forwardsAgent() bool {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	return s.agentForward
+}
+
+// clientConn is an authenticated SSH connection and the transport under
+// it. Sessions own theirs unless it is pooled (see pool.go).
+type clientConn struct {
+	sshClient *ssh.Client
+	conn      *wsConn // nil when tunneled through a jump host
+	// metered is set when the connect config had onStall.
+	metered *meteredConn
+	// agentForward is set when the forwarding handler was installed.
+	agentForward bool
+	// x11 is set when the connect config had x11Forward; shells on the
+	// connection request X11 forwarding.
+	x11 *x11Forward
+	// info is what the handshake negotiated.
+	info connInfo
+
+	// Jump host resources (non-nil if ProxyJump was used).
+	jumpConn   *wsConn
+	jumpClient *ssh.Client
+}
+
+// close closes the SSH connection and its transport.
+func (c *clientConn) close() {
+	if c.sshClient != nil {
+		closeQuietly(c.sshClient)
+	}
+	if c.conn != nil {
+		closeQuietly(c.conn)
+	}
+	if c.jumpClient != nil {
+		closeQuietly(c.jumpClient)
+	}
+	if c.jumpConn != nil {
+		closeQuietly(c.jumpConn)
+	}
+}
+
+// dialClient dials the proxy (through a jump host if configured),
+// authenticates, and installs agent forwarding, returning the connection.
+// Cancelling ctx abandons the dial: a pending host-key prompt is rejected
+// and the transport closed, and the error is errConnectAborted. A non-nil
+// pin is checked before the config's host key verification (reconnects).
+func dialClient(ctx context.Context, config js.Value, pin *hostKeyPin) (*clientConn, error) {
+	proxyURL := jsString(config.Get("proxyUrl"))
+	host := jsString(config.Get("host"))
+	port := jsInt(config.Get("port"), 22)
+	username := jsString(config.Get("username"))
+	allowInsecureWS := jsBool(config.Get("allowInsecureWS"))
+
+	if proxyURL == "" || host == "" || username == "" {
+		return nil, fmt.Errorf("connect: proxyUrl, host, and username are required")
+	}
+
+	// Build auth methods for the final host.
+	authMethods, err := buildAuthMethods(config)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	rekeyThreshold, err := rekeyThresholdFromConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	algorithms, err := algorithmsFromConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	x11, err := parseX11Forward(config, allowInsecureWS)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	dialLimit, err := timeoutFromConfig(config, "dialTimeoutMs", dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	handshakeLimit, err := timeoutFromConfig(config, "handshakeTimeoutMs", sshHandshakeTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	// SSH compression has to happen before encryption, inside the SSH
+	// transport, and x/crypto/ssh doesn't offer it.
+	if jsBool(config.Get("compression")) {
+		logWarnf("compression is not supported (golang.org/x/crypto/ssh has no zlib@openssh.com); connecting uncompressed")
+	}
+
+	wsOpts, err := wsOptionsFromConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	// Determine the transport: direct WS or through a jump host.
+	var netConn net.Conn
+	var jumpConn *wsConn
+	var jumpClient *ssh.Client
+
+	jumpConfig := config.Get("jumpHost")
+	hasJump := !jumpConfig.IsUndefined() && !jumpConfig.IsNull()
+
+	if hasJump {
+		// Jump host (ProxyJump) — connect to bastion first, then tunnel through.
+		jumpHost := jsString(jumpConfig.Get("host"))
+		jumpPort := jsInt(jumpConfig.Get("port"), 22)
+		jumpUser := jsString(jumpConfig.Get("username"))
+		if jumpHost == "" || jumpUser == "" {
+			return nil, fmt.Errorf("connect: jumpHost requires host and username")
+		}
+
+		jumpAuth, err := buildAuthMethods(jumpConfig)
+		if err != nil {
+			return nil, fmt.Errorf("connect: jump host: %w", err)
+		}
+
+		// Build WS URL for jump host.
+		jumpProxyURL := jsString(jumpConfig.Get("proxyUrl"))
+		if jumpProxyURL == "" {
+			jumpProxyURL = proxyURL
+		}
+		jumpAllowInsecureWS := allowInsecureWS || jsBool(jumpConfig.Get("allowInsecureWS"))
+		u, err := parseWebSocketURL(jumpProxyURL, jumpAllowInsecureWS)
+		if err != nil {
+			return nil, fmt.Errorf("connect: jump host proxy: %w", err)
+		}
+		q := u.Query()
+		q.Set("host", jumpHost)
+		q.Set("port", fmt.Sprintf("%d", jumpPort))
+		if token := jsString(config.Get("token")); token != "" {
+			q.Set("token", token)
+		}
+		u.RawQuery = q.Encode()
+
+		dialCtx, dialCancel := context.WithTimeout(ctx, dialLimit)
+		defer dialCancel()
+
+		jConn, err := DialWebSocketWithOptions(dialCtx, u.String(), wsOpts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, errConnectAborted
 			}
+			return nil, wsDialError("connect: failed to establish jump-host WebSocket", err)
+		}
+		jumpConn = jConn.(*wsConn)
 
-			// Build WS URL for jump host.
-			jumpProxyURL := jsString(jumpConfig.Get("proxyUrl"))
-			if jumpProxyURL == "" {
-				jumpProxyURL = proxyURL
+		jumpRekey, err := rekeyThresholdFromConfig(jumpConfig)
+		if err != nil {
+			closeQuietly(jConn)
+			return nil, fmt.Errorf("connect: jump host: %w", err)
+		}
+		jumpAlgorithms, err := algorithmsFromConfig(jumpConfig)
+		if err != nil {
+			closeQuietly(jConn)
+			return nil, fmt.Errorf("connect: jump host: %w", err)
+		}
+
+		jVersion := newVersionConn(jConn)
+		jSSHConfig := &ssh.ClientConfig{
+			User:            jumpUser,
+			Auth:            jumpAuth,
+			HostKeyCallback: makeHostKeyCallbackWithBanner(ctx, jumpConfig, jVersion),
+		}
+		jSSHConfig.RekeyThreshold = jumpRekey
+		jumpAlgorithms.apply(jSSHConfig)
+
+		jSSHConn, jChans, jReqs, err := clientHandshake(ctx, jVersion, fmt.Sprintf("%s:%d", jumpHost, jumpPort), jSSHConfig, handshakeLimit)
+		if err != nil {
+			closeQuietly(jConn)
+			if rejected := wsRejection(jumpConn); rejected != nil {
+				return nil, wsDialError("connect: failed to establish jump-host WebSocket", rejected)
 			}
-			jumpAllowInsecureWS := allowInsecureWS || jsBool(jumpConfig.Get("allowInsecureWS"))
-			u, err := parseWebSocketURL(jumpProxyURL, jumpAllowInsecureWS)
-			if err != nil {
-				return nil, fmt.Errorf("connect: jump host proxy: %w", err)
+			return nil, handshakeError("connect: jump-host SSH handshake failed", err)
+		}
+		jumpClient = ssh.NewClient(jSSHConn, jChans, jReqs)
+
+		// Tunnel through jump host to final destination.
+		netConn, err = jumpClient.Dial("tcp", fmt.Sprintf("%s:%d", host, port))
+		if err != nil {
+			closeQuietly(jumpClient)
+			return nil, publicErr("connect: jump-host tunnel failed", err)
+		}
+	} else {
+		// Direct connection through WebSocket proxy.
+		u, err := parseWebSocketURL(proxyURL, allowInsecureWS)
+		if err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		q.Set("host", host)
+		q.Set("port", fmt.Sprintf("%d", port))
+		if token := jsString(config.Get("token")); token != "" {
+			q.Set("token", token)
+		}
+		u.RawQuery = q.Encode()
+
+		dialCtx, dialCancel := context.WithTimeout(ctx, dialLimit)
+		defer dialCancel()
+
+		netConn, err = DialWebSocketWithOptions(dialCtx, u.String(), wsOpts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, errConnectAborted
 			}
-			q := u.Query()
-			q.Set("host", jumpHost)
-			q.Set("port", fmt.Sprintf("%d", jumpPort))
-			if token := jsString(config.Get("token")); token != "" {
-				q.Set("token", token)
+			return nil, wsDialError("connect: failed to establish WebSocket", err)
+		}
+	}
+
+	cc := &clientConn{jumpConn: jumpConn, jumpClient: jumpClient, x11: x11}
+	// conn may be a *wsConn (direct) or nil (jump host — cleanup via jumpConn).
+	if wc, ok := netConn.(*wsConn); ok {
+		cc.conn = wc
+	}
+
+	// Stall detection meters the transport to the final host, so it
+	// covers both the direct and the jump-host tunnel case.
+	if _, hasOnStall := getCallback(config, "onStall"); hasOnStall {
+		cc.metered = newMeteredConn(netConn)
+		netConn = cc.metered
+	}
+
+	// Capture the server identification line so onHostKey can show it.
+	version := newVersionConn(netConn)
+	netConn = version
+
+	// Build SSH client config for the final host.
+	sshConfig := &ssh.ClientConfig{
+		User:            username,
+		Auth:            authMethods,
+		HostKeyCallback: makeHostKeyCallbackWithBanner(ctx, config, version),
+	}
+	sshConfig.RekeyThreshold = rekeyThreshold
+	algorithms.apply(sshConfig)
+	var hostKey ssh.PublicKey
+	verifyHostKey := sshConfig.HostKeyCallback
+	sshConfig.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		hostKey = key
+		if pin != nil {
+			if same, err := pin.check(hostname, key); same || err != nil {
+				return err
 			}
-			u.RawQuery = q.Encode()
+		}
+		return verifyHostKey(hostname, remote, key)
+	}
+
+	// SSH handshake over the transport (direct WS or tunneled through jump host).
+	sshConn, chans, reqs, err := clientHandshake(ctx, netConn, fmt.Sprintf("%s:%d", host, port), sshConfig, handshakeLimit)
+	if err != nil {
+		closeQuietly(netConn)
+		if jumpClient != nil {
+			closeQuietly(jumpClient)
+		}
+		if rejected := wsRejection(cc.conn); rejected != nil {
+			return nil, wsDialError("connect: failed to establish WebSocket", rejected)
+		}
+		return nil, handshakeError("connect: SSH handshake failed", err)
+	}
 
-			dialCtx, dialCancel := context.WithTimeout(context.Background(), dialTimeout)
-			defer dialCancel()
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+	cc.sshClient = sshClient
+	cc.info = newConnInfo(sshConn, hostKey)
+	// Only the first hop is a WebSocket.
+	if jumpConn != nil {
+		cc.info.wsProtocol = jumpConn.Protocol()
+	} else if cc.conn != nil {
+		cc.info.wsProtocol = cc.conn.Protocol()
+	}
 
-			jConn, err := DialWebSocket(dialCtx, u.String())
-			if err != nil {
-				return nil, publicErr("connect: failed to establish jump-host WebSocket", err)
+	// Set up agent forwarding if requested.
+	if jsBool(config.Get("agentForward")) && globalAgent != nil {
+		scope, err := parseAgentForwardScope(config)
+		if err != nil {
+			cc.close()
+			return nil, fmt.Errorf("connect: %w", err)
+		}
+		if scope != nil {
+			err = forwardScopedAgent(sshClient, globalAgent, scope)
+		} else {
+			err = agent.ForwardToAgent(sshClient, globalAgent)
+		}
+		if err != nil {
+			js.Global().Get("console").Call("warn",
+				"[gossh] Agent forwarding setup failed:", err.Error())
+		} else {
+			cc.agentForward = true
+			js.Global().Get("console").Call("info",
+				"[gossh] SSH agent forwarding enabled — the remote server can use your keys to connect to other servers.")
+		}
+	}
+
+	handleX11Channels(sshClient, config.Get("onX11Request"), x11)
+
+	// Handle SSH banner.
+	if banner := sshConn.ServerVersion(); len(banner) > 0 {
+		if onBanner, ok := getCallback(config, "onBanner"); ok {
+			onBanner.Invoke(maskControl(string(banner)))
+		}
+		emitEvent(config.Get("onEvent"), "banner", map[string]any{"banner": maskControl(string(banner))})
+	}
+
+	return cc, nil
+}
+
+// wsOptionsFromConfig reads the WebSocket options: coalesceReads,
+// wsSubprotocols and wsProtocolAuth, and transport: {readBufferFrames,
+// overflowBytes, writeChunkBytes, maxMessageBytes}.
+func wsOptionsFromConfig(config js.Value) (WSOptions, error) {
+	// coalesceReads: false trades bulk throughput for per-message latency.
+	coalesce := config.Get("coalesceReads")
+	opts := WSOptions{NoReadCoalescing: coalesce.Type() == js.TypeBoolean && !coalesce.Bool()}
+	var err error
+	if opts.Subprotocols, err = wsSubprotocolsFromConfig(config); err != nil {
+		return opts, err
+	}
+	t := config.Get("transport")
+	if t.Type() != js.TypeObject {
+		return opts, nil
+	}
+	for _, f := range []struct {
+		name     string
+		dst      *int
+		min, max int
+	}{
+		{"readBufferFrames", &opts.ReadBufferFrames, minWSReadChanSize, maxWSReadChanSize},
+		{"overflowBytes", &opts.OverflowBytes, minWSOverflowSize, maxWSOverflowSize},
+		{"writeChunkBytes", &opts.WriteChunkBytes, minWSWriteChunkSize, maxWSWriteChunkSize},
+		{"maxMessageBytes", &opts.MaxMessageBytes, minWSMaxMessageSize, maxWSMaxMessageSize},
+	} {
+		v := t.Get(f.name)
+		if v.IsUndefined() {
+			continue
+		}
+		n := -1
+		if v.Type() == js.TypeNumber {
+			n = v.Int()
+		}
+		if n < f.min || n > f.max {
+			return opts, fmt.Errorf("transport.%s must be between %d and %d", f.name, f.min, f.max)
+		}
+		*f.dst = n
+	}
+	return opts, nil
+}
+
+// wsAuthProtocolPrefix starts the subprotocol wsProtocolAuth adds; the
+// rest is the token, base64url-encoded without padding.
+const wsAuthProtocolPrefix = "base64url.bearer."
+
+// wsSubprotocolsFromConfig reads wsSubprotocols, a list of subprotocols to
+// offer, and wsProtocolAuth, a token to offer as one more. Browsers can't
+// set an Authorization header on a WebSocket, so proxies that won't take
+// a token in the query string commonly read it from a subprotocol
+// instead; encoding it makes any token a valid one.
+func wsSubprotocolsFromConfig(config js.Value) ([]string, error) {
+	var protocols []string
+	if v := config.Get("wsSubprotocols"); !v.IsUndefined() && !v.IsNull() {
+		if !js.Global().Get("Array").Call("isArray", v).Bool() {
+			return nil, fmt.Errorf("wsSubprotocols must be an array of strings")
+		}
+		for i := 0; i < v.Length(); i++ {
+			p := v.Index(i)
+			if p.Type() != js.TypeString || !validSubprotocol(p.String()) {
+				return nil, fmt.Errorf("wsSubprotocols[%d] is not a valid subprotocol", i)
 			}
-			jumpConn = jConn.(*wsConn)
+			protocols = append(protocols, p.String())
+		}
+	}
+	if token := jsString(config.Get("wsProtocolAuth")); token != "" {
+		protocols = append(protocols, wsAuthProtocolPrefix+base64.RawURLEncoding.EncodeToString([]byte(token)))
+	}
+	seen := make(map[string]bool, len(protocols))
+	for _, p := range protocols {
+		if seen[p] {
+			return nil, fmt.Errorf("wsSubprotocols: %q is offered twice", p)
+		}
+		seen[p] = true
+	}
+	return protocols, nil
+}
+
+// shellChannel is the interactive shell channel opened by connect.
+type shellChannel struct {
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  io.Reader
+	// stderr is the shell's stderr with separateStderr, else nil: the
+	// stream is dropped, and with a PTY the server merges it into stdout
+	// anyway.
+	stderr io.Reader
+	pty    ptySettings
+	env    map[string]string
+	// envAccepted and envRejected split the env names by the server's
+	// reply, in sorted order.
+	envAccepted []string
+	envRejected []string
+	cols        int
+	rows        int
+}
 
-			jSSHConfig := &ssh.ClientConfig{
-				User:            jumpUser,
-				Auth:            jumpAuth,
-				HostKeyCallback: makeHostKeyCallback(jumpConfig),
-				Timeout:         sshHandshakeTimeout,
+// openShell opens the interactive shell configured by config (term, env,
+// cols, rows). The caller owns cc.
+func openShell(cc *clientConn, config js.Value) (*shellChannel, error) {
+	pty, err := parsePtySettings(config)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	env, err := parseEnv(config)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	return startShell(cc, pty, env, jsInt(config.Get("cols"), 80), jsInt(config.Get("rows"), 24), jsBool(config.Get("separateStderr")))
+}
+
+// startShell opens a session channel with agent and X11 forwarding (if
+// enabled), a PTY, the environment, stdio pipes, and the login shell. The
+// channel is closed on failure. Variables the server refuses (see
+// AcceptEnv) are logged and skipped. With separateStderr, stderr gets a
+// pipe of its own.
+func startShell(cc *clientConn, pty ptySettings, env map[string]string, cols, rows int, separateStderr bool) (*shellChannel, error) {
+	// Open an SSH session for the terminal.
+	sshSession, err := cc.sshClient.NewSession()
+	if err != nil {
+		return nil, publicErr("connect: failed to open SSH session", err)
+	}
+
+	// Request agent forwarding on the session if enabled.
+	if cc.agentForward {
+		_ = agent.RequestAgentForwarding(sshSession)
+	}
+	if cc.x11 != nil {
+		cc.x11.request(sshSession)
+	}
+
+	// Request PTY.
+	consoleLog := js.Global().Get("console")
+	consoleLog.Call("log", "[gossh] Requesting PTY", cols, "x", rows)
+
+	if err := requestPty(sshSession, pty, cols, rows); err != nil {
+		closeQuietly(sshSession)
+		return nil, publicErr("connect: PTY request failed", err)
+	}
+	consoleLog.Call("log", "[gossh] PTY allocated OK")
+
+	envAccepted, envRejected := setEnv(sshSession, env)
+	for _, name := range envRejected {
+		logWarnf("env " + name + " refused by server")
+	}
+
+	// Set up stdin pipe.
+	stdin, err := sshSession.StdinPipe()
+	if err != nil {
+		closeQuietly(sshSession)
+		return nil, publicErr("connect: failed to open stdin pipe", err)
+	}
+
+	// Set up stdout pipe.
+	stdout, err := sshSession.StdoutPipe()
+	if err != nil {
+		closeQuietly(sshSession)
+		return nil, publicErr("connect: failed to open stdout pipe", err)
+	}
+	var stderr io.Reader
+	if separateStderr {
+		stderr, err = sshSession.StderrPipe()
+		if err != nil {
+			closeQuietly(sshSession)
+			return nil, publicErr("connect: failed to open stderr pipe", err)
+		}
+	}
+	consoleLog.Call("log", "[gossh] Pipes created, starting shell...")
+
+	// Start shell.
+	if err := sshSession.Shell(); err != nil {
+		closeQuietly(sshSession)
+		return nil, publicErr("connect: failed to start shell", err)
+	}
+
+	return &shellChannel{
+		session:     sshSession,
+		stdin:       stdin,
+		stdout:      stdout,
+		stderr:      stderr,
+		pty:         pty,
+		env:         env,
+		envAccepted: envAccepted,
+		envRejected: envRejected,
+		cols:        cols,
+		rows:        rows,
+	}, nil
+}
+
+// reportEnv tells config.onEnv which variables the server accepted. It
+// isn't called when no environment was sent.
+func (sh *shellChannel) reportEnv(config js.Value) {
+	onEnv, ok := getCallback(config, "onEnv")
+	if !ok || len(sh.env) == 0 {
+		return
+	}
+	onEnv.Invoke(envReport(sh.envAccepted, sh.envRejected))
+}
+
+// startShellReaders starts the goroutines that wait on the shell and
+// deliver its output. The session ends when the shell's stdout closes,
+// once stderr (with separateStderr) has closed too. config is read here,
+// before the goroutines start.
+func (s *session) startShellReaders(shell *shellChannel, config js.Value) {
+	// Goroutine: wait for SSH session to finish.
+	// sshSession.Wait() keeps the channel alive until the remote shell exits.
+	waitErr := make(chan error, 1)
+	spawn("session.wait", func() {
+		err := shell.session.Wait()
+		waitErr <- err
+		if err != nil {
+			js.Global().Get("console").Call("log", "[gossh] session.Wait() returned:", err.Error())
+		} else {
+			js.Global().Get("console").Call("log", "[gossh] session.Wait() returned: clean exit")
+		}
+	})
+
+	// Line mode: reassemble output into complete lines for onLine.
+	var lines *lineSplitter
+	if onLine, ok := getCallback(config, "onLine"); ok && jsBool(config.Get("lineMode")) {
+		lines = newLineSplitter(jsInt(config.Get("maxLineLength"), defaultMaxLineLength), func(line string) {
+			onLine.Invoke(line)
+		})
+	}
+
+	// Goroutine: with separateStderr, read stderr and forward it to
+	// onStderr. The stdout reader waits for it to finish, so onClose
+	// comes after the last stderr chunk.
+	stderrDone := make(chan struct{})
+	if shell.stderr != nil {
+		spawn("session.stderr", func() {
+			defer close(stderrDone)
+			onStderr := s.onStderr
+			buf := make([]byte, 32*1024)
+			for {
+				n, err := shell.stderr.Read(buf)
+				if n > 0 && onStderr.Type() == js.TypeFunction {
+					onStderr.Invoke(bytesToUint8Array(buf[:n]))
+				}
+				if err != nil {
+					return
+				}
 			}
+		})
+	} else {
+		close(stderrDone)
+	}
 
-			jSSHConn, jChans, jReqs, err := ssh.NewClientConn(jConn, fmt.Sprintf("%s:%d", jumpHost, jumpPort), jSSHConfig)
+	// Goroutine: read stdout and forward to JS onData callback.
+	// Uses s.onData (copied js.Value) — NOT config.Get("onData") —
+	// because config may be GC'd by JS after connect() Promise resolves.
+	spawn("session.stdout", func() {
+		js.Global().Get("console").Call("log", "[gossh] stdout reader goroutine started")
+		onData := s.onData
+		buf := make([]byte, 32*1024)
+		readCount := 0
+		for {
+			n, err := shell.stdout.Read(buf)
+			readCount++
+			if n > 0 {
+				js.Global().Get("console").Call("log", "[gossh] stdout read:", n, "bytes (read #"+fmt.Sprintf("%d", readCount)+")")
+				if !onData.IsUndefined() && !onData.IsNull() && onData.Type() == js.TypeFunction {
+					onData.Invoke(bytesToUint8Array(buf[:n]))
+				}
+				if lines != nil {
+					lines.Write(buf[:n])
+				}
+				s.output.notify()
+			}
 			if err != nil {
-				closeQuietly(jConn)
-				return nil, publicErr("connect: jump-host SSH handshake failed", err)
+				js.Global().Get("console").Call("log", "[gossh] stdout read error:", err.Error(), "(read #"+fmt.Sprintf("%d", readCount)+")")
+				break
+			}
+		}
+		if lines != nil {
+			lines.Flush()
+		}
+		<-stderrDone
+		// A shell replaced by reconnect ends without ending the session.
+		if !s.isShell(shell.session) {
+			return
+		}
+		// The exit status goes to onClose. With autoReconnect, a shell that
+		// ended without one went with the connection. A channel held open
+		// after EOF isn't waited for long.
+		var exit map[string]any
+		select {
+		case err := <-waitErr:
+			if s.autoReconnect != nil && shellLost(err) {
+				s.connectionLost("connection lost")
+				return
+			}
+			exit = shellExit(err)
+		case <-time.After(shellExitGrace):
+		}
+		s.closeWithExit("session ended", exit)
+	})
+}
+
+// parsePtySettings reads the shell's PTY parameters from the connect config.
+func parsePtySettings(config js.Value) (ptySettings, error) {
+	term := jsString(config.Get("term"))
+	if term == "" {
+		term = defaultTerm
+	}
+	if len(term) > 64 || containsCTL(term) || strings.ContainsAny(term, " \t") {
+		return ptySettings{}, fmt.Errorf("invalid term %q", term)
+	}
+	return ptySettings{
+		term: term,
+		modes: ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		},
+	}, nil
+}
+
+// maxShellEnv bounds the number of variables in config.env.
+const maxShellEnv = 64
+
+// parseEnv reads config.env, the variables set on the shell, or exec's
+// opts.env. Names must be non-empty without "=" or control characters, and
+// values must not contain CR, LF, or NUL, so nothing can be smuggled into
+// the request.
+func parseEnv(config js.Value) (map[string]string, error) {
+	v := jsGet(config, "env")
+	if v.IsUndefined() || v.IsNull() {
+		return nil, nil
+	}
+	if v.Type() != js.TypeObject {
+		return nil, fmt.Errorf("env must be an object")
+	}
+	keys := js.Global().Get("Object").Call("keys", v)
+	if keys.Length() > maxShellEnv {
+		return nil, fmt.Errorf("env has more than %d variables", maxShellEnv)
+	}
+	env := make(map[string]string, keys.Length())
+	for i := 0; i < keys.Length(); i++ {
+		name := keys.Index(i).String()
+		value := jsString(v.Get(name))
+		if name == "" || strings.Contains(name, "=") || containsCTL(name) {
+			return nil, fmt.Errorf("invalid env name %q", name)
+		}
+		if containsCRLF(value) || strings.ContainsRune(value, 0) {
+			return nil, fmt.Errorf("env %s: value contains CR, LF, or NUL", name)
+		}
+		env[name] = value
+	}
+	return env, nil
+}
+
+// rekeyThresholdFromConfig reads the optional rekeyThreshold: the number of
+// bytes after which the connection rekeys. 0 or unset keeps the library
+// default (1 GB).
+func rekeyThresholdFromConfig(config js.Value) (uint64, error) {
+	v := config.Get("rekeyThreshold")
+	if v.IsUndefined() || v.IsNull() {
+		return 0, nil
+	}
+	if v.Type() != js.TypeNumber {
+		return 0, fmt.Errorf("rekeyThreshold must be a number")
+	}
+	n := v.Float()
+	if n == 0 {
+		return 0, nil
+	}
+	if n != float64(uint64(n)) || n < minRekeyThreshold || n > maxRekeyThreshold {
+		return 0, fmt.Errorf("rekeyThreshold must be an integer between %d and %d", minRekeyThreshold, uint64(maxRekeyThreshold))
+	}
+	return uint64(n), nil
+}
+
+// algorithmPrefs is the optional algorithms block of a connect config.
+// A nil list keeps the library default for that slot.
+type algorithmPrefs struct {
+	ciphers, macs, keyExchanges, hostKeyAlgorithms []string
+}
+
+// algorithmsFromConfig reads config.algorithms: {ciphers, macs,
+// keyExchanges, hostKeyAlgorithms}, each a preference-ordered list of names
+// the library implements. Names it considers insecure are allowed, since
+// old servers may offer nothing else; the caller has opted in by naming them.
+func algorithmsFromConfig(config js.Value) (algorithmPrefs, error) {
+	var prefs algorithmPrefs
+	v := config.Get("algorithms")
+	if v.IsUndefined() || v.IsNull() {
+		return prefs, nil
+	}
+	if v.Type() != js.TypeObject {
+		return prefs, fmt.Errorf("algorithms must be an object")
+	}
+	supported, insecure := ssh.SupportedAlgorithms(), ssh.InsecureAlgorithms()
+	for _, f := range []struct {
+		name  string
+		known []string
+		dst   *[]string
+	}{
+		{"ciphers", append(supported.Ciphers, insecure.Ciphers...), &prefs.ciphers},
+		{"macs", append(supported.MACs, insecure.MACs...), &prefs.macs},
+		{"keyExchanges", append(supported.KeyExchanges, insecure.KeyExchanges...), &prefs.keyExchanges},
+		{"hostKeyAlgorithms", append(supported.HostKeys, insecure.HostKeys...), &prefs.hostKeyAlgorithms},
+	} {
+		list := v.Get(f.name)
+		if list.IsUndefined() || list.IsNull() {
+			continue
+		}
+		if list.Type() != js.TypeObject || !js.Global().Get("Array").Call("isArray", list).Bool() || list.Length() == 0 {
+			return prefs, fmt.Errorf("algorithms.%s must be a non-empty array of names", f.name)
+		}
+		names := make([]string, list.Length())
+		for i := range names {
+			names[i] = jsString(list.Index(i))
+			if !slices.Contains(f.known, names[i]) {
+				return prefs, fmt.Errorf("algorithms.%s: unknown algorithm %q (supported: %s)", f.name, names[i], strings.Join(f.known, ", "))
 			}
-			jumpClient = ssh.NewClient(jSSHConn, jChans, jReqs)
+		}
+		*f.dst = names
+	}
+	return prefs, nil
+}
+
+// apply sets the chosen algorithms on cfg.
+func (a algorithmPrefs) apply(cfg *ssh.ClientConfig) {
+	cfg.Ciphers = a.ciphers
+	cfg.MACs = a.macs
+	cfg.KeyExchanges = a.keyExchanges
+	cfg.HostKeyAlgorithms = a.hostKeyAlgorithms
+}
+
+// timeoutFromConfig reads a millisecond timeout, def when absent.
+func timeoutFromConfig(config js.Value, name string, def time.Duration) (time.Duration, error) {
+	v := config.Get(name)
+	if v.IsUndefined() || v.IsNull() {
+		return def, nil
+	}
+	if v.Type() != js.TypeNumber {
+		return 0, fmt.Errorf("%s must be a number", name)
+	}
+	ms := v.Float()
+	if !(ms >= 1 && ms <= float64(maxConnectTimeout.Milliseconds())) {
+		return 0, fmt.Errorf("%s must be between 1 and %d", name, maxConnectTimeout.Milliseconds())
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
+
+// clientHandshake runs the SSH handshake on conn. timeout bounds the
+// protocol exchange up to host key verification; from there on the wait is
+// for the user (onHostKey, keyboard-interactive) and the server's own
+// login grace time. On timeout conn is closed, which fails the handshake.
+// ssh.ClientConfig.Timeout can't do this: it only applies to ssh.Dial.
+// Cancelling ctx closes conn too, at any point in the handshake, and the
+// error is then errConnectAborted.
+func clientHandshake(ctx context.Context, conn net.Conn, addr string, cfg *ssh.ClientConfig, timeout time.Duration) (ssh.Conn, <-chan ssh.NewChannel, <-chan *ssh.Request, error) {
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(timeout, func() {
+		timedOut.Store(true)
+		closeQuietly(conn)
+	})
+	defer timer.Stop()
+	stopAbort := context.AfterFunc(ctx, func() { closeQuietly(conn) })
+	defer stopAbort()
+	verify := cfg.HostKeyCallback
+	cfg.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		timer.Stop()
+		return verify(hostname, remote, key)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
+	if err != nil && ctx.Err() != nil {
+		return nil, nil, nil, errConnectAborted
+	}
+	if err != nil && timedOut.Load() {
+		err = fmt.Errorf("no host key from the server within %s", timeout)
+	}
+	return c, chans, reqs, err
+}
+
+// requestPty requests a PTY with the given settings and size. Used for the
+// initial shell, for exec PTYs, and by reconnect, where cols/rows come from
+// the last size recorded by resize rather than the connect defaults.
+func requestPty(sshSession *ssh.Session, pty ptySettings, cols, rows int) error {
+	return sshSession.RequestPty(pty.term, rows, cols, pty.modes)
+}
+
+// newExecSession opens a channel for running a command. When forwardAgent
+// is true, agent forwarding is requested on the channel so the command (e.g.
+// git over ssh) can reach the forwarded agent.
+func (s *session) newExecSession(forwardAgent bool) (*ssh.Session, error) {
+	sshSession, err := s.client().NewSession()
+	if err != nil {
+		return nil, err
+	}
+	if forwardAgent && s.forwardsAgent() {
+		if err := agent.RequestAgentForwarding(sshSession); err != nil {
+			logWarnf("agent forwarding request on exec channel failed:", err.Error())
+		}
+	}
+	return sshSession, nil
+}
+
+// execAgentForward resolves a per-call agentForward option against the
+// connection's setting. A call may opt out, but cannot enable forwarding on
+// a connection that was not configured for it.
+func (s *session) execAgentForward(opts js.Value) bool {
+	v := jsGet(opts, "agentForward")
+	if v.Type() == js.TypeBoolean {
+		return v.Bool() && s.forwardsAgent()
+	}
+	return s.forwardsAgent()
+}
+
+// requestExecPty requests a PTY for an exec channel, sized by opts.cols and
+// opts.rows (default 80x24) with opts.term, and registers it for resize
+// under a new channel ID.
+func (s *session) requestExecPty(sshSession *ssh.Session, opts js.Value) (string, error) {
+	pty, err := parsePtySettings(opts)
+	if err != nil {
+		return "", err
+	}
+	cols, rows := jsInt(opts.Get("cols"), 80), jsInt(opts.Get("rows"), 24)
+	if cols <= 0 || rows <= 0 {
+		return "", fmt.Errorf("pty cols and rows must be positive")
+	}
+	if err := requestPty(sshSession, pty, cols, rows); err != nil {
+		return "", fmt.Errorf("PTY request failed: %w", err)
+	}
+	channelID := generateID()
+	s.registerPty(channelID, sshSession, cols, rows)
+	return channelID, nil
+}
+
+// getSession retrieves an SSH session by ID.
+func getSession(sessionID string) (*session, error) {
+	val, ok := sessionStore.Load(sessionID)
+	if !ok {
+		return nil, fmt.Errorf("session %q not found", sessionID)
+	}
+	return val.(*session), nil
+}
+
+// sshWrite sends data to the SSH session's stdin. Input over the session's
+// inputRateLimit is dropped whole and reported with INPUT_RATE_LIMITED.
+// Called from JS as: GoSSH.write(sessionId, data: Uint8Array) → Error | undefined
+func sshWrite(sessionID string, data js.Value) error {
+	val, ok := sessionStore.Load(sessionID)
+	if !ok {
+		return nil
+	}
+	sess := val.(*session)
+	stdin := sess.shellStdin()
+	if stdin == nil {
+		return nil // shell: false
+	}
+	p := uint8ArrayToBytes(data)
+	if !sess.inputLimit.allow(len(p)) {
+		return errInputRateLimited
+	}
+	sess.input.write(stdin, p)
+	return nil
+}
+
+// sshResize changes the PTY window size of a channel on the session.
+// channelID selects the PTY channel: empty means the interactive shell,
+// otherwise an exec PTY ID from onPtyOpen.
+// Called from JS as: GoSSH.resize(sessionId, cols, rows, channelId?)
+func sshResize(sessionID string, cols, rows int, channelID string) {
+	val, ok := sessionStore.Load(sessionID)
+	if !ok {
+		return
+	}
+	sess := val.(*session)
+	if channelID == "" {
+		channelID = sessionID
+	}
+	if err := sess.resizePty(channelID, cols, rows); err == nil {
+		sess.emit("pty_resized", map[string]any{"channelId": channelID, "cols": cols, "rows": rows})
+	}
+}
+
+// sshGetPtySize returns the last PTY size sent for a channel, or null if
+// the session or channel doesn't exist.
+// Called from JS as: GoSSH.getPtySize(sessionId, channelId?) → {cols, rows} | null
+func sshGetPtySize(sessionID string, channelID string) js.Value {
+	sess, err := getSession(sessionID)
+	if err != nil {
+		return js.Null()
+	}
+	if channelID == "" {
+		channelID = sessionID
+	}
+	cols, rows, ok := sess.ptySize(channelID)
+	if !ok {
+		return js.Null()
+	}
+	return js.ValueOf(map[string]any{"cols": cols, "rows": rows})
+}
+
+// registerPty makes a PTY channel addressable by resize.
+func (s *session) registerPty(channelID string, sshSess *ssh.Session, cols, rows int) {
+	s.ptyMu.Lock()
+	defer s.ptyMu.Unlock()
+	if s.ptys == nil {
+		s.ptys = make(map[string]*ptyChannel)
+	}
+	s.ptys[channelID] = &ptyChannel{session: sshSess, cols: cols, rows: rows}
+}
+
+// unregisterPty removes a PTY channel once it closes.
+func (s *session) unregisterPty(channelID string) {
+	s.ptyMu.Lock()
+	delete(s.ptys, channelID)
+	s.ptyMu.Unlock()
+}
+
+// resizePty sends a window-change to one PTY channel and records the size.
+func (s *session) resizePty(channelID string, cols, rows int) error {
+	s.ptyMu.Lock()
+	p, ok := s.ptys[channelID]
+	s.ptyMu.Unlock()
+	if !ok {
+		return fmt.Errorf("resize: channel %q has no PTY", channelID)
+	}
+	if err := p.session.WindowChange(rows, cols); err != nil {
+		return err
+	}
+	s.ptyMu.Lock()
+	p.cols, p.rows = cols, rows
+	s.ptyMu.Unlock()
+	return nil
+}
 
-			// Tunnel through jump host to final destination.
-			netConn, err = jumpClient.Dial("tcp", fmt.Sprintf("%s:%d", host, port))
-			if err != nil {
-				closeQuietly(jumpClient)
-				return nil, publicErr("connect: jump-host tunnel failed", err)
-			}
-		} else {
-			// Direct connection through WebSocket proxy.
-			u, err := parseWebSocketURL(proxyURL, allowInsecureWS)
-			if err != nil {
-				return nil, err
-			}
-			q := u.Query()
-			q.Set("host", host)
-			q.Set("port", fmt.Sprintf("%d", port))
-			if token := jsString(config.Get("token")); token != "" {
-				q.Set("token", token)
-			}
-			u.RawQuery = q.Encode()
+// ptySize returns the last size sent for a PTY channel.
+func (s *session) ptySize(channelID string) (cols, rows int, ok bool) {
+	s.ptyMu.Lock()
+	defer s.ptyMu.Unlock()
+	p, ok := s.ptys[channelID]
+	if !ok {
+		return 0, 0, false
+	}
+	return p.cols, p.rows, true
+}
 
-			dialCtx, dialCancel := context.WithTimeout(context.Background(), dialTimeout)
-			defer dialCancel()
+// shellPty returns the PTY a re-established shell requests: the shell's
+// original term and modes at the size last sent by resize, or 80x24 if the
+// shell isn't registered.
+func (s *session) shellPty() (pty ptySettings, cols, rows int) {
+	cols, rows, ok := s.ptySize(s.id)
+	if !ok {
+		cols, rows = 80, 24
+	}
+	return s.pty, cols, rows
+}
 
-			netConn, err = DialWebSocket(dialCtx, u.String())
-			if err != nil {
-				return nil, publicErr("connect: failed to establish WebSocket", err)
-			}
+// sshExec runs a command on its own channel and resolves with its output
+// once it exits. By default there is no PTY; with opts.pty the command gets
+// one, registered for resize under the channel ID passed to
+// opts.onPtyOpen(channelId) until the command exits. A non-zero exit status
+// is reported in exitCode rather than rejecting; exitSignal is set when the
+// command was killed by a signal. Aborting the signal closes the channel.
+//
+// Output can also be streamed as it arrives through opts.onData and
+// opts.onStderr. The aggregated output in the result is capped at
+// maxExecOutput per stream (truncated is set when data was dropped);
+// aggregate: false skips it entirely for commands with huge output.
+//
+// startedAt and durationMs time the call on the client, network included.
+// With opts.measureRemote, remote carries the command's own time on the
+// server as {userMs, sysMs, realMs?} (see exec_time.go), or null if it
+// couldn't be read. measureRemote runs the command under `sh -c` rather
+// than the login shell, so it must be POSIX sh syntax.
+//
+// A variable in opts.env that the server refuses fails the call, unless
+// opts.onEnv is set: then it is told which names were accepted and which
+// refused, and the command runs with the accepted ones.
+// Called from JS as:
+//
+//	GoSSH.exec(sessionId, command, opts?: {env, onEnv, signal, stripAnsi, agentForward, pty, onPtyOpen, onData, onStderr, aggregate, measureRemote}) → Promise<{stdout, stderr, exitCode, exitSignal?, truncated, startedAt, durationMs, remote?}>
+func sshExec(sessionID, command string, opts js.Value) js.Value {
+	return newPromise(func() (any, error) {
+		sess, err := getSession(sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("exec: %w", err)
+		}
+		if command == "" {
+			return nil, fmt.Errorf("exec: command required")
+		}
+		signal := jsGet(opts, "signal")
+		if isAborted(signal) {
+			return nil, errExecAborted
 		}
 
-		// Build SSH client config for the final host.
-		sshConfig := &ssh.ClientConfig{
-			User:            username,
-			Auth:            authMethods,
-			HostKeyCallback: makeHostKeyCallback(config),
-			Timeout:         sshHandshakeTimeout,
+		s, err := sess.newExecSession(sess.execAgentForward(opts))
+		if err != nil {
+			return nil, fmt.Errorf("exec: %w", err)
 		}
+		defer closeQuietly(s)
 
-		// SSH handshake over the transport (direct WS or tunneled through jump host).
-		sshConn, chans, reqs, err := ssh.NewClientConn(netConn, fmt.Sprintf("%s:%d", host, port), sshConfig)
+		env, err := parseEnv(opts)
 		if err != nil {
-			closeQuietly(netConn)
-			if jumpClient != nil {
-				closeQuietly(jumpClient)
+			return nil, fmt.Errorf("exec: %w", err)
+		}
+		if len(env) > 0 {
+			accepted, rejected := setEnv(s, env)
+			if onEnv, ok := getCallback(opts, "onEnv"); ok {
+				onEnv.Invoke(envReport(accepted, rejected))
+			} else if len(rejected) > 0 {
+				return nil, fmt.Errorf("exec: env %s refused by server", rejected[0])
 			}
-			return nil, publicErr("connect: SSH handshake failed", err)
 		}
 
-		sshClient := ssh.NewClient(sshConn, chans, reqs)
-
-		// Set up agent forwarding if requested.
-		if jsBool(config.Get("agentForward")) && globalAgent != nil {
-			if err := agent.ForwardToAgent(sshClient, globalAgent); err != nil {
-				js.Global().Get("console").Call("warn",
-					"[gossh] Agent forwarding setup failed:", err.Error())
-			} else {
-				js.Global().Get("console").Call("info",
-					"[gossh] SSH agent forwarding enabled — the remote server can use your keys to connect to other servers.")
+		if ptyOpt := jsGet(opts, "pty"); ptyOpt.Type() == js.TypeObject {
+			channelID, err := sess.requestExecPty(s, ptyOpt)
+			if err != nil {
+				return nil, fmt.Errorf("exec: %w", err)
+			}
+			defer sess.unregisterPty(channelID)
+			if onPtyOpen, ok := getCallback(opts, "onPtyOpen"); ok {
+				onPtyOpen.Invoke(channelID)
 			}
 		}
 
-		// Open an SSH session for the terminal.
-		sshSession, err := sshClient.NewSession()
-		if err != nil {
-			closeQuietly(sshClient)
-			return nil, publicErr("connect: failed to open SSH session", err)
+		// Set on the JS event loop, read here after Run returns.
+		var aborted atomic.Bool
+		if signal.Type() == js.TypeObject {
+			onAbort := js.FuncOf(func(this js.Value, args []js.Value) any {
+				aborted.Store(true)
+				closeQuietly(s)
+				return nil
+			})
+			defer onAbort.Release()
+			signal.Call("addEventListener", "abort", onAbort)
+			defer signal.Call("removeEventListener", "abort", onAbort)
 		}
 
-		// Request agent forwarding on the session if enabled.
-		if jsBool(config.Get("agentForward")) && globalAgent != nil {
-			_ = agent.RequestAgentForwarding(sshSession)
+		aggregate := jsGet(opts, "aggregate").Type() != js.TypeBoolean || jsGet(opts, "aggregate").Bool()
+		strip := jsBool(jsGet(opts, "stripAnsi"))
+		stdout := newExecOutput(jsGet(opts, "onData"), aggregate, strip)
+		stderr := newExecOutput(jsGet(opts, "onStderr"), aggregate, strip)
+		defer func() { heldBytes.exec.Add(-int64(stdout.buf.Len() + stderr.buf.Len())) }()
+		s.Stdout = stdout
+		s.Stderr = stderr
+		var timed *trailerSplitter
+		if jsBool(jsGet(opts, "measureRemote")) {
+			marker := "gossh-times-" + generateID()
+			timed = &trailerSplitter{w: stderr, marker: []byte("\n" + marker + "\n")}
+			s.Stderr = timed
+			command = wrapTimed(command, marker)
 		}
 
-		// Handle SSH banner.
-		if onBanner, ok := getCallback(config, "onBanner"); ok {
-			if banner := sshConn.ServerVersion(); len(banner) > 0 {
-				onBanner.Invoke(maskControl(string(banner)))
-			}
+		startedAt := time.Now()
+		runErr := s.Run(command)
+		duration := time.Since(startedAt)
+		if aborted.Load() {
+			return nil, errExecAborted
 		}
 
-		// Request PTY.
-		cols := jsInt(config.Get("cols"), 80)
-		rows := jsInt(config.Get("rows"), 24)
-
-		consoleLog := js.Global().Get("console")
-		consoleLog.Call("log", "[gossh] Requesting PTY", cols, "x", rows)
-
-		modes := ssh.TerminalModes{
-			ssh.ECHO:          1,
-			ssh.TTY_OP_ISPEED: 14400,
-			ssh.TTY_OP_OSPEED: 14400,
-		}
-		if err := sshSession.RequestPty("xterm-256color", rows, cols, modes); err != nil {
-			closeQuietly(sshSession)
-			closeQuietly(sshClient)
-			return nil, publicErr("connect: PTY request failed", err)
+		result := map[string]any{
+			"exitCode":   0,
+			"startedAt":  startedAt.UnixMilli(),
+			"durationMs": duration.Milliseconds(),
 		}
-		consoleLog.Call("log", "[gossh] PTY allocated OK")
-
-		// Set up stdin pipe.
-		stdin, err := sshSession.StdinPipe()
-		if err != nil {
-			closeQuietly(sshSession)
-			closeQuietly(sshClient)
-			return nil, publicErr("connect: failed to open stdin pipe", err)
+		if timed != nil {
+			_ = timed.flush()
+			result["remote"] = nil
+			if userMs, sysMs, ok := parseTimes(timed.trailer.String()); ok {
+				remote := map[string]any{"userMs": userMs, "sysMs": sysMs}
+				if realMs, ok := parseRealTime(timed.trailer.String()); ok {
+					remote["realMs"] = realMs
+				}
+				result["remote"] = remote
+			}
 		}
-
-		// Set up stdout pipe.
-		stdout, err := sshSession.StdoutPipe()
-		if err != nil {
-			closeQuietly(sshSession)
-			closeQuietly(sshClient)
-			return nil, publicErr("connect: failed to open stdout pipe", err)
+		var exitErr *ssh.ExitError
+		switch {
+		case runErr == nil:
+		case errors.As(runErr, &exitErr):
+			result["exitCode"] = exitErr.ExitStatus()
+			if sig := exitErr.Signal(); sig != "" {
+				result["exitSignal"] = sig
+			}
+		default:
+			return nil, fmt.Errorf("exec: %w", runErr)
 		}
-		consoleLog.Call("log", "[gossh] Pipes created, starting shell...")
 
-		// Start shell.
-		if err := sshSession.Shell(); err != nil {
-			closeQuietly(sshSession)
-			closeQuietly(sshClient)
-			return nil, publicErr("connect: failed to start shell", err)
-		}
-		consoleLog.Call("log", "[gossh] Shell started OK, session:", sessionID)
+		result["stdout"] = stdout.buf.String()
+		result["stderr"] = stderr.buf.String()
+		result["truncated"] = stdout.buf.truncated || stderr.buf.truncated
+		return result, nil
+	})
+}
 
-		// Create session context for lifecycle management.
-		sessCtx, sessCancel := context.WithCancel(context.Background())
+var errExecAborted = errors.New("exec: aborted")
 
-		// conn may be a *wsConn (direct) or nil (jump host — cleanup via jumpConn).
-		var wsC *wsConn
-		if wc, ok := netConn.(*wsConn); ok {
-			wsC = wc
+// setEnv sends env on sshSession in name order and splits the names by the
+// server's reply. Servers refuse names missing from their AcceptEnv.
+func setEnv(sshSession *ssh.Session, env map[string]string) (accepted, rejected []string) {
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		if err := sshSession.Setenv(name, env[name]); err != nil {
+			rejected = append(rejected, name)
+		} else {
+			accepted = append(accepted, name)
 		}
+	}
+	return accepted, rejected
+}
 
-		sess := &session{
-			id:              sessionID,
-			ctx:             sessCtx,
-			cancel:          sessCancel,
-			conn:            wsC,
-			sshClient:       sshClient,
-			sshSession:      sshSession,
-			stdin:           stdin,
-			onData:          config.Get("onData"),
-			onClose:         config.Get("onClose"),
-			strictSFTPPaths: strictSFTPPaths,
-			jumpConn:        jumpConn,
-			jumpClient:      jumpClient,
+// envReport is the {accepted, rejected} value passed to onEnv.
+func envReport(accepted, rejected []string) js.Value {
+	names := func(list []string) []any {
+		out := make([]any, len(list))
+		for i, n := range list {
+			out[i] = n
 		}
+		return out
+	}
+	return js.ValueOf(map[string]any{
+		"accepted": names(accepted),
+		"rejected": names(rejected),
+	})
+}
 
-		sessionStore.Store(sessionID, sess)
-
-		// Goroutine: wait for SSH session to finish.
-		// sshSession.Wait() keeps the channel alive until the remote shell exits.
-		go func() {
-			err := sshSession.Wait()
-			if err != nil {
-				js.Global().Get("console").Call("log", "[gossh] session.Wait() returned:", err.Error())
-			} else {
-				js.Global().Get("console").Call("log", "[gossh] session.Wait() returned: clean exit")
-			}
-		}()
-
-		// Goroutine: read stdout and forward to JS onData callback.
-		// Uses sess.onData (copied js.Value) — NOT config.Get("onData") —
-		// because config may be GC'd by JS after connect() Promise resolves.
-		go func() {
-			js.Global().Get("console").Call("log", "[gossh] stdout reader goroutine started")
-			onData := sess.onData
-			buf := make([]byte, 32*1024)
-			readCount := 0
-			for {
-				n, err := stdout.Read(buf)
-				readCount++
-				if n > 0 {
-					js.Global().Get("console").Call("log", "[gossh] stdout read:", n, "bytes (read #"+fmt.Sprintf("%d", readCount)+")")
-					if !onData.IsUndefined() && !onData.IsNull() && onData.Type() == js.TypeFunction {
-						onData.Invoke(bytesToUint8Array(buf[:n]))
-					}
-				}
-				if err != nil {
-					js.Global().Get("console").Call("log", "[gossh] stdout read error:", err.Error(), "(read #"+fmt.Sprintf("%d", readCount)+")")
-					break
-				}
-			}
-			sess.close("session ended")
-		}()
-
-		// Goroutine: SSH keepalive with backoff.
-		go func() {
-			ticker := time.NewTicker(keepaliveInterval)
-			defer ticker.Stop()
-			failures := 0
-			const maxFailures = 3
-			for {
-				select {
-				case <-sessCtx.Done():
-					return
-				case <-ticker.C:
-					_, _, err := sshClient.SendRequest("keepalive@openssh.com", true, nil)
-					if err != nil {
-						failures++
-						if failures >= maxFailures {
-							sess.close("keepalive failed after 3 attempts")
-							return
-						}
-						continue
-					}
-					failures = 0
-				}
-			}
-		}()
+// execOutput receives one output stream of an exec'd command, passing
+// chunks to an optional JS callback and aggregating them for the result.
+// With stripAnsi, escape sequences are removed as the stream arrives, so
+// the callback and the result see the same text.
+type execOutput struct {
+	onData    js.Value      // optional callback(Uint8Array)
+	strip     *ansiStripper // nil unless stripAnsi
+	aggregate bool
+	buf       cappedBuffer
+}
 
-		return sessionID, nil
-	})
+func newExecOutput(onData js.Value, aggregate, stripAnsi bool) *execOutput {
+	o := &execOutput{onData: onData, aggregate: aggregate, buf: cappedBuffer{max: maxExecOutput}}
+	if stripAnsi {
+		o.strip = &ansiStripper{}
+	}
+	return o
 }
 
-// sshWrite sends data to the SSH session's stdin.
-// Called from JS as: GoSSH.write(sessionId, data: Uint8Array)
-func sshWrite(sessionID string, data js.Value) {
-	val, ok := sessionStore.Load(sessionID)
-	if !ok {
-		return
+func (o *execOutput) Write(p []byte) (int, error) {
+	n := len(p)
+	if o.strip != nil {
+		if p = o.strip.strip(p); len(p) == 0 {
+			return n, nil
+		}
 	}
-	sess := val.(*session)
-	_, _ = sess.stdin.Write(uint8ArrayToBytes(data))
+	if o.onData.Type() == js.TypeFunction {
+		o.onData.Invoke(bytesToUint8Array(p))
+	}
+	if o.aggregate {
+		before := o.buf.Len()
+		_, _ = o.buf.Write(p)
+		heldBytes.exec.Add(int64(o.buf.Len() - before))
+	}
+	return n, nil
 }
 
-// sshResize changes the PTY window size.
-// Called from JS as: GoSSH.resize(sessionId, cols, rows)
-func sshResize(sessionID string, cols, rows int) {
-	val, ok := sessionStore.Load(sessionID)
-	if !ok {
-		return
+// cappedBuffer collects output up to max bytes and drops the rest, so a
+// chatty command can't exhaust memory. Dropped bytes still count as
+// written: failing the write would abort the command's output stream.
+type cappedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.max - b.Len(); n > room {
+		b.truncated = true
+		p = p[:room]
 	}
-	sess := val.(*session)
-	_ = sess.sshSession.WindowChange(rows, cols)
+	b.Buffer.Write(p)
+	return n, nil
 }
 
 // sshDisconnect gracefully closes an SSH session.
@@ -386,59 +1625,185 @@ func sshDisconnect(sessionID string) {
 	sess.close("user disconnect")
 }
 
-// close shuts down a session and notifies JS via onClose callback.
+// close shuts down a session, releasing its resources in sessionClosers
+// order, and notifies JS via onClose callback.
 // Safe to call multiple times — only the first call takes effect.
 func (s *session) close(reason string) {
+	s.closeWithExit(reason, nil)
+}
+
+// closeWithExit is close for a session whose shell ended, with the exit
+// fields from shellExit (nil when there was no exit status) added to the
+// closed event and to onClose's second argument, {reason, exitCode?,
+// exitSignal?}.
+func (s *session) closeWithExit(reason string, exit map[string]any) {
 	s.closeOnce.Do(func() {
 		s.cancel()
 
-		// Clean up any SFTP sessions tied to this SSH session.
-		sftpStore.Range(func(key, val any) bool {
-			ss := val.(*sftpSession)
-			if ss.sessionID == s.id {
-				closeQuietly(ss.client)
-				sftpStore.Delete(key)
-			}
-			return true
-		})
+		for _, c := range sessionClosers {
+			c.close(s)
+		}
 
-		// Clean up any port forwards tied to this SSH session.
-		forwardStore.Range(func(key, val any) bool {
-			fwd := val.(*portForward)
-			if fwd.sessionID == s.id {
-				fwd.cleanup() // Uses cleanupOnce — safe to call even if handleTunnelMessages defer also calls it.
-			}
-			return true
-		})
+		sessionStore.Delete(s.id)
 
-		if s.stdin != nil {
-			closeQuietly(s.stdin)
-		}
-		if s.sshSession != nil {
-			closeQuietly(s.sshSession)
+		// Notify JS.
+		details := map[string]any{"reason": reason}
+		for k, v := range exit {
+			details[k] = v
 		}
-		if s.sshClient != nil {
-			closeQuietly(s.sshClient)
+		s.emit("closed", details)
+		if !s.onClose.IsUndefined() && !s.onClose.IsNull() && s.onClose.Type() == js.TypeFunction {
+			s.onClose.Invoke(reason, details)
 		}
-		if s.conn != nil {
-			closeQuietly(s.conn)
+	})
+}
+
+// shellExit turns the shell's Wait result into {exitCode, exitSignal?}, as
+// exec reports them. It returns nil when the server sent no exit status or
+// the wait failed some other way.
+func shellExit(err error) map[string]any {
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		return map[string]any{"exitCode": 0}
+	case errors.As(err, &exitErr):
+		exit := map[string]any{"exitCode": exitErr.ExitStatus()}
+		if sig := exitErr.Signal(); sig != "" {
+			exit["exitSignal"] = sig
 		}
+		return exit
+	default:
+		return nil
+	}
+}
+
+// maxVersionLineLen is the RFC 4253 §4.2 limit on the identification line.
+const maxVersionLineLen = 255
+
+// versionConn records the server's identification line ("SSH-2.0-...") as
+// the handshake reads it. x/crypto/ssh only exposes ServerVersion after the
+// handshake, which is too late for the host key callback.
+type versionConn struct {
+	net.Conn
+	mu   sync.Mutex
+	line []byte
+	done bool
+}
+
+func newVersionConn(c net.Conn) *versionConn {
+	return &versionConn{Conn: c}
+}
+
+func (c *versionConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.observe(p[:n])
+	}
+	return n, err
+}
 
-		// Clean up jump host resources.
-		if s.jumpClient != nil {
-			closeQuietly(s.jumpClient)
+// observe scans read bytes until the line starting with "SSH-" has ended.
+// Lines before it (allowed by RFC 4253) are discarded.
+func (c *versionConn) observe(b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ch := range b {
+		if c.done {
+			return
 		}
-		if s.jumpConn != nil {
-			closeQuietly(s.jumpConn)
+		if ch == '\n' {
+			if bytes.HasPrefix(c.line, []byte("SSH-")) {
+				c.line = bytes.TrimSuffix(c.line, []byte("\r"))
+				c.done = true
+				return
+			}
+			c.line = c.line[:0]
+			continue
+		}
+		if len(c.line) < maxVersionLineLen {
+			c.line = append(c.line, ch)
 		}
+	}
+}
 
-		sessionStore.Delete(s.id)
+// version returns the identification line, or "" if not yet read.
+func (c *versionConn) version() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.done {
+		return ""
+	}
+	return string(c.line)
+}
 
-		// Notify JS.
-		if !s.onClose.IsUndefined() && !s.onClose.IsNull() && s.onClose.Type() == js.TypeFunction {
-			s.onClose.Invoke(reason)
+// handshakeError hides the details of a failed handshake like publicErr,
+// except for coded errors raised by our own callbacks (e.g.
+// HOST_KEY_CHANGED), which are meant for the app, and a server cutting
+// off authentication, which gets an explanation.
+func handshakeError(publicMsg string, err error) error {
+	var ce *codedError
+	if errors.As(err, &ce) {
+		return ce
+	}
+	if isPasswordChangeRequest(err) {
+		return &codedError{
+			code: errCodePasswordChange,
+			msg: publicMsg + ": the server requires a password change with a request this client can't answer; " +
+				"change the password with another client, or have the server offer keyboard-interactive auth and set onPasswordChange",
 		}
-	})
+	}
+	if isTooManyAuthFailures(err) {
+		return &codedError{
+			code: errCodeTooManyAuthFailures,
+			msg: publicMsg + ": the server disconnected after too many authentication failures " +
+				"(each agent key offered counts as one); remove unneeded keys from the agent, " +
+				"set agentMaxKeys, or authenticate with a specific key (authMethod: 'key')",
+		}
+	}
+	return publicErr(publicMsg, err)
+}
+
+// wsDialError turns a failed WebSocket dial into a coded error. The
+// close code and reason are passed through, being what integrators need
+// to tell a bad URL from a refused token; other errors stay private as
+// with publicErr.
+func wsDialError(publicMsg string, err error) error {
+	var ce *wsCloseError
+	switch {
+	case errors.As(err, &ce) && ce.rejected():
+		return &codedError{code: errCodeWSProxyRejected, msg: publicMsg + ": " + ce.detail()}
+	case errors.As(err, &ce):
+		return &codedError{code: errCodeWSDialFailed, msg: publicMsg + ": " + ce.detail()}
+	case errors.Is(err, errDialTimeout):
+		return &codedError{code: errCodeWSDialTimeout, msg: publicMsg + ": timed out"}
+	}
+	logWarnf(publicMsg+":", err.Error())
+	return &codedError{code: errCodeWSDialFailed, msg: publicMsg}
+}
+
+// wsRejection returns the close event of a WebSocket the proxy closed on
+// purpose (see wsCloseError.rejected), for a handshake that failed
+// because the proxy refused after the upgrade. conn may be nil.
+func wsRejection(conn *wsConn) error {
+	if conn == nil {
+		return nil
+	}
+	if ce := conn.closeError(); ce != nil && ce.rejected() {
+		return ce
+	}
+	return nil
+}
+
+// isPasswordChangeRequest reports whether err is x/crypto/ssh failing on
+// SSH_MSG_USERAUTH_PASSWD_CHANGEREQ (60), which it treats as unexpected.
+func isPasswordChangeRequest(err error) bool {
+	return strings.Contains(err.Error(), "unexpected message type 60 ")
+}
+
+// isTooManyAuthFailures reports whether err is the disconnect OpenSSH
+// sends once a client exceeds MaxAuthTries (default 6).
+func isTooManyAuthFailures(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "too many authentication failures")
 }
 
 // makeHostKeyCallback creates an SSH HostKeyCallback that delegates
@@ -446,15 +1811,71 @@ func (s *session) close(reason string) {
 // The JS callback receives {hostname, fingerprint, keyType} and returns
 // a Promise<boolean>. The Go goroutine blocks until the user decides.
 func makeHostKeyCallback(config js.Value) ssh.HostKeyCallback {
+	return makeHostKeyCallbackWithBanner(context.Background(), config, nil)
+}
+
+// makeHostKeyCallbackWithBanner is makeHostKeyCallback with the server's
+// identification banner (from a versionConn) added to the info object as
+// `banner`, so one trust dialog can show it next to the fingerprint.
+//
+// When the config has knownHosts, onHostKeyAdd, or the onHostKeyLookup
+// and onHostKeyLearn pair, keys are checked against the known hosts first
+// and onHostKey is only asked about unknown hosts.
+//
+// Cancelling ctx rejects a pending onHostKey prompt instead of waiting out
+// its 5 minutes.
+func makeHostKeyCallbackWithBanner(ctx context.Context, config js.Value, vc *versionConn) ssh.HostKeyCallback {
+	prompt, interactive := makeHostKeyPrompt(ctx, config, vc)
+
+	onAdd, hasAdd := getCallback(config, "onHostKeyAdd")
+	onLookup, hasLookup := getCallback(config, "onHostKeyLookup")
+	onLearn, hasLearn := getCallback(config, "onHostKeyLearn")
+	if config.Get("knownHosts").Type() != js.TypeString && !hasAdd && !hasLookup && !hasLearn {
+		return prompt
+	}
+	db, err := parseKnownHosts(jsString(config.Get("knownHosts")))
+	if err != nil {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			return fmt.Errorf("connect: knownHosts: %w", err)
+		}
+	}
+	var add func(host, line string)
+	if (hasAdd || hasLearn) && interactive {
+		add = func(host, line string) {
+			if hasAdd {
+				onAdd.Invoke(line)
+			}
+			if hasLearn {
+				onLearn.Invoke(host, line)
+			}
+		}
+	}
+	if hasLookup {
+		return lookupKnownHostsCallback(ctx, onLookup, db, prompt, add)
+	}
+	return knownHostsCallback(db, prompt, add)
+}
+
+// makeHostKeyPrompt returns the callback that asks JS (onHostKey) about a
+// host key. interactive is false when there is no onHostKey and the
+// callback instead accepts everything (allowInsecureHostKey) or fails.
+func makeHostKeyPrompt(parent context.Context, config js.Value, vc *versionConn) (cb ssh.HostKeyCallback, interactive bool) {
 	onHostKey, hasCallback := getCallback(config, "onHostKey")
 	if !hasCallback {
 		if jsBool(config.Get("allowInsecureHostKey")) {
 			logWarnf("No onHostKey callback provided — accepting all host keys. This is insecure and vulnerable to MITM attacks.")
-			return ssh.InsecureIgnoreHostKey() // #nosec G106 -- explicit development opt-in only.
+			return ssh.InsecureIgnoreHostKey(), false // #nosec G106 -- explicit development opt-in only.
 		}
 		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
 			return errHostKeyCallbackRequired
-		}
+		}, false
+	}
+
+	formats, err := fingerprintFormats(config)
+	if err != nil {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			return err
+		}, true
 	}
 
 	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
@@ -463,20 +1884,28 @@ func makeHostKeyCallback(config js.Value) ssh.HostKeyCallback {
 
 		// Create the info object for JS.
 		info := map[string]any{
-			"hostname":       hostname,
-			"fingerprint":    fingerprint,
-			"fingerprintMD5": ssh.FingerprintLegacyMD5(key),
-			"keyType":        keyType,
-			"randomArt":      RandomArt(key),
+			"hostname":        hostname,
+			"fingerprint":     fingerprint,
+			"fingerprintMD5":  ssh.FingerprintLegacyMD5(key),
+			"fingerprints":    hostKeyFingerprints(key, formats),
+			"keyType":         keyType,
+			"randomArt":       RandomArt(key),
+			"randomArtSHA256": RandomArtSHA256FromKey(key),
+		}
+		if vc != nil {
+			info["banner"] = maskControl(vc.version())
 		}
 
 		// Call JS callback and await the Promise<boolean> result.
 		promise := onHostKey.Invoke(info)
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		ctx, cancel := context.WithTimeout(parent, 5*time.Minute)
 		defer cancel()
 
 		result, err := awaitPromise(ctx, promise)
+		if parent.Err() != nil {
+			return fmt.Errorf("host key verification failed: %w", errConnectAborted)
+		}
 		if err != nil {
 			return fmt.Errorf("host key verification failed: %w", err)
 		}
@@ -485,40 +1914,387 @@ func makeHostKeyCallback(config js.Value) ssh.HostKeyCallback {
 			return fmt.Errorf("host key rejected by user")
 		}
 		return nil
+	}, true
+}
+
+// fingerprintFuncs compute host key fingerprints by format name, from the
+// key's wire encoding. Hashes in base64 follow OpenSSH's "NAME:base64"
+// form without padding; the hex forms are colon-separated.
+var fingerprintFuncs = map[string]func(ssh.PublicKey) string{
+	"sha256": ssh.FingerprintSHA256,
+	"md5":    ssh.FingerprintLegacyMD5,
+	"sha1": func(k ssh.PublicKey) string {
+		h := sha1.Sum(k.Marshal()) // #nosec G401 -- for matching external inventories, not verification strength.
+		return "SHA1:" + b64Fingerprint(h[:])
+	},
+	"sha512": func(k ssh.PublicKey) string {
+		h := sha512.Sum512(k.Marshal())
+		return "SHA512:" + b64Fingerprint(h[:])
+	},
+	"sha256-hex": func(k ssh.PublicKey) string {
+		h := sha256.Sum256(k.Marshal())
+		return hexFingerprint(h[:])
+	},
+	"blake2b-256": func(k ssh.PublicKey) string {
+		h := blake2b.Sum256(k.Marshal())
+		return "BLAKE2b-256:" + b64Fingerprint(h[:])
+	},
+}
+
+func b64Fingerprint(h []byte) string { return base64.RawStdEncoding.EncodeToString(h) }
+
+func hexFingerprint(h []byte) string {
+	parts := make([]string, len(h))
+	for i, b := range h {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// fingerprintFormats reads config.hostKeyFingerprints, the formats to add
+// to onHostKey's fingerprints beyond the default sha256 and md5.
+func fingerprintFormats(config js.Value) ([]string, error) {
+	formats := []string{"sha256", "md5"}
+	v := config.Get("hostKeyFingerprints")
+	if v.IsUndefined() || v.IsNull() {
+		return formats, nil
+	}
+	if v.Type() != js.TypeObject || !js.Global().Get("Array").Call("isArray", v).Bool() {
+		return nil, fmt.Errorf("hostKeyFingerprints must be an array")
+	}
+	for i := 0; i < v.Length(); i++ {
+		name := jsString(v.Index(i))
+		if fingerprintFuncs[name] == nil {
+			known := slices.Sorted(maps.Keys(fingerprintFuncs))
+			return nil, fmt.Errorf("hostKeyFingerprints: unknown format %q (use %s)", name, strings.Join(known, ", "))
+		}
+		if !slices.Contains(formats, name) {
+			formats = append(formats, name)
+		}
+	}
+	return formats, nil
+}
+
+// hostKeyFingerprints returns key's fingerprint in each format, by name.
+func hostKeyFingerprints(key ssh.PublicKey, formats []string) map[string]any {
+	fps := make(map[string]any, len(formats))
+	for _, f := range formats {
+		fps[f] = fingerprintFuncs[f](key)
 	}
+	return fps
 }
 
 // buildAuthMethods constructs SSH auth methods from a JS config object.
+// authMethod is one method name or an array of them, tried in that order
+// within the one connection as the server allows: a server that only
+// offers password once publickey is exhausted still gets the password.
+// In an array, a method that can't be used (say, agent with no keys
+// loaded) is skipped with a warning as long as another remains.
 func buildAuthMethods(config js.Value) ([]ssh.AuthMethod, error) {
-	authMethod := jsString(config.Get("authMethod"))
-	switch authMethod {
+	v := config.Get("authMethod")
+	report := authProgressReporter(config)
+	if v.Type() != js.TypeObject {
+		src, err := authSourceFor(config, jsString(v), report)
+		if err != nil {
+			return nil, err
+		}
+		return assembleAuth([]authSource{src}, report), nil
+	}
+
+	var srcs []authSource
+	var skipped []error
+	for i := 0; i < v.Length(); i++ {
+		name := jsString(v.Index(i))
+		if !knownAuthMethods[name] {
+			return nil, fmt.Errorf("authMethod[%d]: unknown authMethod %q (use password, key, agent, or keyboard-interactive)", i, name)
+		}
+		src, err := authSourceFor(config, name, report)
+		if err != nil {
+			skipped = append(skipped, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		srcs = append(srcs, src)
+	}
+	if len(srcs) == 0 {
+		if len(skipped) == 0 {
+			return nil, fmt.Errorf("authMethod must not be empty")
+		}
+		return nil, errors.Join(skipped...)
+	}
+	for _, err := range skipped {
+		logWarnf("auth method skipped:", err.Error())
+	}
+	return assembleAuth(srcs, report), nil
+}
+
+var knownAuthMethods = map[string]bool{"password": true, "key": true, "agent": true, "keyboard-interactive": true}
+
+// authSource is one configured auth method. Key and agent sources both
+// authenticate with publickey; x/crypto/ssh tries each method name once per
+// connection, so their signers are merged into a single method.
+type authSource struct {
+	signers func() ([]ssh.Signer, error) // key, agent
+	method  ssh.AuthMethod               // password, keyboard-interactive
+	// interactive marks the keyboard-interactive source.
+	interactive bool
+	// passwordChange, for password with onPasswordChange, answers an
+	// expired-password conversation over keyboard-interactive. It's tried
+	// last, and only when keyboard-interactive isn't configured itself.
+	passwordChange ssh.AuthMethod
+}
+
+// authSourceFor builds the source for one authMethod name.
+func authSourceFor(config js.Value, name string, report func(method string)) (authSource, error) {
+	switch name {
 	case "password":
 		password := jsString(config.Get("password"))
 		if password == "" {
-			return nil, fmt.Errorf("password required for password auth")
+			return authSource{}, fmt.Errorf("password required for password auth")
+		}
+		src := authSource{method: ssh.PasswordCallback(func() (string, error) {
+			report("password")
+			return password, nil
+		})}
+		if onChange, ok := getCallback(config, "onPasswordChange"); ok {
+			challenge := passwordChangeChallenge(password, onChange)
+			src.passwordChange = ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+				report("keyboard-interactive")
+				return challenge(name, instruction, questions, echos)
+			})
 		}
-		return []ssh.AuthMethod{ssh.Password(password)}, nil
+		return src, nil
 
 	case "key":
 		keyPEM := jsString(config.Get("keyPEM"))
 		if keyPEM == "" {
-			return nil, fmt.Errorf("keyPEM required for key auth")
+			return authSource{}, fmt.Errorf("keyPEM required for key auth")
 		}
 		signer, err := parsePrivateKey(keyPEM, jsString(config.Get("keyPassphrase")))
 		if err != nil {
-			return nil, fmt.Errorf("parse key: %w", err)
+			return authSource{}, fmt.Errorf("parse key: %w", err)
 		}
-		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+		return authSource{signers: func() ([]ssh.Signer, error) { return []ssh.Signer{signer}, nil }}, nil
 
 	case "agent":
 		if globalAgent == nil {
-			return nil, fmt.Errorf("no agent keys loaded")
+			return authSource{}, fmt.Errorf("no agent keys loaded")
+		}
+		if locked, _ := globalAgent.lockState(); locked {
+			return authSource{}, fmt.Errorf("agent is locked; unlock it with agentUnlock")
+		}
+		if keys, err := globalAgent.List(); err == nil && len(keys) == 0 {
+			return authSource{}, fmt.Errorf("no agent keys loaded")
+		}
+		if fp := jsString(config.Get("agentKeyFingerprint")); fp != "" {
+			signer, err := findSigner(globalAgent.Signers, fp)
+			if err != nil {
+				return authSource{}, err
+			}
+			return authSource{signers: func() ([]ssh.Signer, error) { return []ssh.Signer{signer}, nil }}, nil
+		}
+		maxKeys := jsInt(config.Get("agentMaxKeys"), 0)
+		if maxKeys < 0 {
+			return authSource{}, fmt.Errorf("agentMaxKeys must not be negative")
 		}
-		return []ssh.AuthMethod{ssh.PublicKeysCallback(globalAgent.Signers)}, nil
+		return authSource{signers: limitSigners(globalAgent.Signers, maxKeys)}, nil
+
+	case "keyboard-interactive":
+		onChallenge, ok := getCallback(config, "onKeyboardInteractive")
+		if !ok {
+			return authSource{}, fmt.Errorf("onKeyboardInteractive required for keyboard-interactive auth")
+		}
+		challenge := keyboardInteractiveChallenge(onChallenge)
+		return authSource{interactive: true, method: ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			report("keyboard-interactive")
+			return challenge(name, instruction, questions, echos)
+		})}, nil
 
 	default:
-		return nil, fmt.Errorf("unknown authMethod %q (use password, key, or agent)", authMethod)
+		return authSource{}, fmt.Errorf("unknown authMethod %q (use password, key, agent, or keyboard-interactive)", name)
+	}
+}
+
+// assembleAuth turns sources into auth methods in order, with every
+// publickey source merged at the position of the first and a password
+// change method, if any, after the rest.
+func assembleAuth(srcs []authSource, report func(method string)) []ssh.AuthMethod {
+	var methods []ssh.AuthMethod
+	var keySources []func() ([]ssh.Signer, error)
+	var passwordChange ssh.AuthMethod
+	interactive := false
+	for _, src := range srcs {
+		interactive = interactive || src.interactive
+		if src.passwordChange != nil {
+			passwordChange = src.passwordChange
+		}
+		if src.method != nil {
+			methods = append(methods, src.method)
+			continue
+		}
+		if keySources == nil {
+			methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+				report("publickey")
+				var all []ssh.Signer
+				for _, signers := range keySources {
+					s, err := signers()
+					if err != nil {
+						logWarnf("auth: skipping key source:", err.Error())
+						continue
+					}
+					all = append(all, s...)
+				}
+				return all, nil
+			}))
+		}
+		keySources = append(keySources, src.signers)
+	}
+	if passwordChange != nil && !interactive {
+		methods = append(methods, passwordChange)
+	}
+	return methods
+}
+
+// authProgressReporter returns a func that tells config.onAuthProgress
+// each time the client starts on an auth method: {method, attempt}, with
+// method 'publickey', 'password', or 'keyboard-interactive' (once per
+// challenge round). An attempt that follows another means the earlier one
+// didn't complete authentication.
+func authProgressReporter(config js.Value) func(method string) {
+	onProgress, ok := getCallback(config, "onAuthProgress")
+	if !ok {
+		return func(string) {}
+	}
+	var attempt atomic.Int32
+	return func(method string) {
+		onProgress.Invoke(js.ValueOf(map[string]any{"method": method, "attempt": int(attempt.Add(1))}))
+	}
+}
+
+// limitSigners offers at most max of the agent's keys, in the order they
+// were added; 0 means all. Servers count every rejected key as a failed
+// attempt, so offering many can exhaust MaxAuthTries before the right one.
+func limitSigners(signers func() ([]ssh.Signer, error), max int) func() ([]ssh.Signer, error) {
+	if max == 0 {
+		return signers
+	}
+	return func() ([]ssh.Signer, error) {
+		s, err := signers()
+		if len(s) > max {
+			s = s[:max]
+		}
+		return s, err
+	}
+}
+
+// findSigner returns the signer for the key with the given SHA256
+// fingerprint, so exactly one key is offered.
+func findSigner(signers func() ([]ssh.Signer, error), fingerprint string) (ssh.Signer, error) {
+	all, err := signers()
+	if err != nil {
+		return nil, fmt.Errorf("agent: %w", err)
+	}
+	for _, s := range all {
+		if ssh.FingerprintSHA256(s.PublicKey()) == fingerprint {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("agentKeyFingerprint: key %q is not loaded in the agent", fingerprint)
+}
+
+// keyboardInteractiveTimeout bounds how long one challenge round waits for
+// the user's answers.
+const keyboardInteractiveTimeout = 5 * time.Minute
+
+// keyboardInteractiveChallenge bridges each challenge round to
+// onKeyboardInteractive({name, instruction, questions: [{prompt, echo}]}),
+// which resolves to one answer per question. The server may send several
+// rounds (e.g. password, then OTP); each one calls back into JS.
+func keyboardInteractiveChallenge(onChallenge js.Value) ssh.KeyboardInteractiveChallenge {
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		qs := make([]any, len(questions))
+		for i, q := range questions {
+			qs[i] = map[string]any{"prompt": maskControl(q), "echo": echos[i]}
+		}
+		info := map[string]any{
+			"name":        maskControl(name),
+			"instruction": maskControl(instruction),
+			"questions":   qs,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), keyboardInteractiveTimeout)
+		defer cancel()
+		promise := js.Global().Get("Promise").Call("resolve", onChallenge.Invoke(info))
+		result, err := awaitPromise(ctx, promise)
+		if err != nil {
+			return nil, fmt.Errorf("keyboard-interactive: %w", err)
+		}
+		if len(questions) == 0 {
+			// An informational round: nothing to answer.
+			return nil, nil
+		}
+		if result.Type() != js.TypeObject || result.Get("length").IsUndefined() || result.Length() != len(questions) {
+			return nil, fmt.Errorf("keyboard-interactive: expected %d answers", len(questions))
+		}
+		answers := make([]string, len(questions))
+		for i := range answers {
+			if result.Index(i).Type() != js.TypeString {
+				return nil, fmt.Errorf("keyboard-interactive: answer %d is not a string", i)
+			}
+			answers[i] = result.Index(i).String()
+		}
+		return answers, nil
+	}
+}
+
+// passwordChangeChallenge answers the keyboard-interactive conversation
+// a server (PAM, typically) holds when the password has expired: prompts
+// for the current password get password, and those for a new one, or to
+// retype it, get what onPasswordChange({prompt, instruction}) resolves
+// to, asked once per connection. Any other prompt, an OTP say, fails the
+// round; onKeyboardInteractive is for those.
+//
+// Servers that instead send SSH_MSG_USERAUTH_PASSWD_CHANGEREQ (RFC 4252
+// section 8) can't be answered: x/crypto/ssh has no support for it, and
+// the handshake fails with PASSWORD_CHANGE_REQUIRED (see handshakeError).
+func passwordChangeChallenge(password string, onChange js.Value) ssh.KeyboardInteractiveChallenge {
+	var newPassword string
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i, q := range questions {
+			p := strings.ToLower(q)
+			switch {
+			case strings.Contains(p, "new") || strings.Contains(p, "retype") || strings.Contains(p, "again"):
+				if newPassword == "" {
+					var err error
+					if newPassword, err = askNewPassword(onChange, q, instruction); err != nil {
+						return nil, err
+					}
+				}
+				answers[i] = newPassword
+			case strings.Contains(p, "password"):
+				answers[i] = password
+			default:
+				return nil, fmt.Errorf("password change: can't answer prompt %q (set onKeyboardInteractive and authMethod 'keyboard-interactive')", maskControl(q))
+			}
+		}
+		return answers, nil
+	}
+}
+
+// askNewPassword calls onPasswordChange and waits for the new password, as
+// long as a keyboard-interactive round.
+func askNewPassword(onChange js.Value, prompt, instruction string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyboardInteractiveTimeout)
+	defer cancel()
+	info := map[string]any{"prompt": maskControl(prompt), "instruction": maskControl(instruction)}
+	result, err := awaitPromise(ctx, js.Global().Get("Promise").Call("resolve", onChange.Invoke(info)))
+	if err != nil {
+		return "", fmt.Errorf("onPasswordChange: %w", err)
+	}
+	if result.Type() != js.TypeString || result.String() == "" {
+		return "", fmt.Errorf("onPasswordChange: no new password given")
 	}
+	return result.String(), nil
 }
 
 // parsePrivateKey parses a PEM-encoded private key, optionally decrypting
@@ -0,0 +1,110 @@
+// stall.go detects a transport that stops making progress while in use.
+//
+// x/crypto/ssh rekeys internally; on a slow or broken path a rekey (or the
+// network itself) can hang, which looks exactly like an idle terminal. The
+// SSH transport is wrapped in a meteredConn that records when data was last
+// written without any reply being read. Not every write gets one — a
+// password typed with echo off produces no output — so outstanding data is
+// probed with a keepalive request, which a live server always answers. If
+// nothing is read for the stall window even so, onStall fires; when bytes
+// arrive again it fires once more with recovered: true. An idle session
+// writes nothing, so it never "stalls".
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"syscall/js"
+	"time"
+)
+
+const (
+	// defaultStallTimeout is how long written data may go unanswered.
+	defaultStallTimeout = 15 * time.Second
+	// minStallTimeout keeps ordinary round-trip latency from looking stalled.
+	minStallTimeout = time.Second
+)
+
+// meteredConn wraps a net.Conn and tracks outstanding (unanswered) writes.
+type meteredConn struct {
+	net.Conn
+	// pendingSince is the UnixNano time of the first write after the last
+	// successful read, or 0 when nothing is outstanding.
+	pendingSince atomic.Int64
+}
+
+func newMeteredConn(c net.Conn) *meteredConn {
+	return &meteredConn{Conn: c}
+}
+
+func (c *meteredConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.pendingSince.Store(0)
+	}
+	return n, err
+}
+
+func (c *meteredConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.pendingSince.CompareAndSwap(0, time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// watchStall polls c until ctx is done, reporting stalls to onStall as
+// {stalledMs, recovered}. probe is started once per outstanding write to
+// solicit a reply; it may block for as long as the transport does.
+func watchStall(ctx context.Context, c *meteredConn, timeout time.Duration, onStall js.Value, probe func()) {
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+
+	var stalledAt int64 // pendingSince of the reported stall, 0 if none
+	var probedAt int64  // pendingSince of the last probe, 0 if none
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pending := c.pendingSince.Load()
+		now := time.Now()
+		if stalledAt != 0 && pending != stalledAt {
+			// Data was read since the stall was reported.
+			onStall.Invoke(js.ValueOf(map[string]any{
+				"stalledMs": now.Sub(time.Unix(0, stalledAt)).Milliseconds(),
+				"recovered": true,
+			}))
+			stalledAt = 0
+		}
+		if pending != 0 && pending != probedAt {
+			probedAt = pending
+			spawn("stall.probe", probe)
+		}
+		if stalledAt == 0 && pending != 0 && now.Sub(time.Unix(0, pending)) >= timeout {
+			stalledAt = pending
+			onStall.Invoke(js.ValueOf(map[string]any{
+				"stalledMs": now.Sub(time.Unix(0, pending)).Milliseconds(),
+				"recovered": false,
+			}))
+		}
+	}
+}
+
+// stallTimeoutFromConfig reads stallTimeoutMs, applying the default and minimum.
+func stallTimeoutFromConfig(config js.Value) time.Duration {
+	timeout := defaultStallTimeout
+	if ms := jsInt(config.Get("stallTimeoutMs"), 0); ms > 0 {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	if timeout < minStallTimeout {
+		timeout = minStallTimeout
+	}
+	return timeout
+}
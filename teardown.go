@@ -0,0 +1,88 @@
+// teardown.go releases everything a session owns when it closes. Each kind
+// of per-session resource registers a closer in sessionClosers; new
+// subsystems that track state by session add theirs there, so nothing is
+// left running after disconnect.
+
+//go:build js && wasm
+
+package gossh
+
+// sessionCloser releases one kind of per-session resource. Closers must be
+// idempotent: the resource's own stop path may already have run.
+type sessionCloser struct {
+	name  string
+	close func(s *session)
+}
+
+// sessionClosers run in order under the session's closeOnce. Resources
+// close before whatever they run over: SFTP (with the streams, uploads,
+// tails, and file handles on it), forwards, and channels go first, then the
+// shell, and the connection last.
+var sessionClosers = []sessionCloser{
+	{"sftp", closeSFTPForSession},
+	{"forwards", closeForwardsForSession},
+	{"remoteForwards", closeRemoteForwardsForSession},
+	{"channels", closeChannelsForSession},
+	{"shell", closeShell},
+	{"conn", closeConn},
+}
+
+func closeSFTPForSession(s *session) {
+	sftpStore.Range(func(key, val any) bool {
+		if ss := val.(*sftpSession); ss.sessionID == s.id {
+			closeSFTPSession(ss.id)
+		}
+		return true
+	})
+}
+
+func closeForwardsForSession(s *session) {
+	forwardStore.Range(func(key, val any) bool {
+		if fwd := val.(*portForward); fwd.sessionID == s.id {
+			fwd.cleanup()
+		}
+		return true
+	})
+}
+
+func closeRemoteForwardsForSession(s *session) {
+	remoteForwardStore.Range(func(key, val any) bool {
+		if rf := val.(*remoteForward); rf.sessionID == s.id {
+			rf.stop()
+		}
+		return true
+	})
+}
+
+func closeChannelsForSession(s *session) {
+	channelStore.Range(func(key, val any) bool {
+		if rc := val.(*rawChannel); rc.sessionID == s.id {
+			rc.close()
+		}
+		return true
+	})
+}
+
+func closeShell(s *session) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	if s.stdin != nil {
+		closeQuietly(s.stdin)
+	}
+	if s.sshSession != nil {
+		closeQuietly(s.sshSession)
+	}
+}
+
+// closeConn closes the connection, or releases it if pooled: a pooled
+// connection outlives the session until its last user is gone and the TTL
+// expires.
+func closeConn(s *session) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	if s.pooled != nil {
+		s.pooled.release()
+	} else if s.cc != nil {
+		s.cc.close()
+	}
+}
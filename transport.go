@@ -10,8 +10,10 @@ package gossh
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net"
+	"strings"
 	"sync"
 	"syscall/js"
 	"time"
@@ -29,6 +31,22 @@ const (
 	// wsMaxMessageSize bounds one incoming WebSocket frame to prevent
 	// unbounded allocation from malicious or compromised peers.
 	wsMaxMessageSize = 8 * 1024 * 1024 // 8 MB
+
+	// wsOverflowSize bounds the bytes held in the overflow queue once
+	// readCh is full.
+	wsOverflowSize = 16 * 1024 * 1024 // 16 MB
+)
+
+// Bounds for the WSOptions overrides of the defaults above.
+const (
+	minWSReadChanSize   = 64
+	maxWSReadChanSize   = 65536
+	minWSWriteChunkSize = 1024
+	maxWSWriteChunkSize = 256 * 1024
+	minWSMaxMessageSize = 64 * 1024
+	maxWSMaxMessageSize = 64 * 1024 * 1024
+	minWSOverflowSize   = 64 * 1024
+	maxWSOverflowSize   = 256 * 1024 * 1024
 )
 
 var (
@@ -40,6 +58,57 @@ var (
 	errWSBackpress  = errors.New("websocket: receive buffer overflow")
 )
 
+// wsCloseGrace is how long a failed dial waits for the close event that
+// follows the error event, since only the close event has a code.
+const wsCloseGrace = time.Second
+
+// wsCloseError is a WebSocket close event. A browser hides why a
+// connection couldn't be made — DNS, refused, TLS, or an HTTP error from
+// the proxy all close with 1006 — but a proxy that completes the upgrade
+// and then refuses can say why with its own code and reason.
+type wsCloseError struct {
+	code   int
+	reason string
+	// dialing is set when the connection never opened.
+	dialing bool
+}
+
+// rejected reports whether the server closed on purpose: 1008 (policy
+// violation) or an application code (4000-4999), as proxies use for auth.
+func (e *wsCloseError) rejected() bool {
+	return e.code == 1008 || e.code >= 4000 && e.code <= 4999
+}
+
+// detail describes the close without the "websocket: " prefix.
+func (e *wsCloseError) detail() string {
+	d := fmt.Sprintf("code %d", e.code)
+	if e.reason != "" {
+		d = fmt.Sprintf("%d %s", e.code, e.reason)
+	}
+	switch {
+	case e.rejected():
+		return "proxy rejected: " + d
+	case e.dialing && e.code == 1006:
+		return "dial failed: " + d + " (unreachable, TLS failure, or HTTP error from the proxy; see the browser console)"
+	case e.dialing:
+		return "dial failed: " + d
+	}
+	return "connection closed: " + d
+}
+
+func (e *wsCloseError) Error() string {
+	return "websocket: " + e.detail()
+}
+
+// Is makes a close during the dial errDialFailed and a later one
+// errWSClosed, the errors returned before close events were kept.
+func (e *wsCloseError) Is(target error) bool {
+	if e.dialing {
+		return target == errDialFailed
+	}
+	return target == errWSClosed
+}
+
 // wsConn implements net.Conn over a browser WebSocket.
 // All shared state is protected by mu to prevent race conditions
 // between JS event callbacks and Go Read()/Write() calls.
@@ -47,15 +116,31 @@ type wsConn struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	// mu protects err and closed fields.
+	// mu protects err, closed, opened, closeEvent, and the overflow queue.
 	mu     sync.Mutex
 	err    error
 	closed bool
+	opened bool
+	// closeEvent is the browser's close event, once it has fired.
+	closeEvent *wsCloseError
+	// overflow holds messages that arrived while readCh was full, up to
+	// overflowCap bytes in all; see enqueue.
+	overflow      [][]byte
+	overflowBytes int
+	overflowCap   int
 
 	ws     js.Value    // browser WebSocket object
 	readCh chan []byte // incoming message data
 	buf    []byte      // leftover bytes from previous Read()
 
+	// noCoalesce makes Read return after one message instead of draining
+	// everything queued (see WSOptions.NoReadCoalescing).
+	noCoalesce bool
+	// writeChunk and maxMessage are WSOptions.WriteChunkBytes and
+	// MaxMessageBytes with defaults applied.
+	writeChunk int
+	maxMessage int
+
 	// JS function references (prevent GC while registered)
 	onOpen    js.Func
 	onMessage js.Func
@@ -65,6 +150,61 @@ type wsConn struct {
 	cleanupOnce sync.Once
 }
 
+// WSOptions tunes a WebSocket connection. The zero value is the default.
+type WSOptions struct {
+	// NoReadCoalescing makes each Read return the data of a single
+	// WebSocket message. By default Read also drains any further messages
+	// already queued, which cuts per-read overhead for bulk transfers; the
+	// cost is that a small message arriving behind a large batch waits for
+	// the batch to be copied. Interactive, latency-sensitive sessions may
+	// prefer to turn coalescing off.
+	NoReadCoalescing bool
+	// ReadBufferFrames is how many incoming messages may wait for Read
+	// (default wsReadChanSize) before they spill into the overflow queue.
+	ReadBufferFrames int
+	// OverflowBytes caps the overflow queue (default wsOverflowSize). A
+	// browser WebSocket can't be paused, so a burst that outruns Read is
+	// held there; only once it is full is the connection closed with
+	// errWSBackpress.
+	OverflowBytes int
+	// WriteChunkBytes is the most sent in one WebSocket message (default
+	// wsWriteChunkSize).
+	WriteChunkBytes int
+	// MaxMessageBytes is the largest incoming message accepted (default
+	// wsMaxMessageSize); a larger one closes the connection.
+	MaxMessageBytes int
+	// Subprotocols are offered in the Sec-WebSocket-Protocol header. The
+	// browser throws on a value that isn't an HTTP token (see
+	// validSubprotocol), and fails the connection if the server picks one
+	// it didn't offer.
+	Subprotocols []string
+}
+
+// validSubprotocol reports whether s is an HTTP token (RFC 7230 tchar),
+// the syntax the WebSocket constructor requires of a subprotocol.
+func validSubprotocol(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// orDefault returns v, or def when v is zero.
+func orDefault(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
 // DialWebSocket creates a new WebSocket connection and returns it as net.Conn.
 // The url should be a fully-formed WebSocket URL (ws:// or wss://) including
 // any query parameters for the proxy (e.g., ?host=x&port=22&token=jwt).
@@ -72,19 +212,37 @@ type wsConn struct {
 // The context controls the dial timeout — if the WebSocket doesn't reach
 // OPEN state before ctx is cancelled, the connection is aborted.
 func DialWebSocket(ctx context.Context, url string) (net.Conn, error) {
+	return DialWebSocketWithOptions(ctx, url, WSOptions{})
+}
+
+// DialWebSocketWithOptions is DialWebSocket with tuning options.
+func DialWebSocketWithOptions(ctx context.Context, url string, opts WSOptions) (net.Conn, error) {
 	// Use background context for connection lifetime — dial ctx is only for open timeout.
 	// If we derived from ctx, the deferred cancel in sshConnect would kill the WebSocket
 	// as soon as connect() resolves.
 	connCtx, cancel := context.WithCancel(context.Background())
 
 	c := &wsConn{
-		ctx:    connCtx,
-		cancel: cancel,
-		readCh: make(chan []byte, wsReadChanSize),
+		ctx:        connCtx,
+		cancel:     cancel,
+		readCh:     make(chan []byte, orDefault(opts.ReadBufferFrames, wsReadChanSize)),
+		noCoalesce: opts.NoReadCoalescing,
+		writeChunk: orDefault(opts.WriteChunkBytes, wsWriteChunkSize),
+		maxMessage: orDefault(opts.MaxMessageBytes, wsMaxMessageSize),
 	}
+	c.overflowCap = orDefault(opts.OverflowBytes, wsOverflowSize)
 
 	// Create the browser WebSocket via syscall/js.
-	ws := js.Global().Get("WebSocket").New(url)
+	var ws js.Value
+	if len(opts.Subprotocols) > 0 {
+		protocols := make([]any, len(opts.Subprotocols))
+		for i, p := range opts.Subprotocols {
+			protocols[i] = p
+		}
+		ws = js.Global().Get("WebSocket").New(url, protocols)
+	} else {
+		ws = js.Global().Get("WebSocket").New(url)
+	}
 	ws.Set("binaryType", "arraybuffer")
 	c.ws = ws
 
@@ -92,6 +250,9 @@ func DialWebSocket(ctx context.Context, url string) (net.Conn, error) {
 	openCh := make(chan error, 1)
 
 	c.onOpen = js.FuncOf(func(this js.Value, args []js.Value) any {
+		c.mu.Lock()
+		c.opened = true
+		c.mu.Unlock()
 		select {
 		case openCh <- nil:
 		default:
@@ -113,13 +274,23 @@ func DialWebSocket(ctx context.Context, url string) (net.Conn, error) {
 	})
 
 	c.onClose = js.FuncOf(func(this js.Value, args []js.Value) any {
+		event := args[0]
 		c.mu.Lock()
+		c.closeEvent = &wsCloseError{
+			code:    jsInt(event.Get("code"), 1006),
+			reason:  maskControl(jsString(event.Get("reason"))),
+			dialing: !c.opened,
+		}
 		if c.err == nil {
 			c.err = errWSClosed
 		}
 		c.closed = true
 		c.mu.Unlock()
 		c.cancel()
+		select {
+		case openCh <- errDialFailed:
+		default:
+		}
 		return nil
 	})
 
@@ -129,7 +300,7 @@ func DialWebSocket(ctx context.Context, url string) (net.Conn, error) {
 
 		uint8Array := js.Global().Get("Uint8Array").New(arrayBuf)
 		size := uint8Array.Get("byteLength").Int()
-		if size > wsMaxMessageSize {
+		if size > c.maxMessage {
 			c.mu.Lock()
 			if c.err == nil {
 				c.err = errWSFrameLarge
@@ -147,13 +318,10 @@ func DialWebSocket(ctx context.Context, url string) (net.Conn, error) {
 		data := make([]byte, size)
 		js.CopyBytesToGo(data, uint8Array)
 
-		select {
-		case c.readCh <- data:
-		case <-c.ctx.Done():
-		default:
+		if err := c.enqueue(data); err != nil {
 			c.mu.Lock()
 			if c.err == nil {
-				c.err = errWSBackpress
+				c.err = err
 			}
 			c.mu.Unlock()
 			c.cancel()
@@ -174,6 +342,15 @@ func DialWebSocket(ctx context.Context, url string) (net.Conn, error) {
 	select {
 	case err := <-openCh:
 		if err != nil {
+			// Report the close event's code, which follows the error.
+			select {
+			case <-c.ctx.Done():
+			case <-ctx.Done():
+			case <-time.After(wsCloseGrace):
+			}
+			if ce := c.closeError(); ce != nil {
+				err = ce
+			}
 			c.cleanup()
 			return nil, err
 		}
@@ -185,9 +362,74 @@ func DialWebSocket(ctx context.Context, url string) (net.Conn, error) {
 	return c, nil
 }
 
+// closeError returns the close event, or nil if the WebSocket hasn't
+// closed.
+func (c *wsConn) closeError() *wsCloseError {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeEvent
+}
+
+// Protocol returns the subprotocol the server selected, or "" if none.
+func (c *wsConn) Protocol() string {
+	return c.ws.Get("protocol").String()
+}
+
+// enqueue queues an incoming message for Read. The message handler can't
+// block (it runs on the JS event loop, which also drives Go's timers), so
+// when readCh is full the message goes to the overflow queue instead, and
+// so does everything after it until Read has emptied the queue: every
+// message in readCh is then older than every message in overflow. Only
+// when the overflow would pass overflowCap does it fail, with
+// errWSBackpress. Memory held is thus at most readCh's capacity in
+// messages plus overflowCap bytes.
+func (c *wsConn) enqueue(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.overflow) == 0 {
+		select {
+		case c.readCh <- data:
+			return nil
+		case <-c.ctx.Done():
+			return nil
+		default:
+		}
+	}
+	if c.overflowBytes+len(data) > c.overflowCap {
+		return errWSBackpress
+	}
+	c.overflow = append(c.overflow, data)
+	c.overflowBytes += len(data)
+	return nil
+}
+
+// dequeue returns the oldest queued message without blocking, reporting
+// false if there is none.
+func (c *wsConn) dequeue() ([]byte, bool) {
+	select {
+	case data := <-c.readCh:
+		return data, true
+	default:
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.overflow) == 0 {
+		return nil, false
+	}
+	data := c.overflow[0]
+	c.overflow[0] = nil
+	c.overflow = c.overflow[1:]
+	c.overflowBytes -= len(data)
+	if len(c.overflow) == 0 {
+		c.overflow = nil // let the backing array go
+	}
+	return data, true
+}
+
 // Read implements net.Conn.Read with greedy read optimization.
 // If the internal buffer is empty but the channel has more queued messages,
 // it reads all available data before returning — reducing syscall overhead.
+// With noCoalesce, it returns after the first message.
 func (c *wsConn) Read(p []byte) (int, error) {
 	if err := c.getErr(); err != nil {
 		// Drain any remaining buffered data before reporting error.
@@ -206,45 +448,45 @@ func (c *wsConn) Read(p []byte) (int, error) {
 		return n, nil
 	}
 
-	// Block until we get data, an error, or context cancellation.
-	select {
-	case data, ok := <-c.readCh:
-		if !ok {
-			return 0, io.EOF
-		}
-		n := copy(p, data)
-		if n < len(data) {
-			c.buf = data[n:]
-		}
-
-		// Greedy read: if the channel has more messages queued and we have
-		// room in p, keep reading without blocking. This is critical for
-		// SSH throughput — avoids returning partial data when more is ready.
-		for n < len(p) {
-			select {
-			case extra, ok := <-c.readCh:
-				if !ok {
-					return n, nil
-				}
-				copied := copy(p[n:], extra)
-				n += copied
-				if copied < len(extra) {
-					c.buf = extra[copied:]
-					return n, nil
-				}
-			default:
-				// No more queued messages — return what we have.
-				return n, nil
-			}
+	// Block until we get data, an error, or context cancellation. When
+	// dequeue finds nothing, both queues are empty, so the next message
+	// arrives on readCh.
+	data, ok := c.dequeue()
+	if !ok {
+		select {
+		case data = <-c.readCh:
+		case <-c.ctx.Done():
+			return 0, c.ctxErr()
 		}
+	}
+	n := copy(p, data)
+	if n < len(data) {
+		c.buf = data[n:]
+	}
+	if c.noCoalesce {
 		return n, nil
+	}
 
-	case <-c.ctx.Done():
-		return 0, c.ctxErr()
+	// Greedy read: if more messages are queued and we have room in p,
+	// keep reading without blocking. This is critical for SSH
+	// throughput — avoids returning partial data when more is ready.
+	for n < len(p) {
+		extra, ok := c.dequeue()
+		if !ok {
+			// No more queued messages — return what we have.
+			return n, nil
+		}
+		copied := copy(p[n:], extra)
+		n += copied
+		if copied < len(extra) {
+			c.buf = extra[copied:]
+			return n, nil
+		}
 	}
+	return n, nil
 }
 
-// Write implements net.Conn.Write, chunking data into wsWriteChunkSize segments.
+// Write implements net.Conn.Write, chunking data into writeChunk segments.
 // Each chunk becomes one WebSocket binary message.
 func (c *wsConn) Write(p []byte) (int, error) {
 	if err := c.getErr(); err != nil {
@@ -258,8 +500,8 @@ func (c *wsConn) Write(p []byte) (int, error) {
 	total := 0
 	for len(p) > 0 {
 		chunk := p
-		if len(chunk) > wsWriteChunkSize {
-			chunk = p[:wsWriteChunkSize]
+		if len(chunk) > c.writeChunk {
+			chunk = p[:c.writeChunk]
 		}
 		p = p[len(chunk):]
 
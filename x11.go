@@ -0,0 +1,234 @@
+// x11.go implements X11 forwarding (ssh -X). With the x11Forward connect
+// option, the shell requests forwarding and each x11 channel the server
+// opens is bridged to a WebSocket endpoint the app provides, such as a
+// websockify in front of an X server.
+//
+// As OpenSSH does, the server is given a random fake cookie, and the real
+// one is substituted in each X11 connection's setup message, so the remote
+// host never learns the display's credentials. Connections presenting any
+// other cookie are refused.
+//
+// Without x11Forward, x11 channels are reported through onX11Request and
+// rejected, rather than failing with no trace on the client.
+
+//go:build js && wasm
+
+package gossh
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall/js"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// x11ChannelType is the channel type the server opens for an X11
+	// connection (RFC 4254 §6.3.2).
+	x11ChannelType = "x11"
+	// x11AuthProtocol is the only X authorization protocol forwarded.
+	x11AuthProtocol = "MIT-MAGIC-COOKIE-1"
+	// x11CookieLen is the length of an MIT-MAGIC-COOKIE-1 cookie.
+	x11CookieLen = 16
+)
+
+// x11ChannelData is the x11 channel-open payload.
+type x11ChannelData struct {
+	OriginatorAddress string
+	OriginatorPort    uint32
+}
+
+// x11Request is the x11-req channel request payload (RFC 4254 §6.3.1).
+type x11Request struct {
+	SingleConnection bool
+	AuthProtocol     string
+	AuthCookie       string
+	ScreenNumber     uint32
+}
+
+// x11Forward is the X11 forwarding configured for a connection.
+type x11Forward struct {
+	endpoint   string // WebSocket URL of the X server
+	screen     uint32
+	fakeCookie []byte // given to the server
+	realCookie []byte // sent to the X server; nil for no authorization
+}
+
+// parseX11Forward reads config.x11Forward: {endpoint, cookie?, screen?}.
+// It returns nil when the option is absent.
+func parseX11Forward(config js.Value, allowInsecureWS bool) (*x11Forward, error) {
+	v := config.Get("x11Forward")
+	if v.Type() != js.TypeObject {
+		return nil, nil
+	}
+	u, err := parseWebSocketURL(jsString(v.Get("endpoint")), allowInsecureWS)
+	if err != nil {
+		return nil, fmt.Errorf("x11Forward.endpoint: %w", err)
+	}
+	fwd := &x11Forward{endpoint: u.String(), fakeCookie: make([]byte, x11CookieLen)}
+	if s := jsString(v.Get("cookie")); s != "" {
+		fwd.realCookie, err = hex.DecodeString(s)
+		if err != nil || len(fwd.realCookie) != x11CookieLen {
+			return nil, fmt.Errorf("x11Forward.cookie: expected %d hex-encoded bytes", x11CookieLen)
+		}
+	}
+	screen := jsInt(v.Get("screen"), 0)
+	if screen < 0 || screen > 0xffff {
+		return nil, fmt.Errorf("x11Forward.screen: out of range")
+	}
+	fwd.screen = uint32(screen)
+	if _, err := rand.Read(fwd.fakeCookie); err != nil {
+		return nil, fmt.Errorf("x11Forward: %w", err)
+	}
+	return fwd, nil
+}
+
+// request asks the server to forward X11 for the shell. A refusal isn't
+// fatal, as with ssh -X; it is logged.
+func (f *x11Forward) request(sess *ssh.Session) {
+	ok, err := sess.SendRequest("x11-req", true, ssh.Marshal(x11Request{
+		AuthProtocol: x11AuthProtocol,
+		AuthCookie:   hex.EncodeToString(f.fakeCookie),
+		ScreenNumber: f.screen,
+	}))
+	if err != nil || !ok {
+		logWarnf("X11 forwarding refused by server")
+	}
+}
+
+// handleX11Channels serves x11 channels on client, reporting each to
+// onRequest (if a function) as {originatorAddress, originatorPort}. With
+// fwd nil they are rejected; otherwise each is bridged to fwd.endpoint.
+func handleX11Channels(client *ssh.Client, onRequest js.Value, fwd *x11Forward) {
+	channels := client.HandleChannelOpen(x11ChannelType)
+	if channels == nil {
+		return
+	}
+	hasCallback := onRequest.Type() == js.TypeFunction
+	spawn("x11.accept", func() {
+		for ch := range channels {
+			var data x11ChannelData
+			if err := ssh.Unmarshal(ch.ExtraData(), &data); err != nil {
+				_ = ch.Reject(ssh.ConnectionFailed, "malformed x11 channel request")
+				continue
+			}
+			if hasCallback {
+				onRequest.Invoke(js.ValueOf(map[string]any{
+					"originatorAddress": data.OriginatorAddress,
+					"originatorPort":    int(data.OriginatorPort),
+				}))
+			}
+			if fwd == nil {
+				logWarnf("rejected X11 channel from the server (x11Forward not configured):",
+					fmt.Sprintf("%s:%d", data.OriginatorAddress, data.OriginatorPort))
+				_ = ch.Reject(ssh.Prohibited, "X11 forwarding is not enabled")
+				continue
+			}
+			spawn("x11.bridge", func() { fwd.serve(ch) })
+		}
+	})
+}
+
+// serve connects one x11 channel to the endpoint. The channel is rejected
+// if the endpoint can't be reached.
+func (f *x11Forward) serve(newCh ssh.NewChannel) {
+	dialCtx, dialCancel := context.WithTimeout(context.Background(), dialTimeout)
+	conn, err := DialWebSocketWithOptions(dialCtx, f.endpoint, WSOptions{})
+	dialCancel()
+	if err != nil {
+		logWarnf("X11 endpoint unreachable:", err.Error())
+		_ = newCh.Reject(ssh.ConnectionFailed, "X11 display unreachable")
+		return
+	}
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		closeQuietly(conn)
+		return
+	}
+	spawn("x11.requests", func() { ssh.DiscardRequests(reqs) })
+	f.bridge(ch, conn)
+}
+
+// bridge rewrites the X11 connection setup from ch and then copies both
+// ways until either side closes.
+func (f *x11Forward) bridge(ch io.ReadWriteCloser, conn net.Conn) {
+	defer closeQuietly(ch)
+	defer closeQuietly(conn)
+	setup, err := f.rewriteSetup(ch)
+	if err != nil {
+		logWarnf("X11 connection refused:", err.Error())
+		return
+	}
+	if _, err := conn.Write(setup); err != nil {
+		return
+	}
+	done := make(chan struct{}, 2)
+	spawn("x11.copy", func() {
+		_, _ = io.Copy(conn, ch)
+		done <- struct{}{}
+	})
+	spawn("x11.copy", func() {
+		_, _ = io.Copy(ch, conn)
+		done <- struct{}{}
+	})
+	<-done
+}
+
+// errX11Auth is returned for a setup message without the fake cookie.
+var errX11Auth = errors.New("X11 connection presented the wrong authorization")
+
+// rewriteSetup reads the client's connection setup message (X protocol,
+// "Connection Setup") and returns it with the fake cookie replaced by the
+// real one, or with the authorization removed if there is none.
+func (f *x11Forward) rewriteSetup(r io.Reader) ([]byte, error) {
+	var hdr [12]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder
+	switch hdr[0] {
+	case 'B':
+		order = binary.BigEndian
+	case 'l':
+		order = binary.LittleEndian
+	default:
+		return nil, fmt.Errorf("bad byte order %#x in X11 setup", hdr[0])
+	}
+	nameLen, dataLen := int(order.Uint16(hdr[6:])), int(order.Uint16(hdr[8:]))
+	auth := make([]byte, pad4(nameLen)+pad4(dataLen))
+	if _, err := io.ReadFull(r, auth); err != nil {
+		return nil, err
+	}
+	name, data := auth[:nameLen], auth[pad4(nameLen):pad4(nameLen)+dataLen]
+	if string(name) != x11AuthProtocol || subtle.ConstantTimeCompare(data, f.fakeCookie) != 1 {
+		return nil, errX11Auth
+	}
+
+	var out bytes.Buffer
+	if f.realCookie == nil {
+		order.PutUint16(hdr[6:], 0)
+		order.PutUint16(hdr[8:], 0)
+		out.Write(hdr[:])
+		return out.Bytes(), nil
+	}
+	order.PutUint16(hdr[8:], uint16(len(f.realCookie)))
+	out.Write(hdr[:])
+	out.Write(auth[:pad4(nameLen)])
+	out.Write(f.realCookie)
+	out.Write(make([]byte, pad4(len(f.realCookie))-len(f.realCookie)))
+	return out.Bytes(), nil
+}
+
+// pad4 rounds n up to a multiple of 4, the X protocol's alignment.
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}